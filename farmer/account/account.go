@@ -2,15 +2,20 @@ package account
 
 import (
 	"crypto/x509"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/conseweb/common/hdwallet"
+	"github.com/conseweb/common/passphrase"
 	pb "github.com/conseweb/common/protos"
 	"github.com/hyperledger/fabric/core/crypto/primitives"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	"github.com/hyperledger/fabric/farmer/wallet"
 	"github.com/op/go-logging"
 	"github.com/spf13/viper"
 	"golang.org/x/net/context"
@@ -22,6 +27,8 @@ const (
 
 var (
 	logger = logging.MustGetLogger("farmer")
+
+	ErrNoWallet = errors.New("the wallet is not on this device, recover the account from the passphrase")
 )
 
 var LanguageSupport = map[string]pb.PassphraseLanguage{
@@ -47,6 +54,11 @@ type Account struct {
 
 	Devices []Device `json:"devices"`
 
+	Settings Settings `json:"settings"`
+
+	// saved in the role column, see SetRole.
+	Role string `json:"role"`
+
 	logger *logging.Logger
 }
 
@@ -70,10 +82,33 @@ func NewAccount(nickname, phone, email, pass, lang string) *Account {
 	}
 }
 
-func LoadFromFile() (*Account, error) {
-	fpath := filepath.Join(viper.GetString("peer.fileSystemPath"), "farmerAccount.json")
+// AccountsSchema is the migrations of the accounts logged in this farmer.
+var AccountsSchema = &migrate.Schema{
+	Name: "accounts",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create accounts", Up: createAccounts},
+		{Version: 2, Name: "add roles of accounts", Up: addAccountRoles},
+		{Version: 3, Name: "create device_revocations", Up: createDeviceRevocations},
+	},
+}
 
-	f, err := os.Open(fpath)
+func createAccounts(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS 'accounts' (
+		'id' VARCHAR(64) PRIMARY KEY,
+		'data' TEXT NOT NULL,
+		'updated' INTEGER NOT NULL
+	)`)
+	return err
+}
+
+func accountFilePath() string {
+	return filepath.Join(viper.GetString("peer.fileSystemPath"), "farmerAccount.json")
+}
+
+// LoadFromFile loads the account of the single user farmer, which is imported to farmer.db by ImportFile.
+func LoadFromFile() (*Account, error) {
+	f, err := os.Open(accountFilePath())
 	if err != nil {
 		return nil, err
 	}
@@ -88,25 +123,106 @@ func LoadFromFile() (*Account, error) {
 	return a, nil
 }
 
-func (a *Account) Save() error {
-	fpath := filepath.Join(viper.GetString("peer.fileSystemPath"), "farmerAccount.json")
-	f, err := os.OpenFile(fpath, os.O_CREATE|os.O_WRONLY, 0600)
+// ImportFile saves the account of the single user farmer to db and gives it the contacts without owner,
+// the file is renamed to farmerAccount.json.imported. nil if there is no such file.
+func ImportFile(db *sql.DB) (*Account, error) {
+	a, err := LoadFromFile()
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if a.ID != "" {
+		if err := a.Save(db); err != nil {
+			return nil, err
+		}
+		if err := a.SaveWallet(db, ""); err != nil {
+			return nil, err
+		}
+		if n, err := ClaimContacts(db, a.ID); err != nil {
+			return nil, err
+		} else if n > 0 {
+			logger.Infof("%d contacts are given to account %s", n, a.ID)
+		}
+	} else {
+		a = nil
+	}
+	return a, os.Rename(accountFilePath(), accountFilePath()+".imported")
+}
+
+// SaveWallet keeps the master key of a for the wallet api, which derives the addresses from it.
+// the key is not kept in the json of a saved account, it is regenerated from the passphrase and the
+// password of the signup then, unless the wallet api has one. nothing to do without the passphrase.
+func (a *Account) SaveWallet(db *sql.DB, password string) error {
+	if a.Wallet != nil {
+		if _, err := hdwallet.ParseStringWallet(a.Wallet.String()); err == nil {
+			return wallet.SaveMaster(db, a.ID, a.Wallet)
+		}
+	}
+	if a.Passphrase == "" {
+		return nil
+	}
+	if ok, err := wallet.HasMaster(db, a.ID); err != nil || ok {
+		return err
+	}
+
+	if password == "" {
+		password = a.Password
+	}
+	a.Wallet = hdwallet.MasterKey(passphrase.NewSeed(a.Passphrase, password), viper.GetBool("daemon.dev"))
+	return wallet.SaveMaster(db, a.ID, a.Wallet)
+}
+
+// Save saves the account in db, the role of a saved account is kept. the first account is the owner,
+// the others are viewers.
+func (a *Account) Save(db *sql.DB) error {
+	if a.ID == "" {
+		return fmt.Errorf("account id required")
+	}
+	bs, err := json.Marshal(a)
 	if err != nil {
-		logger.Error(err)
 		return err
 	}
-	defer f.Close()
 
-	encoder := json.NewEncoder(f)
-	encoder.SetIndent("  ", "  ")
-	err = encoder.Encode(a)
+	now := time.Now().Unix()
+	res, err := db.Exec(`UPDATE accounts SET data = ?, updated = ? WHERE id = ?`, string(bs), now, a.ID)
 	if err != nil {
+		logger.Errorf("save account %s failed, %s", a.ID, err)
 		return err
 	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return db.QueryRow(`SELECT role FROM accounts WHERE id = ?`, a.ID).Scan(&a.Role)
+	}
 
+	a.Role = RoleViewer
+	if n, err := CountRole(db, RoleOwner); err != nil {
+		return err
+	} else if n == 0 {
+		a.Role = RoleOwner
+	}
+	if _, err := db.Exec(`INSERT INTO accounts (id, data, updated, role) VALUES (?, ?, ?, ?)`, a.ID, string(bs), now, a.Role); err != nil {
+		logger.Errorf("save account %s failed, %s", a.ID, err)
+		return err
+	}
 	return nil
 }
 
+// Load returns the account id saved in db, sql.ErrNoRows if there is none.
+func Load(db *sql.DB, id string) (*Account, error) {
+	var data, role string
+	if err := db.QueryRow(`SELECT data, role FROM accounts WHERE id = ?`, id).Scan(&data, &role); err != nil {
+		return nil, err
+	}
+	a := new(Account)
+	if err := json.Unmarshal([]byte(data), a); err != nil {
+		return nil, err
+	}
+	a.Role = role
+	return a, nil
+}
+
 func (a *Account) Registry(idpCli pb.IDPPClient) error {
 	priv, err := primitives.NewECDSAKey()
 	if err != nil {
@@ -159,17 +275,28 @@ func (a *Account) Registry(idpCli pb.IDPPClient) error {
 		return err
 	}
 	logger.Debugf("account %+v", a)
+	return nil
+}
 
-	err = a.Save()
+func Login(idpCli pb.IDPPClient, typ pb.SignInType, signup, password string) (a *Account, err error) {
+	ru, err := loginUser(idpCli, typ, signup, password)
 	if err != nil {
-		logger.Errorf("account save local file failed, %v", err.Error())
-		return err
+		return nil, err
+	}
+	a = accountOf(ru)
+	if !a.hasLocalDevice() {
+		// try to bind device.
+		if err := a.BindLocalDevice(idpCli); err != nil {
+			logger.Errorf("bind failed, %v", err.Error())
+			return a, err
+		}
 	}
 
-	return nil
+	return a, nil
 }
 
-func Login(idpCli pb.IDPPClient, typ pb.SignInType, signup, password string) (a *Account, err error) {
+// loginUser returns the user of the idprovider which signup and password sign in.
+func loginUser(idpCli pb.IDPPClient, typ pb.SignInType, signup, password string) (*pb.User, error) {
 	req := &pb.LoginUserReq{
 		SignInType: typ,
 		SignIn:     signup,
@@ -191,14 +318,18 @@ func Login(idpCli pb.IDPPClient, typ pb.SignInType, signup, password string) (a
 	if ru == nil {
 		return nil, fmt.Errorf("got nil user.")
 	}
-	a = &Account{
+	return ru, nil
+}
+
+// accountOf returns the account of the idprovider user, the device with the MAC of this host is local.
+func accountOf(ru *pb.User) *Account {
+	a := &Account{
 		ID:       ru.UserID,
 		Phone:    ru.Mobile,
 		Email:    ru.Email,
 		NickName: ru.Nick,
 		Devices:  []Device{},
 	}
-	exiLocal := false
 	for _, device := range ru.Devices {
 		dwlt, err := hdwallet.ParseStringWallet(string(device.Wpub))
 		if err != nil {
@@ -210,32 +341,25 @@ func Login(idpCli pb.IDPPClient, typ pb.SignInType, signup, password string) (a
 			addr = dwlt.Address()
 		}
 
-		if getLocalMAC() == device.Mac {
-			a.Devices = append(a.Devices, Device{Device: device, IsLocal: true, Address: addr})
-			exiLocal = true
-		} else {
-			a.Devices = append(a.Devices, Device{Device: device, Address: addr})
-		}
+		a.Devices = append(a.Devices, Device{Device: device, IsLocal: getLocalMAC() == device.Mac, Address: addr})
 		logger.Debugf("devices... %#v", a.Devices)
 	}
-	if !exiLocal {
-		// try to bind device.
-		if err := a.BindLocalDevice(idpCli); err != nil {
-			logger.Errorf("bind failed, %v", err.Error())
-			return a, err
-		}
-	}
+	return a
+}
 
-	err = a.Save()
-	if err != nil {
-		logger.Errorf("account save local file failed, %v", err.Error())
-		return a, err
+func (a *Account) hasLocalDevice() bool {
+	for _, d := range a.Devices {
+		if d.IsLocal {
+			return true
+		}
 	}
-
-	return a, nil
+	return false
 }
 
 func (a *Account) BindLocalDevice(idpCli pb.IDPPClient) error {
+	if a.Wallet == nil {
+		return ErrNoWallet
+	}
 	priv, err := primitives.NewECDSAKey()
 	if err != nil {
 		return err
@@ -271,11 +395,6 @@ func (a *Account) BindLocalDevice(idpCli pb.IDPPClient) error {
 	return nil
 }
 
-func (a *Account) Logout() error {
-	a = &Account{}
-	return a.Save()
-}
-
 func (a *Account) Online(client pb.FarmerPublicClient) error {
 	if a.ID == "" {
 		return fmt.Errorf("account id required")
@@ -2,20 +2,103 @@ package account
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/farmer/migrate"
+)
+
+const contactColumns = `
+id,
+name,
+email,
+phone,
+addr,
+description,
+ns_name,
+prev_addr,
+addr_changed,
+verified_at,
+owner`
+
+// import modes, decide what to do with a contact having the same email or phone as a saved one.
+const (
+	ImportMerge   = "merge"
+	ImportSkip    = "skip"
+	ImportReplace = "replace"
 )
 
 type Contact struct {
-	Id          int    `json:"id" sql:"id"`
-	Name        string `json:"name" sql:"name"`
-	Email       string `json:"email" sql:"email"`
-	Phone       string `json:"phone" sql:"phone"`
-	Addr        string `json:"addr" sql:"addr"`
-	Tag         string `json:"tag" sql:"tag"`
-	Description string `json:"description" sql:"description"`
+	Id          int      `json:"id" sql:"id"`
+	Name        string   `json:"name" sql:"name"`
+	Email       string   `json:"email" sql:"email"`
+	Phone       string   `json:"phone" sql:"phone"`
+	Addr        string   `json:"addr" sql:"addr"`
+	Tags        []string `json:"tags" sql:"-"`
+	Description string   `json:"description" sql:"description"`
+
+	// linked nameservice name, the addr is resolved from it. the contacts are not linked to the
+	// idprovider users, it can not look up the address of an user.
+	NsName string `json:"ns_name" sql:"ns_name"`
+
+	// set when a re-verification found a new address, cleared by Update.
+	PrevAddr    string `json:"prev_addr" sql:"prev_addr"`
+	AddrChanged bool   `json:"addr_changed" sql:"addr_changed"`
+	VerifiedAt  int64  `json:"verified_at" sql:"verified_at"`
+
+	// the user whose address book has the contact.
+	Owner string `json:"-" sql:"owner"`
 }
 
+// ContactFilter used by (*Contact).Find, zero value matches all contacts.
+type ContactFilter struct {
+	// the contacts of the user, empty matches every owner.
+	Owner string
+	// matches name, email, phone, addr, ns_name and description.
+	Query   string
+	Tag     string
+	Linked  bool
+	Changed bool
+
+	Limit  int
+	Offset int
+}
+
+// ImportResult counts what ImportContacts did with every contact.
+type ImportResult struct {
+	Inserted int      `json:"inserted"`
+	Merged   int      `json:"merged"`
+	Skipped  int      `json:"skipped"`
+	Errors   []string `json:"errors"`
+}
+
+// ErrContactConflict is returned by FindDuplicate if the email and the phone are of two saved contacts.
+var ErrContactConflict = errors.New("the email and the phone are of different contacts")
+
+// AddrResolver resolves the current lepuscoin address of a linked contact.
+type AddrResolver interface {
+	ResolveName(name string) (string, error)
+}
+
+// ContactsSchema is the migrations of the contacts tables in farmer.db.
+var ContactsSchema = &migrate.Schema{
+	Name: "contacts",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create contacts", Up: createContacts},
+		{Version: 2, Name: "link contacts to names", Up: linkContacts},
+		{Version: 3, Name: "move contact tag to tags table", Up: createContactTags},
+		{Version: 4, Name: "scope contacts by owner", Up: scopeContacts},
+	},
+}
+
+// InitDB migrates the contacts tables of db to the latest version.
 func (c *Contact) InitDB(db *sql.DB) error {
+	return (&migrate.Runner{}).Run(db, ContactsSchema)
+}
+
+func createContacts(tx *sql.Tx) error {
 	sqlstr := `
 	CREATE TABLE IF NOT EXISTS 'contacts' (
 		'id' INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -26,78 +109,193 @@ func (c *Contact) InitDB(db *sql.DB) error {
 		'tag' VARCHAR(16),
 		'description' VARCHAR(255)
 	)`
-	if _, err := db.Exec(sqlstr); err != nil {
+	if _, err := tx.Exec(sqlstr); err != nil {
 		logger.Errorf("create table contacts failed, %s", err)
 		return err
 	}
+	return nil
+}
+
+func linkContacts(tx *sql.Tx) error {
+	return addColumns(tx, "contacts", map[string]string{
+		"ns_name":      "VARCHAR(64) NOT NULL DEFAULT ''",
+		"prev_addr":    "VARCHAR(64) NOT NULL DEFAULT ''",
+		"addr_changed": "INTEGER NOT NULL DEFAULT 0",
+		"verified_at":  "INTEGER NOT NULL DEFAULT 0",
+	})
+}
+
+func createContactTags(tx *sql.Tx) error {
+	// empty email and phone are saved as NULL, so they don't conflict with each other.
+	for _, col := range []string{"email", "phone"} {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE contacts SET %s = NULL WHERE %s = ''", col, col)); err != nil {
+			logger.Errorf("clean empty %s of contacts failed, %s", col, err)
+			return err
+		}
+	}
+
+	if err := initTagsDB(tx); err != nil {
+		return err
+	}
+	return migrateTagColumn(tx)
+}
 
+// scopeContacts rebuilds contacts with the owner, email and phone are unique in the address book
+// of an user. the contacts of the single user farmer are claimed by ClaimContacts.
+func scopeContacts(tx *sql.Tx) error {
+	for _, sqlstr := range []string{`
+	CREATE TABLE 'contacts_owned' (
+		'id' INTEGER PRIMARY KEY AUTOINCREMENT,
+		'owner' VARCHAR(64) NOT NULL DEFAULT '',
+		'name' VARCHAR(32) NOT NULL,
+		'email' VARCHAR(32),
+		'phone' VARCHAR(16),
+		'addr' VARCHAR(64) NOT NULL,
+		'description' VARCHAR(255),
+		'ns_name' VARCHAR(64) NOT NULL DEFAULT '',
+		'prev_addr' VARCHAR(64) NOT NULL DEFAULT '',
+		'addr_changed' INTEGER NOT NULL DEFAULT 0,
+		'verified_at' INTEGER NOT NULL DEFAULT 0,
+		UNIQUE ('owner', 'email'),
+		UNIQUE ('owner', 'phone')
+	)`, `
+	INSERT INTO contacts_owned (` + contactColumns + `)
+	SELECT ` + strings.Replace(contactColumns, "owner", "''", 1) + ` FROM contacts`,
+		`DROP TABLE contacts`,
+		`ALTER TABLE contacts_owned RENAME TO contacts`,
+		`CREATE INDEX IF NOT EXISTS 'idx_contacts_owner' ON 'contacts' ('owner')`,
+	} {
+		if _, err := tx.Exec(sqlstr); err != nil {
+			logger.Errorf("scope contacts by owner failed, %s", err)
+			return err
+		}
+	}
 	return nil
 }
 
+// ClaimContacts gives the contacts without owner, saved by the single user farmer, to owner.
+func ClaimContacts(db *sql.DB, owner string) (int64, error) {
+	res, err := db.Exec(`UPDATE contacts SET owner = ? WHERE owner = ''`, owner)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 // used by (*Contact).List
 func (c *Contact) List(db *sql.DB) ([]*Contact, error) {
-	query := `SELECT 
-id,
-name,
-email,
-phone,
-addr,
-tag,
-description FROM contacts`
-	rows, err := db.Query(query)
-	if err != nil {
-		logger.Errorf("query contact failed, %s", err)
-		return nil, err
+	cs, _, err := c.Find(db, nil)
+	return cs, err
+}
+
+// Find returns the contacts matching f, and the count of them without limit and offset.
+func (c *Contact) Find(db *sql.DB, f *ContactFilter) ([]*Contact, int, error) {
+	if f == nil {
+		f = &ContactFilter{}
 	}
 
-	cs := []*Contact{}
+	where := []string{}
+	args := []interface{}{}
+	if f.Owner != "" {
+		where = append(where, `owner = ?`)
+		args = append(args, f.Owner)
+	}
+	if f.Query != "" {
+		like := "%" + f.Query + "%"
+		where = append(where, `(name LIKE ? OR email LIKE ? OR phone LIKE ? OR addr LIKE ? OR ns_name LIKE ? OR description LIKE ?)`)
+		args = append(args, like, like, like, like, like, like)
+	}
+	if f.Tag != "" {
+		where = append(where, `id IN (SELECT ct.contact_id FROM contact_tags ct JOIN tags t ON t.id = ct.tag_id WHERE t.name = ?)`)
+		args = append(args, f.Tag)
+	}
+	if f.Linked {
+		where = append(where, `ns_name != ''`)
+	}
+	if f.Changed {
+		where = append(where, `addr_changed = 1`)
+	}
 
-	for rows.Next() {
-		ret := &Contact{}
-		if err = rows.Scan(&ret.Id, &ret.Name, &ret.Email, &ret.Phone, &ret.Addr, &ret.Tag, &ret.Description); err != nil {
-			return nil, err
-		}
-		cs = append(cs, ret)
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
 	}
 
-	return cs, nil
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM contacts`+cond, args...).Scan(&count); err != nil {
+		logger.Errorf("count contacts failed, %s", err)
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + contactColumns + ` FROM contacts` + cond + ` ORDER BY id`
+	if f.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", f.Limit, f.Offset)
+	}
+
+	cs, err := queryContacts(db, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return cs, count, nil
+}
+
+// ListLinked returns contacts which reference a nameservice name.
+func (c *Contact) ListLinked(db *sql.DB) ([]*Contact, error) {
+	cs, _, err := c.Find(db, &ContactFilter{Linked: true})
+	return cs, err
 }
 
-// used by (*Contact).Get
-func (c *Contact) Get(db *sql.DB, id int) (*Contact, error) {
-	ret := &Contact{}
-	query := `SELECT * FROM contacts WHERE id = ?`
-	err := db.QueryRow(query, id).Scan(&ret.Id, &ret.Name, &ret.Email, &ret.Phone, &ret.Addr, &ret.Tag, &ret.Description)
+// Get returns the contact id of owner.
+func (c *Contact) Get(db *sql.DB, owner string, id int) (*Contact, error) {
+	query := `SELECT ` + contactColumns + ` FROM contacts WHERE id = ? AND owner = ?`
+	ret, err := scanContact(db.QueryRow(query, id, owner))
 	if err != nil {
 		logger.Errorf("query contact<%v> failed, %s", id, err)
 		return nil, err
 	}
 
+	if ret.Tags, err = getTags(db, ret.Id); err != nil {
+		return nil, err
+	}
 	return ret, nil
 }
 
+// Update replaces c of c.Owner with n, and confirms a changed address.
+// sql.ErrNoRows if the owner has no contact c.Id.
 func (c *Contact) Update(db *sql.DB, n *Contact) error {
 	sqlstr := `
-UPDATE contacts SET 
+UPDATE contacts SET
 name = ?,
 email = ?,
 phone = ?,
 addr = ?,
-tag = ?,
-description = ?
-WHERE id = ?
+description = ?,
+ns_name = ?,
+prev_addr = '',
+addr_changed = 0
+WHERE id = ? AND owner = ?
 `
 
-	if _, err := db.Exec(sqlstr, n.Name, n.Email, n.Phone, n.Addr, n.Tag, n.Description, c.Id); err != nil {
+	res, err := db.Exec(sqlstr, n.Name, nullString(n.Email), nullString(n.Phone), n.Addr, n.Description, n.NsName, c.Id, c.Owner)
+	if err != nil {
 		logger.Errorf("update<%+v> to <%+v> failed, %s", c, n, err)
 		return err
 	}
+	if cnt, _ := res.RowsAffected(); cnt == 0 {
+		return sql.ErrNoRows
+	}
+	if err := setTags(db, c.Id, n.Tags); err != nil {
+		return err
+	}
 	c.Name = n.Name
 	c.Email = n.Email
 	c.Phone = n.Phone
 	c.Addr = n.Addr
-	c.Tag = n.Tag
+	c.Tags = normalizeTags(n.Tags)
 	c.Description = n.Description
+	c.NsName = n.NsName
+	c.PrevAddr = ""
+	c.AddrChanged = false
 	return nil
 }
 
@@ -108,51 +306,322 @@ INSERT INTO contacts (
 	email,
 	phone,
 	addr,
-	tag,
-	description
-) VALUES(?, ?, ?, ?, ?, ?)
+	description,
+	ns_name,
+	verified_at,
+	owner
+) VALUES(?, ?, ?, ?, ?, ?, ?, ?)
 `
-	if _, err := db.Exec(sqlstr, c.Name, c.Email, c.Phone, c.Addr, c.Tag, c.Description); err != nil {
+	res, err := db.Exec(sqlstr, c.Name, nullString(c.Email), nullString(c.Phone), c.Addr, c.Description, c.NsName, c.VerifiedAt, c.Owner)
+	if err != nil {
 		logger.Errorf("insert %+v into table contacts failed, %s", c, err)
 		return err
 	}
 
-	return c.loadId(db)
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.Id = int(id)
+	c.Tags = normalizeTags(c.Tags)
+
+	return setTags(db, c.Id, c.Tags)
 }
 
-func (c *Contact) Remove(db *sql.DB, id int) error {
+// Remove removes the contact id of owner, sql.ErrNoRows if there is none.
+func (c *Contact) Remove(db *sql.DB, owner string, id int) error {
 	sqlstr := `
-	DELETE FROM contacts WHERE id = ?;
+	DELETE FROM contacts WHERE id = ? AND owner = ?;
 `
-	if _, err := db.Exec(sqlstr, id); err != nil {
+	res, err := db.Exec(sqlstr, id, owner)
+	if err != nil {
 		logger.Errorf("remove %+v from contacts failed, %s", id, err)
 		return err
 	}
+	if cnt, _ := res.RowsAffected(); cnt == 0 {
+		return sql.ErrNoRows
+	}
+
+	return setTags(db, id, nil)
+}
+
+// RemoveAll removes every contact of owner.
+func (c *Contact) RemoveAll(db *sql.DB, owner string) error {
+	for _, sqlstr := range []string{
+		`DELETE FROM contact_tags WHERE contact_id IN (SELECT id FROM contacts WHERE owner = ?)`,
+		`DELETE FROM contacts WHERE owner = ?`,
+	} {
+		if _, err := db.Exec(sqlstr, owner); err != nil {
+			logger.Errorf("remove all from contacts failed, %s", err)
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (c *Contact) RemoveAll(db *sql.DB) error {
-	sqlstr := `DELETE FROM contacts`
-	if _, err := db.Exec(sqlstr, c.Id); err != nil {
-		logger.Errorf("remove all from contacts failed, %s", err)
-		return err
+// FindDuplicate returns the contact of c.Owner having the same email or phone as c, nil if there is none.
+// ErrContactConflict if the email matches one contact and the phone another.
+func (c *Contact) FindDuplicate(db *sql.DB) (*Contact, error) {
+	if c.Email == "" && c.Phone == "" {
+		return nil, nil
 	}
 
+	query := `SELECT ` + contactColumns + ` FROM contacts WHERE owner = ? AND (email = ? OR phone = ?) ORDER BY id LIMIT 2`
+	dups, err := queryContacts(db, query, c.Owner, nullString(c.Email), nullString(c.Phone))
+	if err != nil {
+		logger.Errorf("query duplicate of contact %+v failed, %s", c, err)
+		return nil, err
+	}
+
+	switch len(dups) {
+	case 0:
+		return nil, nil
+	case 1:
+		return dups[0], nil
+	}
+	return nil, ErrContactConflict
+}
+
+// Merge fills the empty fields of c with the ones of n, and adds n's tags to c.
+func (c *Contact) Merge(db *sql.DB, n *Contact) error {
+	merged := *c
+	for _, f := range []struct{ dst, src *string }{
+		{&merged.Name, &n.Name},
+		{&merged.Email, &n.Email},
+		{&merged.Phone, &n.Phone},
+		{&merged.Addr, &n.Addr},
+		{&merged.Description, &n.Description},
+		{&merged.NsName, &n.NsName},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.src
+		}
+	}
+	merged.Tags = append(append([]string{}, c.Tags...), n.Tags...)
+
+	// keep the pending address change, Update would confirm it.
+	prevAddr, changed := c.PrevAddr, c.AddrChanged
+	if err := c.Update(db, &merged); err != nil {
+		return err
+	}
+	if changed {
+		if _, err := db.Exec(`UPDATE contacts SET prev_addr = ?, addr_changed = 1 WHERE id = ?`, prevAddr, c.Id); err != nil {
+			return err
+		}
+		c.PrevAddr, c.AddrChanged = prevAddr, changed
+	}
 	return nil
 }
 
-func (c *Contact) loadId(db *sql.DB) error {
-	if c.Email == "" || c.Phone == "" {
-		return fmt.Errorf("need email or phone")
+// ImportContacts saves cs to the address book of owner, the contacts having the same email or phone
+// as a saved one are handled by mode.
+func ImportContacts(db *sql.DB, owner string, cs []*Contact, mode string) (*ImportResult, error) {
+	switch mode {
+	case "":
+		mode = ImportMerge
+	case ImportMerge, ImportSkip, ImportReplace:
+	default:
+		return nil, fmt.Errorf("unknown import mode %s", mode)
+	}
+
+	ret := &ImportResult{Errors: []string{}}
+	for i, c := range cs {
+		c.Owner = owner
+		if c.Name == "" {
+			ret.Errors = append(ret.Errors, fmt.Sprintf("contact %d: name is required", i+1))
+			continue
+		}
+
+		dup, err := c.FindDuplicate(db)
+		if err == ErrContactConflict {
+			ret.Errors = append(ret.Errors, fmt.Sprintf("contact %d<%s>: %s", i+1, c.Name, err))
+			continue
+		}
+		if err != nil {
+			return ret, err
+		}
+
+		switch {
+		case dup == nil:
+			err = c.Insert(db)
+			if err == nil {
+				ret.Inserted++
+			}
+		case mode == ImportSkip:
+			ret.Skipped++
+		case mode == ImportReplace:
+			err = dup.Update(db, c)
+			if err == nil {
+				c.Id = dup.Id
+				ret.Merged++
+			}
+		default:
+			err = dup.Merge(db, c)
+			if err == nil {
+				*c = *dup
+				ret.Merged++
+			}
+		}
+		if err != nil {
+			ret.Errors = append(ret.Errors, fmt.Sprintf("contact %d<%s>: %s", i+1, c.Name, err))
+		}
+	}
+
+	return ret, nil
+}
+
+// Linked reports whether the contact's addr comes from a nameservice name.
+func (c *Contact) Linked() bool {
+	return c.NsName != ""
+}
+
+// Resolve returns the current address of a linked contact.
+func (c *Contact) Resolve(r AddrResolver) (string, error) {
+	if c.NsName == "" {
+		return "", fmt.Errorf("contact<%v> is not linked", c.Id)
 	}
+	return r.ResolveName(c.NsName)
+}
 
-	query := `SELECT id FROM contacts WHERE email = ? and phone = ?`
-	err := db.QueryRow(query, c.Email, c.Phone).Scan(&c.Id)
+// Verify resolves the contact again, if the address moved, the new one is saved and the contact flagged.
+func (c *Contact) Verify(db *sql.DB, r AddrResolver) (changed bool, err error) {
+	addr, err := c.Resolve(r)
+	if err != nil {
+		logger.Warningf("resolve contact<%v> failed, %s", c.Id, err)
+		return false, err
+	}
+
+	if addr != c.Addr && c.Addr != "" {
+		logger.Noticef("contact<%v> address changed, %s -> %s", c.Id, c.Addr, addr)
+		c.PrevAddr = c.Addr
+		c.AddrChanged = true
+		changed = true
+	}
+	c.Addr = addr
+	c.VerifiedAt = time.Now().Unix()
+
+	sqlstr := `UPDATE contacts SET addr = ?, prev_addr = ?, addr_changed = ?, verified_at = ? WHERE id = ?`
+	if _, err = db.Exec(sqlstr, c.Addr, c.PrevAddr, c.AddrChanged, c.VerifiedAt, c.Id); err != nil {
+		logger.Errorf("update verified contact<%v> failed, %s", c.Id, err)
+		return false, err
+	}
+
+	return changed, nil
+}
+
+// VerifyContacts re-verifies every linked contact, and returns the ones whose address changed.
+func VerifyContacts(db *sql.DB, r AddrResolver) ([]*Contact, error) {
+	cs, err := (*Contact).ListLinked(nil, db)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []*Contact{}
+	for _, c := range cs {
+		ok, err := c.Verify(db, r)
+		if err != nil {
+			// keep the last known address, try again next round.
+			continue
+		}
+		if ok {
+			changed = append(changed, c)
+		}
+	}
+
+	return changed, nil
+}
+
+// execer is implemented by *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanContact(row rowScanner) (*Contact, error) {
+	ret := &Contact{Tags: []string{}}
+	var email, phone, desc sql.NullString
+	err := row.Scan(&ret.Id, &ret.Name, &email, &phone, &ret.Addr, &desc,
+		&ret.NsName, &ret.PrevAddr, &ret.AddrChanged, &ret.VerifiedAt, &ret.Owner)
+	if err != nil {
+		return nil, err
+	}
+	ret.Email, ret.Phone, ret.Description = email.String, phone.String, desc.String
+	return ret, nil
+}
+
+func queryContacts(db *sql.DB, query string, args ...interface{}) ([]*Contact, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		logger.Errorf("query contact failed, %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	cs := []*Contact{}
+
+	for rows.Next() {
+		ret, err := scanContact(rows)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, ret)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	return cs, loadTags(db, cs)
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// tableColumns returns the column names of table.
+func tableColumns(db execer, table string) (map[string]struct{}, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info('%s')", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols := map[string]struct{}{}
+	for rows.Next() {
+		var (
+			cid, notnull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notnull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		cols[name] = struct{}{}
+	}
+	return cols, rows.Err()
+}
+
+// addColumns adds the missing columns to an existing table.
+func addColumns(db execer, table string, cols map[string]string) error {
+	exists, err := tableColumns(db, table)
+	if err != nil {
 		return err
 	}
 
+	for name, def := range cols {
+		if _, ok := exists[name]; ok {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE '%s' ADD COLUMN '%s' %s", table, name, def)); err != nil {
+			logger.Errorf("add column %s.%s failed, %s", table, name, err)
+			return err
+		}
+	}
 	return nil
 }
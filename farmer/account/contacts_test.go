@@ -1,6 +1,7 @@
 package account
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
 	"testing"
@@ -45,12 +46,12 @@ func TestDB(t *testing.T) {
 		Email:       "test@test.com",
 		Phone:       "12312341234",
 		Addr:        "xxxyyyzzz",
-		Tag:         "dev",
+		Tags:        []string{"dev"},
 		Description: "for test user's contact.",
 	}
 
 	if err = c.Insert(db); err != nil {
-		t.Errorf("insert failed, ", err)
+		t.Errorf("insert failed, %s", err)
 		return
 	}
 
@@ -64,9 +65,170 @@ func TestDB(t *testing.T) {
 
 	cs, err := (*Contact).List(nil, db)
 	if err != nil {
-		t.Errorf("list failed, ", err)
+		t.Errorf("list failed, %s", err)
 		return
 	}
 
 	t.Logf("contacts: %+v", cs[0])
 }
+
+type mockResolver map[string]string
+
+func (m mockResolver) ResolveName(name string) (string, error) {
+	if addr, ok := m[name]; ok {
+		return addr, nil
+	}
+	return "", fmt.Errorf("name %s not found", name)
+}
+
+func TestVerifyContacts(t *testing.T) {
+	db, err := getDB()
+	if err != nil {
+		t.Errorf("get db failed, %s", err)
+		return
+	}
+
+	if err = (*Contact).InitDB(nil, db); err != nil {
+		t.Errorf("init table, %s", err)
+		return
+	}
+
+	r := mockResolver{"alice": "addr-1"}
+	c := &Contact{
+		Name:   "alice",
+		Email:  "alice@test.com",
+		Phone:  "12312340000",
+		NsName: "alice",
+	}
+	if c.Addr, err = c.Resolve(r); err != nil {
+		t.Errorf("resolve failed, %s", err)
+		return
+	}
+	if err = c.Insert(db); err != nil {
+		t.Errorf("insert failed, %s", err)
+		return
+	}
+
+	r["alice"] = "addr-2"
+	changed, err := VerifyContacts(db, r)
+	if err != nil {
+		t.Errorf("verify failed, %s", err)
+		return
+	}
+	if len(changed) != 1 || changed[0].Id != c.Id {
+		t.Errorf("expect contact<%v> changed, got %+v", c.Id, changed)
+		return
+	}
+
+	got, err := (*Contact).Get(nil, db, "", c.Id)
+	if err != nil {
+		t.Errorf("get failed, %s", err)
+		return
+	}
+	if got.Addr != "addr-2" || got.PrevAddr != "addr-1" || !got.AddrChanged {
+		t.Errorf("unexpected contact after verify, %+v", got)
+	}
+}
+
+func TestVCardRoundTrip(t *testing.T) {
+	cs := []*Contact{{
+		Name:        "Bob; Jr.",
+		Email:       "bob@test.com",
+		Phone:       "12300001111",
+		Addr:        "addr-bob",
+		Tags:        []string{"dev", "friend"},
+		Description: "a long description, with comma and\nnew line, folded by the writer because it is too long",
+		NsName:      "bob",
+	}}
+
+	for _, version := range []string{"3.0", "4.0"} {
+		var buf bytes.Buffer
+		if err := WriteVCards(&buf, cs, version); err != nil {
+			t.Errorf("write vcard %s failed, %s", version, err)
+			return
+		}
+
+		got, err := ParseVCards(&buf)
+		if err != nil {
+			t.Errorf("parse vcard %s failed, %s", version, err)
+			return
+		}
+		if len(got) != 1 {
+			t.Errorf("expect 1 contact, got %v", len(got))
+			return
+		}
+		g, w := got[0], cs[0]
+		if g.Name != w.Name || g.Email != w.Email || g.Phone != w.Phone || g.Addr != w.Addr ||
+			g.Description != w.Description || g.NsName != w.NsName || fmt.Sprint(g.Tags) != fmt.Sprint(w.Tags) {
+			t.Errorf("vcard %s, expect %+v, got %+v", version, w, g)
+		}
+	}
+}
+
+func TestImportContacts(t *testing.T) {
+	db, err := getDB()
+	if err != nil {
+		t.Errorf("get db failed, %s", err)
+		return
+	}
+
+	if err = (*Contact).InitDB(nil, db); err != nil {
+		t.Errorf("init table, %s", err)
+		return
+	}
+	if err = (*Contact).RemoveAll(nil, db, "alice"); err != nil {
+		t.Errorf("remove all failed, %s", err)
+		return
+	}
+
+	data := "name,email,phone,address,tags\n" +
+		"carol,carol@test.com,,addr-carol,dev\n" +
+		"dave,,,addr-dave,\n" +
+		"carol2,carol@test.com,12300002222,,friend;dev\n"
+	cs, err := ParseCSV(bytes.NewBufferString(data))
+	if err != nil {
+		t.Errorf("parse csv failed, %s", err)
+		return
+	}
+
+	ret, err := ImportContacts(db, "alice", cs, ImportMerge)
+	if err != nil {
+		t.Errorf("import failed, %s", err)
+		return
+	}
+	if ret.Inserted != 2 || ret.Merged != 1 || len(ret.Errors) != 0 {
+		t.Errorf("unexpected import result %+v", ret)
+		return
+	}
+
+	found, count, err := (*Contact).Find(nil, db, &ContactFilter{Owner: "alice", Tag: "friend"})
+	if err != nil {
+		t.Errorf("find failed, %s", err)
+		return
+	}
+	if count != 1 || found[0].Name != "carol" || found[0].Phone != "12300002222" || len(found[0].Tags) != 2 {
+		t.Errorf("unexpected merged contact %+v", found)
+	}
+
+	// the email of carol and the phone of erin.
+	cs, _ = ParseCSV(bytes.NewBufferString("name,email,phone\nerin,,12300003333\nmix,carol@test.com,12300003333\n"))
+	ret, err = ImportContacts(db, "alice", cs, ImportMerge)
+	if err != nil || ret.Inserted != 1 || ret.Merged != 0 || len(ret.Errors) != 1 {
+		t.Errorf("import of a conflicted contact %+v %v", ret, err)
+	}
+	if c, _ := (*Contact).Get(nil, db, "alice", found[0].Id); c == nil || c.Phone != "12300002222" {
+		t.Errorf("carol should not be changed, %+v", c)
+	}
+
+	// the address book of another user does not conflict.
+	cs, _ = ParseCSV(bytes.NewBufferString("name,email\ncarol,carol@test.com\n"))
+	if ret, err = ImportContacts(db, "bob", cs, ImportMerge); err != nil || ret.Inserted != 1 {
+		t.Errorf("import of bob %+v %v", ret, err)
+	}
+	if err := (*Contact).Remove(nil, db, "bob", found[0].Id); err != sql.ErrNoRows {
+		t.Errorf("bob removed the contact of alice, %v", err)
+	}
+	if tags, err := ListTags(db, "bob"); err != nil || len(tags) != 0 {
+		t.Errorf("tags of bob %v %v", tags, err)
+	}
+}
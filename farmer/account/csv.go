@@ -0,0 +1,83 @@
+package account
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvColumns are the columns written by WriteCSV, tags are joined by ";".
+var csvColumns = []string{"name", "email", "phone", "addr", "tags", "description", "ns_name"}
+
+// ParseCSV reads contacts from csv data, the first record is the header naming the columns.
+func ParseCSV(r io.Reader) ([]*Contact, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []*Contact{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for i, col := range header {
+		col = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(col, "\ufeff")))
+		if col == "address" {
+			col = "addr"
+		}
+		index[col] = i
+	}
+	if _, ok := index["name"]; !ok {
+		return nil, fmt.Errorf("column name is required")
+	}
+
+	cs := []*Contact{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		get := func(col string) string {
+			if i, ok := index[col]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		cs = append(cs, &Contact{
+			Name:        get("name"),
+			Email:       get("email"),
+			Phone:       get("phone"),
+			Addr:        get("addr"),
+			Tags:        normalizeTags(strings.Split(get("tags"), ";")),
+			Description: get("description"),
+			NsName:      get("ns_name"),
+		})
+	}
+
+	return cs, nil
+}
+
+// WriteCSV writes cs with a header record.
+func WriteCSV(w io.Writer, cs []*Contact) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvColumns); err != nil {
+		return err
+	}
+
+	for _, c := range cs {
+		record := []string{c.Name, c.Email, c.Phone, c.Addr, strings.Join(c.Tags, ";"), c.Description, c.NsName}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -1,8 +1,13 @@
 package account
 
 import (
+	"database/sql"
+	"fmt"
+	"time"
+
 	"github.com/conseweb/common/hdwallet"
 	pb "github.com/conseweb/common/protos"
+	"golang.org/x/net/context"
 )
 
 func (a *Account) NewLocalDevice() Device {
@@ -30,4 +35,172 @@ type Device struct {
 	IsLocal bool
 	Wallet  *hdwallet.HDWallet
 	Address string `json:"address"` // wallet.Address
+
+	// the name given on this farmer, the alias is the one the idprovider verifies.
+	Label string `json:"label"`
+}
+
+// Revocation is a device unbound from the account, its keys are not trusted any more.
+type Revocation struct {
+	DeviceID string    `json:"device_id"`
+	UserID   string    `json:"user_id"`
+	Wpub     string    `json:"wpub"`
+	Spub     []byte    `json:"spub"`
+	Revoked  time.Time `json:"revoked"`
+}
+
+func createDeviceRevocations(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS 'device_revocations' (
+		'device_id' VARCHAR(64) PRIMARY KEY,
+		'user_id' VARCHAR(64) NOT NULL,
+		'wpub' TEXT NOT NULL,
+		'spub' BLOB,
+		'revoked' INTEGER NOT NULL
+	)`)
+	return err
+}
+
+// GetDevice returns the device id of the account, nil if there is none.
+func (a *Account) GetDevice(id string) *Device {
+	for i := range a.Devices {
+		if a.Devices[i].Device != nil && a.Devices[i].DeviceID == id {
+			return &a.Devices[i]
+		}
+	}
+	return nil
+}
+
+// BindDevice binds a new device to the account by the idprovider, its wallet is the child of master
+// after the ones of the bound and the revoked devices.
+func (a *Account) BindDevice(db *sql.DB, idpCli pb.IDPPClient, master func(uint32) (*hdwallet.HDWallet, error), dev *pb.Device) (*Device, error) {
+	n, err := CountRevoked(db, a.ID)
+	if err != nil {
+		return nil, err
+	}
+	wlt, err := master(uint32(len(a.Devices) + n))
+	if err != nil {
+		return nil, err
+	}
+	pub := wlt.Pub()
+
+	resp, err := idpCli.BindDeviceForUser(context.Background(), &pb.BindDeviceReq{
+		UserID: a.ID,
+		Os:     dev.Os,
+		For:    dev.For,
+		Mac:    dev.Mac,
+		Alias:  dev.Alias,
+		Wpub:   []byte(pub.String()),
+		Spub:   dev.Spub,
+		Sign:   []byte("ffff"),
+	})
+	if err != nil {
+		logger.Errorf("BindDevice failed, %v", err.Error())
+		return nil, err
+	}
+	if resp.Error != nil && !resp.Error.OK() {
+		return nil, resp.Error
+	}
+	if resp.Device == nil {
+		return nil, fmt.Errorf("got nil device.")
+	}
+
+	a.Devices = append(a.Devices, Device{Device: resp.Device, Address: pub.Address()})
+	return &a.Devices[len(a.Devices)-1], nil
+}
+
+// RevokeDevice removes device id from the account and records its keys revoked, the local device
+// can not be revoked. sql.ErrNoRows if the account has no such device.
+func (a *Account) RevokeDevice(db *sql.DB, id string) (*Revocation, error) {
+	dev := a.GetDevice(id)
+	if dev == nil {
+		return nil, sql.ErrNoRows
+	}
+	if dev.IsLocal {
+		return nil, fmt.Errorf("device %s is the local device", id)
+	}
+
+	r := &Revocation{
+		DeviceID: id,
+		UserID:   a.ID,
+		Wpub:     string(dev.Wpub),
+		Spub:     dev.Spub,
+		Revoked:  time.Now(),
+	}
+	if _, err := db.Exec(`INSERT OR REPLACE INTO device_revocations (device_id, user_id, wpub, spub, revoked) VALUES (?, ?, ?, ?, ?)`,
+		r.DeviceID, r.UserID, r.Wpub, r.Spub, r.Revoked.Unix()); err != nil {
+		return nil, err
+	}
+
+	devs := a.Devices[:0]
+	for _, d := range a.Devices {
+		if d.Device == nil || d.DeviceID != id {
+			devs = append(devs, d)
+		}
+	}
+	a.Devices = devs
+	return r, nil
+}
+
+// IsRevoked tells whether device id is revoked.
+func IsRevoked(db *sql.DB, deviceID string) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM device_revocations WHERE device_id = ?`, deviceID).Scan(&n)
+	return n > 0, err
+}
+
+// CountRevoked returns how many devices of userID are revoked.
+func CountRevoked(db *sql.DB, userID string) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM device_revocations WHERE user_id = ?`, userID).Scan(&n)
+	return n, err
+}
+
+// DropRevoked removes the revoked devices from the account, the idprovider still lists them after
+// they are unbound here.
+func (a *Account) DropRevoked(db *sql.DB) error {
+	rows, err := db.Query(`SELECT device_id FROM device_revocations WHERE user_id = ?`, a.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	revoked := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		revoked[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	devs := a.Devices[:0]
+	for _, d := range a.Devices {
+		if d.Device == nil || !revoked[d.DeviceID] {
+			devs = append(devs, d)
+		}
+	}
+	a.Devices = devs
+	return nil
+}
+
+// Merge keeps what is only saved on this farmer from old, the wallet, the nickname, the settings and
+// the labels of the devices.
+func (a *Account) Merge(old *Account) {
+	a.Lang, a.Passphrase, a.Wallet = old.Lang, old.Passphrase, old.Wallet
+	a.Settings = old.Settings
+	if old.NickName != "" {
+		a.NickName = old.NickName
+	}
+	for i := range a.Devices {
+		if a.Devices[i].Device == nil {
+			continue
+		}
+		if d := old.GetDevice(a.Devices[i].DeviceID); d != nil {
+			a.Devices[i].Label = d.Label
+		}
+	}
 }
@@ -0,0 +1,65 @@
+package account
+
+import (
+	"database/sql"
+	"testing"
+
+	pb "github.com/conseweb/common/protos"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRevokeDevice(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, AccountsSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Account{ID: "alice", Devices: []Device{
+		{Device: &pb.Device{DeviceID: "local"}, IsLocal: true},
+		{Device: &pb.Device{DeviceID: "nas", Wpub: []byte("xpub")}, Label: "home"},
+	}}
+	if _, err := a.RevokeDevice(db, "local"); err == nil {
+		t.Error("the local device is revoked")
+	}
+	if _, err := a.RevokeDevice(db, "phone"); err != sql.ErrNoRows {
+		t.Errorf("revoke no device, %v", err)
+	}
+	r, err := a.RevokeDevice(db, "nas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Wpub != "xpub" || len(a.Devices) != 1 || a.GetDevice("nas") != nil {
+		t.Fatalf("revoked %+v, devices %+v", r, a.Devices)
+	}
+	if ok, err := IsRevoked(db, "nas"); err != nil || !ok {
+		t.Errorf("nas is not revoked, %v", err)
+	}
+	if n, err := CountRevoked(db, "alice"); err != nil || n != 1 {
+		t.Errorf("revoked %d, %v", n, err)
+	}
+
+	// the idprovider still lists the unbound device.
+	login := &Account{ID: "alice", Devices: []Device{
+		{Device: &pb.Device{DeviceID: "local"}, IsLocal: true},
+		{Device: &pb.Device{DeviceID: "nas"}},
+		{Device: &pb.Device{DeviceID: "pad"}},
+	}}
+	old := &Account{ID: "alice", Passphrase: "words", Devices: []Device{
+		{Device: &pb.Device{DeviceID: "local"}, Label: "farmer"},
+	}}
+	login.Merge(old)
+	if err := login.DropRevoked(db); err != nil {
+		t.Fatal(err)
+	}
+	if len(login.Devices) != 2 || login.GetDevice("nas") != nil || login.GetDevice("pad") == nil {
+		t.Errorf("devices %+v", login.Devices)
+	}
+	if login.Passphrase != "words" || login.GetDevice("local").Label != "farmer" {
+		t.Errorf("not merged, %+v", login)
+	}
+}
@@ -0,0 +1,103 @@
+package account
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// roles of the accounts. local-admin is not saved, it is an owner requesting from the loopback.
+const (
+	RoleOwner      = "owner"
+	RoleViewer     = "viewer"
+	RoleLocalAdmin = "local-admin"
+)
+
+// Member is an account of the farmer without the secrets.
+type Member struct {
+	ID       string    `json:"id"`
+	NickName string    `json:"nickname"`
+	Email    string    `json:"email"`
+	Phone    string    `json:"phone"`
+	Role     string    `json:"role"`
+	Updated  time.Time `json:"updated"`
+}
+
+func addAccountRoles(tx *sql.Tx) error {
+	for _, sqlstr := range []string{
+		`ALTER TABLE accounts ADD COLUMN 'role' VARCHAR(16) NOT NULL DEFAULT 'viewer'`,
+		// the imported account of the single user farmer.
+		`UPDATE accounts SET role = 'owner' WHERE id = (SELECT id FROM accounts ORDER BY updated LIMIT 1)`,
+	} {
+		if _, err := tx.Exec(sqlstr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CountRole returns how many accounts have role.
+func CountRole(db *sql.DB, role string) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM accounts WHERE role = ?`, role).Scan(&n)
+	return n, err
+}
+
+// SetRole sets the role of account id, the last owner can not be a viewer.
+// sql.ErrNoRows if there is no such account.
+func SetRole(db *sql.DB, id, role string) error {
+	if role != RoleOwner && role != RoleViewer {
+		return fmt.Errorf("unknown role %s, owner or viewer", role)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var old string
+	if err := tx.QueryRow(`SELECT role FROM accounts WHERE id = ?`, id).Scan(&old); err != nil {
+		return err
+	}
+	if old == RoleOwner && role != RoleOwner {
+		var n int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM accounts WHERE role = ?`, RoleOwner).Scan(&n); err != nil {
+			return err
+		}
+		if n <= 1 {
+			return fmt.Errorf("account %s is the last owner", id)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE accounts SET role = ? WHERE id = ?`, role, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListMembers returns the accounts of the farmer, the owners first.
+func ListMembers(db *sql.DB) ([]*Member, error) {
+	rows, err := db.Query(`SELECT data, role, updated FROM accounts ORDER BY role = 'owner' DESC, updated`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ms := []*Member{}
+	for rows.Next() {
+		var (
+			data, role string
+			updated    int64
+		)
+		if err := rows.Scan(&data, &role, &updated); err != nil {
+			return nil, err
+		}
+		a := new(Account)
+		if err := json.Unmarshal([]byte(data), a); err != nil {
+			return nil, err
+		}
+		ms = append(ms, &Member{ID: a.ID, NickName: a.NickName, Email: a.Email, Phone: a.Phone, Role: role, Updated: time.Unix(updated, 0)})
+	}
+	return ms, rows.Err()
+}
@@ -0,0 +1,60 @@
+package account
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/hyperledger/fabric/farmer/migrate"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRoles(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, AccountsSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, bob := &Account{ID: "alice"}, &Account{ID: "bob"}
+	for _, a := range []*Account{alice, bob} {
+		if err := a.Save(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if alice.Role != RoleOwner || bob.Role != RoleViewer {
+		t.Fatalf("roles of alice %s, bob %s", alice.Role, bob.Role)
+	}
+
+	if err := SetRole(db, "alice", RoleViewer); err == nil {
+		t.Error("the last owner is a viewer")
+	}
+	if err := SetRole(db, "carol", RoleOwner); err != sql.ErrNoRows {
+		t.Errorf("set role of no account, %v", err)
+	}
+	if err := SetRole(db, "bob", RoleLocalAdmin); err == nil {
+		t.Error("local-admin is saved")
+	}
+	if err := SetRole(db, "bob", RoleOwner); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRole(db, "alice", RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+
+	// the role is kept by save.
+	if err := bob.Save(db); err != nil || bob.Role != RoleOwner {
+		t.Errorf("save bob, %s %v", bob.Role, err)
+	}
+	a, err := Load(db, "alice")
+	if err != nil || a.Role != RoleViewer {
+		t.Errorf("load alice %+v %v", a, err)
+	}
+
+	ms, err := ListMembers(db)
+	if err != nil || len(ms) != 2 || ms[0].ID != "bob" {
+		t.Errorf("members %+v %v", ms, err)
+	}
+}
@@ -0,0 +1,162 @@
+package account
+
+import (
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/conseweb/common/hdwallet"
+	"github.com/conseweb/common/passphrase"
+	pb "github.com/conseweb/common/protos"
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	"github.com/spf13/viper"
+)
+
+// the children of the master after the bound and the revoked devices which are looked up for the key
+// of the local device.
+const deviceKeyGap = 20
+
+var (
+	ErrInvalidMnemonic  = errors.New("invalid passphrase")
+	ErrMnemonicMismatch = errors.New("the passphrase is not the one of the account")
+)
+
+// Settings are the preferences of the account on this farmer.
+type Settings struct {
+	// of the farmer ui, one of LanguageSupport. the passphrase language is Lang.
+	Language string `json:"language"`
+	Notify   Notify `json:"notify"`
+}
+
+// Notify tells how the account is notified.
+type Notify struct {
+	Email bool `json:"email"`
+	Phone bool `json:"phone"`
+	// the events notified, all if empty.
+	Events []string `json:"events"`
+}
+
+// Validate checks the language is supported.
+func (s *Settings) Validate() error {
+	if s.Language == "" {
+		return nil
+	}
+	if _, ok := LanguageSupport[s.Language]; !ok {
+		return fmt.Errorf("unsupported language %s", s.Language)
+	}
+	return nil
+}
+
+// Recovery recovers an account on a fresh host, the wallet is regenerated from the passphrase.
+type Recovery struct {
+	SignInType pb.SignInType
+	SignIn     string
+	Password   string
+
+	Passphrase string
+	// the wallet is created with the password of the signup, Password if empty.
+	WalletPassword string
+}
+
+// language returns the language of the passphrase.
+func (r *Recovery) language() (pb.PassphraseLanguage, error) {
+	for _, l := range LanguageSupport {
+		if passphrase.IsMnemonicValid(r.Passphrase, l) {
+			return l, nil
+		}
+	}
+	return 0, ErrInvalidMnemonic
+}
+
+// Recover signs in the account and regenerates the wallet and the key of the local device, the local
+// device is bound again if it is not bound.
+func (r *Recovery) Recover(db *sql.DB, idpCli pb.IDPPClient) (*Account, error) {
+	r.Passphrase = strings.Join(strings.Fields(r.Passphrase), " ")
+	lang, err := r.language()
+	if err != nil {
+		return nil, err
+	}
+	ru, err := loginUser(idpCli, r.SignInType, r.SignIn, r.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	pass := r.WalletPassword
+	if pass == "" {
+		pass = r.Password
+	}
+	master := hdwallet.MasterKey(passphrase.NewSeed(r.Passphrase, pass), viper.GetBool("daemon.dev"))
+	if len(ru.Wpub) > 0 && string(ru.Wpub) != master.Pub().String() {
+		return nil, ErrMnemonicMismatch
+	}
+
+	a := accountOf(ru)
+	a.Lang, a.Passphrase, a.Wallet = lang, r.Passphrase, master
+	if err := a.DropRevoked(db); err != nil {
+		return nil, err
+	}
+	revoked, err := CountRevoked(db, a.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range a.Devices {
+		d := &a.Devices[i]
+		if !d.IsLocal {
+			continue
+		}
+		key, err := deviceKey(master, string(d.Wpub), len(a.Devices)+revoked+deviceKeyGap)
+		if err != nil {
+			return nil, fmt.Errorf("device %s of this host is bound with another wallet", d.DeviceID)
+		}
+		d.Wallet, d.Address = key, key.Pub().Address()
+		return a, nil
+	}
+
+	spub, err := newSpub()
+	if err != nil {
+		return nil, err
+	}
+	d, err := a.BindDevice(db, idpCli, master.Child, &pb.Device{
+		Os:    GetLocalOS(),
+		For:   pb.DeviceFor_FARMER,
+		Mac:   getLocalMAC(),
+		Alias: GetLocalOS(),
+		Spub:  spub,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the child BindDevice derived the wallet from.
+	key, err := master.Child(uint32(len(a.Devices) - 1 + revoked))
+	if err != nil {
+		return nil, err
+	}
+	d.IsLocal, d.Wallet = true, key
+	return a, nil
+}
+
+// deviceKey returns the child of master in [0, n) whose public key is wpub.
+func deviceKey(master *hdwallet.HDWallet, wpub string, n int) (*hdwallet.HDWallet, error) {
+	for i := 0; i < n; i++ {
+		key, err := master.Child(uint32(i))
+		if err != nil {
+			continue
+		}
+		if key.Pub().String() == wpub {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no device key of %s", wpub)
+}
+
+// newSpub returns a new signature public key of a device.
+func newSpub() ([]byte, error) {
+	priv, err := primitives.NewECDSAKey()
+	if err != nil {
+		return nil, err
+	}
+	return x509.MarshalPKIXPublicKey(&priv.PublicKey)
+}
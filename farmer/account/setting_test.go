@@ -0,0 +1,136 @@
+package account
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/conseweb/common/hdwallet"
+	pb "github.com/conseweb/common/protos"
+	"github.com/hyperledger/fabric/core/crypto/primitives"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	"github.com/hyperledger/fabric/farmer/wallet"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// stubIDP signs in user with the password, the bound devices are added to the user.
+type stubIDP struct {
+	pb.IDPPClient
+	user  *pb.User
+	binds int
+}
+
+func (s *stubIDP) LoginUser(ctx context.Context, in *pb.LoginUserReq, opts ...grpc.CallOption) (*pb.LoginUserRsp, error) {
+	if in.Password != s.user.Pass {
+		return &pb.LoginUserRsp{Error: &pb.Error{ErrorType: pb.ErrorType_INVALID_PARAM, Message: "wrong password"}}, nil
+	}
+	return &pb.LoginUserRsp{User: s.user}, nil
+}
+
+func (s *stubIDP) BindDeviceForUser(ctx context.Context, in *pb.BindDeviceReq, opts ...grpc.CallOption) (*pb.BindDeviceRsp, error) {
+	s.binds++
+	d := &pb.Device{UserID: in.UserID, DeviceID: "d" + in.Mac, Mac: in.Mac, Os: in.Os, Alias: in.Alias, Wpub: in.Wpub}
+	s.user.Devices = append(s.user.Devices, d)
+	return &pb.BindDeviceRsp{Device: d}, nil
+}
+
+func TestRecover(t *testing.T) {
+	if err := primitives.InitSecurityLevel("SHA3", 256); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, AccountsSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	ph, master := hdwallet.NewHDWallet("secret", pb.PassphraseLanguage_English, false)
+	other, _ := hdwallet.NewHDWallet("secret", pb.PassphraseLanguage_English, false)
+	idp := &stubIDP{user: &pb.User{UserID: "alice", Pass: "secret", Wpub: []byte(master.Pub().String())}}
+
+	r := &Recovery{SignInType: pb.SignInType_SI_USERID, SignIn: "alice", Password: "secret", Passphrase: "not words"}
+	if _, err := r.Recover(db, idp); err != ErrInvalidMnemonic {
+		t.Errorf("recover from no passphrase, %v", err)
+	}
+	r.Passphrase = other
+	if _, err := r.Recover(db, idp); err != ErrMnemonicMismatch {
+		t.Errorf("recover from the passphrase of another wallet, %v", err)
+	}
+
+	r.Passphrase = ph
+	a, err := r.Recover(db, idp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Wallet.String() != master.String() || idp.binds != 1 {
+		t.Fatalf("wallet is not recovered or device not bound, binds %d", idp.binds)
+	}
+	child, _ := master.Child(0)
+	if len(a.Devices) != 1 || !a.Devices[0].IsLocal || a.Devices[0].Wallet.String() != child.String() {
+		t.Fatalf("devices %+v", a.Devices)
+	}
+
+	// the device is bound already, its key is derived again.
+	again, err := r.Recover(db, idp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idp.binds != 1 || again.Devices[0].Wallet.String() != child.String() {
+		t.Errorf("recover again, binds %d, devices %+v", idp.binds, again.Devices)
+	}
+}
+
+func TestImportFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "account")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("peer.fileSystemPath", dir)
+	defer viper.Set("peer.fileSystemPath", "")
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, AccountsSchema, ContactsSchema, wallet.Schema); err != nil {
+		t.Fatal(err)
+	}
+
+	// the json does not keep the key of the wallet, it is regenerated from the passphrase.
+	ph, master := hdwallet.NewHDWallet("secret", pb.PassphraseLanguage_English, false)
+	bs, _ := json.Marshal(&Account{ID: "alice", Password: "secret", Passphrase: ph, Wallet: master})
+	if err := ioutil.WriteFile(filepath.Join(dir, "farmerAccount.json"), bs, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := ImportFile(db)
+	if err != nil || a == nil {
+		t.Fatalf("import %+v %v", a, err)
+	}
+	if a.Wallet.String() != master.String() {
+		t.Errorf("the wallet is not regenerated")
+	}
+	// the wallet api works for the imported account.
+	if _, err := wallet.Open(db, "alice"); err != nil {
+		t.Errorf("open the wallet of the imported account, %s", err)
+	}
+
+	// a saved master is not replaced by the one of another password.
+	a, _ = Load(db, "alice")
+	if err := a.SaveWallet(db, "other"); err != nil || a.Wallet.String() == master.String() {
+		t.Errorf("save wallet again, %v", err)
+	}
+	if ok, _ := wallet.HasMaster(db, "alice"); !ok {
+		t.Errorf("the master is dropped")
+	}
+}
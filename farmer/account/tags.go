@@ -0,0 +1,164 @@
+package account
+
+import (
+	"database/sql"
+	"strings"
+)
+
+func initTagsDB(db execer) error {
+	for _, sqlstr := range []string{`
+	CREATE TABLE IF NOT EXISTS 'tags' (
+		'id' INTEGER PRIMARY KEY AUTOINCREMENT,
+		'name' VARCHAR(32) NOT NULL UNIQUE
+	)`, `
+	CREATE TABLE IF NOT EXISTS 'contact_tags' (
+		'contact_id' INTEGER NOT NULL,
+		'tag_id' INTEGER NOT NULL,
+		PRIMARY KEY ('contact_id', 'tag_id')
+	)`,
+	} {
+		if _, err := db.Exec(sqlstr); err != nil {
+			logger.Errorf("create table of tags failed, %s", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateTagColumn moves the values of the old contacts.tag column into the tags table.
+func migrateTagColumn(db execer) error {
+	cols, err := tableColumns(db, "contacts")
+	if err != nil {
+		return err
+	}
+	if _, ok := cols["tag"]; !ok {
+		return nil
+	}
+
+	rows, err := db.Query(`SELECT id, tag FROM contacts WHERE tag IS NOT NULL AND tag != ''`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	olds := map[int]string{}
+	for rows.Next() {
+		var (
+			id  int
+			tag string
+		)
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		olds[id] = tag
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, tag := range olds {
+		tags, err := getTags(db, id)
+		if err != nil {
+			return err
+		}
+		if err := setTags(db, id, append(tags, tag)); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(`UPDATE contacts SET tag = NULL`)
+	return err
+}
+
+// ListTags returns every tag name in use by the contacts of owner.
+func ListTags(db *sql.DB, owner string) ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT t.name FROM tags t
+	JOIN contact_tags ct ON ct.tag_id = t.id
+	JOIN contacts c ON c.id = ct.contact_id
+	WHERE c.owner = ? ORDER BY t.name`, owner)
+	if err != nil {
+		logger.Errorf("query tags failed, %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	return tags, rows.Err()
+}
+
+// setTags replaces the tags of contact id.
+func setTags(db execer, id int, tags []string) error {
+	if _, err := db.Exec(`DELETE FROM contact_tags WHERE contact_id = ?`, id); err != nil {
+		logger.Errorf("clean tags of contact<%v> failed, %s", id, err)
+		return err
+	}
+
+	for _, tag := range normalizeTags(tags) {
+		if _, err := db.Exec(`INSERT OR IGNORE INTO tags (name) VALUES (?)`, tag); err != nil {
+			logger.Errorf("insert tag %s failed, %s", tag, err)
+			return err
+		}
+		if _, err := db.Exec(`INSERT OR IGNORE INTO contact_tags (contact_id, tag_id) SELECT ?, id FROM tags WHERE name = ?`, id, tag); err != nil {
+			logger.Errorf("tag contact<%v> with %s failed, %s", id, tag, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func getTags(db execer, id int) ([]string, error) {
+	rows, err := db.Query(`SELECT t.name FROM tags t JOIN contact_tags ct ON ct.tag_id = t.id WHERE ct.contact_id = ? ORDER BY t.name`, id)
+	if err != nil {
+		logger.Errorf("query tags of contact<%v> failed, %s", id, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tags = append(tags, name)
+	}
+	return tags, rows.Err()
+}
+
+// loadTags fills the tags of cs.
+func loadTags(db *sql.DB, cs []*Contact) error {
+	for _, c := range cs {
+		tags, err := getTags(db, c.Id)
+		if err != nil {
+			return err
+		}
+		c.Tags = tags
+	}
+	return nil
+}
+
+// normalizeTags trims tags and drops the empty and repeated ones.
+func normalizeTags(tags []string) []string {
+	ret := []string{}
+	seen := map[string]struct{}{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		ret = append(ret, tag)
+	}
+	return ret
+}
@@ -0,0 +1,230 @@
+package account
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// vCard properties of the farmer, for the fields which vCard does not have.
+const (
+	vcardAddr   = "X-LEPUSCOIN-ADDR"
+	vcardNsName = "X-NAMESERVICE-NAME"
+)
+
+// ParseVCards reads contacts from vCard 3.0 or 4.0 data, one contact for each BEGIN:VCARD ... END:VCARD.
+func ParseVCards(r io.Reader) ([]*Contact, error) {
+	lines, err := unfoldVCard(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := []*Contact{}
+	var c *Contact
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		name, value, err := splitVCardLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCARD"):
+			c = &Contact{Tags: []string{}}
+			continue
+		case name == "END" && strings.EqualFold(value, "VCARD"):
+			if c == nil {
+				return nil, fmt.Errorf("line %d: END without BEGIN", i+1)
+			}
+			cs = append(cs, c)
+			c = nil
+			continue
+		case c == nil:
+			return nil, fmt.Errorf("line %d: %s outside of a vcard", i+1, name)
+		}
+
+		switch name {
+		case "VERSION":
+			if value != "3.0" && value != "4.0" {
+				return nil, fmt.Errorf("line %d: unsupported vcard version %s", i+1, value)
+			}
+		case "FN":
+			c.Name = unescapeVCard(value)
+		case "N":
+			if c.Name == "" {
+				// family;given;additional;prefix;suffix
+				parts := splitVCardValue(value, ';')
+				names := []string{}
+				for _, idx := range []int{3, 1, 2, 0, 4} {
+					if idx < len(parts) && parts[idx] != "" {
+						names = append(names, parts[idx])
+					}
+				}
+				c.Name = strings.Join(names, " ")
+			}
+		case "EMAIL":
+			if c.Email == "" {
+				c.Email = unescapeVCard(value)
+			}
+		case "TEL":
+			if c.Phone == "" {
+				c.Phone = strings.TrimPrefix(unescapeVCard(value), "tel:")
+			}
+		case "NOTE":
+			c.Description = unescapeVCard(value)
+		case "CATEGORIES":
+			c.Tags = append(c.Tags, splitVCardValue(value, ',')...)
+		case vcardAddr:
+			c.Addr = unescapeVCard(value)
+		case vcardNsName:
+			c.NsName = unescapeVCard(value)
+		}
+	}
+	if c != nil {
+		return nil, fmt.Errorf("vcard of %s is not ended", c.Name)
+	}
+
+	return cs, nil
+}
+
+// WriteVCards writes cs as vCard of version "3.0" or "4.0".
+func WriteVCards(w io.Writer, cs []*Contact, version string) error {
+	if version == "" {
+		version = "4.0"
+	}
+	if version != "3.0" && version != "4.0" {
+		return fmt.Errorf("unsupported vcard version %s", version)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, c := range cs {
+		props := [][2]string{
+			{"BEGIN", "VCARD"},
+			{"VERSION", version},
+			{"FN", escapeVCard(c.Name)},
+		}
+		if version == "3.0" {
+			// N is required by vCard 3.0
+			props = append(props, [2]string{"N", escapeVCard(c.Name) + ";;;;"})
+		}
+		if c.Email != "" {
+			props = append(props, [2]string{"EMAIL", escapeVCard(c.Email)})
+		}
+		if c.Phone != "" {
+			props = append(props, [2]string{"TEL", escapeVCard(c.Phone)})
+		}
+		if c.Description != "" {
+			props = append(props, [2]string{"NOTE", escapeVCard(c.Description)})
+		}
+		if len(c.Tags) > 0 {
+			tags := make([]string, 0, len(c.Tags))
+			for _, tag := range c.Tags {
+				tags = append(tags, escapeVCard(tag))
+			}
+			props = append(props, [2]string{"CATEGORIES", strings.Join(tags, ",")})
+		}
+		for _, p := range [][2]string{
+			{vcardAddr, c.Addr},
+			{vcardNsName, c.NsName},
+		} {
+			if p[1] != "" {
+				props = append(props, [2]string{p[0], escapeVCard(p[1])})
+			}
+		}
+		props = append(props, [2]string{"END", "VCARD"})
+
+		for _, p := range props {
+			if _, err := bw.WriteString(foldVCard(p[0] + ":" + p[1])); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// unfoldVCard joins the folded lines, which start with a space or a tab.
+func unfoldVCard(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitVCardLine splits "group.NAME;param=x:value" into upper case NAME and value, params are ignored.
+func splitVCardLine(line string) (name string, value string, err error) {
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", "", fmt.Errorf("invalid vcard line %q", line)
+	}
+
+	name = strings.ToUpper(strings.SplitN(line[:colon], ";", 2)[0])
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+	return name, line[colon+1:], nil
+}
+
+// splitVCardValue splits value by the unescaped sep, and unescapes every part.
+func splitVCardValue(value string, sep byte) []string {
+	parts := []string{}
+	var cur []byte
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			cur = append(cur, value[i], value[i+1])
+			i++
+		case value[i] == sep:
+			parts = append(parts, unescapeVCard(string(cur)))
+			cur = cur[:0]
+		default:
+			cur = append(cur, value[i])
+		}
+	}
+	return append(parts, unescapeVCard(string(cur)))
+}
+
+func escapeVCard(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`).Replace(s)
+}
+
+func unescapeVCard(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";").Replace(s)
+}
+
+// foldVCard ends line with CRLF, and folds it every 75 octets without breaking utf-8 characters.
+func foldVCard(line string) string {
+	const max = 75
+	var buf strings.Builder
+	n := 0
+	for _, r := range line {
+		size := len(string(r))
+		if n+size > max {
+			buf.WriteString("\r\n ")
+			n = 1
+		}
+		buf.WriteRune(r)
+		n += size
+	}
+	buf.WriteString("\r\n")
+	return buf.String()
+}
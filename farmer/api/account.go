@@ -1,14 +1,20 @@
 package api
 
 import (
+	"bytes"
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	pb "github.com/conseweb/common/protos"
 	"github.com/go-martini/martini"
 	"github.com/hyperledger/fabric/farmer/account"
+	"github.com/hyperledger/fabric/farmer/session"
+	"github.com/hyperledger/fabric/farmer/wallet"
 	"github.com/martini-contrib/render"
 	"golang.org/x/net/context"
 )
@@ -85,7 +91,7 @@ func RegVerificationType(rw http.ResponseWriter, req *http.Request, ctx *Request
 
 	resp, err := cli.AcquireCaptcha(context.Background(), &pb.AcquireCaptchaReq{stype, svalue})
 	if err != nil {
-		ctx.Error(501, err, "idp server error")
+		ctx.Error(502, withCode(CodeIDPUnavailable, err), "idp server error")
 		return
 	}
 	if resp.Error != nil && !resp.Error.OK() {
@@ -114,7 +120,7 @@ func Registry(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
 	stype, svalue := user.SignUpArgus()
 	resp, err := cli.VerifyCaptcha(context.Background(), &pb.VerifyCaptchaReq{stype, svalue, user.Captcha})
 	if err != nil {
-		ctx.Error(501, err, "idp server error")
+		ctx.Error(502, withCode(CodeIDPUnavailable, err), "idp server error")
 		return
 	}
 	if resp.Error != nil && !resp.Error.OK() {
@@ -133,6 +139,16 @@ func Registry(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
 		ctx.Error(500, err)
 		return
 	}
+	if err := acc.Save(ctx.db); err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	// keep the master key on this device, the wallet api derives addresses from it.
+	if err := wallet.SaveMaster(ctx.db, acc.ID, acc.Wallet); err != nil {
+		ctx.Error(500, err)
+		return
+	}
 
 	ctx.rnd.JSON(201, acc)
 }
@@ -149,22 +165,209 @@ func Login(ctx *RequestContext) {
 
 	st, su := user.SignInArgus()
 	a, err := account.Login(cli, st, su, user.Password)
+	if err == account.ErrNoWallet {
+		ctx.Error(400, err)
+		return
+	}
 	if err != nil {
 		ctx.Error(500, err)
 		return
 	}
 
-	daemon.ResetAccount(a)
-	log.Debugf("set nuew account %+v", a)
+	// the wallet is kept on this device only.
+	if old, err := account.Load(ctx.db, a.ID); err == nil {
+		a.Merge(old)
+	}
+	if err := a.DropRevoked(ctx.db); err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	if err := a.Save(ctx.db); err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	if err := a.SaveWallet(ctx.db, user.Password); err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	loginAs(ctx, a, 200)
+}
 
-	ctx.rnd.JSON(200, a)
+// loginAs issues a session of the saved account a, which becomes the farmer account.
+func loginAs(ctx *RequestContext, a *account.Account, status int) {
+	s, token, err := sessions.Issue(a.ID, ctx.req.UserAgent())
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	daemon.SetAccount(a)
+	ctx.log.Debugf("account %s login, session %s", a.ID, s.ID)
+
+	ctx.rnd.JSON(status, struct {
+		*account.Account
+		Token   string `json:"token"`
+		Expires int64  `json:"expires"`
+	}{a, token, s.Expires.Unix()})
 }
 
+// POST /account/recover, recovers the account on this host from the passphrase.
+// body: {"type": "email", "email": "a@b.c", "password": "xxx", "passphrase": "...", "wallet_password": ""}
+func RecoverAccount(ctx *RequestContext) {
+	var req struct {
+		accountWrapper
+		Passphrase     string `json:"passphrase"`
+		WalletPassword string `json:"wallet_password"`
+	}
+	if err := json.NewDecoder(ctx.req.Body).Decode(&req); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	cli, err := daemon.GetIDPClient()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	st, su := req.SignInArgus()
+	r := &account.Recovery{
+		SignInType:     st,
+		SignIn:         su,
+		Password:       req.Password,
+		Passphrase:     req.Passphrase,
+		WalletPassword: req.WalletPassword,
+	}
+	a, err := r.Recover(ctx.db, cli)
+	switch err {
+	case nil:
+	case account.ErrInvalidMnemonic, account.ErrMnemonicMismatch:
+		ctx.Error(400, err)
+		return
+	default:
+		ctx.Error(500, err, "recover account failed")
+		return
+	}
+
+	if old, err := account.Load(ctx.db, a.ID); err == nil {
+		a.Settings = old.Settings
+	}
+	if err := a.Save(ctx.db); err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	if err := wallet.SaveMaster(ctx.db, a.ID, a.Wallet); err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.log.Noticef("account %s is recovered from the passphrase", a.ID)
+	loginAs(ctx, a, 200)
+}
+
+// GET /account/setting
+func GetAccountSetting(ctx *RequestContext) {
+	ctx.rnd.JSON(200, ctx.user.Settings)
+}
+
+// PATCH /account/setting {"nickname": "alice", "language": "English", "notify": {"email": true}},
+// the nickname is kept on this farmer.
+func UpdateAccountSetting(ctx *RequestContext) {
+	var req struct {
+		NickName *string         `json:"nickname"`
+		Language *string         `json:"language"`
+		Notify   *account.Notify `json:"notify"`
+	}
+	if err := json.NewDecoder(ctx.req.Body).Decode(&req); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	st := ctx.user.Settings
+	if req.Language != nil {
+		st.Language = *req.Language
+	}
+	if req.Notify != nil {
+		st.Notify = *req.Notify
+	}
+	if err := st.Validate(); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	ctx.user.Settings = st
+	if req.NickName != nil {
+		if nick := strings.TrimSpace(*req.NickName); nick != "" {
+			ctx.user.NickName = nick
+		}
+	}
+
+	if !saveUser(ctx) {
+		return
+	}
+	ctx.rnd.JSON(200, ctx.user.Settings)
+}
+
+// DELETE /account/logout, revokes the token of the request.
 func Logout(ctx *RequestContext) {
-	daemon.ResetAccount(nil)
+	if err := sessions.Revoke(ctx.user.ID, ctx.session.ID); err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	resetFarmerAccount(ctx.db, ctx.user.ID)
 	ctx.res.WriteHeader(200)
 }
 
+// resetFarmerAccount sets the farmer account to the user of the newest session, if the logout user was it.
+func resetFarmerAccount(db *sql.DB, logout string) {
+	if u := daemon.GetUser(); u == nil || u.ID != logout {
+		return
+	}
+
+	var a *account.Account
+	if id, err := session.LastActive(db); err != nil {
+		log.Warningf("query active sessions failed, %s", err)
+	} else if id != "" {
+		if a, err = account.Load(db, id); err != nil {
+			log.Warningf("load account %s failed, %s", id, err)
+		}
+	}
+	daemon.SetAccount(a)
+}
+
+// GET /account/sessions, the active sessions of the login user.
+func ListSessions(ctx *RequestContext) {
+	ss, err := sessions.List(ctx.user.ID)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, ss)
+}
+
+// DELETE /account/sessions/:id
+func RevokeSession(ctx *RequestContext, params martini.Params) {
+	err := sessions.Revoke(ctx.user.ID, params["id"])
+	if err == sql.ErrNoRows {
+		ctx.Error(404, fmt.Errorf("not found session %s", params["id"]))
+		return
+	}
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	resetFarmerAccount(ctx.db, ctx.user.ID)
+	ctx.Message(200, "successful")
+}
+
+// DELETE /account/sessions, revokes every session of the login user, the token of the request too.
+func RevokeSessions(ctx *RequestContext) {
+	n, err := sessions.RevokeUser(ctx.user.ID)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	resetFarmerAccount(ctx.db, ctx.user.ID)
+	ctx.rnd.JSON(200, map[string]int64{"revoked": n})
+}
+
 func UnbindDevide(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
 	// registry
 	// cli, err := daemon.GetIDPClient()
@@ -189,23 +392,177 @@ func OfflineAccount(ctx *RequestContext) {
 }
 
 func GetAccountState(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, rnd render.Render) {
-	if daemon.Account == nil {
-		ctx.Error(404, "not found account")
-		return
-	}
-	rnd.JSON(200, daemon.Account)
+	rnd.JSON(200, ctx.user)
 }
 
 // contacts.
+// GET /account/contacts?q=xxx&tag=xxx&linked=true&changed=true&limit=10&offset=0
 func ListContacts(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-	ret, err := (*account.Contact).List(nil, ctx.db)
+	f, err := contactFilter(ctx)
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	ret, count, err := (*account.Contact).Find(nil, ctx.db, f)
 	if err != nil {
 		ctx.Error(500, err)
 		return
 	}
+	rw.Header().Set("Record-Count", strconv.Itoa(count))
 	ctx.rnd.JSON(200, ret)
 }
 
+// GET /account/contacts/tags
+func ListContactTags(ctx *RequestContext) {
+	tags, err := account.ListTags(ctx.db, ctx.user.ID)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, tags)
+}
+
+// POST /account/contacts/import?format=vcard|csv&mode=merge|skip|replace
+// body is the file, or a multipart form with the file in field "file".
+func ImportContacts(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	var body io.Reader = req.Body
+	if mf, _, err := req.FormFile("file"); err == nil {
+		defer mf.Close()
+		body = mf
+	}
+
+	var (
+		cs  []*account.Contact
+		err error
+	)
+	switch contactsFormat(ctx.params["format"], req.Header.Get("Content-Type")) {
+	case "vcard":
+		cs, err = account.ParseVCards(body)
+	case "csv":
+		cs, err = account.ParseCSV(body)
+	default:
+		err = fmt.Errorf("unknown contacts format %s", ctx.params["format"])
+	}
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	for _, c := range cs {
+		if c.Linked() && c.Addr == "" {
+			if err := resolveLinkedContact(c); err != nil {
+				ctx.log.Warningf("resolve imported contact %s failed, %s", c.Name, err)
+			}
+		}
+	}
+
+	ret, err := account.ImportContacts(ctx.db, ctx.user.ID, cs, ctx.params["mode"])
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	ctx.rnd.JSON(201, ret)
+}
+
+// GET /account/contacts/export?format=vcard|csv&version=3.0|4.0, filters are the same as ListContacts.
+func ExportContacts(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	f, err := contactFilter(ctx)
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	cs, _, err := (*account.Contact).Find(nil, ctx.db, f)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	switch format := contactsFormat(ctx.params["format"], ""); format {
+	case "vcard":
+		err = account.WriteVCards(&buf, cs, ctx.params["version"])
+		rw.Header().Set("Content-Type", "text/vcard; charset=utf-8")
+		rw.Header().Set("Content-Disposition", `attachment; filename="contacts.vcf"`)
+	case "csv":
+		err = account.WriteCSV(&buf, cs)
+		rw.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		rw.Header().Set("Content-Disposition", `attachment; filename="contacts.csv"`)
+	default:
+		err = fmt.Errorf("unknown contacts format %s", format)
+	}
+	if err != nil {
+		rw.Header().Del("Content-Disposition")
+		ctx.Error(400, err)
+		return
+	}
+
+	rw.WriteHeader(200)
+	rw.Write(buf.Bytes())
+}
+
+func contactFilter(ctx *RequestContext) (*account.ContactFilter, error) {
+	f := &account.ContactFilter{
+		Owner: ctx.user.ID,
+		Query: ctx.params["q"],
+		Tag:   ctx.params["tag"],
+	}
+
+	for _, v := range []struct {
+		key string
+		val *bool
+	}{
+		{"linked", &f.Linked},
+		{"changed", &f.Changed},
+	} {
+		if ctx.params[v.key] == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(ctx.params[v.key])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s, %s", v.key, ctx.params[v.key], err)
+		}
+		*v.val = b
+	}
+
+	for _, v := range []struct {
+		key string
+		val *int
+	}{
+		{"limit", &f.Limit},
+		{"offset", &f.Offset},
+	} {
+		if ctx.params[v.key] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(ctx.params[v.key])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s: %s", v.key, ctx.params[v.key])
+		}
+		*v.val = n
+	}
+	return f, nil
+}
+
+// contactsFormat returns "vcard" or "csv" from the format param, or the content type.
+func contactsFormat(format, contentType string) string {
+	if format == "" {
+		format = "vcard"
+		if strings.Contains(contentType, "csv") {
+			format = "csv"
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case "vcard", "vcf":
+		return "vcard"
+	case "csv":
+		return "csv"
+	}
+	return format
+}
+
 func AddContacts(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
 	cont := &account.Contact{}
 	err := json.NewDecoder(ctx.req.Body).Decode(cont)
@@ -214,6 +571,12 @@ func AddContacts(rw http.ResponseWriter, req *http.Request, ctx *RequestContext)
 		return
 	}
 
+	if err = resolveLinkedContact(cont); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	cont.Owner = ctx.user.ID
 	if err = cont.Insert(ctx.db); err != nil {
 		ctx.Error(500, err)
 		return
@@ -235,8 +598,17 @@ func UpdateContacts(rw http.ResponseWriter, req *http.Request, ctx *RequestConte
 		return
 	}
 
-	upd := &account.Contact{Id: id}
+	if err = resolveLinkedContact(newc); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	upd := &account.Contact{Id: id, Owner: ctx.user.ID}
 	err = upd.Update(ctx.db, newc)
+	if err == sql.ErrNoRows {
+		ctx.Error(404, fmt.Errorf("not found contact<%v>", id))
+		return
+	}
 	if err != nil {
 		ctx.Error(500, err)
 		return
@@ -246,7 +618,7 @@ func UpdateContacts(rw http.ResponseWriter, req *http.Request, ctx *RequestConte
 }
 
 func RemoveAllContacts(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-	if err := (*account.Contact).RemoveAll(nil, ctx.db); err != nil {
+	if err := (*account.Contact).RemoveAll(nil, ctx.db, ctx.user.ID); err != nil {
 		ctx.Error(400, err)
 		return
 	}
@@ -260,7 +632,11 @@ func RemoveContacts(rw http.ResponseWriter, req *http.Request, ctx *RequestConte
 		return
 	}
 
-	err = (*account.Contact).Remove(nil, ctx.db, id)
+	err = (*account.Contact).Remove(nil, ctx.db, ctx.user.ID, id)
+	if err == sql.ErrNoRows {
+		ctx.Error(404, fmt.Errorf("not found contact<%v>", id))
+		return
+	}
 	if err != nil {
 		ctx.Error(500, err)
 		return
@@ -1,18 +1,20 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	stdlog "log"
 	"net/http"
-	"net/url"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/account"
 	"github.com/hyperledger/fabric/farmer/api/views"
 	daepkg "github.com/hyperledger/fabric/farmer/daemon"
-	ccpkg "github.com/hyperledger/fabric/peer/chaincode"
+	"github.com/hyperledger/fabric/farmer/session"
 	"github.com/hyperledger/fabric/storage"
 	"github.com/martini-contrib/cors"
 	"github.com/martini-contrib/render"
@@ -23,6 +25,8 @@ import (
 const (
 	API_PREFIX      = "/api"
 	SOCKETIO_PREFIX = "/socket.io"
+
+	defaultSessionTTL = 7 * 24 * time.Hour
 )
 
 var (
@@ -32,25 +36,10 @@ var (
 	fsDriver    storage.StorageDriver
 
 	ccManager = &chaincodeManager{}
+	// tokens of the login users.
+	sessions *session.Manager
 )
 
-func init() {
-	ccManager.ccs = map[string]*ccpkg.ChaincodeWrapper{
-		"lepuscoin": &ccpkg.ChaincodeWrapper{
-			Path: "github.com/conseweb/common/assets/lepuscoin",
-			Name: "",
-		},
-		"poe": &ccpkg.ChaincodeWrapper{
-			Path: "github.com/conseweb/common/assets/poe",
-			Name: "",
-		},
-		"nameservice": &ccpkg.ChaincodeWrapper{
-			Path: "github.com/conseweb/common/assets/nameservice",
-			Name: "",
-		},
-	}
-}
-
 type RequestContext struct {
 	params martini.Params
 	mc     martini.Context
@@ -61,6 +50,18 @@ type RequestContext struct {
 
 	db  *sql.DB
 	evt *EventHandler
+
+	// set by AuthMW.
+	user    *account.Account
+	session *session.Session
+	role    string
+
+	// pattern of the matched route, set by RouteMW.
+	route string
+
+	// X-Request-Id of the request and the response, log is prefixed with it.
+	requestID string
+	log       reqLog
 }
 
 type EventClient struct {
@@ -71,38 +72,22 @@ type eventHandle struct {
 	es map[string]EventClient
 }
 
-func notFound(gateways map[string]*url.URL) http.HandlerFunc {
-	return func(w http.ResponseWriter, req *http.Request) {
-		for way, _ := range gateways {
-			if strings.HasPrefix(req.URL.Path, way) {
+func notFound(gateways []*gateway) martini.Handler {
+	return func(w http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+		for _, g := range gateways {
+			if strings.HasPrefix(req.URL.Path, g.prefix) {
 				w.WriteHeader(http.StatusNotFound)
 				return
 			}
 		}
-		for _, v := range []string{API_PREFIX, SOCKETIO_PREFIX} {
-			if strings.HasPrefix(req.URL.Path, v) {
-				w.WriteHeader(http.StatusNotFound)
-				return
-			}
+		if strings.HasPrefix(req.URL.Path, API_PREFIX) {
+			ctx.Error(404, withCode(CodeRouteNotFound, fmt.Errorf("no route %s %s", req.Method, req.URL.Path)))
+			return
 		}
-	}
-}
-
-func getGatewayRouters() (map[string]*url.URL, error) {
-	gateways := map[string]*url.URL{}
-
-	for k, v := range viper.GetStringMapString("daemon.gateway") {
-		log.Noticef("get setting proxy router, %s --> %s", k, v)
-		way := "/" + strings.Trim(k, "/ \n")
-		to, err := url.Parse(v)
-		if err != nil {
-			log.Errorf("formt URL<%s> failed, error: %s", v, err.Error())
-			return nil, err
+		if strings.HasPrefix(req.URL.Path, SOCKETIO_PREFIX) {
+			w.WriteHeader(http.StatusNotFound)
 		}
-		gateways[way] = to
 	}
-
-	return gateways, nil
 }
 
 func Serve(d *daepkg.Daemon) error {
@@ -112,24 +97,27 @@ func Serve(d *daepkg.Daemon) error {
 
 	m := NewMartini()
 
-	m.Use(cors.Allow(&cors.Options{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "PATCH", "POST", "DELETE", "PUT"},
-		AllowHeaders:     []string{"Limt", "Offset", "Content-Type", "Origin", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Record-Count", "Limt", "Offset", "Content-Type"},
-		AllowCredentials: true,
-		MaxAge:           time.Second * 864000,
-	}))
+	if opts := corsOptions(); opts != nil {
+		m.Use(cors.Allow(opts))
+	}
 
 	// gateway.
-	gateways, err := getGatewayRouters()
+	gateways, err := getGateways()
 	if err != nil {
 		return err
 	}
 
-	for way, to := range gateways {
-		m.Any(way+"/**", ProxyTo(way, to))
-		log.Noticef("add proxy router %s --> %s", way, to.String())
+	stopChecks := make(chan struct{})
+	d.OnShutdown(func(context.Context) error {
+		close(stopChecks)
+		return nil
+	})
+	for _, g := range gateways {
+		m.Any(g.prefix+"/**", RouteMW, g.Handle)
+		if g.healthPath != "" {
+			go g.checkLoop(stopChecks)
+		}
+		log.Noticef("add proxy router %s", g)
 	}
 
 	view := views.New()
@@ -138,97 +126,29 @@ func Serve(d *daepkg.Daemon) error {
 	evt := NewEventHandler()
 	m.Map(evt)
 
-	m.Use(requextCtx)
+	if db := d.GetDB(); db != nil {
+		if err := ccManager.Load(db, evt); err != nil {
+			return err
+		}
+		ttl := viper.GetDuration("daemon.session.ttl")
+		if ttl <= 0 {
+			ttl = defaultSessionTTL
+		}
+		if sessions, err = session.NewManager(db, ttl); err != nil {
+			return err
+		}
+	}
 
-	m.Any(SOCKETIO_PREFIX, evt.ServeHTTP)
-	m.Group(API_PREFIX, func(r martini.Router) {
-		/// no auth
-		r.Post("/signup/:vtype", RegVerificationType)
-		r.Post("/signup", Registry)
-		r.Post("/account/login", Login)
+	go verifyContactsLoop(evt)
+	go followBlocksLoop(evt)
+	go challengeLoop(evt)
+	go lotteryLoop(evt)
 
-		/// need user auth
-		r.Group("", func(r martini.Router) {
-			r.Group("/account", func(r martini.Router) {
-				r.Get("", GetAccountState)
-				r.Delete("/logout", Logout)
-				r.Patch("/setting", Hello)
-
-				// local contacts
-				r.Get("/contacts", ListContacts)
-				r.Post("/contacts", AddContacts)
-				r.Patch("/contacts/:id", UpdateContacts)
-				r.Delete("/contacts", RemoveAllContacts)
-				r.Delete("/contacts/:id", RemoveContacts)
-			})
-
-			r.Group("/device", func(r martini.Router) {
-				r.Post("/bind", Hello)
-				r.Delete("/unbind", Hello)
-				r.Post("/tx", NewTx)
-				r.Get("/coinbase_tx/:addr", GetCoinBaseTx)
-			})
-
-			/// need deploy lepuscoin chaincode.
-			r.Group("/lepuscoin", func(r martini.Router) {
-				r.Post("/tx", NewTx)
-				r.Post("/deploy", DeployLepuscoin)
-				r.Post("/coinbase", DoCoinbase)
-				r.Post("/transfer", Transfer)
-				r.Get("/balance", QueryAddrs)
-				r.Get("/coin", QueryCoin)
-				r.Get("/tx/:tx", QueryTx)
-			}, DeployLepuscoinMW)
-
-			/// name service
-			r.Group("/namesrv", func(r martini.Router) {
-				r.Post("/deploy", DeployNameService)
-				r.Post("/new", NewNameServiceKV)
-				r.Delete("/:key", RemoveNameServiceKV)
-			}, DeployNameSrvnMW)
-
-			/// file indexer
-			r.Group("/indexer", func(r martini.Router) {
-				r.Post("/online/:device_id", OnlineDevice)
-				r.Post("/offline/:device_id", OfflineDevice)
-				r.Post("/files/:device_id", SetFileIndex)
-				r.Get("/address/:file_id", GetFileAddr)
-			}, SetIndexerDBMW)
-
-			// filesystem
-			r.Group("/fs", func(r martini.Router) {
-				r.Get("/ls/**", GetFileList)
-				r.Get("/cat/**", GetFile)
-				r.Put("/new/**", UploadFile)
-				r.Post("/mkdir/**", NewDir)
-				r.Patch("/rename/**", RenameFile)
-				r.Delete("/rm/**", RemoveFile)
-			}, SetFsDriverMW)
-		}, AuthMW)
-
-		r.Post("/cc/deploy", DeployCC)
-		r.Post("/cc/invoke", InvokeCC)
-		r.Post("/cc/query", QueryCC)
-
-		r.Patch("/peer/start", StartPeer)
-		r.Patch("/peer/stop", StopPeer)
-		r.Patch("/peer/restart", RestartPeer)
-
-		r.Get("/metrics", GetMetrics)
-
-		r.Get("/chaincode", ListChaincodes)
-		r.Get("/chaincode/:alias", GetChaincode)
+	m.Use(requextCtx)
+	m.Use(MetricsMW)
 
-		/// proxy fo fabirc
-		r.Post("/chaincode", ProxyChaincode, ProxyFabric)
-
-		r.Any("/chain", ProxyFabric)
-		r.Any("/chain/**", ProxyFabric)
-		r.Any("/devops/**", ProxyFabric)
-		r.Any("/registrar/**", ProxyFabric)
-		r.Any("/transactions/**", ProxyFabric)
-		r.Any("/network/**", ProxyFabric)
-	})
+	m.Any(SOCKETIO_PREFIX, RouteMW, evt.ServeHTTP)
+	m.Group(API_PREFIX, apiRoutes, RouteMW, RateLimit(RateDefault))
 
 	server := &http.Server{
 		Handler:  m,
@@ -236,8 +156,188 @@ func Serve(d *daepkg.Daemon) error {
 		ErrorLog: stdlog.New(os.Stderr, "", 0),
 	}
 
+	// drain the in-flight requests at exit.
+	d.OnShutdown(server.Shutdown)
+
 	log.Info("server is starting on ", listenAddr)
-	return server.ListenAndServe()
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// apiRoutes are the routes under API_PREFIX, every one of them is in openapi.json.
+func apiRoutes(r martini.Router) {
+	/// no auth
+	r.Post("/signup/:vtype", RateLimit(RateCaptcha), RegVerificationType)
+	r.Post("/signup", RateLimit(RateAuth), Registry)
+	r.Post("/account/login", RateLimit(RateAuth), Login)
+	r.Post("/account/recover", RateLimit(RateAuth), RecoverAccount)
+
+	/// need user auth
+	r.Group("", func(r martini.Router) {
+		// any role.
+		r.Get("/account", GetAccountState)
+		r.Get("/account/setting", GetAccountSetting)
+		r.Patch("/account/setting", UpdateAccountSetting)
+		r.Delete("/account/logout", Logout)
+		r.Get("/account/sessions", ListSessions)
+		r.Delete("/account/sessions", RevokeSessions)
+		r.Delete("/account/sessions/:id", RevokeSession)
+
+		r.Post("/cc/deploy", Require(PermChaincode), DeployCC)
+		r.Post("/cc/invoke", Require(PermChaincode), InvokeCC)
+		r.Post("/cc/query", Require(PermRead), QueryCC)
+
+		r.Get("/chaincode", Require(PermRead), ListChaincodes)
+		r.Get("/chaincode/:alias", Require(PermRead), GetChaincode)
+		r.Put("/chaincode/:alias", Require(PermChaincode), RegisterChaincode)
+		r.Delete("/chaincode/:alias", Require(PermChaincode), RemoveChaincode)
+		r.Post("/chaincode/:alias/deploy", Require(PermChaincode), DeployChaincode)
+		r.Post("/chaincode/:alias/upgrade", Require(PermChaincode), UpgradeChaincode)
+
+		/// the local admin only
+		r.Group("", func(r martini.Router) {
+			r.Patch("/peer/start", StartPeer)
+			r.Patch("/peer/stop", StopPeer)
+			r.Patch("/peer/restart", RestartPeer)
+
+			r.Get("/users", ListMembers)
+			r.Patch("/users/:id", SetMemberRole)
+			r.Get("/users/quota", ListStorageQuotas)
+			r.Put("/users/:id/quota", SetStorageQuota)
+		}, Require(PermAdmin))
+
+		/// proxy fo fabirc
+		r.Post("/chaincode", Require(PermChaincode), ProxyChaincode, ProxyFabric)
+
+		r.Get("/chain", Require(PermRead), ProxyFabric)
+		r.Get("/chain/**", Require(PermRead), ProxyFabric)
+		r.Get("/transactions/**", Require(PermRead), ProxyFabric)
+		r.Get("/network/**", Require(PermRead), ProxyFabric)
+		r.Any("/devops/**", Require(PermAdmin), ProxyFabric)
+		r.Any("/registrar/**", Require(PermAdmin), ProxyFabric)
+	}, AuthMW)
+
+	/// read for GET, write for the others
+	r.Group("", func(r martini.Router) {
+		r.Group("/account", func(r martini.Router) {
+			// local contacts
+			r.Get("/contacts", ListContacts)
+			r.Post("/contacts", AddContacts)
+			r.Get("/contacts/tags", ListContactTags)
+			r.Post("/contacts/import", ImportContacts)
+			r.Get("/contacts/export", ExportContacts)
+			r.Patch("/contacts/:id", UpdateContacts)
+			r.Delete("/contacts", RemoveAllContacts)
+			r.Delete("/contacts/:id", RemoveContacts)
+			r.Post("/contacts/:id/verify", VerifyContact)
+		})
+
+		// hd wallet
+		r.Group("/wallet", func(r martini.Router) {
+			r.Get("/accounts", ListWalletAccounts)
+			r.Post("/accounts", NewWalletAccount)
+			r.Get("/addresses", ListWalletAddresses)
+			r.Post("/addresses", NewWalletAddress)
+			r.Patch("/addresses/:addr", LabelWalletAddress)
+			r.Get("/addresses/:addr/pubkey", GetWalletPubKey)
+			r.Get("/multisig", ListWalletMultisigs)
+			r.Post("/multisig", NewWalletMultisig)
+			r.Post("/scan", DeployLepuscoinMW, ScanWallet)
+			r.Get("/balance", DeployLepuscoinMW, GetWalletBalance)
+		})
+
+		// payment requests
+		r.Group("/invoice", func(r martini.Router) {
+			r.Get("", ListInvoices)
+			r.Post("", NewInvoice)
+			r.Post("/decode", DecodeInvoice)
+			r.Post("/pay", DeployLepuscoinMW, PayInvoice)
+			r.Get("/:id", GetInvoice)
+		})
+
+		r.Group("/device", func(r martini.Router) {
+			r.Get("", ListDevices)
+			r.Post("/captcha", RateLimit(RateCaptcha), AcquireDeviceCaptcha)
+			r.Post("/bind", BindDevice)
+			r.Post("/verify", VerifyDevice)
+			r.Patch("/:id", LabelDevice)
+			r.Delete("/:id", UnbindDevice)
+			r.Post("/tx", NewTx)
+			r.Get("/coinbase_tx/:addr", GetCoinBaseTx)
+		})
+
+		/// need deploy lepuscoin chaincode.
+		r.Group("/lepuscoin", func(r martini.Router) {
+			r.Post("/tx", NewTx)
+			r.Post("/deploy", Require(PermChaincode), DeployLepuscoin)
+			r.Post("/coinbase", RateLimit(RateCoinbase), DoCoinbase)
+			r.Get("/issuance", ListIssuance)
+			r.Get("/issuance/policy", GetIssuancePolicy)
+			r.Post("/transfer", Transfer)
+			r.Post("/transfer/dryrun", DryRunTransfer)
+			r.Post("/timelock", TimeLockTransfer)
+			r.Post("/multisig/spend", SpendMultisig)
+			r.Get("/psbt", ListPSBTs)
+			r.Post("/psbt", ImportPSBT)
+			r.Get("/psbt/:hash", GetPSBT)
+			r.Post("/psbt/:hash/sign", SignPSBT)
+			r.Post("/psbt/:hash/submit", SubmitPSBT)
+			r.Get("/balance", QueryAddrs)
+			r.Get("/coin", QueryCoin)
+			r.Get("/tx/:tx", QueryTx)
+			r.Get("/history", ListHistory)
+			r.Get("/history/:hash", GetHistoryTx)
+		}, DeployLepuscoinMW)
+
+		/// name service
+		r.Group("/lottery", func(r martini.Router) {
+			r.Get("/next", GetNextLottery)
+			r.Get("/tickets", ListLotteryTickets)
+			r.Post("/tickets", SendLotteryTicket)
+			r.Get("/tickets/:id", GetLotteryTicket)
+			r.Post("/tickets/:id/check", CheckLotteryTicket)
+		})
+
+		r.Group("/namesrv", func(r martini.Router) {
+			r.Post("/deploy", Require(PermChaincode), DeployNameService)
+			r.Post("/new", NewNameServiceKV)
+			r.Get("/:key", ResolveNameServiceKV)
+			r.Delete("/:key", RemoveNameServiceKV)
+		}, DeployNameSrvnMW)
+
+		/// proof of existence
+		r.Group("/poe", func(r martini.Router) {
+			r.Get("", ListProofs)
+			r.Post("", DeployPoeMW, RegisterProof)
+			r.Post("/verify", VerifyProofReceipt)
+			r.Get("/:hash", GetProof)
+			r.Get("/:hash/receipt", GetProofReceipt)
+		})
+
+		/// file indexer
+		r.Group("/indexer", func(r martini.Router) {
+			r.Post("/online/:device_id", VerifyDeviceMW, OnlineDevice)
+			r.Post("/offline/:device_id", OfflineDevice)
+			r.Post("/files/:device_id", VerifyDeviceMW, SetFileIndex)
+			r.Get("/address/:file_id", GetFileAddr)
+		}, SetIndexerDBMW)
+
+		// filesystem
+		r.Group("/fs", func(r martini.Router) {
+			r.Get("/ls/**", GetFileList)
+			r.Get("/cat/**", GetFile)
+			r.Put("/new/**", RateLimit(RateUpload), UploadFile)
+			r.Post("/mkdir/**", NewDir)
+			r.Patch("/rename/**", RenameFile)
+			r.Delete("/rm/**", RemoveFile)
+			r.Get("/quota", GetStorageQuota)
+		}, SetFsDriverMW)
+	}, AuthMW, MethodPermMW)
+
+	r.Get("/metrics", GetMetrics)
+	r.Get("/openapi.json", GetOpenAPI)
 }
 
 func NewMartini() *martini.ClassicMartini {
@@ -251,6 +351,11 @@ func NewMartini() *martini.ClassicMartini {
 }
 
 func requextCtx(w http.ResponseWriter, req *http.Request, mc martini.Context, rnd render.Render, evt *EventHandler) {
+	// the gateways pass the id to the upstreams.
+	id := requestID(req.Header.Get("X-Request-Id"))
+	req.Header.Set("X-Request-Id", id)
+	w.Header().Set("X-Request-Id", id)
+
 	ctx := &RequestContext{
 		res:    w,
 		req:    req,
@@ -259,6 +364,9 @@ func requextCtx(w http.ResponseWriter, req *http.Request, mc martini.Context, rn
 		evt:    evt,
 		db:     daemon.GetDB(),
 		params: make(map[string]string),
+
+		requestID: id,
+		log:       reqLog(id),
 	}
 
 	req.ParseForm()
@@ -268,7 +376,7 @@ func requextCtx(w http.ResponseWriter, req *http.Request, mc martini.Context, rn
 		}
 	}
 
-	log.Debugf("[%s] %s", req.Method, req.URL.String())
+	ctx.log.Debugf("%s %s", req.Method, req.URL.String())
 
 	mc.Map(ctx)
 	mc.Next()
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/account"
+	"github.com/martini-contrib/cors"
+	"github.com/spf13/viper"
+)
+
+// Permission is what a role is allowed to do by the api.
+type Permission string
+
+const (
+	// query the data of the login user and the chain.
+	PermRead Permission = "read"
+	// change the data of the login user, send transactions.
+	PermWrite Permission = "write"
+	// deploy, invoke and register chaincodes.
+	PermChaincode Permission = "chaincode"
+	// control the peer, proxy the fabric api and manage the roles of the accounts.
+	PermAdmin Permission = "admin"
+)
+
+var rolePerms = map[string][]Permission{
+	account.RoleViewer:     {PermRead},
+	account.RoleOwner:      {PermRead, PermWrite, PermChaincode},
+	account.RoleLocalAdmin: {PermRead, PermWrite, PermChaincode, PermAdmin},
+}
+
+// isLoopback tells whether the request comes from this host. the forwarded headers are not trusted.
+func isLoopback(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requestRole returns the role of the user in the request, an owner is the local admin on the loopback,
+// or anywhere unless daemon.auth.adminLoopbackOnly.
+func requestRole(req *http.Request, a *account.Account) string {
+	if a.Role != account.RoleOwner {
+		return account.RoleViewer
+	}
+	if isLoopback(req) || !viper.GetBool("daemon.auth.adminLoopbackOnly") {
+		return account.RoleLocalAdmin
+	}
+	return account.RoleOwner
+}
+
+// can tells whether the role of the request has perm.
+func (ctx *RequestContext) can(perm Permission) bool {
+	for _, p := range rolePerms[ctx.role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// require answers 403 and returns false unless the role of the request has perm.
+func (ctx *RequestContext) require(perm Permission) bool {
+	if ctx.can(perm) {
+		return true
+	}
+	if perm == PermAdmin && ctx.role == account.RoleOwner {
+		ctx.Error(403, fmt.Errorf("%s permission is required", perm), "admin api is served on the loopback only")
+		return false
+	}
+	ctx.Error(403, fmt.Errorf("%s permission is required, role is %s", perm, ctx.role))
+	return false
+}
+
+// Require answers 403 unless the role of the request has perm, used after AuthMW.
+func Require(perm Permission) martini.Handler {
+	return func(ctx *RequestContext) {
+		ctx.require(perm)
+	}
+}
+
+// MethodPermMW requires read permission for GET and HEAD, and write permission for the others.
+func MethodPermMW(ctx *RequestContext) {
+	switch ctx.req.Method {
+	case "GET", "HEAD":
+		ctx.require(PermRead)
+	default:
+		ctx.require(PermWrite)
+	}
+}
+
+// corsOptions returns the CORS of daemon.cors.allowOrigins, nil if it is empty, then only the same
+// origin is allowed. the credentials are not allowed with the origin *.
+func corsOptions() *cors.Options {
+	origins := viper.GetStringSlice("daemon.cors.allowOrigins")
+	if len(origins) == 0 {
+		return nil
+	}
+
+	credentials := viper.GetBool("daemon.cors.allowCredentials")
+	for _, o := range origins {
+		if o == "*" {
+			credentials = false
+		}
+	}
+	return &cors.Options{
+		AllowOrigins:     origins,
+		AllowMethods:     []string{"GET", "PATCH", "POST", "DELETE", "PUT"},
+		AllowHeaders:     []string{"Limt", "Offset", "Content-Type", "Origin", "Accept", "Authorization"},
+		ExposeHeaders:    []string{"Record-Count", "Limt", "Offset", "Content-Type"},
+		AllowCredentials: credentials,
+		MaxAge:           time.Second * 864000,
+	}
+}
+
+// GET /users, the accounts of the farmer.
+func ListMembers(ctx *RequestContext) {
+	ms, err := account.ListMembers(ctx.db)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, ms)
+}
+
+// PATCH /users/:id {"role": "owner|viewer"}
+func SetMemberRole(ctx *RequestContext, params martini.Params) {
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(ctx.req.Body).Decode(&body); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	err := account.SetRole(ctx.db, params["id"], body.Role)
+	if err == sql.ErrNoRows {
+		ctx.Error(404, fmt.Errorf("not found account %s", params["id"]))
+		return
+	}
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	ctx.rnd.JSON(200, map[string]string{"id": params["id"], "role": body.Role})
+}
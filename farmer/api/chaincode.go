@@ -1,24 +1,91 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/registry"
 	ccpkg "github.com/hyperledger/fabric/peer/chaincode"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultChaincodePollInterval  = 2 * time.Second
+	defaultChaincodeDeployTimeout = 5 * time.Minute
+	defaultChaincodeWaitTimeout   = 30 * time.Second
 )
 
 var (
 	ErrNotFound  = errors.New("not found chaincode.")
 	ErrNotDeploy = errors.New("not deploy chaincode.")
+
+	errNoRegistry    = errors.New("chaincode registry is not loaded")
+	errAliasDeployed = errors.New("the alias is deployed, upgrade it to change the path")
+	errDeploying     = errors.New("the alias is deploying")
+
+	// errors of querying a chaincode which is not running yet, the others come from the running chaincode.
+	notRunningErrors = []string{
+		"Failed to launch",
+		"deployment transaction does not exist",
+		"Timeout expired",
+		"Cannot execute transaction or query",
+		"Error trying to connect",
+		"grpc:",
+	}
 )
 
+// default chaincodes registered at the first start.
+var defaultChaincodes = []*registry.Chaincode{
+	{Alias: "lepuscoin", Path: "github.com/conseweb/common/assets/lepuscoin", Function: "deploy"},
+	{Alias: "poe", Path: "github.com/conseweb/common/assets/poe", Function: "deploy"},
+	{Alias: "nameservice", Path: "github.com/conseweb/common/assets/nameservice", Function: "deploy"},
+}
+
+// chaincodeManager keeps the chaincode registry of farmer.db in memory, and follows the deploying.
 type chaincodeManager struct {
 	sync.Mutex
-	ccs map[string]*ccpkg.ChaincodeWrapper
+	db  *sql.DB
+	evt *EventHandler
+	ccs map[string]*registry.Chaincode
+	// closed when the deploy of the alias is ready or failed.
+	waits map[string]chan struct{}
+}
+
+// Load registers the default chaincodes, loads the registry, and resumes following the deploying.
+// the changes of deploy status are broadcast by evt.
+func (c *chaincodeManager) Load(db *sql.DB, evt *EventHandler) error {
+	for _, cc := range defaultChaincodes {
+		cp := *cc
+		if err := registry.Ensure(db, &cp); err != nil {
+			return err
+		}
+	}
+	ccs, err := registry.List(db)
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.db, c.evt = db, evt
+	c.ccs = map[string]*registry.Chaincode{}
+	c.waits = map[string]chan struct{}{}
+	for _, cc := range ccs {
+		c.ccs[cc.Alias] = cc
+		if cc.Status == registry.StatusPending {
+			c.waits[cc.Alias] = make(chan struct{})
+			go c.poll(*cc, time.Unix(cc.Deployed, 0))
+		}
+	}
+	return nil
 }
 
 // args[...] 0=method, 1=funtion >2=args...
@@ -28,13 +95,16 @@ func (c *chaincodeManager) Get(key string, args ...string) (*ccpkg.ChaincodeWrap
 
 	cc, ok := c.ccs[key]
 	if !ok {
-		return nil, fmt.Errorf("chaincode %s, %v", key, ErrNotFound)
+		return nil, fmt.Errorf("chaincode %s, %w", key, ErrNotFound)
 	}
 
-	var newcc ccpkg.ChaincodeWrapper = *cc
-
-	newcc.Args = []string{}
-	newcc.Attributes = []string{}
+	newcc := &ccpkg.ChaincodeWrapper{
+		Name:       cc.Name,
+		Path:       cc.Path,
+		Language:   cc.Language,
+		Args:       []string{},
+		Attributes: []string{},
+	}
 
 	l := len(args)
 	log.Debugf("args %+v, length: %v", args, l)
@@ -49,29 +119,357 @@ func (c *chaincodeManager) Get(key string, args ...string) (*ccpkg.ChaincodeWrap
 		newcc.Args = args[2:]
 	}
 
-	if newcc.Name == "" {
-		return &newcc, ErrNotDeploy
+	if cc.Status != registry.StatusReady {
+		return newcc, ErrNotDeploy
 	}
-	return &newcc, nil
+	return newcc, nil
 }
 
-func (c *chaincodeManager) SetName(key, name string) {
+// Lookup returns a copy of the registered alias.
+func (c *chaincodeManager) Lookup(alias string) (*registry.Chaincode, bool) {
 	c.Lock()
 	defer c.Unlock()
 
-	cc, ok := c.ccs[key]
+	cc, ok := c.ccs[alias]
+	if !ok {
+		return nil, false
+	}
+	cp := *cc
+	return &cp, true
+}
+
+// List returns the registered chaincodes by alias.
+func (c *chaincodeManager) List() []*registry.Chaincode {
+	c.Lock()
+	defer c.Unlock()
+
+	ccs := []*registry.Chaincode{}
+	for _, cc := range c.ccs {
+		cp := *cc
+		ccs = append(ccs, &cp)
+	}
+	sort.Sort(chaincodesByAlias(ccs))
+	return ccs
+}
+
+type chaincodesByAlias []*registry.Chaincode
+
+func (s chaincodesByAlias) Len() int           { return len(s) }
+func (s chaincodesByAlias) Less(i, j int) bool { return s[i].Alias < s[j].Alias }
+func (s chaincodesByAlias) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Register registers cc, or updates the registered alias. the path of a deployed alias is changed by Upgrade only.
+func (c *chaincodeManager) Register(cc *registry.Chaincode) (*registry.Chaincode, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.db == nil {
+		return nil, errNoRegistry
+	}
+	saved := &registry.Chaincode{}
+	if old, ok := c.ccs[cc.Alias]; ok {
+		*saved = *old
+		if old.Status != registry.StatusRegistered && old.Status != registry.StatusFailed && cc.Path != old.Path {
+			return nil, errAliasDeployed
+		}
+	}
+	saved.Alias, saved.Path, saved.Version, saved.Language = cc.Alias, cc.Path, cc.Version, cc.Language
+	saved.Function, saved.Args = cc.Function, cc.Args
+	if err := registry.Save(c.db, saved); err != nil {
+		return nil, err
+	}
+	c.ccs[saved.Alias] = saved
+	cp := *saved
+	return &cp, nil
+}
+
+// Remove unregisters alias, the deployed chaincode is kept in the peer.
+func (c *chaincodeManager) Remove(alias string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.db == nil {
+		return errNoRegistry
+	}
+	if err := registry.Remove(c.db, alias); err != nil {
+		return err
+	}
+	delete(c.ccs, alias)
+	c.done(alias)
+	return nil
+}
+
+// Deploy deploys the registered alias and follows its deploy tx until it is committed. an alias
+// being deployed or ready is deployed again only to upgrade it by the non-empty fields of up,
+// which are saved once deployed.
+func (c *chaincodeManager) Deploy(alias string, up *registry.Chaincode) (*registry.Chaincode, error) {
+	c.Lock()
+	if c.db == nil {
+		c.Unlock()
+		return nil, errNoRegistry
+	}
+	cc, ok := c.ccs[alias]
+	if !ok {
+		c.Unlock()
+		return nil, fmt.Errorf("chaincode %s, %w", alias, ErrNotFound)
+	}
+	if cc.Status == registry.StatusPending {
+		c.Unlock()
+		if up != nil {
+			return nil, errDeploying
+		}
+		cc, _ := c.Lookup(alias)
+		return cc, nil
+	}
+	if cc.Status == registry.StatusReady && up == nil {
+		cp := *cc
+		c.Unlock()
+		return &cp, nil
+	}
+	prev := *cc
+	next := *cc
+	if up != nil {
+		upgrade(&next, up)
+	}
+	cc.Status, cc.Error = registry.StatusPending, ""
+	c.waits[alias] = make(chan struct{})
+	c.broadcast(cc)
+	c.Unlock()
+
+	cw := &ccpkg.ChaincodeWrapper{
+		Path:     next.Path,
+		Language: next.Language,
+		Method:   "deploy",
+		Function: next.Function,
+		Args:     next.Args,
+	}
+	height, name, err := deployChaincode(cw)
+
+	c.Lock()
+	defer c.Unlock()
+	cc, ok = c.ccs[alias]
 	if !ok {
-		c.ccs[key] = &ccpkg.ChaincodeWrapper{Name: name}
+		return nil, fmt.Errorf("chaincode %s, %w", alias, ErrNotFound)
+	}
+	if err != nil {
+		// a failed upgrade keeps the deployed chaincode ready, the error is kept for the caller.
+		cc.Status, cc.Error = registry.StatusFailed, err.Error()
+		if prev.Status == registry.StatusReady {
+			cc.Status = registry.StatusReady
+		}
+		log.Errorf("deploy chaincode %s failed, %s", alias, err)
+		registry.Save(c.db, cc)
+		c.broadcast(cc)
+		c.done(alias)
+		return nil, err
 	}
+	log.Debugf("deploy chaincode %s: %s", alias, name)
 
-	cc.Name = name
+	*cc = next
+	// same path and args deploy the same chaincode again.
+	if prev.Status == registry.StatusReady && name == prev.Name {
+		c.done(alias)
+	} else {
+		cc.Name, cc.Txid, cc.Block, cc.Status, cc.Error = name, name, 0, registry.StatusPending, ""
+		cc.DeployHeight, cc.Deployed, cc.Ready = height, time.Now().Unix(), 0
+		go c.poll(*cc, time.Now())
+	}
+	if err := registry.Save(c.db, cc); err != nil {
+		return nil, err
+	}
+	c.broadcast(cc)
+	cp := *cc
+	return &cp, nil
+}
+
+// upgrade sets the non-empty fields of up to cc.
+func upgrade(cc, up *registry.Chaincode) {
+	if up.Path != "" {
+		cc.Path = up.Path
+	}
+	if up.Version != "" {
+		cc.Version = up.Version
+	}
+	if up.Language != "" {
+		cc.Language = up.Language
+	}
+	if up.Function != "" {
+		cc.Function = up.Function
+	}
+	if up.Args != nil {
+		cc.Args = up.Args
+	}
 }
 
-func (c *chaincodeManager) Set(key string, cc *ccpkg.ChaincodeWrapper) {
+// Track registers cc, which is deployed since the height, and follows its deploy tx.
+func (c *chaincodeManager) Track(cc *registry.Chaincode, height uint64) error {
 	c.Lock()
 	defer c.Unlock()
 
-	c.ccs[key] = cc
+	if c.db == nil {
+		return errNoRegistry
+	}
+	if old, ok := c.ccs[cc.Alias]; ok && old.Name == cc.Name && old.Status != registry.StatusFailed {
+		return nil
+	}
+	cc.Status, cc.Txid, cc.DeployHeight, cc.Deployed = registry.StatusPending, cc.Name, height, time.Now().Unix()
+	if err := registry.Save(c.db, cc); err != nil {
+		return err
+	}
+	c.ccs[cc.Alias] = cc
+	c.done(cc.Alias)
+	c.waits[cc.Alias] = make(chan struct{})
+	c.broadcast(cc)
+	go c.poll(*cc, time.Now())
+	return nil
+}
+
+// deployChaincode deploys cw, returns the blockchain height before the deploy and the chaincode name.
+func deployChaincode(cw *ccpkg.ChaincodeWrapper) (uint64, string, error) {
+	var height uint64
+	if src, err := peerSource(); err == nil {
+		height, _ = src.Height()
+	}
+	name, err := cw.Deploy()
+	if err != nil {
+		return 0, "", err
+	}
+	if name == "" {
+		return 0, "", fmt.Errorf("chaincode %s deployed without name", cw.Path)
+	}
+	return height, name, nil
+}
+
+// poll follows the deploy of cc every farmer.chaincode.pollInterval. it looks up the block which
+// commits the deploy tx, then probes the chaincode by a query until it answers. the alias is ready
+// once answered, or failed if not in farmer.chaincode.deployTimeout since deployed.
+func (c *chaincodeManager) poll(cc registry.Chaincode, deployed time.Time) {
+	interval := viper.GetDuration("farmer.chaincode.pollInterval")
+	if interval <= 0 {
+		interval = defaultChaincodePollInterval
+	}
+	timeout := viper.GetDuration("farmer.chaincode.deployTimeout")
+	if timeout <= 0 {
+		timeout = defaultChaincodeDeployTimeout
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	from := cc.DeployHeight
+	reason := fmt.Sprintf("deploy tx %s not committed in %s", cc.Txid, timeout)
+	for range ticker.C {
+		if cc.Block == 0 {
+			src, err := peerSource()
+			if err != nil {
+				log.Debugf("connect peer failed, %s", err)
+			} else {
+				found, next, err := registry.FindDeploy(src, cc.Txid, from)
+				if err != nil {
+					log.Debugf("look up deploy of chaincode %s failed, %s", cc.Alias, err)
+				}
+				from = next
+				if found {
+					cc.Block = next - 1
+					log.Debugf("deploy tx of chaincode %s is committed in block %d", cc.Alias, cc.Block)
+					if !c.update(&cc, "", "") {
+						return
+					}
+				}
+			}
+		}
+
+		if cc.Block > 0 {
+			err := probeChaincode(&cc)
+			if err == nil {
+				c.update(&cc, registry.StatusReady, "")
+				return
+			}
+			reason = fmt.Sprintf("chaincode does not answer in %s, %s", timeout, err)
+		}
+
+		if time.Since(deployed) > timeout {
+			c.update(&cc, registry.StatusFailed, reason)
+			return
+		}
+	}
+}
+
+// probeChaincode queries the chaincode, it is running if answered, even by an error of itself.
+func probeChaincode(cc *registry.Chaincode) error {
+	cw := &ccpkg.ChaincodeWrapper{Name: cc.Name, Path: cc.Path, Language: cc.Language}
+	_, err := cw.Query()
+	if err == nil {
+		return nil
+	}
+	for _, e := range notRunningErrors {
+		if strings.Contains(err.Error(), e) {
+			return err
+		}
+	}
+	return nil
+}
+
+// update saves the block and the status of the deploy followed by poll, an empty status is kept.
+// tells false if the alias is removed or deployed again.
+func (c *chaincodeManager) update(polled *registry.Chaincode, status, reason string) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	cc, ok := c.ccs[polled.Alias]
+	if !ok || cc.Txid != polled.Txid || cc.Status != registry.StatusPending {
+		return false
+	}
+
+	cc.Block = polled.Block
+	if status != "" {
+		cc.Status, cc.Error = status, reason
+	}
+	switch cc.Status {
+	case registry.StatusReady:
+		cc.Ready = time.Now().Unix()
+		log.Infof("chaincode %s is ready: %s", cc.Alias, cc.Name)
+	case registry.StatusFailed:
+		log.Errorf("deploy chaincode %s failed, %s", cc.Alias, reason)
+	}
+	registry.Save(c.db, cc)
+	c.broadcast(cc)
+	if status != "" {
+		c.done(cc.Alias)
+	}
+	return true
+}
+
+// broadcast notifies the deploy status of cc, must be locked.
+func (c *chaincodeManager) broadcast(cc *registry.Chaincode) {
+	if c.evt == nil {
+		return
+	}
+	cp := *cc
+	c.evt.Broadcast(map[string]interface{}{"chaincode": &cp})
+}
+
+// done wakes up the waiting of alias, must be locked.
+func (c *chaincodeManager) done(alias string) {
+	if ch, ok := c.waits[alias]; ok {
+		close(ch)
+		delete(c.waits, alias)
+	}
+}
+
+// WaitReady waits the deploy of alias at most timeout, returns the chaincode at last.
+func (c *chaincodeManager) WaitReady(alias string, timeout time.Duration) (*registry.Chaincode, bool) {
+	c.Lock()
+	ch := c.waits[alias]
+	c.Unlock()
+
+	if ch != nil && timeout > 0 {
+		select {
+		case <-ch:
+		case <-time.After(timeout):
+		}
+	}
+	return c.Lookup(alias)
 }
 
 /// POST /cc/deploy?alisa=xxx
@@ -83,20 +481,47 @@ func DeployCC(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
 		return
 	}
 
-	ret, err := cw.Deploy()
-	if err != nil {
-		ctx.Error(400, err)
+	alias := ctx.params["alisa"]
+	if alias == "" {
+		// without alias, the chaincode is registered by its name.
+		height, name, err := deployChaincode(cw)
+		if err != nil {
+			ctx.Error(400, err)
+			return
+		}
+		err = ccManager.Track(&registry.Chaincode{
+			Alias:    name,
+			Path:     cw.Path,
+			Name:     name,
+			Language: cw.Language,
+			Function: cw.Function,
+			Args:     cw.Args,
+		}, height)
+		if err != nil {
+			ctx.Error(500, err)
+			return
+		}
+		ctx.rnd.JSON(201, map[string]interface{}{"message": name})
 		return
 	}
 
-	name := ctx.params["alisa"]
-	if name == "" {
-		name = ret
+	if _, err := ccManager.Register(&registry.Chaincode{
+		Alias:    alias,
+		Path:     cw.Path,
+		Language: cw.Language,
+		Function: cw.Function,
+		Args:     cw.Args,
+	}); err != nil {
+		ctx.Error(registryErrStatus(err), err)
+		return
+	}
+	cc, err := ccManager.Deploy(alias, nil)
+	if err != nil {
+		ctx.Error(400, err)
+		return
 	}
 
-	ccManager.Set(name, cw)
-
-	ctx.rnd.JSON(201, map[string]interface{}{"message": string(ret)})
+	ctx.rnd.JSON(201, map[string]interface{}{"message": cc.Name})
 }
 
 func InvokeCC(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
@@ -106,6 +531,9 @@ func InvokeCC(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
 		ctx.Error(400, err)
 		return
 	}
+	if refuseCoinbase(ctx, cw) {
+		return
+	}
 
 	ret, err := cw.Invoke()
 	if err != nil {
@@ -133,18 +561,112 @@ func QueryCC(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
 	ctx.rnd.JSON(200, map[string]interface{}{"message": string(ret)})
 }
 
+// GET /chaincode
 func ListChaincodes(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-	ctx.rnd.JSON(200, ccManager.ccs)
+	ctx.rnd.JSON(200, ccManager.List())
 }
 
+// GET /chaincode/:alias?wait=10s
+// the status is registered, pending, ready or failed with the error. a pending one is waited at most wait.
 func GetChaincode(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, params martini.Params) {
-	alias := params["alias"]
+	var wait time.Duration
+	if s := ctx.params["wait"]; s != "" {
+		var err error
+		if wait, err = time.ParseDuration(s); err != nil {
+			ctx.Error(400, err)
+			return
+		}
+		if max := viper.GetDuration("farmer.chaincode.waitTimeout"); max > 0 && wait > max {
+			wait = max
+		}
+	}
 
-	cc, err := ccManager.Get(alias)
-	if err == ErrNotFound {
+	cc, ok := ccManager.WaitReady(params["alias"], wait)
+	if !ok {
 		ctx.Error(404, fmt.Errorf("not found"))
 		return
 	}
 
 	ctx.rnd.JSON(200, cc)
 }
+
+// PUT /chaincode/:alias
+// {
+// 	"path": "github.com/conseweb/common/assets/lepuscoin",
+// 	"version": "v1",
+// 	"language": "GOLANG",
+// 	"function": "deploy",
+// 	"args": []
+// }
+func RegisterChaincode(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, params martini.Params) {
+	cc := &registry.Chaincode{}
+	if err := json.NewDecoder(ctx.req.Body).Decode(cc); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	cc.Alias = params["alias"]
+	if cc.Path == "" {
+		ctx.Error(400, "path is required.")
+		return
+	}
+
+	saved, err := ccManager.Register(cc)
+	if err != nil {
+		ctx.Error(registryErrStatus(err), err)
+		return
+	}
+	ctx.rnd.JSON(200, saved)
+}
+
+// POST /chaincode/:alias/deploy
+func DeployChaincode(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, params martini.Params) {
+	cc, err := ccManager.Deploy(params["alias"], nil)
+	if err != nil {
+		ctx.Error(registryErrStatus(err), err)
+		return
+	}
+	ctx.rnd.JSON(202, cc)
+}
+
+// POST /chaincode/:alias/upgrade, the empty fields are kept.
+// {
+// 	"path": "github.com/conseweb/common/assets/lepuscoin",
+// 	"version": "v2",
+// 	"function": "deploy",
+// 	"args": []
+// }
+func UpgradeChaincode(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, params martini.Params) {
+	up := &registry.Chaincode{}
+	if err := json.NewDecoder(ctx.req.Body).Decode(up); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	cc, err := ccManager.Deploy(params["alias"], up)
+	if err != nil {
+		ctx.Error(registryErrStatus(err), err)
+		return
+	}
+	ctx.rnd.JSON(202, cc)
+}
+
+// DELETE /chaincode/:alias
+func RemoveChaincode(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, params martini.Params) {
+	if err := ccManager.Remove(params["alias"]); err != nil {
+		ctx.Error(registryErrStatus(err), err)
+		return
+	}
+	ctx.Message(200, "successful")
+}
+
+func registryErrStatus(err error) int {
+	switch {
+	case errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrNotFound):
+		return 404
+	case err == errAliasDeployed || err == errDeploying:
+		return 409
+	case err == errNoRegistry:
+		return 503
+	}
+	return 500
+}
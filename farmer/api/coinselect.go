@@ -0,0 +1,228 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultCoinSelection = "bnb"
+	defaultDustLimit     = 10
+
+	// branch and bound gives up after so many tries.
+	bnbMaxTries = 100000
+)
+
+// coinSelector picks utxos whose balance covers target, dust is the change not worth an output.
+type coinSelector func(utxos []txIn, target, dust uint64) ([]txIn, error)
+
+var coinSelectors = map[string]coinSelector{
+	"largest-first":       selectLargestFirst,
+	"smallest-sufficient": selectSmallestSufficient,
+	"bnb":                 selectBranchAndBound,
+}
+
+// transferPlan is the exact inputs and outputs of a transfer.
+type transferPlan struct {
+	Strategy string  `json:"strategy"`
+	In       []txIn  `json:"in"`
+	Out      []txOut `json:"out"`
+	Fee      uint64  `json:"fee"`
+	Change   uint64  `json:"change"`
+}
+
+func (p *transferPlan) tx() *txWrapper {
+	return &txWrapper{In: p.In, Out: p.Out}
+}
+
+func dustLimit() uint64 {
+	if viper.IsSet("farmer.lepuscoin.dustLimit") {
+		return uint64(viper.GetInt("farmer.lepuscoin.dustLimit"))
+	}
+	return defaultDustLimit
+}
+
+var errAmountOverflow = errors.New("the sum of the amounts and the fee overflows")
+
+// planTransfer selects the inputs of tranf from utxos, and appends the fee and change outputs.
+func planTransfer(tranf *txWrapper, utxos []txIn) (*transferPlan, error) {
+	strategy := tranf.Strategy
+	if strategy == "" {
+		strategy = viper.GetString("farmer.lepuscoin.coinSelection")
+	}
+	if strategy == "" {
+		strategy = defaultCoinSelection
+	}
+	selector, ok := coinSelectors[strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown coin selection strategy %s", strategy)
+	}
+
+	dust := dustLimit()
+	feeAddr := viper.GetString("farmer.lepuscoin.feeAddr")
+	if tranf.Fee > 0 && feeAddr == "" {
+		return nil, fmt.Errorf("fee is not accepted, farmer.lepuscoin.feeAddr is not set")
+	}
+
+	var target uint64
+	now := time.Now().Unix()
+	for _, out := range tranf.Out {
+		if out.Amount < dust {
+			return nil, fmt.Errorf("amount %d to %s is below the dust limit %d", out.Amount, out.Addr, dust)
+		}
+		// client.NewTxOut drops a past until silently.
+		if out.Until != 0 && out.Until <= now {
+			return nil, fmt.Errorf("until %d to %s is not in the future", out.Until, out.Addr)
+		}
+		if target+out.Amount < target {
+			return nil, errAmountOverflow
+		}
+		target += out.Amount
+	}
+	if target == 0 {
+		return nil, fmt.Errorf("At least one out_addr is required")
+	}
+	if target+tranf.Fee < target {
+		return nil, errAmountOverflow
+	}
+	target += tranf.Fee
+
+	in, err := selector(utxos, target, dust)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &transferPlan{
+		Strategy: strategy,
+		In:       in,
+		Out:      append([]txOut{}, tranf.Out...),
+		Fee:      tranf.Fee,
+	}
+	p.Change = sumTxIn(in) - target
+
+	// change below the dust limit goes to the fee, unless nobody takes fee.
+	if p.Change > 0 && p.Change < dust && feeAddr != "" {
+		p.Fee += p.Change
+		p.Change = 0
+	}
+	if p.Fee > 0 {
+		p.Out = append(p.Out, txOut{Addr: feeAddr, Amount: p.Fee})
+	}
+	if p.Change > 0 {
+		charge := tranf.ChargeAddr
+		if charge == "" {
+			charge = in[0].Addr
+		}
+		p.Out = append(p.Out, txOut{Addr: charge, Amount: p.Change})
+	}
+	return p, nil
+}
+
+func sumTxIn(in []txIn) uint64 {
+	var sum uint64
+	for _, v := range in {
+		sum += v.Balance
+	}
+	return sum
+}
+
+type txInsByBalance []txIn
+
+func (s txInsByBalance) Len() int           { return len(s) }
+func (s txInsByBalance) Less(i, j int) bool { return s[i].Balance < s[j].Balance }
+func (s txInsByBalance) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func sortedTxIn(utxos []txIn, desc bool) []txIn {
+	sorted := append([]txIn{}, utxos...)
+	if desc {
+		sort.Stable(sort.Reverse(txInsByBalance(sorted)))
+	} else {
+		sort.Stable(txInsByBalance(sorted))
+	}
+	return sorted
+}
+
+func insufficient(utxos []txIn, target uint64) error {
+	return fmt.Errorf("Insufficient balance, %d available, %d required", sumTxIn(utxos), target)
+}
+
+// selectLargestFirst spends the largest utxos until target is covered.
+func selectLargestFirst(utxos []txIn, target, dust uint64) ([]txIn, error) {
+	var (
+		sum uint64
+		ret []txIn
+	)
+	for _, in := range sortedTxIn(utxos, true) {
+		ret = append(ret, in)
+		sum += in.Balance
+		if sum >= target {
+			return ret, nil
+		}
+	}
+	return nil, insufficient(utxos, target)
+}
+
+// selectSmallestSufficient spends the smallest single utxo which covers target,
+// or falls back to largest-first if none does.
+func selectSmallestSufficient(utxos []txIn, target, dust uint64) ([]txIn, error) {
+	for _, in := range sortedTxIn(utxos, false) {
+		if in.Balance >= target {
+			return []txIn{in}, nil
+		}
+	}
+	return selectLargestFirst(utxos, target, dust)
+}
+
+// selectBranchAndBound searches the utxos whose sum is in [target, target+dust),
+// so that no change output is needed, or falls back to largest-first.
+func selectBranchAndBound(utxos []txIn, target, dust uint64) ([]txIn, error) {
+	sorted := sortedTxIn(utxos, true)
+
+	// rest[i] is the sum of sorted[i:], for pruning the branches which can not reach target.
+	rest := make([]uint64, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		rest[i] = rest[i+1] + sorted[i].Balance
+	}
+
+	var (
+		tries    int
+		selected []bool
+		found    []bool
+	)
+	selected = make([]bool, len(sorted))
+
+	var search func(i int, sum uint64) bool
+	search = func(i int, sum uint64) bool {
+		tries++
+		switch {
+		case sum >= target && sum-target < dust:
+			found = append([]bool{}, selected...)
+			return true
+		case sum >= target, i >= len(sorted), sum+rest[i] < target, tries > bnbMaxTries:
+			return false
+		}
+
+		selected[i] = true
+		if search(i+1, sum+sorted[i].Balance) {
+			return true
+		}
+		selected[i] = false
+		return search(i+1, sum)
+	}
+
+	if !search(0, 0) {
+		return selectLargestFirst(utxos, target, dust)
+	}
+
+	ret := []txIn{}
+	for i, ok := range found {
+		if ok {
+			ret = append(ret, sorted[i])
+		}
+	}
+	return ret, nil
+}
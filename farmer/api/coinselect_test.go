@@ -0,0 +1,108 @@
+package api
+
+import (
+	"math"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func utxos(balances ...uint64) []txIn {
+	ret := []txIn{}
+	for i, b := range balances {
+		ret = append(ret, txIn{Addr: "a", PreTxHash: string(rune('a' + i)), TxOutIndex: "0", Balance: b})
+	}
+	return ret
+}
+
+func TestCoinSelectors(t *testing.T) {
+	us := utxos(5, 50, 20, 30, 100)
+
+	for _, c := range []struct {
+		strategy string
+		target   uint64
+		expect   []uint64
+	}{
+		{"largest-first", 120, []uint64{100, 50}},
+		{"smallest-sufficient", 25, []uint64{30}},
+		{"smallest-sufficient", 120, []uint64{100, 50}},
+		{"bnb", 55, []uint64{50, 5}},
+		{"bnb", 70, []uint64{50, 20}},
+		// nothing sums to 201-210, falls back to largest-first.
+		{"bnb", 201, []uint64{100, 50, 30, 20, 5}},
+	} {
+		in, err := coinSelectors[c.strategy](us, c.target, 10)
+		if err != nil {
+			t.Errorf("%s %d failed, %s", c.strategy, c.target, err)
+			continue
+		}
+		if len(in) != len(c.expect) {
+			t.Errorf("%s %d: expect %v, got %+v", c.strategy, c.target, c.expect, in)
+			continue
+		}
+		for i := range in {
+			if in[i].Balance != c.expect[i] {
+				t.Errorf("%s %d: expect %v, got %+v", c.strategy, c.target, c.expect, in)
+				break
+			}
+		}
+	}
+
+	if _, err := selectLargestFirst(us, 206, 10); err == nil {
+		t.Errorf("expect insufficient balance")
+	}
+}
+
+func TestPlanTransfer(t *testing.T) {
+	viper.Set("farmer.lepuscoin.feeAddr", "")
+	if _, err := planTransfer(&txWrapper{Out: []txOut{{Addr: "b", Amount: 40}}, Fee: 1}, utxos(100)); err == nil {
+		t.Errorf("expect error of fee without fee address")
+	}
+	if _, err := planTransfer(&txWrapper{Out: []txOut{{Addr: "b", Amount: 5}}}, utxos(100)); err == nil {
+		t.Errorf("expect error of dust output")
+	}
+	half := uint64(math.MaxUint64/2 + 1)
+	if _, err := planTransfer(&txWrapper{Out: []txOut{{Addr: "b", Amount: half}, {Addr: "c", Amount: half}}}, utxos(100)); err != errAmountOverflow {
+		t.Errorf("expect errAmountOverflow, got %v", err)
+	}
+
+	viper.Set("farmer.lepuscoin.feeAddr", "fee")
+	defer viper.Set("farmer.lepuscoin.feeAddr", "")
+	if _, err := planTransfer(&txWrapper{Out: []txOut{{Addr: "b", Amount: math.MaxUint64 - 10}}, Fee: 20}, utxos(100)); err != errAmountOverflow {
+		t.Errorf("expect errAmountOverflow of the fee, got %v", err)
+	}
+
+	p, err := planTransfer(&txWrapper{
+		Out:        []txOut{{Addr: "b", Amount: 40}},
+		Fee:        2,
+		ChargeAddr: "c",
+		Strategy:   "largest-first",
+	}, utxos(100, 20))
+	if err != nil {
+		t.Fatalf("plan failed, %s", err)
+	}
+	if len(p.In) != 1 || p.Fee != 2 || p.Change != 58 || len(p.Out) != 3 || p.Out[2].Addr != "c" {
+		t.Errorf("unexpected plan %+v", p)
+	}
+
+	// the change of 3 is dust, it goes to the fee.
+	p, err = planTransfer(&txWrapper{Out: []txOut{{Addr: "b", Amount: 15}}, Fee: 2}, utxos(100, 20))
+	if err != nil {
+		t.Fatalf("plan failed, %s", err)
+	}
+	if p.Strategy != "bnb" || len(p.In) != 1 || p.Fee != 5 || p.Change != 0 || len(p.Out) != 2 {
+		t.Errorf("unexpected plan %+v", p)
+	}
+
+	ptx, err := p.tx().Build()
+	if err != nil {
+		t.Fatalf("build failed, %s", err)
+	}
+	var sum uint64
+	for _, out := range ptx.Txout {
+		sum += out.Value
+	}
+	if len(ptx.Txout) != 2 || sum != 20 {
+		t.Errorf("expect outputs spending 20 exactly, got %+v", ptx.Txout)
+	}
+}
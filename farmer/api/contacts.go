@@ -0,0 +1,121 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/account"
+	"github.com/spf13/viper"
+)
+
+const defaultContactsVerifyInterval = 10 * time.Minute
+
+// ccResolver resolves linked contacts through the deployed chaincodes.
+type ccResolver struct{}
+
+var _ account.AddrResolver = ccResolver{}
+
+func (ccResolver) ResolveName(name string) (string, error) {
+	return resolveNameService(name)
+}
+
+// resolveContactOuts fills the addr of outs which are addressed by contact id of owner.
+func resolveContactOuts(db *sql.DB, owner string, outs []txOut) error {
+	for i, out := range outs {
+		if out.ContactID == 0 {
+			continue
+		}
+		if db == nil {
+			return fmt.Errorf("contacts db is not ready")
+		}
+
+		c, err := (*account.Contact).Get(nil, db, owner, out.ContactID)
+		if err != nil {
+			return fmt.Errorf("not found contact<%v>, %w", out.ContactID, err)
+		}
+		if c.AddrChanged {
+			return fmt.Errorf("address of contact<%v> changed from %s to %s, confirm it first", c.Id, c.PrevAddr, c.Addr)
+		}
+		if c.Addr == "" {
+			return fmt.Errorf("contact<%v> has no address", c.Id)
+		}
+		if out.Addr != "" && out.Addr != c.Addr {
+			return fmt.Errorf("address %s is not the address of contact<%v>", out.Addr, c.Id)
+		}
+		outs[i].Addr = c.Addr
+	}
+	return nil
+}
+
+// verifyContactsLoop re-verifies linked contacts every farmer.contacts.verifyInterval.
+func verifyContactsLoop(evt *EventHandler) {
+	interval := viper.GetDuration("farmer.contacts.verifyInterval")
+	if interval <= 0 {
+		interval = defaultContactsVerifyInterval
+	}
+	log.Debugf("verify linked contacts every %s", interval)
+
+	for range time.Tick(interval) {
+		db := daemon.GetDB()
+		if db == nil || !daemon.IsLogin() {
+			continue
+		}
+
+		changed, err := account.VerifyContacts(db, ccResolver{})
+		if err != nil {
+			log.Errorf("verify contacts failed, %s", err)
+			continue
+		}
+		if len(changed) > 0 && evt != nil {
+			evt.Broadcast(map[string]interface{}{"contacts_changed": changed})
+		}
+	}
+}
+
+// POST /account/contacts/:id/verify
+func VerifyContact(ctx *RequestContext, params martini.Params) {
+	id, err := strconv.Atoi(params["id"])
+	if err != nil {
+		ctx.Error(400, fmt.Errorf("invalied id<%v>, %s", params["id"], err))
+		return
+	}
+
+	c, err := (*account.Contact).Get(nil, ctx.db, ctx.user.ID, id)
+	if err != nil {
+		ctx.Error(404, err)
+		return
+	}
+	if !c.Linked() {
+		ctx.Error(400, fmt.Errorf("contact<%v> is not linked to a name", id))
+		return
+	}
+
+	if _, err := c.Verify(ctx.db, ccResolver{}); err != nil {
+		ctx.Error(502, err)
+		return
+	}
+
+	ctx.rnd.JSON(200, c)
+}
+
+// resolveLinkedContact sets the addr of a new or updated linked contact.
+func resolveLinkedContact(c *account.Contact) error {
+	if !c.Linked() {
+		if strings.TrimSpace(c.Addr) == "" {
+			return fmt.Errorf("addr or ns_name is required")
+		}
+		return nil
+	}
+
+	addr, err := c.Resolve(ccResolver{})
+	if err != nil {
+		return err
+	}
+	c.Addr = addr
+	c.VerifiedAt = time.Now().Unix()
+	return nil
+}
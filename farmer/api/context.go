@@ -4,13 +4,26 @@ import (
 	"fmt"
 )
 
+// Error writes the error envelope, {"code": "...", "error": "...", "message": "...", "request_id": "..."}.
+// the code is stable, see errorCode. a 500 of the known errors, e.g. sql.ErrNoRows, is corrected by errorStatus.
 func (ctx *RequestContext) Error(status int, err interface{}, msg ...interface{}) {
+	status, code := classify(status, err)
 	ret := map[string]string{
+		"code":  code,
 		"error": fmt.Sprint(err),
 	}
 	if len(msg) > 0 {
 		ret["message"] = fmt.Sprint(msg...)
 	}
+	if ctx.requestID != "" {
+		ret["request_id"] = ctx.requestID
+	}
+
+	if status >= 500 {
+		ctx.log.Errorf("%s %s answers %d %s, %v", ctx.req.Method, ctx.req.URL.Path, status, ret["code"], err)
+	} else {
+		ctx.log.Debugf("%s %s answers %d %s, %v", ctx.req.Method, ctx.req.URL.Path, status, ret["code"], err)
+	}
 	ctx.rnd.JSON(status, ret)
 }
 
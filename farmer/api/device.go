@@ -0,0 +1,375 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conseweb/common/hdwallet"
+	pb "github.com/conseweb/common/protos"
+	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/account"
+	"github.com/hyperledger/fabric/farmer/indexer"
+	"github.com/hyperledger/fabric/farmer/wallet"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+const defaultVerifyTTL = 10 * time.Minute
+
+type deviceWrapper struct {
+	account.Device
+	Online bool `json:"online"`
+}
+
+type bindDeviceReq struct {
+	// the captcha is sent to the email or the phone of the user.
+	Type    string `json:"type"`
+	Captcha string `json:"captcha"`
+
+	Os    string `json:"os"`
+	Mac   string `json:"mac"`
+	Alias string `json:"alias"`
+	For   string `json:"for"`
+	Spub  []byte `json:"spub"`
+	Label string `json:"label"`
+}
+
+// captchaTarget returns where the captcha of the user goes, the email or the phone.
+func captchaTarget(a *account.Account, typ string) (pb.SignUpType, string, error) {
+	switch {
+	case typ == "email" || (typ == "" && a.Phone == ""):
+		if a.Email == "" {
+			return 0, "", fmt.Errorf("account has no email")
+		}
+		return pb.SignUpType_EMAIL, a.Email, nil
+	case typ == "phone" || typ == "":
+		if a.Phone == "" {
+			return 0, "", fmt.Errorf("account has no phone")
+		}
+		return pb.SignUpType_MOBILE, a.Phone, nil
+	}
+	return 0, "", fmt.Errorf("unknown captcha type %s, email or phone", typ)
+}
+
+func parseDeviceFor(s string) (pb.DeviceFor, error) {
+	if s == "" {
+		return pb.DeviceFor_FARMER, nil
+	}
+	v, ok := pb.DeviceFor_value[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown device for %s", s)
+	}
+	return pb.DeviceFor(v), nil
+}
+
+// onlineDevices returns the ids of the devices which are online in the indexer.
+func onlineDevices() (map[string]bool, error) {
+	orm, err := indexer.InitDB()
+	if err != nil {
+		return nil, err
+	}
+	devs := make([]*indexer.Device, 0)
+	if err := orm.Find(&devs); err != nil {
+		return nil, err
+	}
+	online := map[string]bool{}
+	for _, d := range devs {
+		online[d.ID] = true
+	}
+	return online, nil
+}
+
+// saveUser saves the account of the request, and the farmer account if it is the same user.
+func saveUser(ctx *RequestContext) bool {
+	if err := ctx.user.Save(ctx.db); err != nil {
+		ctx.Error(500, err)
+		return false
+	}
+	if u := daemon.GetUser(); u != nil && u.ID == ctx.user.ID {
+		ctx.user.Wallet = u.Wallet
+		daemon.SetAccount(ctx.user)
+	}
+	return true
+}
+
+// GET /device, the devices of the account and whether they are online.
+func ListDevices(ctx *RequestContext) {
+	online, err := onlineDevices()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	devs := make([]deviceWrapper, 0, len(ctx.user.Devices))
+	for _, d := range ctx.user.Devices {
+		if d.Device == nil {
+			continue
+		}
+		devs = append(devs, deviceWrapper{d, online[d.DeviceID]})
+	}
+	ctx.rnd.JSON(200, devs)
+}
+
+// POST /device/captcha {"type": "email"}, sends the captcha to confirm the binding.
+func AcquireDeviceCaptcha(ctx *RequestContext) {
+	var req bindDeviceReq
+	if err := json.NewDecoder(ctx.req.Body).Decode(&req); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	stype, svalue, err := captchaTarget(ctx.user, req.Type)
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	cli, err := daemon.GetIDPClient()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	resp, err := cli.AcquireCaptcha(context.Background(), &pb.AcquireCaptchaReq{SignUpType: stype, SignUp: svalue})
+	if err != nil {
+		ctx.Error(502, withCode(CodeIDPUnavailable, err), "idp server error")
+		return
+	}
+	if resp.Error != nil && !resp.Error.OK() {
+		ctx.Error(500, resp.Error)
+		return
+	}
+	ctx.Message(200, "captcha sent")
+}
+
+// POST /device/bind, binds a new device to the account after the captcha is verified.
+func BindDevice(ctx *RequestContext) {
+	var req bindDeviceReq
+	if err := json.NewDecoder(ctx.req.Body).Decode(&req); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	if req.Captcha == "" || req.Mac == "" {
+		ctx.Error(400, fmt.Errorf("captcha and mac required"))
+		return
+	}
+	dfor, err := parseDeviceFor(req.For)
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	stype, svalue, err := captchaTarget(ctx.user, req.Type)
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	for _, d := range ctx.user.Devices {
+		if d.Device != nil && d.Mac == req.Mac {
+			ctx.Error(409, fmt.Errorf("device %s is bound already", d.DeviceID))
+			return
+		}
+	}
+
+	w, err := wallet.Open(ctx.db, ctx.user.ID)
+	if err == wallet.ErrNoMaster {
+		ctx.Error(400, err, "the wallet is not on this device")
+		return
+	}
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	cli, err := daemon.GetIDPClient()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	resp, err := cli.VerifyCaptcha(context.Background(), &pb.VerifyCaptchaReq{SignUpType: stype, SignUp: svalue, Captcha: req.Captcha})
+	if err != nil {
+		ctx.Error(502, withCode(CodeIDPUnavailable, err), "idp server error")
+		return
+	}
+	if resp.Error != nil && !resp.Error.OK() {
+		ctx.Error(400, resp.Error)
+		return
+	}
+
+	if req.Alias == "" {
+		req.Alias = req.Os
+	}
+	dev, err := ctx.user.BindDevice(ctx.db, cli, func(i uint32) (*hdwallet.HDWallet, error) {
+		return w.DeviceKey(i)
+	}, &pb.Device{Os: req.Os, For: dfor, Mac: req.Mac, Alias: req.Alias, Spub: req.Spub})
+	if err != nil {
+		ctx.Error(500, err, "bind device failed")
+		return
+	}
+	dev.Label = req.Label
+	if !saveUser(ctx) {
+		return
+	}
+	ctx.log.Noticef("device %s is bound to account %s", dev.DeviceID, ctx.user.ID)
+	ctx.rnd.JSON(201, dev)
+}
+
+// DELETE /device/:id, unbinds the device, its keys are revoked and it is not online any more.
+func UnbindDevice(ctx *RequestContext, params martini.Params) {
+	id := params["id"]
+	r, err := ctx.user.RevokeDevice(ctx.db, id)
+	if err == sql.ErrNoRows {
+		ctx.Error(404, fmt.Errorf("not found device %s", id))
+		return
+	}
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	if !saveUser(ctx) {
+		return
+	}
+
+	if orm, err := indexer.InitDB(); err != nil {
+		ctx.log.Errorf("open indexer failed, %s", err)
+	} else if _, err := orm.Where("id = ?", id).Delete(&indexer.Device{}); err != nil {
+		ctx.log.Errorf("set device %s offline failed, %s", id, err)
+	}
+	forgetVerified(id)
+	ctx.log.Noticef("device %s of account %s is revoked", id, ctx.user.ID)
+	ctx.rnd.JSON(200, r)
+}
+
+// PATCH /device/:id {"label": "nas"}, renames the device on this farmer.
+func LabelDevice(ctx *RequestContext, params martini.Params) {
+	var req struct {
+		Label string `json:"label"`
+	}
+	if err := json.NewDecoder(ctx.req.Body).Decode(&req); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	dev := ctx.user.GetDevice(params["id"])
+	if dev == nil {
+		ctx.Error(404, fmt.Errorf("not found device %s", params["id"]))
+		return
+	}
+	dev.Label = strings.TrimSpace(req.Label)
+	if !saveUser(ctx) {
+		return
+	}
+	ctx.rnd.JSON(200, dev)
+}
+
+type verifyDeviceReq struct {
+	DeviceID string `json:"device_id"`
+	UserID   string `json:"user_id"`
+	Alias    string `json:"alias"`
+	For      string `json:"for"`
+}
+
+// verified caches the devices verified by IDPA for farmer.device.verifyTTL.
+var verified = struct {
+	sync.Mutex
+	until map[string]time.Time
+}{until: map[string]time.Time{}}
+
+func forgetVerified(deviceID string) {
+	verified.Lock()
+	defer verified.Unlock()
+	for k := range verified.until {
+		if strings.HasPrefix(k, deviceID+"/") {
+			delete(verified.until, k)
+		}
+	}
+}
+
+// verifyDevice tells whether the device is bound to the user, the reason is why not.
+// a device revoked on this farmer is never valid.
+func verifyDevice(db *sql.DB, req *verifyDeviceReq) (bool, string, error) {
+	if req.DeviceID == "" || req.UserID == "" {
+		return false, "", fmt.Errorf("device_id and user_id required")
+	}
+	dfor, err := parseDeviceFor(req.For)
+	if err != nil {
+		return false, "", err
+	}
+	if revoked, err := account.IsRevoked(db, req.DeviceID); err != nil {
+		return false, "", err
+	} else if revoked {
+		return false, "device is revoked", nil
+	}
+
+	key := strings.Join([]string{req.DeviceID, req.UserID, req.Alias, dfor.String()}, "/")
+	now := time.Now()
+	verified.Lock()
+	ok := now.Before(verified.until[key])
+	verified.Unlock()
+	if ok {
+		return true, "", nil
+	}
+
+	cli, err := daemon.GetIDPAClient()
+	if err != nil {
+		return false, "", err
+	}
+	resp, err := cli.VerifyDevice(context.Background(), &pb.VerifyDeviceReq{
+		DeviceID:    req.DeviceID,
+		For:         dfor,
+		UserID:      req.UserID,
+		DeviceAlias: req.Alias,
+	})
+	if err != nil {
+		return false, "", err
+	}
+	if resp.Error != nil && !resp.Error.OK() {
+		return false, resp.Error.Message, nil
+	}
+
+	ttl := viper.GetDuration("farmer.device.verifyTTL")
+	if ttl <= 0 {
+		ttl = defaultVerifyTTL
+	}
+	verified.Lock()
+	verified.until[key] = now.Add(ttl)
+	verified.Unlock()
+	return true, "", nil
+}
+
+// POST /device/verify {"device_id", "user_id", "alias", "for"}, whether the device is bound to the user.
+func VerifyDevice(ctx *RequestContext) {
+	var req verifyDeviceReq
+	if err := json.NewDecoder(ctx.req.Body).Decode(&req); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	ok, reason, err := verifyDevice(ctx.db, &req)
+	if err != nil {
+		ctx.Error(500, err, "verify device failed")
+		return
+	}
+	ctx.rnd.JSON(200, map[string]interface{}{"valid": ok, "reason": reason})
+}
+
+// VerifyDeviceMW refuses the peer device of :device_id which IDPA doesn't verify, the account and the
+// alias are the user_id and alias params. it is enabled by farmer.device.verifyPeers.
+func VerifyDeviceMW(ctx *RequestContext, params martini.Params) {
+	if !viper.GetBool("farmer.device.verifyPeers") {
+		return
+	}
+
+	req := &verifyDeviceReq{
+		DeviceID: params["device_id"],
+		UserID:   ctx.params["user_id"],
+		Alias:    ctx.params["alias"],
+	}
+	ok, reason, err := verifyDevice(ctx.db, req)
+	if err != nil {
+		ctx.Error(403, err, "device is not verified")
+		return
+	}
+	if !ok {
+		ctx.Error(403, fmt.Errorf("device %s is not bound to %s, %s", req.DeviceID, req.UserID, reason))
+	}
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	pb "github.com/conseweb/common/protos"
+	"github.com/hyperledger/fabric/farmer/account"
+	"github.com/hyperledger/fabric/farmer/quota"
+	"github.com/hyperledger/fabric/farmer/session"
+	"github.com/hyperledger/fabric/storage"
+	"github.com/op/go-logging"
+)
+
+// the codes of the error envelope, they are stable, the clients check the code rather than the error
+// text. the errors of the idprovider are idp_ and the lowercase of the pb.ErrorType, e.g. idp_invalid_captcha.
+const (
+	CodeBadRequest     = "bad_request"
+	CodeInvalidJSON    = "invalid_json"
+	CodeUnauthorized   = "unauthorized"
+	CodeLoginRequired  = "login_required"
+	CodeInvalidToken   = "invalid_token"
+	CodeTokenExpired   = "token_expired"
+	CodeTokenRevoked   = "token_revoked"
+	CodeForbidden      = "forbidden"
+	CodeNotFound       = "not_found"
+	CodeRouteNotFound  = "route_not_found"
+	CodeConflict       = "conflict"
+	CodeTooManyRequest = "too_many_requests"
+	CodeInternal       = "internal"
+	CodeNotImplemented = "not_implemented"
+	CodeBadGateway     = "bad_gateway"
+	CodeUnavailable    = "unavailable"
+	CodeTimeout        = "timeout"
+
+	CodeChaincodeNotFound  = "chaincode_not_found"
+	CodeChaincodeNotDeploy = "chaincode_not_deployed"
+	CodeFileNotFound       = "file_not_found"
+	CodeFileExists         = "file_exists"
+	CodeInvalidPath        = "invalid_path"
+	CodePermissionDenied   = "permission_denied"
+	CodeIDPUnavailable     = "idp_unavailable"
+	CodeNoWallet           = "no_wallet"
+	CodeQuotaExceeded      = "quota_exceeded"
+)
+
+var statusCodes = map[int]string{
+	400: CodeBadRequest,
+	401: CodeUnauthorized,
+	403: CodeForbidden,
+	404: CodeNotFound,
+	409: CodeConflict,
+	429: CodeTooManyRequest,
+	507: CodeQuotaExceeded,
+	500: CodeInternal,
+	501: CodeNotImplemented,
+	502: CodeBadGateway,
+	503: CodeUnavailable,
+	504: CodeTimeout,
+}
+
+var errLoginRequired = errors.New("login required.")
+
+// codedError is an error with the code of the envelope.
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+
+func (e *codedError) Unwrap() error { return e.err }
+
+// withCode sets the code of err in the envelope.
+func withCode(code string, err error) error {
+	return &codedError{code, err}
+}
+
+// classify returns the status and the code of the envelope of err.
+func classify(status int, err interface{}) (int, string) {
+	if e, ok := err.(error); ok && status == 500 {
+		if s := errorStatus(e); s != 0 {
+			status = s
+		}
+	}
+	return status, errorCode(status, err)
+}
+
+// errorCode returns the code of err, or the one of the status if err is not known.
+func errorCode(status int, err interface{}) string {
+	if e, ok := err.(error); ok {
+		var (
+			coded  *codedError
+			idpErr *pb.Error
+		)
+		switch {
+		case errors.As(e, &coded):
+			return coded.code
+		case errors.As(e, &idpErr):
+			return "idp_" + strings.ToLower(idpErr.ErrorType.String())
+		case errors.Is(e, errLoginRequired):
+			return CodeLoginRequired
+		case errors.Is(e, session.ErrInvalidToken):
+			return CodeInvalidToken
+		case errors.Is(e, session.ErrExpired):
+			return CodeTokenExpired
+		case errors.Is(e, session.ErrRevoked):
+			return CodeTokenRevoked
+		case errors.Is(e, ErrNotFound):
+			return CodeChaincodeNotFound
+		case errors.Is(e, ErrNotDeploy):
+			return CodeChaincodeNotDeploy
+		case errors.Is(e, account.ErrNoWallet):
+			return CodeNoWallet
+		case errors.Is(e, quota.ErrExceeded):
+			return CodeQuotaExceeded
+		case errors.Is(e, storage.ErrInvalidPath):
+			return CodeInvalidPath
+		case errors.Is(e, os.ErrNotExist):
+			return CodeFileNotFound
+		case errors.Is(e, os.ErrExist):
+			return CodeFileExists
+		case errors.Is(e, os.ErrPermission):
+			return CodePermissionDenied
+		case isJSONError(e) && status == 400:
+			return CodeInvalidJSON
+		}
+	}
+
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// errorStatus returns the status of the known errors, 0 if err is not known.
+func errorStatus(err error) int {
+	var idpErr *pb.Error
+	switch {
+	case errors.As(err, &idpErr):
+		return idpErrStatus(idpErr)
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, ErrNotFound), errors.Is(err, os.ErrNotExist):
+		return 404
+	case errors.Is(err, os.ErrExist):
+		return 409
+	case errors.Is(err, quota.ErrExceeded):
+		return 507
+	case errors.Is(err, os.ErrPermission):
+		return 403
+	case errors.Is(err, storage.ErrInvalidPath), isJSONError(err):
+		return 400
+	case errors.Is(err, session.ErrInvalidToken), errors.Is(err, session.ErrExpired), errors.Is(err, session.ErrRevoked):
+		return 401
+	}
+	return 0
+}
+
+// idpErrStatus is the status of the error answered by the idprovider.
+func idpErrStatus(e *pb.Error) int {
+	switch e.ErrorType {
+	case pb.ErrorType_INTERNAL_ERROR:
+		return 502
+	case pb.ErrorType_ALREADY_SIGNUP, pb.ErrorType_ALREADY_DEVICE_MAC, pb.ErrorType_ALREADY_DEVICE_ALIAS,
+		pb.ErrorType_ALREADY_RECEIVED_LOTTERY, pb.ErrorType_INVALID_STATE_FARMER_ONLINE,
+		pb.ErrorType_INVALID_STATE_FARMER_OFFLINE:
+		return 409
+	case pb.ErrorType_INVALID_SIGN_IN:
+		return 401
+	case pb.ErrorType_INAPPROPRIATE_DEVICE_ROLE, pb.ErrorType_FARMER_CHALLENGE_FAIL:
+		return 403
+	}
+	return 400
+}
+
+// storageErrStatus is the status of the errors of the storage driver.
+func storageErrStatus(err error) int {
+	if s := errorStatus(err); s != 0 {
+		return s
+	}
+	return 500
+}
+
+func isJSONError(err error) bool {
+	var (
+		syntax *json.SyntaxError
+		typ    *json.UnmarshalTypeError
+	)
+	return errors.As(err, &syntax) || errors.As(err, &typ) || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// requestID returns the X-Request-Id of the request if it is sane, or a new one.
+func requestID(header string) string {
+	if requestIDPattern.MatchString(header) {
+		return header
+	}
+	bs := make([]byte, 8)
+	rand.Read(bs)
+	return hex.EncodeToString(bs)
+}
+
+// reqLog logs the lines of a request, prefixed with the request id.
+type reqLog string
+
+// logger returns a copy of log which skips the frame of reqLog, so %{shortfunc} is the caller.
+func (id reqLog) logger() *logging.Logger {
+	if log == nil {
+		return nil
+	}
+	l := *log
+	l.ExtraCalldepth++
+	return &l
+}
+
+func (id reqLog) prefix(format string, args []interface{}) (string, []interface{}) {
+	if id == "" {
+		return format, args
+	}
+	return "[%s] " + format, append([]interface{}{string(id)}, args...)
+}
+
+func (id reqLog) Debugf(format string, args ...interface{}) {
+	if l := id.logger(); l != nil {
+		format, args = id.prefix(format, args)
+		l.Debugf(format, args...)
+	}
+}
+
+func (id reqLog) Debug(args ...interface{}) {
+	if l := id.logger(); l != nil {
+		format, args := id.prefix("%s", []interface{}{fmt.Sprint(args...)})
+		l.Debugf(format, args...)
+	}
+}
+
+func (id reqLog) Infof(format string, args ...interface{}) {
+	if l := id.logger(); l != nil {
+		format, args = id.prefix(format, args)
+		l.Infof(format, args...)
+	}
+}
+
+func (id reqLog) Noticef(format string, args ...interface{}) {
+	if l := id.logger(); l != nil {
+		format, args = id.prefix(format, args)
+		l.Noticef(format, args...)
+	}
+}
+
+func (id reqLog) Warningf(format string, args ...interface{}) {
+	if l := id.logger(); l != nil {
+		format, args = id.prefix(format, args)
+		l.Warningf(format, args...)
+	}
+}
+
+func (id reqLog) Errorf(format string, args ...interface{}) {
+	if l := id.logger(); l != nil {
+		format, args = id.prefix(format, args)
+		l.Errorf(format, args...)
+	}
+}
+
+func (id reqLog) Error(args ...interface{}) {
+	if l := id.logger(); l != nil {
+		format, args := id.prefix("%s", []interface{}{fmt.Sprint(args...)})
+		l.Errorf(format, args...)
+	}
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	pb "github.com/conseweb/common/protos"
+	"github.com/hyperledger/fabric/farmer/account"
+	fclient "github.com/hyperledger/fabric/farmer/client"
+	"github.com/hyperledger/fabric/farmer/quota"
+	"github.com/hyperledger/fabric/farmer/session"
+	"github.com/hyperledger/fabric/storage"
+)
+
+func TestClassify(t *testing.T) {
+	var v interface{}
+	jsonErr := json.Unmarshal([]byte("{"), &v)
+
+	for i, c := range []struct {
+		status int
+		err    interface{}
+		want   int
+		code   string
+	}{
+		{400, jsonErr, 400, CodeInvalidJSON},
+		{500, jsonErr, 400, CodeInvalidJSON},
+		{400, errors.New("bad amount"), 400, CodeBadRequest},
+		{500, errors.New("boom"), 500, CodeInternal},
+		{500, sql.ErrNoRows, 404, CodeNotFound},
+		{404, sql.ErrNoRows, 404, CodeNotFound},
+		{400, fmt.Errorf("chaincode poe, %w", ErrNotFound), 400, CodeChaincodeNotFound},
+		{500, fmt.Errorf("chaincode poe, %w", ErrNotFound), 404, CodeChaincodeNotFound},
+		{400, ErrNotDeploy, 400, CodeChaincodeNotDeploy},
+		{401, errLoginRequired, 401, CodeLoginRequired},
+		{401, session.ErrInvalidToken, 401, CodeInvalidToken},
+		{500, session.ErrExpired, 401, CodeTokenExpired},
+		{401, session.ErrRevoked, 401, CodeTokenRevoked},
+		{400, account.ErrNoWallet, 400, CodeNoWallet},
+		{500, &pb.Error{ErrorType: pb.ErrorType_INVALID_CAPTCHA}, 400, "idp_invalid_captcha"},
+		{500, &pb.Error{ErrorType: pb.ErrorType_ALREADY_SIGNUP}, 409, "idp_already_signup"},
+		{500, &pb.Error{ErrorType: pb.ErrorType_INVALID_SIGN_IN}, 401, "idp_invalid_sign_in"},
+		{500, &pb.Error{ErrorType: pb.ErrorType_INTERNAL_ERROR}, 502, "idp_internal_error"},
+		{403, &pb.Error{ErrorType: pb.ErrorType_INVALID_SIGN_IN}, 403, "idp_invalid_sign_in"},
+		{502, withCode(CodeIDPUnavailable, errors.New("connection refused")), 502, CodeIDPUnavailable},
+		{500, &os.PathError{Op: "open", Path: "/a", Err: os.ErrNotExist}, 404, CodeFileNotFound},
+		{500, &os.PathError{Op: "mkdir", Path: "/a", Err: os.ErrExist}, 409, CodeFileExists},
+		{500, &os.PathError{Op: "open", Path: "/a", Err: os.ErrPermission}, 403, CodePermissionDenied},
+		{500, fmt.Errorf("/.., %w", storage.ErrInvalidPath), 400, CodeInvalidPath},
+		{503, "deploying", 503, CodeUnavailable},
+		{418, "teapot", 418, CodeBadRequest},
+		{500, fmt.Errorf("put /a, %w", quota.ErrExceeded), 507, CodeQuotaExceeded},
+		{508, "loop", 508, CodeInternal},
+	} {
+		status, code := classify(c.status, c.err)
+		if status != c.want || code != c.code {
+			t.Errorf("%d: %d %v is %d %s, expect %d %s", i, c.status, c.err, status, code, c.want, c.code)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	for h, keep := range map[string]bool{
+		"":                      false,
+		"abc-123":               true,
+		"a.b_c:d":               true,
+		"with space":            false,
+		"<script>":              false,
+		strings.Repeat("a", 65): false,
+	} {
+		id := requestID(h)
+		if keep && id != h {
+			t.Errorf("%q should be kept, %q", h, id)
+		}
+		if !keep && !regexp.MustCompile(`^[0-9a-f]{16}$`).MatchString(id) {
+			t.Errorf("%q should be replaced, %q", h, id)
+		}
+	}
+}
+
+// errorOf asserts err is the envelope of status and code, the request id is the one of the header.
+func errorOf(t *testing.T, what string, err error, status int, code string) {
+	e, ok := err.(*fclient.Error)
+	if !ok {
+		t.Errorf("%s should answer %d %s, %v", what, status, code, err)
+		return
+	}
+	if e.Status != status || e.Code != code {
+		t.Errorf("%s answers %d %s, expect %d %s, %s", what, e.Status, e.Code, status, code, e)
+	}
+	if e.RequestID == "" {
+		t.Errorf("%s answers no request id", what)
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	cli, done := newContractServer(t)
+	defer done()
+
+	anon := fclient.New(cli.Base, "")
+	anon.HTTP = cli.HTTP
+	_, err := anon.GetAccountState()
+	errorOf(t, "no token", err, 401, CodeLoginRequired)
+
+	anon.Token = "nothing"
+	_, err = anon.GetAccountState()
+	errorOf(t, "invalid token", err, 401, CodeInvalidToken)
+
+	db := daemon.GetDB()
+	s, token, err := sessions.Issue("alice", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sessions.Revoke("alice", s.ID); err != nil {
+		t.Fatal(err)
+	}
+	anon.Token = token
+	_, err = anon.GetAccountState()
+	errorOf(t, "revoked token", err, 401, CodeTokenRevoked)
+
+	// only the first account is the owner.
+	bob := &account.Account{ID: "bob", Email: "bob@example.com", NickName: "bob"}
+	if err := bob.Save(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, anon.Token, err = sessions.Issue(bob.ID, "test"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = anon.ListMembers()
+	errorOf(t, "viewer lists members", err, 403, CodeForbidden)
+
+	_, err = cli.Request("PATCH", "/account/setting", "application/json", strings.NewReader("{"))
+	errorOf(t, "invalid json", err, 400, CodeInvalidJSON)
+
+	_, err = cli.GetInvoice("nothing")
+	errorOf(t, "missing invoice", err, 404, CodeNotFound)
+
+	_, err = cli.ListPSBTs()
+	errorOf(t, "missing chaincode", err, 404, CodeChaincodeNotFound)
+
+	_, err = cli.GetFile("nothing")
+	errorOf(t, "missing file", err, 404, CodeFileNotFound)
+
+	_, err = cli.RenameFile("nothing", &fclient.RenameFileQuery{Newpath: "/../../etc/passwd"})
+	errorOf(t, "rename out of the root", err, 400, CodeInvalidPath)
+
+	err = cli.Do("GET", "/nothing", nil, nil)
+	errorOf(t, "missing route", err, 404, CodeRouteNotFound)
+
+	// the id of the request is answered in the header and the envelope.
+	rsp, err := cli.Request("GET", "/account", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if !regexp.MustCompile(`^[0-9a-f]{16}$`).MatchString(rsp.Header.Get("X-Request-Id")) {
+		t.Errorf("X-Request-Id is %q", rsp.Header.Get("X-Request-Id"))
+	}
+
+	req, _ := http.NewRequest("GET", cli.Base+"/invoice/nothing", nil)
+	req.Header.Set("Authorization", "Bearer "+cli.Token)
+	req.Header.Set("X-Request-Id", "trace-42")
+	rsp, err = cli.HTTP.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	var e fclient.Error
+	json.NewDecoder(rsp.Body).Decode(&e)
+	if rsp.Header.Get("X-Request-Id") != "trace-42" || e.RequestID != "trace-42" {
+		t.Errorf("request id is %q %q, expect trace-42", rsp.Header.Get("X-Request-Id"), e.RequestID)
+	}
+}
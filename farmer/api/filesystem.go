@@ -14,7 +14,7 @@ import (
 func GetFile(ctx *RequestContext, params martini.Params, fs storage.StorageDriver) {
 	f, err := fs.Reader(context.TODO(), getFilePath(params))
 	if err != nil {
-		ctx.Error(400, err)
+		ctx.Error(storageErrStatus(err), err)
 		return
 	}
 
@@ -26,7 +26,7 @@ func GetFile(ctx *RequestContext, params martini.Params, fs storage.StorageDrive
 func GetFileList(ctx *RequestContext, params martini.Params, fs storage.StorageDriver) {
 	fis, err := fs.List(context.TODO(), getFilePath(params))
 	if err != nil {
-		ctx.Error(500, err)
+		ctx.Error(storageErrStatus(err), err)
 		return
 	}
 
@@ -44,14 +44,14 @@ func UploadFile(ctx *RequestContext, params martini.Params, fs storage.StorageDr
 
 	fw, err := fs.Writer(context.TODO(), getFilePath(params), false)
 	if err != nil {
-		ctx.Error(400, err)
+		ctx.Error(storageErrStatus(err), err)
 		return
 	}
 	defer fw.Close()
 
 	_, err = io.Copy(fw, mf)
 	if err != nil {
-		ctx.Error(500, err)
+		ctx.Error(storageErrStatus(err), err)
 		return
 	}
 
@@ -62,7 +62,7 @@ func UploadFile(ctx *RequestContext, params martini.Params, fs storage.StorageDr
 func NewDir(ctx *RequestContext, params martini.Params, fs storage.StorageDriver) {
 	err := fs.Mkdir(context.TODO(), getFilePath(params))
 	if err != nil {
-		ctx.Error(400, err)
+		ctx.Error(storageErrStatus(err), err)
 		return
 	}
 	ctx.Message(200, getFilePath(params))
@@ -79,7 +79,7 @@ func RenameFile(ctx *RequestContext, params martini.Params, fs storage.StorageDr
 
 	err := fs.Move(context.TODO(), oldPath, newPath)
 	if err != nil {
-		ctx.Error(400, err)
+		ctx.Error(storageErrStatus(err), err)
 		return
 	}
 
@@ -90,7 +90,7 @@ func RenameFile(ctx *RequestContext, params martini.Params, fs storage.StorageDr
 func RemoveFile(ctx *RequestContext, params martini.Params, fs storage.StorageDriver) {
 	err := fs.Delete(context.TODO(), getFilePath(params))
 	if err != nil {
-		ctx.Error(400, err)
+		ctx.Error(storageErrStatus(err), err)
 		return
 	}
 
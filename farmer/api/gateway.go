@@ -0,0 +1,349 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+const (
+	// an upstream failed by a request is skipped for the time, if no health check.
+	defaultGatewayRecover = 10 * time.Second
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = 2 * time.Second
+)
+
+// upstream is a backend of a gateway.
+type upstream struct {
+	url *url.URL
+
+	lock      sync.Mutex
+	unhealthy bool      // by the health checks
+	downUntil time.Time // by the failed requests
+}
+
+func (u *upstream) up() bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return !u.unhealthy && !time.Now().Before(u.downUntil)
+}
+
+func (u *upstream) fail(recover time.Duration) {
+	u.lock.Lock()
+	u.downUntil = time.Now().Add(recover)
+	u.lock.Unlock()
+}
+
+// setHealthy returns whether the health is changed.
+func (u *upstream) setHealthy(ok bool) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	changed := u.unhealthy == ok
+	u.unhealthy = !ok
+	if ok {
+		u.downUntil = time.Time{}
+	}
+	return changed
+}
+
+// headerRules rewrites the headers, the removed first.
+type headerRules struct {
+	Set    map[string]string
+	Remove []string
+}
+
+func (r headerRules) apply(h http.Header) {
+	for _, k := range r.Remove {
+		h.Del(k)
+	}
+	for k, v := range r.Set {
+		h.Set(k, v)
+	}
+}
+
+// gateway proxies the requests under prefix to the upstreams in round-robin, a daemon.gateway route.
+type gateway struct {
+	prefix    string
+	upstreams []*upstream
+	next      uint32
+
+	// of a request, the websocket is not limited.
+	timeout time.Duration
+	// more upstreams tried on the connection errors, the requests with body are not retried.
+	retries int
+
+	healthPath     string
+	healthInterval time.Duration
+	healthTimeout  time.Duration
+
+	requestHeaders  headerRules
+	responseHeaders headerRules
+
+	transport http.RoundTripper
+}
+
+// lookup returns the value of key in m ignoring the case, viper lowercases the keys.
+func lookup(m map[string]interface{}, key string) interface{} {
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+func parseHeaderRules(v interface{}) headerRules {
+	m := cast.ToStringMap(v)
+	return headerRules{
+		Set:    cast.ToStringMapString(lookup(m, "set")),
+		Remove: cast.ToStringSlice(lookup(m, "remove")),
+	}
+}
+
+// parseGateway returns the gateway of a daemon.gateway entry, which is the URL of the upstream or
+// a map of upstreams, timeout, retries, healthCheck, requestHeaders and responseHeaders.
+func parseGateway(name string, v interface{}) (*gateway, error) {
+	g := &gateway{
+		prefix:    "/" + strings.Trim(name, "/ \n"),
+		transport: http.DefaultTransport,
+	}
+
+	var urls []string
+	if s, ok := v.(string); ok {
+		urls = []string{s}
+	} else {
+		m := cast.ToStringMap(v)
+		urls = cast.ToStringSlice(lookup(m, "upstreams"))
+		g.timeout = cast.ToDuration(lookup(m, "timeout"))
+		g.retries = cast.ToInt(lookup(m, "retries"))
+		g.requestHeaders = parseHeaderRules(lookup(m, "requestHeaders"))
+		g.responseHeaders = parseHeaderRules(lookup(m, "responseHeaders"))
+
+		hc := cast.ToStringMap(lookup(m, "healthCheck"))
+		g.healthPath = cast.ToString(lookup(hc, "path"))
+		g.healthInterval = cast.ToDuration(lookup(hc, "interval"))
+		g.healthTimeout = cast.ToDuration(lookup(hc, "timeout"))
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("gateway %s has no upstream", name)
+	}
+	if g.healthInterval <= 0 {
+		g.healthInterval = defaultHealthInterval
+	}
+	if g.healthTimeout <= 0 {
+		g.healthTimeout = defaultHealthTimeout
+	}
+
+	for _, s := range urls {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("format URL<%s> of gateway %s failed, %s", s, name, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("URL<%s> of gateway %s has no scheme or host", s, name)
+		}
+		g.upstreams = append(g.upstreams, &upstream{url: u})
+	}
+	return g, nil
+}
+
+// getGateways returns the gateways of daemon.gateway, sorted by the prefix.
+func getGateways() ([]*gateway, error) {
+	gateways := []*gateway{}
+	for k, v := range viper.GetStringMap("daemon.gateway") {
+		g, err := parseGateway(k, v)
+		if err != nil {
+			log.Errorf("setting of gateway %s is wrong, %s", k, err)
+			return nil, err
+		}
+		gateways = append(gateways, g)
+	}
+	sort.Slice(gateways, func(i, j int) bool { return gateways[i].prefix < gateways[j].prefix })
+	return gateways, nil
+}
+
+func (g *gateway) String() string {
+	urls := make([]string, len(g.upstreams))
+	for i, u := range g.upstreams {
+		urls[i] = u.url.String()
+	}
+	return g.prefix + " --> " + strings.Join(urls, ", ")
+}
+
+func (g *gateway) recoverAfter() time.Duration {
+	if g.healthPath != "" {
+		return g.healthInterval
+	}
+	return defaultGatewayRecover
+}
+
+// pick returns the upstreams in the order to try, from the next one of round-robin, the down ones last.
+func (g *gateway) pick() []*upstream {
+	n := len(g.upstreams)
+	start := int((atomic.AddUint32(&g.next, 1) - 1) % uint32(n))
+
+	ups, downs := make([]*upstream, 0, n), []*upstream{}
+	for i := 0; i < n; i++ {
+		u := g.upstreams[(start+i)%n]
+		if u.up() {
+			ups = append(ups, u)
+		} else {
+			downs = append(downs, u)
+		}
+	}
+	return append(ups, downs...)
+}
+
+func joinPath(base, p string) string {
+	if p == "" {
+		return base
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return strings.TrimSuffix(base, "/") + p
+}
+
+// RoundTrip sends the request to the picked upstreams, the next one is tried on the connection errors.
+func (g *gateway) RoundTrip(req *http.Request) (*http.Response, error) {
+	ups := g.pick()
+	tries := g.retries + 1
+	if tries > len(ups) {
+		tries = len(ups)
+	}
+	replayable := req.Body == nil || req.Body == http.NoBody
+	path := req.URL.Path
+
+	var lastErr error
+	for i := 0; i < tries; i++ {
+		u, out := ups[i], req
+		if i > 0 {
+			out = req.Clone(req.Context())
+		}
+		out.URL.Scheme, out.URL.Host = u.url.Scheme, u.url.Host
+		out.URL.Path = joinPath(u.url.Path, path)
+		out.URL.RawPath = ""
+		out.Host = u.url.Host
+
+		resp, err := g.transport.RoundTrip(out)
+		if err == nil {
+			return resp, nil
+		}
+		log.Debugf("proxy %s to %s failed, %s", path, u.url, err)
+		lastErr = err
+		if req.Context().Err() != nil {
+			break
+		}
+		u.fail(g.recoverAfter())
+		if !replayable {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+// direct rewrites the request to the upstream, which is chosen by RoundTrip.
+func (g *gateway) direct(req *http.Request) {
+	req.URL.Path = strings.TrimPrefix(req.URL.Path, g.prefix)
+	req.URL.RawPath = ""
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req.Header.Set("User-Agent", "")
+	}
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	req.Header.Set("X-Forwarded-Host", req.Host)
+	req.Header.Set("X-Forwarded-Proto", proto)
+	g.requestHeaders.apply(req.Header)
+}
+
+func isUpgrade(req *http.Request) bool {
+	return req.Header.Get("Upgrade") != "" &&
+		strings.Contains(strings.ToLower(req.Header.Get("Connection")), "upgrade")
+}
+
+// serve proxies req with the streaming and the websocket passed through, onError writes the error
+// if no upstream answers.
+func (g *gateway) serve(rw http.ResponseWriter, req *http.Request, onError func(int, error)) {
+	if g.timeout > 0 && !isUpgrade(req) {
+		c, cancel := context.WithTimeout(req.Context(), g.timeout)
+		defer cancel()
+		req = req.WithContext(c)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director:      g.direct,
+		Transport:     g,
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			g.responseHeaders.apply(resp.Header)
+			return nil
+		},
+		ErrorHandler: func(rw http.ResponseWriter, req *http.Request, err error) {
+			status := http.StatusBadGateway
+			if errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusGatewayTimeout
+			}
+			onError(status, err)
+		},
+	}
+	proxy.ServeHTTP(rw, req)
+}
+
+// Handle is the handler of the gateway routes.
+func (g *gateway) Handle(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	ctx.log.Debugf("proxy %s by gateway %s", req.URL.Path, g.prefix)
+	g.serve(rw, req, func(status int, err error) {
+		ctx.Error(status, err)
+	})
+}
+
+// check probes the health path of the upstreams, an upstream answering < 400 is healthy.
+func (g *gateway) check(cli *http.Client) {
+	for _, u := range g.upstreams {
+		to := *u.url
+		to.Path = joinPath(to.Path, g.healthPath)
+		to.RawPath = ""
+
+		ok := false
+		resp, err := cli.Get(to.String())
+		if err == nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			ok = resp.StatusCode < 400
+		}
+		if u.setHealthy(ok) {
+			log.Noticef("upstream %s of gateway %s is healthy: %v", u.url, g.prefix, ok)
+		}
+	}
+}
+
+// checkLoop checks the upstreams every healthInterval until stop is closed.
+func (g *gateway) checkLoop(stop <-chan struct{}) {
+	cli := &http.Client{Timeout: g.healthTimeout}
+	t := time.NewTicker(g.healthInterval)
+	defer t.Stop()
+
+	for {
+		g.check(cli)
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+func init() {
+	log = logging.MustGetLogger("api")
+}
+
+func newGatewayServer(t *testing.T, conf interface{}) (*gateway, *httptest.Server) {
+	g, err := parseGateway("gw", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		g.serve(w, req, func(status int, err error) {
+			http.Error(w, err.Error(), status)
+		})
+	}))
+	return g, front
+}
+
+func get(t *testing.T, url string) (int, string, http.Header) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	bs, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(bs), resp.Header
+}
+
+func TestGatewayRoundRobin(t *testing.T) {
+	backend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("X-Secret", "s")
+			fmt.Fprintf(w, "%s %s %s %s", name, req.URL.Path, req.Header.Get("X-Farmer"), req.Header.Get("Cookie"))
+		}))
+	}
+	a, b := backend("a"), backend("b")
+	defer a.Close()
+	defer b.Close()
+
+	_, front := newGatewayServer(t, map[interface{}]interface{}{
+		"upstreams":       []interface{}{a.URL + "/v1", b.URL + "/v1"},
+		"requestheaders":  map[interface{}]interface{}{"set": map[interface{}]interface{}{"X-Farmer": "f"}, "remove": []interface{}{"Cookie"}},
+		"responseheaders": map[interface{}]interface{}{"remove": []interface{}{"X-Secret"}},
+	})
+	defer front.Close()
+
+	got := []string{}
+	for i := 0; i < 4; i++ {
+		req, _ := http.NewRequest("GET", front.URL+"/gw/x", nil)
+		req.Header.Set("Cookie", "c")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.Header.Get("X-Secret") != "" {
+			t.Error("response header is not removed")
+		}
+		got = append(got, string(bs))
+	}
+	want := []string{"a /v1/x f ", "b /v1/x f ", "a /v1/x f ", "b /v1/x f "}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestGatewayFailover(t *testing.T) {
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer ok.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	g, front := newGatewayServer(t, map[string]interface{}{
+		"upstreams": []string{dead.URL, ok.URL},
+		"retries":   1,
+	})
+	defer front.Close()
+
+	for i := 0; i < 3; i++ {
+		if code, body, _ := get(t, front.URL+"/gw/"); code != 200 || body != "ok" {
+			t.Fatalf("get %d %s", code, body)
+		}
+	}
+	if g.upstreams[0].up() {
+		t.Error("dead upstream is up")
+	}
+
+	g.check(&http.Client{Timeout: time.Second})
+	if g.upstreams[0].up() || !g.upstreams[1].up() {
+		t.Error("health check is wrong")
+	}
+}
+
+func TestGatewayTimeout(t *testing.T) {
+	done := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-done:
+		case <-req.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(done)
+
+	_, front := newGatewayServer(t, map[string]interface{}{
+		"upstreams": []string{slow.URL},
+		"timeout":   "50ms",
+	})
+	defer front.Close()
+
+	if code, _, _ := get(t, front.URL+"/gw/"); code != http.StatusGatewayTimeout {
+		t.Errorf("status %d, want 504", code)
+	}
+}
+
+func TestGatewayStreaming(t *testing.T) {
+	next := make(chan struct{})
+	stream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, "first\n")
+		w.(http.Flusher).Flush()
+		<-next
+		fmt.Fprint(w, "second\n")
+	}))
+	defer stream.Close()
+
+	_, front := newGatewayServer(t, stream.URL)
+	defer front.Close()
+
+	resp, err := http.Get(front.URL + "/gw/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		r := bufio.NewReader(resp.Body)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+	select {
+	case line := <-lines:
+		if line != "first\n" {
+			t.Fatalf("got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first chunk is not flushed")
+	}
+	close(next)
+	if line := <-lines; line != "second\n" {
+		t.Errorf("got %q", line)
+	}
+}
+
+func TestGatewayWebSocket(t *testing.T) {
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "upgrade required", 426)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+		line, _ := rw.ReadString('\n')
+		rw.WriteString("echo " + line)
+		rw.Flush()
+	}))
+	defer echo.Close()
+
+	_, front := newGatewayServer(t, map[string]interface{}{
+		"upstreams": []string{echo.URL},
+		"timeout":   "10ms",
+	})
+	defer front.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(front.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprint(conn, "GET /gw/ws HTTP/1.1\r\nHost: farmer\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 101 {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	// longer than the timeout, which is not applied to the websocket.
+	time.Sleep(50 * time.Millisecond)
+	fmt.Fprint(conn, "hi\n")
+	if line, err := r.ReadString('\n'); err != nil || line != "echo hi\n" {
+		t.Errorf("got %q %v", line, err)
+	}
+}
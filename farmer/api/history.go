@@ -0,0 +1,180 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/hyperledger/fabric/core/peer"
+	"github.com/hyperledger/fabric/farmer/history"
+	"github.com/hyperledger/fabric/farmer/invoice"
+	pb "github.com/hyperledger/fabric/protos"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+const defaultHistorySyncInterval = 5 * time.Second
+
+// openchainSource reads the committed blocks from the peer.
+type openchainSource struct {
+	cli pb.OpenchainClient
+}
+
+func newOpenchainSource() (*openchainSource, error) {
+	conn, err := peer.NewPeerClientConnection()
+	if err != nil {
+		return nil, err
+	}
+	return &openchainSource{cli: pb.NewOpenchainClient(conn)}, nil
+}
+
+var (
+	sharedSourceLock sync.Mutex
+	sharedSource     *openchainSource
+)
+
+// peerSource returns the openchainSource shared by the requests, connected at the first call.
+func peerSource() (*openchainSource, error) {
+	sharedSourceLock.Lock()
+	defer sharedSourceLock.Unlock()
+
+	if sharedSource == nil {
+		src, err := newOpenchainSource()
+		if err != nil {
+			return nil, err
+		}
+		sharedSource = src
+	}
+	return sharedSource, nil
+}
+
+func (s *openchainSource) Height() (uint64, error) {
+	info, err := s.cli.GetBlockchainInfo(context.Background(), &empty.Empty{})
+	if err != nil {
+		return 0, err
+	}
+	return info.Height, nil
+}
+
+func (s *openchainSource) Block(n uint64) (*pb.Block, error) {
+	return s.cli.GetBlockByNumber(context.Background(), &pb.BlockNumber{Number: n})
+}
+
+// followBlocksLoop records the lepuscoin txs of the committed blocks every farmer.lepuscoin.syncInterval,
+// and settles the invoices paid by them.
+func followBlocksLoop(evt *EventHandler) {
+	interval := viper.GetDuration("farmer.lepuscoin.syncInterval")
+	if interval <= 0 {
+		interval = defaultHistorySyncInterval
+	}
+	log.Debugf("follow lepuscoin blocks every %s", interval)
+
+	var src *openchainSource
+	for range time.Tick(interval) {
+		db := daemon.GetDB()
+		if db == nil {
+			continue
+		}
+		cc, err := ccManager.Get("lepuscoin")
+		if err != nil {
+			continue
+		}
+
+		if src == nil {
+			if src, err = newOpenchainSource(); err != nil {
+				log.Debugf("connect peer failed, %s", err)
+				continue
+			}
+		}
+
+		n, err := history.Sync(db, src, cc.Name)
+		if err != nil {
+			log.Debugf("sync lepuscoin history failed, %s", err)
+			continue
+		}
+		if n > 0 && evt != nil {
+			h, _ := history.Height(db)
+			evt.Broadcast(map[string]interface{}{"lepuscoin_history": map[string]interface{}{"txs": n, "height": h}})
+		}
+
+		paid, err := invoice.Settle(db, time.Now())
+		if err != nil {
+			log.Debugf("settle invoices failed, %s", err)
+		}
+		if len(paid) > 0 && evt != nil {
+			evt.Broadcast(map[string]interface{}{"invoice_paid": paid})
+		}
+	}
+}
+
+// GET /lepuscoin/history?addrs=xxx,yyy&limit=20&offset=0, the wallet addresses if no addrs.
+func ListHistory(ctx *RequestContext) {
+	limit, offset, ok := parsePage(ctx, 20)
+	if !ok {
+		return
+	}
+
+	var addrs []string
+	if param := ctx.params["addrs"]; param != "" {
+		addrs = strings.Split(param, ",")
+	} else {
+		w := openWallet(ctx)
+		if w == nil {
+			return
+		}
+		as, err := w.Addresses(-1, -1)
+		if err != nil {
+			ctx.Error(500, err)
+			return
+		}
+		for _, a := range as {
+			addrs = append(addrs, a.Address)
+		}
+	}
+
+	txs, count, err := history.List(ctx.db, addrs, limit, offset)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.res.Header().Set("Record-Count", strconv.Itoa(count))
+	ctx.rnd.JSON(200, txs)
+}
+
+// GET /lepuscoin/history/:hash
+func GetHistoryTx(ctx *RequestContext, params martini.Params) {
+	tx, err := history.Get(ctx.db, params["hash"])
+	if err == sql.ErrNoRows {
+		ctx.Error(404, fmt.Errorf("tx %s not in history", params["hash"]))
+		return
+	}
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, tx)
+}
+
+// parsePage parses the limit and offset params, writes the error and returns false if invalid.
+func parsePage(ctx *RequestContext, defLimit int) (limit, offset int, ok bool) {
+	limit = defLimit
+	var err error
+	if s := ctx.params["limit"]; s != "" {
+		if limit, err = strconv.Atoi(s); err != nil {
+			ctx.Error(400, fmt.Errorf("invalid limit %s", s))
+			return 0, 0, false
+		}
+	}
+	if s := ctx.params["offset"]; s != "" {
+		if offset, err = strconv.Atoi(s); err != nil || offset < 0 {
+			ctx.Error(400, fmt.Errorf("invalid offset %s", s))
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
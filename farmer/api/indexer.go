@@ -96,7 +96,7 @@ func OnlineDevice(ctx *RequestContext, orm *xorm.Engine, params martini.Params)
 		return
 	}
 
-	_, err = orm.Where("device_id = ?", devID).Delete(&indexer.Device{})
+	_, err = orm.Where("id = ?", devID).Delete(&indexer.Device{})
 	if err != nil {
 		ctx.Error(500, err)
 		return
@@ -116,7 +116,7 @@ func OnlineDevice(ctx *RequestContext, orm *xorm.Engine, params martini.Params)
 func OfflineDevice(ctx *RequestContext, orm *xorm.Engine, params martini.Params) {
 	devID := params["device_id"]
 
-	_, err := orm.Where("device_id = ?", devID).Delete(&indexer.Device{})
+	_, err := orm.Where("id = ?", devID).Delete(&indexer.Device{})
 	if err != nil {
 		ctx.Error(500, err)
 		return
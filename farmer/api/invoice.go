@@ -0,0 +1,186 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/invoice"
+	"github.com/hyperledger/fabric/farmer/wallet"
+	"github.com/spf13/viper"
+)
+
+// POST /invoice
+// body:
+// {
+// 	"amount": 100,
+// 	"memo": "coffee",
+// 	"name": "shop.alice", // or "addr": "mtCL...", a new wallet address if neither
+// 	"expires_in": "1h" // or "expires": 1500000000, farmer.invoice.defaultExpiry if neither
+// }
+func NewInvoice(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	var body struct {
+		Amount    uint64 `json:"amount"`
+		Memo      string `json:"memo"`
+		Name      string `json:"name"`
+		Addr      string `json:"addr"`
+		Expires   int64  `json:"expires"`
+		ExpiresIn string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	inv := &invoice.Invoice{Name: body.Name, Addr: body.Addr, Amount: body.Amount, Memo: body.Memo, Expires: body.Expires}
+	if inv.Expires == 0 {
+		expiresIn := viper.GetDuration("farmer.invoice.defaultExpiry")
+		if body.ExpiresIn != "" {
+			d, err := time.ParseDuration(body.ExpiresIn)
+			if err != nil || d <= 0 {
+				ctx.Error(400, fmt.Errorf("invalid expires_in %s", body.ExpiresIn))
+				return
+			}
+			expiresIn = d
+		}
+		if expiresIn > 0 {
+			inv.Expires = time.Now().Add(expiresIn).Unix()
+		}
+	}
+
+	switch {
+	case inv.Name != "":
+		addr, err := resolveNameService(inv.Name)
+		if err != nil {
+			ctx.Error(404, err)
+			return
+		}
+		if inv.Addr != "" && inv.Addr != addr {
+			ctx.Error(400, fmt.Errorf("address %s is not the address of name %s", inv.Addr, inv.Name))
+			return
+		}
+		inv.Addr = addr
+	case inv.Addr == "":
+		// a fresh address for every invoice, so that its payment is not mixed with others.
+		w := openWallet(ctx)
+		if w == nil {
+			return
+		}
+		a, err := w.NextAddress(0, wallet.ChainReceive, "invoice")
+		if err != nil {
+			ctx.Error(500, err)
+			return
+		}
+		inv.Addr = a.Address
+	}
+
+	if err := invoice.Create(ctx.db, ctx.user.ID, inv); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	ctx.rnd.JSON(201, inv)
+}
+
+// GET /invoice?status=pending&limit=20&offset=0
+func ListInvoices(ctx *RequestContext) {
+	limit, offset, ok := parsePage(ctx, 20)
+	if !ok {
+		return
+	}
+
+	invs, count, err := invoice.List(ctx.db, ctx.user.ID, ctx.params["status"], limit, offset)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.res.Header().Set("Record-Count", strconv.Itoa(count))
+	ctx.rnd.JSON(200, invs)
+}
+
+// GET /invoice/:id
+func GetInvoice(ctx *RequestContext, params martini.Params) {
+	inv, err := invoice.Get(ctx.db, ctx.user.ID, params["id"])
+	if err == sql.ErrNoRows {
+		ctx.Error(404, fmt.Errorf("invoice %s not found", params["id"]))
+		return
+	}
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, inv)
+}
+
+// POST /invoice/decode {"uri": "lepuscoin:mtCL...?amount=100"}, for the payer.
+func DecodeInvoice(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	var body struct {
+		URI string `json:"uri"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	inv, status, err := decodeInvoiceURI(body.URI)
+	if err != nil {
+		ctx.Error(status, err)
+		return
+	}
+	ctx.rnd.JSON(200, inv)
+}
+
+// POST /invoice/pay, the same body as transfer with the uri instead of out:
+// {
+// 	"uri": "lepuscoin:mtCL...?amount=100",
+// 	"in": [{"addr": "from xxx..."}],
+// 	"fee": 5
+// }
+func PayInvoice(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	var body struct {
+		txWrapper
+		URI string `json:"uri"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	inv, status, err := decodeInvoiceURI(body.URI)
+	if err != nil {
+		ctx.Error(status, err)
+		return
+	}
+	body.Out = []txOut{{Addr: inv.Addr, Amount: inv.Amount}}
+
+	plan, w := prepareTransfer(ctx, &body.txWrapper, false)
+	if plan == nil {
+		return
+	}
+	submitTransfer(ctx, plan, w)
+}
+
+// decodeInvoiceURI parses the uri, it must not be expired, and its addr must be the current
+// address of its name. returns the http status of the error.
+func decodeInvoiceURI(uri string) (*invoice.Invoice, int, error) {
+	inv, err := invoice.ParseURI(uri)
+	if err != nil {
+		return nil, 400, err
+	}
+	if inv.Expires != 0 && inv.Expires < time.Now().Unix() {
+		return nil, 410, fmt.Errorf("payment request expired at %s", time.Unix(inv.Expires, 0))
+	}
+	if inv.Name != "" {
+		addr, err := resolveNameService(inv.Name)
+		if err != nil {
+			return nil, 409, err
+		}
+		if addr != inv.Addr {
+			return nil, 409, fmt.Errorf("address %s is not the address of name %s", inv.Addr, inv.Name)
+		}
+	}
+	return inv, 200, nil
+}
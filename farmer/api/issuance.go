@@ -0,0 +1,248 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/conseweb/common/assets/lepuscoin/client"
+	pb "github.com/conseweb/common/protos"
+	"github.com/hyperledger/fabric/farmer/challenge"
+	"github.com/hyperledger/fabric/farmer/issuance"
+	"github.com/hyperledger/fabric/farmer/wallet"
+	ccpkg "github.com/hyperledger/fabric/peer/chaincode"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+// coinbaseFunction of the lepuscoin chaincode is only invoked by invokeCoinbase under the issuance policy.
+const coinbaseFunction = "invoke_coinbase"
+
+// refuseCoinbase refuses the generic chaincode routes invoking the coinbase, which would bypass the
+// issuance policy and the audit log. any chaincode is refused, it may be lepuscoin by the path.
+func refuseCoinbase(ctx *RequestContext, cw *ccpkg.ChaincodeWrapper) bool {
+	if cw.Function != coinbaseFunction {
+		return false
+	}
+	ctx.Error(403, fmt.Errorf("%s is only invoked by POST /lepuscoin/coinbase", coinbaseFunction))
+	return true
+}
+
+// signCoinbase checks the manual coinbase of amount to every addr against the issuance policy,
+// and signs it by the issuer, which is a wallet address. the entry is reserved in the audit log
+// and returned to be updated by the caller. writes the error and returns nil if failed.
+func signCoinbase(ctx *RequestContext, issuer string, addrs []string, amount uint64) (*issuance.Entry, []byte) {
+	e := &issuance.Entry{Kind: issuance.KindManual, UserID: ctx.user.ID, Addrs: addrs, Amount: amount}
+	reject := func(status int, err error) {
+		e.Status, e.Reason = issuance.StatusRejected, err.Error()
+		issuance.Record(ctx.db, e)
+		ctx.Error(status, err)
+	}
+
+	w := openWallet(ctx)
+	if w == nil {
+		return nil, nil
+	}
+	pubkey, err := w.PubKey(issuer)
+	if err != nil {
+		reject(403, err)
+		return nil, nil
+	}
+	e.Issuer = pubkey
+	if err := issuance.LoadPolicy().ReserveManual(ctx.db, e, time.Now()); err != nil {
+		if e.Status == issuance.StatusRejected {
+			ctx.Error(403, err)
+		} else {
+			ctx.Error(500, err)
+		}
+		return nil, nil
+	}
+
+	tx := client.NewTransactionV1("")
+	for _, addr := range addrs {
+		tx.AddTxOut(client.NewTxOut(amount, addr, time.Time{}))
+	}
+	signed, err := w.SignCoinbase(tx, issuer)
+	if err != nil {
+		e.Status, e.Reason = issuance.StatusFailed, err.Error()
+		issuance.Update(ctx.db, e)
+		ctx.Error(500, err)
+		return nil, nil
+	}
+	e.TxHash = tx.TxHash()
+	return e, signed
+}
+
+// invokeCoinbase invokes the signed coinbase, and updates e reserved to issued or failed.
+func invokeCoinbase(db *sql.DB, e *issuance.Entry, signed []byte) ([]byte, error) {
+	bs := base64.StdEncoding.EncodeToString(signed)
+
+	ret, err := func() ([]byte, error) {
+		cw, err := ccManager.Get("lepuscoin", "invoke", coinbaseFunction, bs)
+		if err != nil {
+			return nil, err
+		}
+		return cw.Invoke()
+	}()
+
+	e.Status = issuance.StatusIssued
+	if err != nil {
+		e.Status, e.Reason = issuance.StatusFailed, err.Error()
+	}
+	if rerr := issuance.Update(db, e); rerr != nil && err == nil {
+		err = rerr
+	}
+	return ret, err
+}
+
+// rewardConquest issues the reward of a conquered challenge to the first receive address of the wallet.
+// the farmer signs the coinbase of its own reward, and the chaincode does not check the conquest, so the
+// reward is as trusted as the farmer: it only holds where the farmers are trusted, or the supervisor
+// audits the rewards against its challenges. set farmer.lepuscoin.issuance.reward 0 to disable it.
+func rewardConquest(db *sql.DB, userID string) (*issuance.Entry, error) {
+	w, err := wallet.Open(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	as, err := w.Addresses(0, int(wallet.ChainReceive))
+	if err != nil {
+		return nil, err
+	}
+	var addr string
+	if len(as) > 0 {
+		addr = as[0].Address
+	} else {
+		a, err := w.NextAddress(0, wallet.ChainReceive, "reward")
+		if err != nil {
+			return nil, err
+		}
+		addr = a.Address
+	}
+
+	e := &issuance.Entry{Kind: issuance.KindReward, UserID: userID, Addrs: []string{addr}}
+	if err := issuance.LoadPolicy().ReserveReward(db, e, time.Now()); err != nil {
+		return e, err
+	}
+
+	tx := client.NewTransactionV1("")
+	tx.AddTxOut(client.NewTxOut(e.Amount, addr, time.Time{}))
+	signed, err := w.SignCoinbase(tx, addr)
+	if err != nil {
+		e.Status, e.Reason = issuance.StatusFailed, err.Error()
+		issuance.Update(db, e)
+		return nil, err
+	}
+	e.TxHash = tx.TxHash()
+	_, err = invokeCoinbase(db, e, signed)
+	return e, err
+}
+
+// challengeLoop pings the supervisor every farmer.challenge.pingInterval, answers its challenges,
+// and issues the reward of the conquered. disabled if the interval is 0.
+func challengeLoop(evt *EventHandler) {
+	interval := viper.GetDuration("farmer.challenge.pingInterval")
+	if interval <= 0 {
+		log.Debugf("supervisor challenge is disabled")
+		return
+	}
+	log.Debugf("ping supervisor every %s", interval)
+
+	var src *openchainSource
+	for range time.Tick(interval) {
+		db, u := daemon.GetDB(), daemon.GetUser()
+		if db == nil || u == nil {
+			continue
+		}
+		cli, err := daemon.GetSVClient()
+		if err != nil {
+			continue
+		}
+		if src == nil {
+			if src, err = newOpenchainSource(); err != nil {
+				log.Debugf("connect peer failed, %s", err)
+				continue
+			}
+		}
+		height, err := src.Height()
+		if err != nil || height == 0 {
+			continue
+		}
+
+		rsp, err := cli.FarmerPing(context.Background(), &pb.FarmerPingReq{
+			FarmerID:    u.ID,
+			BlocksRange: &pb.BlocksRange{HighBlockNumber: height - 1},
+		})
+		if err != nil || (rsp.Error != nil && !rsp.Error.OK()) {
+			log.Debugf("ping supervisor failed, %v %v", err, rsp.GetError())
+			supervisorPings.With("error").Inc()
+			continue
+		}
+		if !rsp.NeedChallenge {
+			supervisorPings.With("ok").Inc()
+			continue
+		}
+		supervisorPings.With("challenge").Inc()
+
+		ok, err := challenge.Conquer(cli, u.ID, src, rsp.HashAlgo, rsp.BlocksRange)
+		if err != nil || !ok {
+			log.Debugf("challenge of blocks %v not conquered, %v", rsp.BlocksRange, err)
+			supervisorChallenges.With("failed").Inc()
+			continue
+		}
+		supervisorChallenges.With("conquered").Inc()
+		e, err := rewardConquest(db, u.ID)
+		if err != nil {
+			log.Errorf("reward conquered challenge failed, %s", err)
+			continue
+		}
+		if evt != nil {
+			evt.Broadcast(map[string]interface{}{"lepuscoin_reward": e})
+		}
+	}
+}
+
+// GET /lepuscoin/issuance?kind=manual&status=rejected&limit=20&offset=0
+func ListIssuance(ctx *RequestContext) {
+	limit, offset, ok := parsePage(ctx, 20)
+	if !ok {
+		return
+	}
+
+	es, count, err := issuance.List(ctx.db, ctx.params["kind"], ctx.params["status"], limit, offset)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.res.Header().Set("Record-Count", strconv.Itoa(count))
+	ctx.rnd.JSON(200, es)
+}
+
+// GET /lepuscoin/issuance/policy
+func GetIssuancePolicy(ctx *RequestContext) {
+	p := issuance.LoadPolicy()
+	now := time.Now()
+	issued, err := issuance.Issued(ctx.db, now.Add(-p.Period))
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"issuers":          p.Issuers,
+		"period":           p.Period.String(),
+		"period_cap":       p.PeriodCap,
+		"max_amount":       p.MaxAmount,
+		"reward":           p.Reward,
+		"halving_interval": p.HalvingInterval,
+		"period_issued":    issued,
+	}
+	if reward, err := p.RewardAmount(ctx.db, now); err == nil {
+		ret["next_reward"] = reward
+	} else {
+		ret["next_reward"] = 0
+		ret["next_reward_error"] = fmt.Sprint(err)
+	}
+	ctx.rnd.JSON(200, ret)
+}
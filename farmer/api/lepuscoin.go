@@ -1,7 +1,10 @@
 package api
 
 import (
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -11,6 +14,8 @@ import (
 	"github.com/conseweb/common/assets/lepuscoin/client"
 	pb "github.com/conseweb/common/assets/lepuscoin/protos"
 	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/issuance"
+	"github.com/hyperledger/fabric/farmer/wallet"
 	ccpkg "github.com/hyperledger/fabric/peer/chaincode"
 )
 
@@ -28,6 +33,10 @@ type txWrapper struct {
 	ChargeAddr string  `json:"charge_addr"`
 	In         []txIn  `json:"in"`
 	Out        []txOut `json:"out"`
+
+	// for transfer only, see planTransfer.
+	Fee      uint64 `json:"fee"`
+	Strategy string `json:"strategy"`
 }
 
 type txIn struct {
@@ -35,12 +44,16 @@ type txIn struct {
 	PreTxHash  string `json:"pre_tx_hash"`
 	TxOutIndex string `json:"tx_out_index"`
 	Balance    uint64 `json:"balance"`
+	Until      int64  `json:"until,omitempty"` // locked until, unix seconds
 }
 
 type txOut struct {
 	Addr   string `json:"addr"`
 	Amount uint64 `json:"amount"`
 	Until  int64  `json:"until"`
+
+	// pay to a local contact, the addr is taken from the contact.
+	ContactID int `json:"contact_id,omitempty"`
 }
 
 func queryLepuscoinAddrs(cc *ccpkg.ChaincodeWrapper, addrs ...string) (*pb.QueryAddrResults, error) {
@@ -87,6 +100,7 @@ func getTxIn(cc *ccpkg.ChaincodeWrapper, addrs ...string) ([]txIn, error) {
 				PreTxHash:  phis[0],
 				TxOutIndex: phis[1],
 				Balance:    advl.Value,
+				Until:      advl.Until,
 			}
 			retIns = append(retIns, in)
 		}
@@ -96,6 +110,15 @@ func getTxIn(cc *ccpkg.ChaincodeWrapper, addrs ...string) ([]txIn, error) {
 }
 
 func (tx *txWrapper) Serialized() ([]byte, error) {
+	ptx, err := tx.Build()
+	if err != nil {
+		return nil, err
+	}
+	return ptx.Base64Bytes()
+}
+
+// Build makes the lepuscoin TX, the change goes to ChargeAddr.
+func (tx *txWrapper) Build() (*pb.TX, error) {
 	if len(tx.Out) == 0 {
 		return nil, fmt.Errorf("At least one out_addr is required")
 	}
@@ -137,10 +160,11 @@ func (tx *txWrapper) Serialized() ([]byte, error) {
 		}
 	}
 
-	return txCli.Base64Bytes()
+	return txCli, nil
 }
 
-// invoke chaincode coinbase
+// GET /device/coinbase_tx/:addr?issuer=xxx&amount=1000000
+// signs a coinbase by the issuer under the issuance policy without invoking it, it is recorded as signed.
 func GetCoinBaseTx(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, par martini.Params) {
 	addr := par["addr"]
 
@@ -148,16 +172,25 @@ func GetCoinBaseTx(rw http.ResponseWriter, req *http.Request, ctx *RequestContex
 		ctx.Error(400, fmt.Errorf("invoke coinbase transaction failed, address is nil"))
 		return
 	}
-	cli := client.NewTransactionV1("")
-	cli.AddTxOut(client.NewTxOut(1000000, addr, time.Time{}))
-	bs, err := cli.Base64Bytes()
+	amount, err := strconv.ParseUint(ctx.params["amount"], 10, 64)
 	if err != nil {
-		log.Errorf("encode base64 failed, error: %s", err.Error())
-		ctx.Error(400, err)
+		ctx.Error(400, fmt.Errorf("invalid amount %s", ctx.params["amount"]))
+		return
+	}
+
+	e, signed := signCoinbase(ctx, ctx.params["issuer"], []string{addr}, amount)
+	if e == nil {
+		return
+	}
+	e.Status = issuance.StatusSigned
+	if err := issuance.Update(ctx.db, e); err != nil {
+		ctx.Error(500, err)
 		return
 	}
-	log.Debugf("conbase tx: %s", bs)
-	ctx.rnd.JSON(200, map[string]string{"message": string(bs)})
+
+	bs := base64.StdEncoding.EncodeToString(signed)
+	ctx.log.Debugf("conbase tx: %s", bs)
+	ctx.rnd.JSON(200, map[string]string{"message": bs})
 }
 
 /// POST /lepuscoin/tx
@@ -165,7 +198,7 @@ func NewTx(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, par m
 	var tx txWrapper
 	err := json.NewDecoder(req.Body).Decode(&tx)
 	if err != nil {
-		log.Error(err)
+		ctx.log.Error(err)
 		ctx.Error(400, err)
 		return
 	}
@@ -176,71 +209,45 @@ func NewTx(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, par m
 		return
 	}
 
-	log.Debugf("conbase tx: %s", bs)
+	ctx.log.Debugf("conbase tx: %s", bs)
 	ctx.Message(200, string(bs))
 }
 
 // POST /lepuscoin/deploy
 func DeployLepuscoin(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-	lcc, err := ccManager.Get("lepuscoin", "deploy", "deploy")
-	if err == ErrNotDeploy {
-		name, err := lcc.Deploy()
-		if err != nil {
-			ctx.Error(500, err)
-			return
-		}
-
-		if name != "" {
-			ccManager.SetName("lepuscoin", name)
-			lcc.Name = name // for return frontend
-			log.Debugf("set lepuscoin chaincode name: %s", name)
-		}
-	} else if err != nil {
-		ctx.Error(400, err)
+	cc, err := ccManager.Deploy("lepuscoin", nil)
+	if err != nil {
+		ctx.Error(registryErrStatus(err), err)
 		return
 	}
 
-	log.Debugf("return lepuscoin Chaincode name", lcc.Name)
-	ctx.Message(201, lcc.Name)
+	ctx.log.Debugf("return lepuscoin Chaincode name: %s", cc.Name)
+	ctx.Message(201, cc.Name)
 }
 
-// POST /lepuscoin/coinbase
+// POST /lepuscoin/coinbase {"addrs": ["xxx"], "amount": 1000000, "issuer": "wallet address of an issuer key"}
 func DoCoinbase(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
 	var body struct {
-		Addrs []string `json:"addrs"`
+		Addrs  []string `json:"addrs"`
+		Amount uint64   `json:"amount"`
+		Issuer string   `json:"issuer"`
 	}
 
 	err := json.NewDecoder(ctx.req.Body).Decode(&body)
 	if err != nil {
-		log.Error("decode body failed, ", err)
+		ctx.log.Error("decode body failed, ", err)
 		ctx.Error(400, err)
 		return
 	}
 
-	tx := &txWrapper{}
-	for _, addr := range body.Addrs {
-		tx.Out = append(tx.Out, txOut{
-			Addr:   addr,
-			Amount: 1000000,
-		})
-	}
-	txbs, err := tx.Serialized()
-	if err != nil {
-		log.Errorf("serialized tx failed, %v", err)
-		ctx.Error(500, err)
-		return
-	}
-
-	cw, err := ccManager.Get("lepuscoin", "invoke", "invoke_coinbase", string(txbs))
-	if err != nil {
-		log.Errorf("lepuscoin's chaincode not deploy")
-		ctx.Error(500, err)
+	e, signed := signCoinbase(ctx, body.Issuer, body.Addrs, body.Amount)
+	if e == nil {
 		return
 	}
 
-	retbs, err := cw.Invoke()
+	retbs, err := invokeCoinbase(ctx.db, e, signed)
 	if err != nil {
-		log.Errorf("invoke coinbase failed, %v", err)
+		ctx.log.Errorf("invoke coinbase failed, %v", err)
 		ctx.Error(500, err)
 		return
 	}
@@ -255,71 +262,151 @@ func DoCoinbase(rw http.ResponseWriter, req *http.Request, ctx *RequestContext)
 // 		"addr": "from xxx..."
 // 		}]
 // 	"out": [{
-// 		"addr": "to addr",
+// 		"addr": "to addr", // or "contact_id": 1
 // 		"amount": 100xxx
-// 		}]
+// 		}],
+// 	"fee": 10,
+// 	"strategy": "bnb" // or largest-first, smallest-sufficient
 // }
 func Transfer(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-	var tranf txWrapper
-	err := json.NewDecoder(ctx.req.Body).Decode(&tranf)
-	if err != nil {
-		ctx.Error(400, err)
+	tranf := decodeTransfer(ctx)
+	if tranf == nil {
 		return
 	}
-	if len(tranf.In) == 0 {
-		ctx.Error(400, fmt.Errorf("At least one in address account is required"))
+	plan, w := prepareTransfer(ctx, tranf, false)
+	if plan == nil {
 		return
 	}
+	submitTransfer(ctx, plan, w)
+}
 
-	addrs := make([]string, 0, len(tranf.In))
-	for _, v := range tranf.In {
-		addrs = append(addrs, v.Addr)
-	}
-
-	// get tx's in
-	qAddrCc, err := ccManager.Get("lepuscoin", "query", "query_addrs")
+// submitTransfer signs the planned tx by the wallet and invokes the transfer.
+func submitTransfer(ctx *RequestContext, plan *transferPlan, w *wallet.Wallet) {
+	ptx, err := plan.tx().Build()
 	if err != nil {
+		ctx.log.Errorf("try decode transfer tx failed, %v", err)
 		ctx.Error(500, err)
 		return
 	}
-	in, err := getTxIn(qAddrCc, addrs...)
+
+	signed, err := w.SignTx(ptx)
 	if err != nil {
-		log.Errorf("got tx in failed, %v", err)
-		ctx.Error(500, err)
+		ctx.log.Errorf("sign transfer tx failed, %v", err)
+		ctx.Error(403, err)
 		return
 	}
+	invokeTransfer(ctx, signed)
+}
 
-	tx := &txWrapper{
-		In:  in,
-		Out: tranf.Out,
-	}
-	bs, err := tx.Serialized()
+// invokeTransfer sends the serialized SignedTX to the chaincode.
+func invokeTransfer(ctx *RequestContext, signed []byte) bool {
+	bs := []byte(base64.StdEncoding.EncodeToString(signed))
+
+	cw, err := ccManager.Get("lepuscoin", "invoke", "invoke_transfer", string(bs))
 	if err != nil {
-		log.Errorf("try decode transfer tx failed, %v", err)
+		ctx.log.Errorf("lepuscoin's chaincode not deploy")
 		ctx.Error(500, err)
-		return
+		return false
 	}
 
-	cw, err := ccManager.Get("lepuscoin", "invoke", "invoke_transfer", string(bs))
+	retbs, err := cw.Invoke()
 	if err != nil {
-		log.Errorf("lepuscoin's chaincode not deploy")
+		ctx.log.Errorf("invoke coinbase failed, %v", err)
 		ctx.Error(500, err)
+		return false
+	}
+
+	ctx.Message(200, string(retbs))
+	return true
+}
+
+// POST /lepuscoin/transfer/dryrun, the same body as transfer, returns the plan without invoking.
+func DryRunTransfer(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	tranf := decodeTransfer(ctx)
+	if tranf == nil {
+		return
+	}
+	plan, _ := prepareTransfer(ctx, tranf, false)
+	if plan == nil {
 		return
 	}
+	ctx.rnd.JSON(200, plan)
+}
 
-	retbs, err := cw.Invoke()
+// decodeTransfer decodes the transfer body, writes the error and returns nil if failed.
+func decodeTransfer(ctx *RequestContext) *txWrapper {
+	tranf := &txWrapper{}
+	if err := json.NewDecoder(ctx.req.Body).Decode(tranf); err != nil {
+		ctx.Error(400, err)
+		return nil
+	}
+	return tranf
+}
+
+// prepareTransfer plans the transfer from the spendable utxos of the in addresses, which are
+// the multisig addresses of the wallet if multisig. writes the error and returns nil if failed.
+func prepareTransfer(ctx *RequestContext, tranf *txWrapper, multisig bool) (*transferPlan, *wallet.Wallet) {
+	if len(tranf.In) == 0 {
+		ctx.Error(400, fmt.Errorf("At least one in address account is required"))
+		return nil, nil
+	}
+	if err := resolveContactOuts(ctx.db, ctx.user.ID, tranf.Out); err != nil {
+		status := 409
+		if errors.Is(err, sql.ErrNoRows) {
+			status = 404
+		}
+		ctx.Error(status, err)
+		return nil, nil
+	}
+
+	// only the addresses of the wallet can be spent, every txin is signed by its key.
+	w := openWallet(ctx)
+	if w == nil {
+		return nil, nil
+	}
+	addrs := make([]string, 0, len(tranf.In))
+	for _, v := range tranf.In {
+		var err error
+		if multisig {
+			if _, err = w.LookupMultisig(v.Addr); err == sql.ErrNoRows {
+				err = fmt.Errorf("%s is not a multisig address of the wallet", v.Addr)
+			}
+		} else {
+			_, err = w.Key(v.Addr)
+		}
+		if err != nil {
+			ctx.Error(403, err)
+			return nil, nil
+		}
+		addrs = append(addrs, v.Addr)
+	}
+
+	// get tx's in
+	qAddrCc, err := ccManager.Get("lepuscoin", "query", "query_addrs")
 	if err != nil {
-		log.Errorf("invoke coinbase failed, %v", err)
 		ctx.Error(500, err)
-		return
+		return nil, nil
+	}
+	utxos, err := getTxIn(qAddrCc, addrs...)
+	if err != nil {
+		ctx.log.Errorf("got tx in failed, %v", err)
+		ctx.Error(500, err)
+		return nil, nil
 	}
 
-	ctx.Message(200, string(retbs))
+	plan, err := planTransfer(tranf, spendableTxIns(utxos, time.Now()))
+	if err != nil {
+		ctx.Error(400, err)
+		return nil, nil
+	}
+	ctx.log.Debugf("transfer plan: %+v", plan)
+	return plan, w
 }
 
-// GET /lepuscoin/balance?addrs=[....]&format=false
+// GET /lepuscoin/balance?addrs=[....]&format=false&summary=false
 func QueryAddrs(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
 	format, _ := strconv.ParseBool(ctx.params["format"])
+	summary, _ := strconv.ParseBool(ctx.params["summary"])
 	param := ctx.params["addrs"]
 	if len(param) == 0 {
 		ctx.Error(400, "need addrs")
@@ -334,18 +421,23 @@ func QueryAddrs(rw http.ResponseWriter, req *http.Request, ctx *RequestContext)
 	}
 
 	var ret interface{}
-	if format {
+	if summary {
+		var ins []txIn
+		if ins, err = getTxIn(qAddrCc, addrs...); err == nil {
+			ret = summarizeBalances(addrs, ins, time.Now())
+		}
+	} else if format {
 		ret, err = getTxIn(qAddrCc, addrs...)
 	} else {
 		ret, err = queryLepuscoinAddrs(qAddrCc, addrs...)
 	}
 	if err != nil {
-		log.Errorf("got tx in failed, %v", err)
+		ctx.log.Errorf("got tx in failed, %v", err)
 		ctx.Error(500, err)
 		return
 	}
 
-	log.Debugf("query balance, ret: %+v", ret)
+	ctx.log.Debugf("query balance, ret: %+v", ret)
 	ctx.rnd.JSON(200, ret)
 }
 
@@ -396,7 +488,7 @@ func QueryTx(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, par
 
 	txs, err := GetTxList(cc, nil, sHash, depth)
 	if err != nil {
-		log.Errorf("Get tx list failed, %v", err)
+		ctx.log.Errorf("Get tx list failed, %v", err)
 		ctx.Error(500, err)
 		return
 	}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/issuance"
+	"github.com/hyperledger/fabric/farmer/lottery"
+	"github.com/spf13/viper"
+)
+
+// ledgerState returns the state of the ledger and the challenges of userID, which the lottery number
+// is derived from.
+func ledgerState(db *sql.DB, userID string) (*lottery.State, error) {
+	src, err := peerSource()
+	if err != nil {
+		return nil, err
+	}
+	height, err := src.Height()
+	if err != nil {
+		return nil, err
+	}
+	if height == 0 {
+		return nil, fmt.Errorf("ledger has no block")
+	}
+	block, err := src.Block(height - 1)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := block.GetHash()
+	if err != nil {
+		return nil, err
+	}
+	n, err := issuance.Conquered(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &lottery.State{Height: height, BlockHash: hash, Conquered: n}, nil
+}
+
+func lotteryClient() (*lottery.Client, error) {
+	api, err := daemon.GetLotteryClient()
+	if err != nil {
+		return nil, err
+	}
+	return lottery.NewClient(api, daemon.GetDB()), nil
+}
+
+// lotteryLoop sends the ticket of the farmer account to the open lottery, and checks the results of
+// the ended ones every farmer.lottery.interval.
+func lotteryLoop(evt *EventHandler) {
+	interval := viper.GetDuration("farmer.lottery.interval")
+	if interval <= 0 {
+		log.Debugf("lottery is disabled")
+		return
+	}
+	log.Debugf("take part in the lottery every %s", interval)
+
+	for range time.Tick(interval) {
+		db, u := daemon.GetDB(), daemon.GetUser()
+		if db == nil {
+			continue
+		}
+		c, err := lotteryClient()
+		if err != nil {
+			continue
+		}
+		now := time.Now()
+
+		if u != nil {
+			if s, err := ledgerState(db, u.ID); err != nil {
+				log.Debugf("get ledger state failed, %s", err)
+			} else if t, err := c.Participate(u.ID, s, now); err == nil {
+				evt.Broadcast(map[string]interface{}{"lottery_ticket": t})
+			} else if err != lottery.ErrSent && err != lottery.ErrNotOpen {
+				log.Debugf("take part in the lottery failed, %s", err)
+			}
+		}
+
+		ts, err := lottery.Pending(db, now)
+		if err != nil {
+			log.Errorf("list pending lottery tickets failed, %s", err)
+			continue
+		}
+		for _, t := range ts {
+			if err := c.Check(t, now); err != nil {
+				log.Debugf("check lottery ticket %d failed, %s", t.ID, err)
+				continue
+			}
+			evt.Broadcast(map[string]interface{}{"lottery_result": t})
+		}
+	}
+}
+
+// GET /lottery/next, the window of the next lottery and the ticket of the user in it.
+func GetNextLottery(ctx *RequestContext) {
+	c, err := lotteryClient()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	w, err := c.Next()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	ret := map[string]interface{}{
+		"start": w.Start,
+		"end":   w.End,
+		"open":  w.Open(time.Now()),
+	}
+	if t, err := lottery.Find(ctx.db, ctx.user.ID, w.Start); err == nil {
+		ret["ticket"] = t
+	} else if err != sql.ErrNoRows {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, ret)
+}
+
+// POST /lottery/tickets, sends the ticket of the user to the open lottery.
+func SendLotteryTicket(ctx *RequestContext) {
+	c, err := lotteryClient()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	s, err := ledgerState(ctx.db, ctx.user.ID)
+	if err != nil {
+		ctx.Error(500, err, "get ledger state failed")
+		return
+	}
+
+	t, err := c.Participate(ctx.user.ID, s, time.Now())
+	switch err {
+	case nil:
+	case lottery.ErrNotOpen:
+		ctx.Error(400, err)
+		return
+	case lottery.ErrSent:
+		ctx.Error(409, err, fmt.Sprintf("ticket %d", t.ID))
+		return
+	default:
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(201, t)
+}
+
+// GET /lottery/tickets?limit=20&offset=0, the tickets of the user, the latest first.
+func ListLotteryTickets(ctx *RequestContext) {
+	limit, offset, ok := parsePage(ctx, 20)
+	if !ok {
+		return
+	}
+
+	ts, count, err := lottery.List(ctx.db, ctx.user.ID, limit, offset)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.res.Header().Set("Record-Count", strconv.Itoa(count))
+	ctx.rnd.JSON(200, ts)
+}
+
+func getLotteryTicket(ctx *RequestContext, params martini.Params) (*lottery.Ticket, bool) {
+	id, err := strconv.ParseInt(params["id"], 10, 64)
+	if err != nil {
+		ctx.Error(400, fmt.Errorf("invalid ticket id %s", params["id"]))
+		return nil, false
+	}
+	t, err := lottery.Get(ctx.db, ctx.user.ID, id)
+	if err == sql.ErrNoRows {
+		ctx.Error(404, fmt.Errorf("not found ticket %d", id))
+		return nil, false
+	}
+	if err != nil {
+		ctx.Error(500, err)
+		return nil, false
+	}
+	return t, true
+}
+
+// GET /lottery/tickets/:id
+func GetLotteryTicket(ctx *RequestContext, params martini.Params) {
+	if t, ok := getLotteryTicket(ctx, params); ok {
+		ctx.rnd.JSON(200, t)
+	}
+}
+
+// POST /lottery/tickets/:id/check, gets and verifies the result of the ended lottery now.
+func CheckLotteryTicket(ctx *RequestContext, params martini.Params) {
+	t, ok := getLotteryTicket(ctx, params)
+	if !ok {
+		return
+	}
+	c, err := lotteryClient()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	if err := c.Check(t, time.Now()); err == lottery.ErrNotDrawn {
+		ctx.Error(400, err)
+		return
+	} else if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, t)
+}
@@ -1,9 +1,182 @@
 package api
 
 import (
+	"io"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/golang/protobuf/ptypes/empty"
+	"github.com/hyperledger/fabric/farmer/indexer"
+	"github.com/hyperledger/fabric/farmer/metrics"
+	"github.com/hyperledger/fabric/farmer/quota"
+	"github.com/hyperledger/fabric/storage"
+	"golang.org/x/net/context"
 )
 
+var (
+	httpRequests = metrics.NewCounterVec("farmer_http_requests_total",
+		"HTTP requests by the route pattern and the status code.", "method", "route", "code")
+	httpDuration = metrics.NewHistogramVec("farmer_http_request_duration_seconds",
+		"Latency of the HTTP requests by the route pattern.", nil, "method", "route")
+
+	httpRateLimited = metrics.NewCounterVec("farmer_http_rate_limited_total",
+		"Requests refused by the rate limits by the route class.", "class")
+
+	storageBytes = metrics.NewCounterVec("farmer_storage_bytes_total",
+		"Bytes read and written by the storage driver.", "driver", "op")
+	// /metrics is not authenticated, the storage is not labeled by the users.
+	storageUsed = metrics.NewGaugeVec("farmer_storage_used_bytes",
+		"Bytes of the files written by all the users.")
+	storageFull = metrics.NewGaugeVec("farmer_storage_quota_full_users",
+		"Users whose files reach their storage quota.")
+
+	supervisorPings = metrics.NewCounterVec("farmer_supervisor_pings_total",
+		"Pings of the supervisor by the result, ok, error or challenge.", "result")
+	supervisorChallenges = metrics.NewCounterVec("farmer_supervisor_challenges_total",
+		"Challenges of the supervisor by the result, conquered or failed.", "result")
+
+	indexerFiles   = metrics.NewGaugeVec("farmer_indexer_files", "Files in the indexer.")
+	indexerBytes   = metrics.NewGaugeVec("farmer_indexer_bytes", "Total size of the files in the indexer.")
+	indexerDevices = metrics.NewGaugeVec("farmer_indexer_devices", "Devices in the indexer.")
+
+	peerUp     = metrics.NewGaugeVec("farmer_peer_up", "1 if the embedded peer answers the blockchain info.")
+	peerHeight = metrics.NewGaugeVec("farmer_peer_block_height", "Block height of the embedded peer.")
+)
+
+// how long a scrape waits the peer.
+const peerScrapeTimeout = 2 * time.Second
+
+// RouteMW records the route pattern of the request for the metrics, used in the route groups.
+func RouteMW(ctx *RequestContext, r martini.Route) {
+	ctx.route = r.Pattern()
+}
+
+// MetricsMW counts the requests and their latencies by the route pattern, the unmatched are "other".
+func MetricsMW(ctx *RequestContext, mc martini.Context) {
+	start := time.Now()
+	mc.Next()
+
+	route := ctx.route
+	if route == "" {
+		route = "other"
+	}
+	code := 200
+	if rw, ok := ctx.res.(martini.ResponseWriter); ok && rw.Status() != 0 {
+		code = rw.Status()
+	}
+	httpRequests.With(ctx.req.Method, route, strconv.Itoa(code)).Inc()
+	httpDuration.With(ctx.req.Method, route).Observe(time.Since(start).Seconds())
+}
+
+// meteredDriver counts the bytes read and written by the driver.
+type meteredDriver struct {
+	storage.StorageDriver
+}
+
+func (d meteredDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	bs, err := d.StorageDriver.GetContent(ctx, path)
+	storageBytes.With(d.Name(), "read").Add(float64(len(bs)))
+	return bs, err
+}
+
+func (d meteredDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	err := d.StorageDriver.PutContent(ctx, path, content)
+	if err == nil {
+		storageBytes.With(d.Name(), "write").Add(float64(len(content)))
+	}
+	return err
+}
+
+func (d meteredDriver) Reader(ctx context.Context, path string) (io.ReadCloser, error) {
+	r, err := d.StorageDriver.Reader(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReader{ReadCloser: r, c: storageBytes.With(d.Name(), "read")}, nil
+}
+
+func (d meteredDriver) Writer(ctx context.Context, path string, append bool) (io.WriteCloser, error) {
+	w, err := d.StorageDriver.Writer(ctx, path, append)
+	if err != nil {
+		return nil, err
+	}
+	return &countingWriter{WriteCloser: w, c: storageBytes.With(d.Name(), "write")}, nil
+}
+
+type countingReader struct {
+	io.ReadCloser
+	c *metrics.Counter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.c.Add(float64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	io.WriteCloser
+	c *metrics.Counter
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.c.Add(float64(n))
+	return n, err
+}
+
+// collectGauges updates the gauges which are read at the scrape.
+func collectGauges() {
+	if db := daemon.GetDB(); db != nil {
+		if us, err := quota.List(db, defaultQuota()); err == nil {
+			var used, full int64
+			for _, u := range us {
+				used += u.Used
+				if u.Available() == 0 {
+					full++
+				}
+			}
+			storageUsed.With().Set(float64(used))
+			storageFull.With().Set(float64(full))
+		} else {
+			log.Debugf("count storage usage failed, %s", err)
+		}
+	}
+	if orm, err := indexer.InitDB(); err == nil {
+		if s, err := indexer.GetStats(orm.DB().DB); err == nil {
+			indexerFiles.With().Set(float64(s.Files))
+			indexerBytes.With().Set(float64(s.Bytes))
+			indexerDevices.With().Set(float64(s.Devices))
+		} else {
+			log.Debugf("count indexer failed, %s", err)
+		}
+	}
+
+	up := peerUp.With()
+	up.Set(0)
+	src, err := peerSource()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), peerScrapeTimeout)
+	defer cancel()
+	info, err := src.cli.GetBlockchainInfo(ctx, &empty.Empty{})
+	if err != nil {
+		log.Debugf("get blockchain info failed, %s", err)
+		return
+	}
+	up.Set(1)
+	peerHeight.With().Set(float64(info.Height))
+}
+
+// GET /metrics, in the prometheus text format.
 func GetMetrics(rw http.ResponseWriter, req *http.Request) {
+	collectGauges()
 
+	rw.Header().Set("Content-Type", metrics.ContentType)
+	if err := metrics.WriteText(rw); err != nil {
+		log.Warningf("write metrics failed, %s", err)
+	}
 }
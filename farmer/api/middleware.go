@@ -1,66 +1,114 @@
 package api
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/account"
 	"github.com/hyperledger/fabric/farmer/indexer"
+	"github.com/hyperledger/fabric/farmer/registry"
+	"github.com/hyperledger/fabric/farmer/session"
+	"github.com/hyperledger/fabric/storage"
 	"github.com/hyperledger/fabric/storage/localfs"
 	"github.com/spf13/viper"
 )
 
-// need user login
+// bearerToken returns the token of the Authorization header, or of the access_token param
+// for the clients can't set headers, e.g. the links of downloads.
+func bearerToken(ctx *RequestContext) string {
+	auth := ctx.req.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ctx.params["access_token"]
+}
+
+// need user login, sets the user and the session of the token.
 func AuthMW(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-	if !daemon.IsLogin() {
-		ctx.Message(401, "login required.")
+	token := bearerToken(ctx)
+	if token == "" {
+		ctx.Error(401, errLoginRequired)
+		return
+	}
+	if sessions == nil {
+		ctx.Error(503, fmt.Errorf("sessions are not ready"))
 		return
 	}
-}
 
-// if lepuscoin chaincode not deploy, try to deploy and return a 501 error.
-func DeployLepuscoinMW(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-	lcc, err := ccManager.Get("lepuscoin", "deploy", "deploy")
-	if err == ErrNotDeploy {
-		name, err := lcc.Deploy()
-		if err != nil {
-			ctx.Error(500, err)
-			return
-		}
+	s, err := sessions.Verify(token)
+	switch err {
+	case nil:
+	case session.ErrInvalidToken, session.ErrExpired, session.ErrRevoked:
+		ctx.Error(401, err)
+		return
+	default:
+		ctx.Error(500, err)
+		return
+	}
 
-		if name != "" {
-			ccManager.SetName("lepuscoin", name)
-			lcc.Name = name // for return frontend
-			log.Debugf("set lepuscoin chaincode name: %s", name)
-		}
-		ctx.Error(501, fmt.Errorf("lepuscoin chaincode is deploying, please wait."))
+	a, err := account.Load(ctx.db, s.UserID)
+	if err == sql.ErrNoRows {
+		ctx.Error(401, fmt.Errorf("not found account %s, login again", s.UserID))
 		return
-	} else if err != nil {
-		ctx.Error(400, err)
+	}
+	if err != nil {
+		ctx.Error(500, err)
 		return
 	}
+	ctx.user, ctx.session = a, s
+	ctx.role = requestRole(req, a)
 }
 
-func DeployNameSrvnMW(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-	lcc, err := ccManager.Get("nameservice", "deploy", "deploy")
-	if err == ErrNotDeploy {
-		name, err := lcc.Deploy()
-		if err != nil {
-			ctx.Error(500, err)
-			return
-		}
+// ensureDeployed deploys the alias if not deployed, and waits it at most farmer.chaincode.waitTimeout.
+// writes the error and returns false if it is not ready.
+func ensureDeployed(ctx *RequestContext, alias string) bool {
+	if _, err := ccManager.Get(alias); err == nil {
+		return true
+	} else if err != ErrNotDeploy {
+		ctx.Error(registryErrStatus(err), err)
+		return false
+	}
 
-		if name != "" {
-			ccManager.SetName("nameservice", name)
-			lcc.Name = name // for return frontend
-			log.Debugf("set nameservice chaincode name: %s", name)
-		}
-		ctx.Error(501, fmt.Errorf("nameservice chaincode is deploying, please wait."))
-		return
-	} else if err != nil {
-		ctx.Error(400, err)
-		return
+	if _, err := ccManager.Deploy(alias, nil); err != nil {
+		ctx.Error(500, err)
+		return false
+	}
+	timeout := viper.GetDuration("farmer.chaincode.waitTimeout")
+	if timeout <= 0 {
+		timeout = defaultChaincodeWaitTimeout
+	}
+	cc, ok := ccManager.WaitReady(alias, timeout)
+	if !ok {
+		ctx.Error(404, fmt.Errorf("chaincode %s, %w", alias, ErrNotFound))
+		return false
+	}
+
+	switch cc.Status {
+	case registry.StatusReady:
+		return true
+	case registry.StatusFailed:
+		ctx.Error(500, fmt.Errorf("deploy %s chaincode failed, %s", alias, cc.Error))
+	default:
+		ctx.res.Header().Set("Retry-After", "5")
+		ctx.Error(503, withCode(CodeChaincodeNotDeploy, fmt.Errorf("%s chaincode is deploying, please wait, see GET /api/chaincode/%s.", alias, alias)))
 	}
+	return false
+}
+
+// if lepuscoin chaincode not deploy, try to deploy and wait it to be ready.
+func DeployLepuscoinMW(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	ensureDeployed(ctx, "lepuscoin")
+}
+
+func DeployNameSrvnMW(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	ensureDeployed(ctx, "nameservice")
+}
+
+func DeployPoeMW(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	ensureDeployed(ctx, "poe")
 }
 
 func SetIndexerDBMW(ctx *RequestContext, mc martini.Context) {
@@ -72,30 +120,40 @@ func SetIndexerDBMW(ctx *RequestContext, mc martini.Context) {
 	mc.Map(orm)
 }
 
+// SetFsDriverMW maps the storage driver, the writes of the login user are limited by the quota.
 func SetFsDriverMW(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, mc martini.Context) {
-	if fsDriver != nil {
-		mc.Map(fsDriver)
+	fs, err := getFsDriver()
+	if err != nil {
+		ctx.Error(500, err)
 		return
 	}
+	if ctx.user != nil && ctx.db != nil {
+		fs = quotaDriver{StorageDriver: fs, db: ctx.db, user: ctx.user.ID}
+	}
+	mc.MapTo(fs, (*storage.StorageDriver)(nil))
+}
+
+// getFsDriver returns the storage driver of farmer.fstype, opened at the first call.
+func getFsDriver() (storage.StorageDriver, error) {
+	if fsDriver != nil {
+		return fsDriver, nil
+	}
 
 	fstype := viper.GetString("farmer.fstype")
 	rootPath := viper.GetString("farmer.localChroot")
-	var err error
 
 	switch fstype {
 	case "ipfs":
-		ctx.Error(500, "TODO")
-		return
+		return nil, fmt.Errorf("TODO")
 	case "local":
 		log.Infof("farmer use local filesystem")
-		fsDriver, err = localfs.NewDriver(rootPath)
+		d, err := localfs.NewDriver(rootPath)
 		if err != nil {
-			ctx.Error(500, "get chroot path failed.")
-			return
+			return nil, fmt.Errorf("get chroot path failed.")
 		}
+		fsDriver = meteredDriver{d}
 	default:
-		ctx.Error(500, fmt.Errorf("unknown storage type %s", fstype))
-		return
+		return nil, fmt.Errorf("unknown storage type %s", fstype)
 	}
-	mc.Map(fsDriver)
+	return fsDriver, nil
 }
@@ -0,0 +1,207 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/wallet"
+	"github.com/spf13/viper"
+)
+
+// GET /wallet/addresses/:addr/pubkey, for the co-signers of a multisig address.
+func GetWalletPubKey(ctx *RequestContext, params martini.Params) {
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	pk, err := w.PubKey(params["addr"])
+	if _, ok := err.(*wallet.CannotSignError); ok {
+		ctx.Error(404, err)
+		return
+	}
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, map[string]string{"addr": params["addr"], "pubkey": pk})
+}
+
+// GET /wallet/multisig
+func ListWalletMultisigs(ctx *RequestContext) {
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	mss, err := w.Multisigs()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, mss)
+}
+
+// POST /wallet/multisig {"m": 2, "pubkeys": ["02xxx", "03xxx", "02xxx"], "label": "shared"}
+func NewWalletMultisig(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	var body struct {
+		M       int      `json:"m"`
+		Pubkeys []string `json:"pubkeys"`
+		Label   string   `json:"label"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	ms, err := w.NewMultisig(body.M, body.Pubkeys, body.Label, viper.GetBool("daemon.dev"))
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	ctx.rnd.JSON(201, ms)
+}
+
+// POST /lepuscoin/multisig/spend, the same body as transfer, the in addresses are multisig.
+// returns the psbt signed by the wallet, pass its "psbt" to the other co-signers.
+func SpendMultisig(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	tranf := decodeTransfer(ctx)
+	if tranf == nil {
+		return
+	}
+	plan, w := prepareTransfer(ctx, tranf, true)
+	if plan == nil {
+		return
+	}
+
+	ptx, err := plan.tx().Build()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	p, err := w.NewPSBT(ptx)
+	if err != nil {
+		ctx.log.Errorf("create psbt failed, %v", err)
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(201, p)
+}
+
+// GET /lepuscoin/psbt, the psbts created or imported by the login user.
+func ListPSBTs(ctx *RequestContext) {
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	ps, err := w.PSBTs()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, ps)
+}
+
+// POST /lepuscoin/psbt {"psbt": "base64 from a co-signer"}, merges the signatures into the saved one.
+// it must have a txin of the wallet keys.
+func ImportPSBT(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	var body struct {
+		PSBT string `json:"psbt"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	p, err := w.ImportPSBT([]byte(body.PSBT))
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	ctx.rnd.JSON(200, p)
+}
+
+// GET /lepuscoin/psbt/:hash
+func GetPSBT(ctx *RequestContext, params martini.Params) {
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	p, err := w.GetPSBT(params["hash"])
+	if !psbtFound(ctx, params["hash"], err) {
+		return
+	}
+	ctx.rnd.JSON(200, p)
+}
+
+// POST /lepuscoin/psbt/:hash/sign
+func SignPSBT(ctx *RequestContext, params martini.Params) {
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	p, err := w.SignPSBT(params["hash"])
+	if !psbtFound(ctx, params["hash"], err) {
+		return
+	}
+	ctx.rnd.JSON(200, p)
+}
+
+// POST /lepuscoin/psbt/:hash/submit, invokes the transfer once every txin is signed.
+func SubmitPSBT(ctx *RequestContext, params martini.Params) {
+	hash := params["hash"]
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	p, err := w.GetPSBT(hash)
+	if !psbtFound(ctx, hash, err) {
+		return
+	}
+	if p.Submitted {
+		ctx.Error(409, fmt.Errorf("psbt %s is submitted", hash))
+		return
+	}
+
+	signed, err := w.FinalizePSBT(hash)
+	if err != nil {
+		ctx.Error(409, err)
+		return
+	}
+	if !invokeTransfer(ctx, signed) {
+		return
+	}
+	if err := w.MarkSubmitted(hash); err != nil {
+		ctx.log.Errorf("mark psbt %s submitted failed, %v", hash, err)
+	}
+}
+
+// psbtFound writes the error of getting the psbt hash, false if any.
+func psbtFound(ctx *RequestContext, hash string, err error) bool {
+	if err == sql.ErrNoRows {
+		ctx.Error(404, fmt.Errorf("psbt %s not found", hash))
+		return false
+	}
+	if err != nil {
+		ctx.Error(500, err)
+		return false
+	}
+	return true
+}
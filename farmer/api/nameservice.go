@@ -2,35 +2,26 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-martini/martini"
 )
 
 // POST /nameservice/deploy
 func DeployNameService(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-	lcc, err := ccManager.Get("nameservice", "deploy", "deploy")
-	if err == ErrNotDeploy {
-		name, err := lcc.Deploy()
-		if err != nil {
-			ctx.Error(500, err)
-			return
-		}
-
-		if name != "" {
-			ccManager.SetName("nameservice", name)
-			lcc.Name = name // for return frontend
-			log.Debugf("set nameservice chaincode name: %s", name)
-		}
-	} else if err != nil {
-		ctx.Error(400, err)
+	cc, err := ccManager.Deploy("nameservice", nil)
+	if err != nil {
+		ctx.Error(registryErrStatus(err), err)
 		return
 	}
 
-	log.Debugf("return nameservice Chaincode name", lcc.Name)
-	ctx.Message(201, lcc.Name)
+	ctx.log.Debugf("return nameservice Chaincode name: %s", cc.Name)
+	ctx.Message(201, cc.Name)
 }
 
+// POST /namesrv/new {"key": "a", "value": "b"}
 func NewNameServiceKV(ctx *RequestContext) {
 	var kv struct {
 		Key   string `json:"key"`
@@ -45,7 +36,7 @@ func NewNameServiceKV(ctx *RequestContext) {
 
 	cc, err := ccManager.Get("nameservice", "invoke", "addoto", kv.Key, kv.Value)
 	if err != nil {
-		ctx.Error(500, err)
+		ctx.Error(registryErrStatus(err), err)
 		return
 	}
 
@@ -55,14 +46,15 @@ func NewNameServiceKV(ctx *RequestContext) {
 		return
 	}
 
-	ctx.res.Write(bs)
-	ctx.res.WriteHeader(201)
+	// the txid of the invoke.
+	ctx.Message(201, string(bs))
 }
 
+// DELETE /namesrv/:key
 func RemoveNameServiceKV(ctx *RequestContext, params martini.Params) {
 	cc, err := ccManager.Get("nameservice", "invoke", "deloto", params["key"])
 	if err != nil {
-		ctx.Error(500, err)
+		ctx.Error(registryErrStatus(err), err)
 		return
 	}
 
@@ -72,6 +64,36 @@ func RemoveNameServiceKV(ctx *RequestContext, params martini.Params) {
 		return
 	}
 
-	ctx.res.Write(bs)
-	ctx.res.WriteHeader(201)
+	// the txid of the invoke.
+	ctx.Message(201, string(bs))
+}
+
+// resolveNameService returns the value of key in nameservice chaincode.
+func resolveNameService(key string) (string, error) {
+	cc, err := ccManager.Get("nameservice", "query", "getoto", key)
+	if err != nil {
+		return "", err
+	}
+
+	bs, err := cc.Query()
+	if err != nil {
+		return "", err
+	}
+
+	value := strings.TrimSpace(string(bs))
+	if value == "" {
+		return "", fmt.Errorf("name %s not found", key)
+	}
+	return value, nil
+}
+
+// GET /namesrv/:key
+func ResolveNameServiceKV(ctx *RequestContext, params martini.Params) {
+	value, err := resolveNameService(params["key"])
+	if err != nil {
+		ctx.Error(404, err)
+		return
+	}
+
+	ctx.rnd.JSON(200, map[string]string{"key": params["key"], "value": value})
 }
@@ -0,0 +1,18 @@
+package api
+
+import (
+	_ "embed"
+)
+
+// openapiSpec describes every route of apiRoutes, it is checked against the routes and the handlers
+// by openapi_test.go, and farmer/client is generated from it.
+//
+//go:embed openapi.json
+var openapiSpec []byte
+
+// GET /openapi.json, the swagger 2.0 document of the api.
+func GetOpenAPI(ctx *RequestContext) {
+	ctx.res.Header().Set("Content-Type", "application/json; charset=utf-8")
+	ctx.res.WriteHeader(200)
+	ctx.res.Write(openapiSpec)
+}
@@ -0,0 +1,609 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conseweb/common/hdwallet"
+	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/account"
+	fclient "github.com/hyperledger/fabric/farmer/client"
+	daepkg "github.com/hyperledger/fabric/farmer/daemon"
+	"github.com/hyperledger/fabric/farmer/history"
+	"github.com/hyperledger/fabric/farmer/indexer"
+	"github.com/hyperledger/fabric/farmer/invoice"
+	"github.com/hyperledger/fabric/farmer/issuance"
+	"github.com/hyperledger/fabric/farmer/lottery"
+	"github.com/hyperledger/fabric/farmer/poe"
+	"github.com/hyperledger/fabric/farmer/quota"
+	"github.com/hyperledger/fabric/farmer/registry"
+	"github.com/hyperledger/fabric/farmer/session"
+	"github.com/hyperledger/fabric/farmer/wallet"
+	ccpkg "github.com/hyperledger/fabric/peer/chaincode"
+	"github.com/hyperledger/fabric/storage"
+	"github.com/spf13/viper"
+)
+
+type specSchema struct {
+	Type                 string                 `json:"type"`
+	Format               string                 `json:"format"`
+	Ref                  string                 `json:"$ref"`
+	Nullable             bool                   `json:"x-nullable"`
+	Items                *specSchema            `json:"items"`
+	AdditionalProperties *specSchema            `json:"additionalProperties"`
+	Properties           map[string]*specSchema `json:"properties"`
+}
+
+type specOperation struct {
+	OperationID string `json:"operationId"`
+	Responses   map[string]struct {
+		Schema *specSchema `json:"schema"`
+	} `json:"responses"`
+}
+
+type specDoc struct {
+	BasePath    string                               `json:"basePath"`
+	Paths       map[string]map[string]*specOperation `json:"paths"`
+	Definitions map[string]*specSchema               `json:"definitions"`
+}
+
+func loadSpec(t *testing.T) *specDoc {
+	doc := &specDoc{}
+	if err := json.Unmarshal(openapiSpec, doc); err != nil {
+		t.Fatalf("invalid openapi.json, %s", err)
+	}
+	return doc
+}
+
+func (doc *specDoc) resolve(s *specSchema) *specSchema {
+	for s != nil && s.Ref != "" {
+		s = doc.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+	}
+	return s
+}
+
+// specPath is the path in the document of the martini pattern, :id is {id} and ** is {path}.
+func specPath(pattern string) string {
+	segs := strings.Split(strings.TrimPrefix(pattern, API_PREFIX), "/")
+	for i, s := range segs {
+		switch {
+		case s == "**":
+			segs[i] = "{path}"
+		case strings.HasPrefix(s, ":"):
+			segs[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadSpec(t)
+	if doc.BasePath != API_PREFIX {
+		t.Errorf("basePath is %s", doc.BasePath)
+	}
+
+	r := martini.NewRouter()
+	r.Group(API_PREFIX, apiRoutes)
+
+	routed := map[string]bool{}
+	for _, rt := range r.All() {
+		path, method := specPath(rt.Pattern()), strings.ToLower(rt.Method())
+		ops, ok := doc.Paths[path]
+		if !ok {
+			t.Errorf("route %s %s is not in openapi.json", rt.Method(), path)
+			continue
+		}
+		// a route of any method is documented by some methods.
+		if method == "*" {
+			for m := range ops {
+				routed[m+" "+path] = true
+			}
+			continue
+		}
+		if _, ok := ops[method]; !ok {
+			t.Errorf("route %s %s is not in openapi.json", rt.Method(), path)
+		}
+		routed[method+" "+path] = true
+	}
+
+	ids := map[string]string{}
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			if !routed[method+" "+path] {
+				t.Errorf("%s %s of openapi.json has no route", strings.ToUpper(method), path)
+			}
+			if prev, ok := ids[op.OperationID]; ok || op.OperationID == "" {
+				t.Errorf("operationId %q of %s %s is not unique, %s", op.OperationID, method, path, prev)
+			}
+			ids[op.OperationID] = method + " " + path
+		}
+	}
+}
+
+// specTypes are the go values of the definitions, their json fields must be the properties.
+var specTypes = map[string]interface{}{
+	"Account":        account.Account{},
+	"Device":         account.Device{},
+	"DeviceStatus":   deviceWrapper{},
+	"Settings":       account.Settings{},
+	"Notify":         account.Notify{},
+	"SignUp":         accountWrapper{},
+	"Session":        session.Session{},
+	"Member":         account.Member{},
+	"Revocation":     account.Revocation{},
+	"Contact":        account.Contact{},
+	"ImportResult":   account.ImportResult{},
+	"ChaincodeSpec":  ccpkg.ChaincodeWrapper{},
+	"Chaincode":      registry.Chaincode{},
+	"WalletAccount":  wallet.Account{},
+	"Address":        wallet.Address{},
+	"Balance":        wallet.Balance{},
+	"Multisig":       wallet.Multisig{},
+	"PSBT":           wallet.PSBT{},
+	"PSBTInput":      wallet.PSBTInput{},
+	"TxIn":           txIn{},
+	"TxOut":          txOut{},
+	"Transfer":       txWrapper{},
+	"TransferPlan":   transferPlan{},
+	"IssuanceEntry":  issuance.Entry{},
+	"HistoryTx":      history.Tx{},
+	"HistoryTxIn":    history.TxIn{},
+	"HistoryTxOut":   history.TxOut{},
+	"Invoice":        invoice.Invoice{},
+	"LotteryTicket":  lottery.Ticket{},
+	"Proof":          poe.Proof{},
+	"Receipt":        poe.Receipt{},
+	"DeviceBinding":  bindDeviceReq{},
+	"DeviceIdentity": verifyDeviceReq{},
+	"IndexedDevice":  indexer.Device{},
+	"IndexedFile":    indexer.FileInfo{},
+	"FileAddress":    FileWrapper{},
+	"FileInfo":       storage.FileInfoField{},
+	"StorageUsage":   quota.Usage{},
+}
+
+// jsonFields returns the json fields of the struct t, the embedded structs are flattened.
+func jsonFields(t reflect.Type, fields map[string]reflect.StructField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			jsonFields(ft, fields)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+}
+
+// jsonType is the type of the json of t in the document.
+func jsonType(t reflect.Type, tag string) string {
+	if strings.Contains(tag, ",string") {
+		return "string"
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return "array"
+	}
+	return "object"
+}
+
+func TestOpenAPIDefinitions(t *testing.T) {
+	doc := loadSpec(t)
+	for name, v := range specTypes {
+		def, ok := doc.Definitions[name]
+		if !ok {
+			t.Errorf("definition %s is not in openapi.json", name)
+			continue
+		}
+
+		fields := map[string]reflect.StructField{}
+		jsonFields(reflect.TypeOf(v), fields)
+		for key, f := range fields {
+			p, ok := def.Properties[key]
+			if !ok {
+				t.Errorf("field %s of %s is not in openapi.json", key, name)
+				continue
+			}
+			typ := "object"
+			if p = doc.resolve(p); p.Type != "" {
+				typ = p.Type
+			}
+			if got := jsonType(f.Type, f.Tag.Get("json")); got != typ {
+				t.Errorf("field %s of %s is %s, openapi.json says %s", key, name, got, typ)
+			}
+		}
+		for key := range def.Properties {
+			if _, ok := fields[key]; !ok {
+				t.Errorf("property %s of %s is not in %T", key, name, v)
+			}
+		}
+	}
+}
+
+// validate checks the json value v is of the schema s, every field of an object must be documented.
+func (doc *specDoc) validate(v interface{}, s *specSchema, at string) []string {
+	s = doc.resolve(s)
+	if s == nil || (s.Type == "" && s.Properties == nil) {
+		return nil
+	}
+	if v == nil {
+		// the nil slices, maps and pointers.
+		return nil
+	}
+
+	var errs []string
+	mismatch := func() []string {
+		return append(errs, fmt.Sprintf("%s is %T, openapi.json says %s", at, v, s.Type))
+	}
+	switch s.Type {
+	case "object", "":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for k, fv := range m {
+			p := s.AdditionalProperties
+			if s.Properties != nil {
+				if p, ok = s.Properties[k]; !ok {
+					errs = append(errs, fmt.Sprintf("%s.%s is not in openapi.json", at, k))
+					continue
+				}
+			}
+			errs = append(errs, doc.validate(fv, p, at+"."+k)...)
+		}
+	case "array":
+		l, ok := v.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for i, item := range l {
+			errs = append(errs, doc.validate(item, s.Items, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return mismatch()
+		}
+	case "integer":
+		if n, ok := v.(json.Number); !ok || strings.ContainsAny(n.String(), ".eE") {
+			return mismatch()
+		}
+	case "number":
+		if _, ok := v.(json.Number); !ok {
+			return mismatch()
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return mismatch()
+		}
+	}
+	return errs
+}
+
+// operation returns the operation of the request path, the literal paths are preferred to the templates.
+func (doc *specDoc) operation(method, path string) (string, *specOperation) {
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Count(paths[i], "{") < strings.Count(paths[j], "{")
+	})
+
+	param := regexp.MustCompile(`\\\{[a-z_]+\\\}`)
+	for _, p := range paths {
+		expr := param.ReplaceAllStringFunc(regexp.QuoteMeta(p), func(s string) string {
+			if s == `\{path\}` {
+				return ".*"
+			}
+			return "[^/]+"
+		})
+		if !regexp.MustCompile("^" + expr + "$").MatchString(path) {
+			continue
+		}
+		if op, ok := doc.Paths[p][strings.ToLower(method)]; ok {
+			return p, op
+		}
+	}
+	return "", nil
+}
+
+// contractTransport checks every response of the api is documented by openapi.json.
+type contractTransport struct {
+	t   *testing.T
+	doc *specDoc
+}
+
+func (c *contractTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rsp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	rsp.Body = ioutil.NopCloser(bytes.NewReader(bs))
+
+	path, op := c.doc.operation(req.Method, strings.TrimPrefix(req.URL.Path, API_PREFIX))
+	if op == nil {
+		if rsp.StatusCode != 404 {
+			c.t.Errorf("%s %s is not in openapi.json", req.Method, req.URL.Path)
+			return rsp, nil
+		}
+		// the routes not found answer the error too.
+		op = &specOperation{OperationID: "notFound"}
+	}
+	r, ok := op.Responses[fmt.Sprint(rsp.StatusCode)]
+	if !ok && op.Responses == nil {
+		r.Schema = &specSchema{Ref: "#/definitions/Error"}
+	} else if !ok {
+		if rsp.StatusCode < 300 {
+			c.t.Errorf("%s %s answers %d which is not in openapi.json", req.Method, path, rsp.StatusCode)
+		}
+		r = op.Responses["default"]
+	}
+	if r.Schema == nil || r.Schema.Type == "file" || len(bs) == 0 {
+		return rsp, nil
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		c.t.Errorf("%s %s answers invalid json, %s", req.Method, path, err)
+		return rsp, nil
+	}
+	for _, e := range c.doc.validate(v, r.Schema, op.OperationID) {
+		c.t.Errorf("%s %s %d: %s", req.Method, path, rsp.StatusCode, e)
+	}
+	return rsp, nil
+}
+
+// newContractServer serves the api of a daemon in a temp dir, the client is logged in as the owner.
+func newContractServer(t *testing.T) (*fclient.Client, func()) {
+	dir, err := ioutil.TempDir("", "farmer-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(dir, "fs"), 0755)
+	viper.Set("peer.fileSystemPath", dir)
+	viper.Set("farmer.fstype", "local")
+	viper.Set("farmer.localChroot", filepath.Join(dir, "fs"))
+
+	d := daepkg.NewDaemon()
+	if err := d.Init(); err != nil {
+		t.Fatal(err)
+	}
+	daemon, log = d, d.GetLogger()
+	db := d.GetDB()
+	if sessions, err = session.NewManager(db, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &account.Account{ID: "alice", Email: "alice@example.com", NickName: "alice"}
+	if err := a.Save(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := wallet.SaveMaster(db, a.ID, hdwallet.MasterKey([]byte("contract test seed"), true)); err != nil {
+		t.Fatal(err)
+	}
+	_, token, err := sessions.Issue(a.ID, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMartini()
+	m.Map(NewEventHandler())
+	m.Use(requextCtx)
+	m.Group(API_PREFIX, apiRoutes, RouteMW)
+	m.NotFound(notFound(nil))
+	srv := httptest.NewServer(m)
+
+	cli := fclient.New(srv.URL+API_PREFIX, token)
+	cli.HTTP = &http.Client{Transport: &contractTransport{t, loadSpec(t)}}
+	return cli, func() {
+		srv.Close()
+		db.Close()
+		indexer.CloseDB()
+		fsDriver, sessions, daemon = nil, nil, nil
+		os.RemoveAll(dir)
+	}
+}
+
+func TestOpenAPIHandlers(t *testing.T) {
+	cli, done := newContractServer(t)
+	defer done()
+
+	check := func(what string, err error) {
+		if err != nil {
+			t.Errorf("%s failed, %s", what, err)
+		}
+	}
+
+	if doc, err := cli.GetOpenAPI(); err != nil || !bytes.Equal(doc, bytes.TrimSpace(openapiSpec)) {
+		t.Errorf("get openapi.json, %d bytes %v", len(doc), err)
+	}
+	if a, err := cli.GetAccountState(); err != nil || a.ID != "alice" || a.Role != account.RoleOwner {
+		t.Errorf("get account, %+v %v", a, err)
+	}
+	lang := "English"
+	if st, err := cli.UpdateAccountSetting(&fclient.SettingsUpdate{Language: &lang}); err != nil || st.Language != lang {
+		t.Errorf("update setting, %+v %v", st, err)
+	}
+	_, err := cli.GetAccountSetting()
+	check("get setting", err)
+	_, err = cli.ListSessions()
+	check("list sessions", err)
+	_, err = cli.ListMembers()
+	check("list members", err)
+	_, err = cli.ListChaincodes()
+	check("list chaincodes", err)
+
+	// contacts.
+	c, err := cli.AddContacts(&fclient.Contact{Name: "bob", Addr: "addr-bob", Tags: []string{"friend"}})
+	check("add contact", err)
+	if cs, n, err := cli.ListContacts(&fclient.ListContactsQuery{Tag: "friend"}); err != nil || n != 1 || len(cs) != 1 {
+		t.Errorf("list contacts, %d %+v %v", n, cs, err)
+	}
+	_, err = cli.ListContactTags()
+	check("list tags", err)
+	if c != nil {
+		c.Description = "the builder"
+		_, err = cli.UpdateContacts(fmt.Sprint(c.ID), c)
+		check("update contact", err)
+	}
+	if rc, err := cli.ExportContacts(&fclient.ExportContactsQuery{Format: "csv"}); err != nil {
+		t.Errorf("export contacts failed, %s", err)
+	} else {
+		bs, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		_, err = cli.ImportContacts(&fclient.ImportContactsQuery{Format: "csv"}, bytes.NewReader(bs), "text/csv")
+		check("import contacts", err)
+	}
+	_, err = cli.RemoveAllContacts()
+	check("remove contacts", err)
+
+	// wallet.
+	_, err = cli.NewWalletAccount(&fclient.NewAccount{Name: "savings"})
+	check("new wallet account", err)
+	_, err = cli.ListWalletAccounts()
+	check("list wallet accounts", err)
+	var pubkeys []string
+	for i := 0; i < 2; i++ {
+		addr, err := cli.NewWalletAddress(&fclient.NewAddress{Label: "shop"})
+		if err != nil {
+			t.Fatalf("new wallet address failed, %s", err)
+		}
+		_, err = cli.LabelWalletAddress(addr.Address, &fclient.Label{Label: "shop2"})
+		check("label address", err)
+		pk, err := cli.GetWalletPubKey(addr.Address)
+		if err != nil {
+			t.Fatalf("get pubkey failed, %s", err)
+		}
+		pubkeys = append(pubkeys, pk.Pubkey)
+	}
+	_, err = cli.ListWalletAddresses(nil)
+	check("list wallet addresses", err)
+	_, err = cli.NewWalletMultisig(&fclient.NewMultisig{M: 2, Pubkeys: pubkeys, Label: "shared"})
+	check("new multisig", err)
+	_, err = cli.ListWalletMultisigs()
+	check("list multisigs", err)
+
+	// payment requests.
+	inv, err := cli.NewInvoice(&fclient.NewInvoice{Amount: 100, Memo: "coffee"})
+	if err != nil {
+		t.Fatalf("new invoice failed, %s", err)
+	}
+	_, err = cli.GetInvoice(inv.ID)
+	check("get invoice", err)
+	_, err = cli.DecodeInvoice(&fclient.InvoiceURI{URI: inv.URI})
+	check("decode invoice", err)
+	if _, n, err := cli.ListInvoices(nil); err != nil || n != 1 {
+		t.Errorf("list invoices, %d %v", n, err)
+	}
+	if _, err := cli.GetInvoice("nothing"); err == nil || err.(*fclient.Error).Status != 404 {
+		t.Errorf("expect 404 of a missing invoice, %v", err)
+	}
+
+	// issuance, history and psbts ask the lepuscoin chaincode, there is no peer here.
+	_, _, err = cli.ListLotteryTickets(nil)
+	check("list lottery tickets", err)
+	_, _, err = cli.ListProofs(nil)
+	check("list proofs", err)
+	if v, err := cli.VerifyProofReceipt(&fclient.Receipt{Hash: "00"}); err != nil || v.Valid {
+		t.Errorf("verify a bad receipt, %+v %v", v, err)
+	}
+
+	// indexer.
+	_, err = cli.ListDevices()
+	check("list devices", err)
+	_, err = cli.OnlineDevice("dev1", nil, &fclient.IndexedDevice{ID: "dev1", Address: "127.0.0.1:9375"})
+	check("online device", err)
+	_, err = cli.SetFileIndex("dev1", nil, []fclient.IndexedFile{{Path: "/a.txt", Hash: "h1", Size: 1}})
+	check("index files", err)
+	if f, err := cli.GetFileAddr("1"); err != nil || f.Address != "127.0.0.1:9375" {
+		t.Errorf("get file address, %+v %v", f, err)
+	}
+	_, err = cli.OfflineDevice("dev1")
+	check("offline device", err)
+
+	// storage.
+	_, err = cli.NewDir("docs")
+	check("mkdir", err)
+	_, err = cli.UploadFile("docs/a.txt", "a.txt", strings.NewReader("hello"))
+	check("upload", err)
+	if fis, err := cli.GetFileList("docs"); err != nil || len(fis) != 2 || fis[1].Path != "/docs/a.txt" {
+		t.Errorf("list files, %+v %v", fis, err)
+	}
+	if rc, err := cli.GetFile("docs/a.txt"); err != nil {
+		t.Errorf("cat file failed, %s", err)
+	} else {
+		bs, _ := ioutil.ReadAll(rc)
+		rc.Close()
+		if string(bs) != "hello" {
+			t.Errorf("cat file, %q", bs)
+		}
+	}
+	_, err = cli.RenameFile("docs/a.txt", &fclient.RenameFileQuery{Newpath: "docs/b.txt"})
+	check("rename", err)
+	_, err = cli.RemoveFile("docs/b.txt")
+	check("remove", err)
+	if u, err := cli.GetStorageQuota(); err != nil || u.Files != 0 {
+		t.Errorf("get storage quota, %+v %v", u, err)
+	}
+	_, err = cli.SetStorageQuota("alice", &fclient.QuotaUpdate{Quota: 1 << 20})
+	check("set storage quota", err)
+	_, err = cli.ListStorageQuotas()
+	check("list storage quotas", err)
+
+	if rc, err := cli.GetMetrics(); err != nil {
+		t.Errorf("get metrics failed, %s", err)
+	} else {
+		rc.Close()
+	}
+	check("logout", cli.Logout())
+	if _, err := cli.GetAccountState(); err == nil || err.(*fclient.Error).Status != 401 {
+		t.Errorf("expect 401 after logout, %v", err)
+	}
+}
@@ -33,7 +33,7 @@ func RestartPeer(rw http.ResponseWriter, req *http.Request, ctx *RequestContext)
 func GetPeerState(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
 	clientConn, err := peer.NewPeerClientConnection()
 	if err != nil {
-		log.Infof("Error trying to connect to local peer: %s", err)
+		ctx.log.Infof("Error trying to connect to local peer: %s", err)
 		ctx.Error(500, fmt.Errorf("Error trying to connect to local peer: %s", err))
 		return
 	}
@@ -42,7 +42,7 @@ func GetPeerState(rw http.ResponseWriter, req *http.Request, ctx *RequestContext
 
 	status, err := serverClient.GetStatus(context.Background(), &empty.Empty{})
 	if err != nil {
-		log.Infof("Error trying to get status from local peer: %s", err)
+		ctx.log.Infof("Error trying to get status from local peer: %s", err)
 		ctx.Error(500, fmt.Errorf("Error trying to connect to local peer: %s", err))
 		return
 	}
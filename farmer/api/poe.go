@@ -0,0 +1,279 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/poe"
+	pb "github.com/hyperledger/fabric/protos"
+	"golang.org/x/net/context"
+)
+
+// queryProof asks the poe chaincode for the proof of hash, nil if not registered.
+func queryProof(hash string) (*poe.Proof, error) {
+	cc, err := ccManager.Get("poe", "query", poe.FuncGet, hash)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := cc.Invoke()
+	if err != nil || len(ret) == 0 {
+		// the chaincode answers an error for the unknown hash.
+		log.Debugf("query proof %s: %v", hash, err)
+		return nil, nil
+	}
+
+	p := &poe.Proof{}
+	if err := json.Unmarshal(ret, p); err != nil {
+		return nil, fmt.Errorf("invalid proof of poe chaincode, %s", err)
+	}
+	return p, nil
+}
+
+// resolveProof looks up the registering tx of the pending p, and marks it committed if found.
+// returns the block which commits it, nil if not committed yet.
+func resolveProof(db *sql.DB, p *poe.Proof) (*pb.Block, error) {
+	src, err := peerSource()
+	if err != nil {
+		return nil, err
+	}
+	if p.Status == poe.StatusCommitted {
+		return src.Block(p.Block)
+	}
+
+	block, n, next, err := poe.FindTx(src, p.Txid, p.Height)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		p.Height = next
+		return nil, poe.Scanned(db, p.Hash, next)
+	}
+
+	hash, err := block.GetHash()
+	if err != nil {
+		return nil, err
+	}
+	p.Status, p.Block, p.BlockHash = poe.StatusCommitted, n, hex.EncodeToString(hash)
+	for _, tx := range block.Transactions {
+		if tx.Txid == p.Txid && tx.Timestamp != nil {
+			p.Timestamp = tx.Timestamp.Seconds
+		}
+	}
+	return block, poe.Commit(db, p.Hash, p.Block, p.BlockHash, p.Timestamp)
+}
+
+// POST /poe
+// {
+// 	"hash": "hex of the document hash, or",
+// 	"file": "path in the farmer storage, hashed by sha256",
+// 	"name": "name of the document"
+// }
+func RegisterProof(ctx *RequestContext) {
+	var body struct {
+		Hash string `json:"hash"`
+		File string `json:"file"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(ctx.req.Body).Decode(&body); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	hash := body.Hash
+	if body.File != "" {
+		fs, err := getFsDriver()
+		if err != nil {
+			ctx.Error(500, err)
+			return
+		}
+		f, err := fs.Reader(context.TODO(), body.File)
+		if err != nil {
+			ctx.Error(400, err)
+			return
+		}
+		defer f.Close()
+
+		if hash, err = poe.HashReader(f); err != nil {
+			ctx.Error(500, err)
+			return
+		}
+		if body.Hash != "" && body.Hash != hash {
+			ctx.Error(400, fmt.Errorf("the %s hash of file is %s", poe.Algo, hash))
+			return
+		}
+	}
+	hash, err := poe.NormalizeHash(hash)
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	// the first registering proves the existence.
+	if p, err := poe.Get(ctx.db, hash); err == nil {
+		ctx.rnd.JSON(409, p)
+		return
+	}
+	if p, err := queryProof(hash); err != nil {
+		ctx.Error(500, err)
+		return
+	} else if p != nil {
+		ctx.rnd.JSON(409, p)
+		return
+	}
+
+	p := &poe.Proof{
+		Hash:   hash,
+		UserID: ctx.user.ID,
+		Owner:  ctx.user.ID,
+		Name:   body.Name,
+		File:   body.File,
+	}
+	if src, err := peerSource(); err == nil {
+		p.Height, _ = src.Height()
+	}
+
+	cc, err := ccManager.Get("poe", "invoke", poe.FuncRegister, p.Hash, p.Owner, p.Name)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	txid, err := cc.Invoke()
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	p.Chaincode, p.Txid = cc.Name, string(txid)
+
+	if err := poe.Record(ctx.db, p); err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(201, p)
+}
+
+// GET /poe?owner=xxx&limit=20&offset=0, the proofs registered by the farmer, owner is the login user if empty.
+func ListProofs(ctx *RequestContext) {
+	limit, offset, ok := parsePage(ctx, 20)
+	if !ok {
+		return
+	}
+	owner := ctx.params["owner"]
+	if owner == "" {
+		owner = ctx.user.ID
+	}
+
+	ps, count, err := poe.List(ctx.db, owner, limit, offset)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.res.Header().Set("Record-Count", strconv.Itoa(count))
+	ctx.rnd.JSON(200, ps)
+}
+
+// GET /poe/:hash
+// the proof registered by the farmer with its tx and block, or the one answered by the poe chaincode.
+func GetProof(ctx *RequestContext, params martini.Params) {
+	hash, err := poe.NormalizeHash(params["hash"])
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	p, err := poe.Get(ctx.db, hash)
+	if err == nil {
+		if p.Status == poe.StatusPending {
+			if _, err := resolveProof(ctx.db, p); err != nil {
+				ctx.log.Debugf("resolve proof %s failed, %s", hash, err)
+			}
+		}
+		ctx.rnd.JSON(200, p)
+		return
+	} else if err != sql.ErrNoRows {
+		ctx.Error(500, err)
+		return
+	}
+
+	p, err = queryProof(hash)
+	if err != nil && err != ErrNotDeploy {
+		ctx.Error(500, err)
+		return
+	}
+	if p == nil {
+		ctx.Error(404, fmt.Errorf("hash %s is not registered", hash))
+		return
+	}
+	ctx.rnd.JSON(200, p)
+}
+
+// GET /poe/:hash/receipt
+func GetProofReceipt(ctx *RequestContext, params martini.Params) {
+	hash, err := poe.NormalizeHash(params["hash"])
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	p, err := poe.Get(ctx.db, hash)
+	if err == sql.ErrNoRows {
+		ctx.Error(404, fmt.Errorf("hash %s is not registered by the farmer", hash))
+		return
+	} else if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	block, err := resolveProof(ctx.db, p)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	if block == nil {
+		ctx.Error(409, poe.ErrNotCommitted)
+		return
+	}
+
+	r, err := poe.NewReceipt(p, block, p.Block)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, r)
+}
+
+// POST /poe/verify, the receipt of GET /poe/:hash/receipt
+// valid if it is of the poe chaincode deployed by the farmer, and its block is the one of the local peer.
+func VerifyProofReceipt(ctx *RequestContext) {
+	r := &poe.Receipt{}
+	if err := json.NewDecoder(ctx.req.Body).Decode(r); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	var chaincode string
+	if cc, ok := ccManager.Lookup("poe"); ok {
+		chaincode = cc.Name
+	}
+	err := poe.VerifyReceipt(r, chaincode)
+	if err == nil {
+		src, serr := peerSource()
+		if serr != nil {
+			ctx.Error(500, serr)
+			return
+		}
+		if err = poe.MatchBlock(src, r); err != nil && !errors.Is(err, poe.ErrBlockMismatch) {
+			ctx.Error(500, err)
+			return
+		}
+	}
+
+	ret := map[string]interface{}{"valid": true}
+	if err != nil {
+		ret["valid"], ret["error"] = false, err.Error()
+	}
+	ctx.rnd.JSON(200, ret)
+}
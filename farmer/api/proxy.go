@@ -7,7 +7,6 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
 
@@ -21,45 +20,9 @@ func GetClient() *http.Client {
 	return http.DefaultClient
 }
 
-func ProxyTo(way string, to *url.URL) func(http.ResponseWriter, *http.Request, *RequestContext) {
-	return func(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-		cli := GetClient()
-
-		toPath := strings.TrimPrefix(req.URL.Path, way)
-		log.Debugf("proxy %s -> %s", req.URL.Path, toPath)
-		req.RequestURI = ""
-		req.URL.Host = to.Host
-		req.URL.Scheme = to.Scheme
-		req.URL.Path = to.Path + toPath
-		req.Close = true
-		req.Header.Set("Connection", "close")
-
-		log.Debugf("to %s", req.URL.String())
-
-		resp, err := cli.Do(req)
-		if err != nil {
-			ctx.Error(400, err)
-			return
-		}
-		defer resp.Body.Close()
-
-		for k, vv := range resp.Header {
-			if strings.ToLower(k) == "content-length" {
-				continue
-			}
-			for _, v := range vv {
-				rw.Header().Set(k, v)
-			}
-		}
-
-		rw.WriteHeader(resp.StatusCode)
-		io.Copy(rw, resp.Body)
-	}
-}
-
 func ProxyFabric(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-	log.Debug("...")
-	log.Debugf("proxy to %s", req.URL.Path)
+	ctx.log.Debug("...")
+	ctx.log.Debugf("proxy to %s", req.URL.Path)
 	cli := GetClient()
 
 	req.RequestURI = ""
@@ -97,13 +60,16 @@ func ProxyFabric(rw http.ResponseWriter, req *http.Request, ctx *RequestContext)
 }
 
 func ProxyChaincode(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
-	log.Debugf("proxy chaincode to %s", req.URL.Path)
+	ctx.log.Debugf("proxy chaincode to %s", req.URL.Path)
 	cw := &ccpkg.ChaincodeWrapper{}
 	err := json.NewDecoder(req.Body).Decode(cw)
 	if err != nil {
 		ctx.Error(400, err)
 		return
 	}
+	if refuseCoinbase(ctx, cw) {
+		return
+	}
 
 	bs, err := json.Marshal(cw.ToJSONRPC())
 	if err != nil {
@@ -119,7 +85,7 @@ func ProxyChaincode(rw http.ResponseWriter, req *http.Request, ctx *RequestConte
 	}
 	req.ContentLength = int64(n)
 	req.Header.Set("Content-Length", strconv.Itoa(n))
-	log.Debugf("set new Content-Length %v", n)
+	ctx.log.Debugf("set new Content-Length %v", n)
 
 	req.Body = ioutil.NopCloser(buf)
 	ctx.mc.Next()
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/account"
+	"github.com/hyperledger/fabric/farmer/quota"
+	"github.com/hyperledger/fabric/storage"
+	"github.com/spf13/viper"
+	"golang.org/x/net/context"
+)
+
+// defaultQuota is farmer.quota.default, the bytes a user may write to the storage, e.g. 1GB, 0 is unlimited.
+func defaultQuota() int64 {
+	return int64(viper.GetSizeInBytes("farmer.quota.default"))
+}
+
+// quotaDriver records the files written by the user in farmer.db, and refuses the writes over the quota.
+type quotaDriver struct {
+	storage.StorageDriver
+	db   *sql.DB
+	user string
+}
+
+// limit returns the bytes the user may write to path, -1 if unlimited, and the size of path kept by
+// an append.
+func (d quotaDriver) limit(path string, append bool) (limit, base int64, err error) {
+	u, err := quota.Get(d.db, d.user, defaultQuota())
+	if err != nil {
+		return 0, 0, err
+	}
+	owner, size, err := quota.File(d.db, path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if append {
+		base = size
+	}
+	limit = u.Available()
+	if limit < 0 {
+		return -1, base, nil
+	}
+
+	switch {
+	case owner == d.user && !append:
+		// the file is replaced.
+		limit += size
+	case owner != d.user && append:
+		// the file becomes the user's.
+		limit -= size
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	return limit, base, nil
+}
+
+func (d quotaDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	limit, _, err := d.limit(path, false)
+	if err != nil {
+		return err
+	}
+	if limit >= 0 && int64(len(content)) > limit {
+		return quota.ErrExceeded
+	}
+	if err := d.StorageDriver.PutContent(ctx, path, content); err != nil {
+		return err
+	}
+	return quota.Record(d.db, d.user, path, int64(len(content)))
+}
+
+func (d quotaDriver) Writer(ctx context.Context, path string, append bool) (io.WriteCloser, error) {
+	limit, base, err := d.limit(path, append)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		return nil, quota.ErrExceeded
+	}
+	w, err := d.StorageDriver.Writer(ctx, path, append)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaWriter{WriteCloser: w, d: d, path: path, limit: limit, base: base}, nil
+}
+
+func (d quotaDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	if err := d.StorageDriver.Move(ctx, sourcePath, destPath); err != nil {
+		return err
+	}
+	return quota.Move(d.db, sourcePath, destPath)
+}
+
+func (d quotaDriver) Delete(ctx context.Context, path string) error {
+	if err := d.StorageDriver.Delete(ctx, path); err != nil {
+		return err
+	}
+	return quota.Remove(d.db, path)
+}
+
+// quotaWriter fails the writes over the limit, the file of a failed write is deleted at Close
+// unless it is appended.
+type quotaWriter struct {
+	io.WriteCloser
+	d     quotaDriver
+	path  string
+	limit int64
+	// size of the file before the append.
+	base     int64
+	written  int64
+	exceeded bool
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	if w.limit >= 0 && w.written+int64(len(p)) > w.limit {
+		w.exceeded = true
+		return 0, quota.ErrExceeded
+	}
+	n, err := w.WriteCloser.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *quotaWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	if w.exceeded && w.base == 0 {
+		return w.d.Delete(context.TODO(), w.path)
+	}
+	return quota.Record(w.d.db, w.d.user, w.path, w.base+w.written)
+}
+
+// GET /fs/quota, the storage used by the login user.
+func GetStorageQuota(ctx *RequestContext) {
+	u, err := quota.Get(ctx.db, ctx.user.ID, defaultQuota())
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, u)
+}
+
+// GET /users/quota, the storage used by the users.
+func ListStorageQuotas(ctx *RequestContext) {
+	us, err := quota.List(ctx.db, defaultQuota())
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, us)
+}
+
+// PUT /users/:id/quota {"quota": 1073741824}, bytes, 0 is unlimited, -1 drops it for the default one.
+func SetStorageQuota(ctx *RequestContext, params martini.Params) {
+	var req struct {
+		Quota *int64 `json:"quota"`
+	}
+	if err := json.NewDecoder(ctx.req.Body).Decode(&req); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	if req.Quota == nil {
+		ctx.Error(400, fmt.Errorf("quota is required"))
+		return
+	}
+	if _, err := account.Load(ctx.db, params["id"]); err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	if err := quota.SetQuota(ctx.db, params["id"], *req.Quota); err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	u, err := quota.Get(ctx.db, params["id"], defaultQuota())
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, u)
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	fclient "github.com/hyperledger/fabric/farmer/client"
+	"github.com/spf13/viper"
+)
+
+func TestStorageQuota(t *testing.T) {
+	cli, done := newContractServer(t)
+	defer done()
+	viper.Set("farmer.quota.default", 10)
+	defer viper.Set("farmer.quota.default", nil)
+
+	upload := func(path, content string) error {
+		_, err := cli.UploadFile(path, "f", strings.NewReader(content))
+		return err
+	}
+	used := func(used, files int64) {
+		u, err := cli.GetStorageQuota()
+		if err != nil || u.Used != used || u.Files != files || u.Quota != 10 {
+			t.Errorf("usage %+v %v, expect %d bytes of %d files", u, err, used, files)
+		}
+	}
+
+	_, err := cli.NewDir("docs")
+	check(t, "mkdir", err)
+	if err := upload("docs/a", "123456"); err != nil {
+		t.Fatal(err)
+	}
+	errorOf(t, "upload over the quota", upload("docs/b", "123456"), 507, CodeQuotaExceeded)
+	_, err = cli.GetFile("docs/b")
+	errorOf(t, "the file over the quota", err, 404, CodeFileNotFound)
+	used(6, 1)
+
+	// a replaced file is not counted twice.
+	if err := upload("docs/a", "123456789"); err != nil {
+		t.Errorf("replace the file failed, %s", err)
+	}
+	used(9, 1)
+
+	_, err = cli.RenameFile("docs", &fclient.RenameFileQuery{Newpath: "archive"})
+	check(t, "rename", err)
+	used(9, 1)
+	_, err = cli.RemoveFile("archive")
+	check(t, "remove", err)
+	used(0, 0)
+
+	// 0 is unlimited for alice.
+	if u, err := cli.SetStorageQuota("alice", &fclient.QuotaUpdate{Quota: 0}); err != nil || !u.Custom {
+		t.Errorf("set quota, %+v %v", u, err)
+	}
+	check(t, "upload without quota", upload("big", strings.Repeat("x", 100)))
+	_, err = cli.SetStorageQuota("nobody", &fclient.QuotaUpdate{Quota: 1})
+	errorOf(t, "quota of a missing user", err, 404, CodeNotFound)
+
+	us, err := cli.ListStorageQuotas()
+	if err != nil || len(us) != 1 || us[0].UserID != "alice" || us[0].Used != 100 {
+		t.Errorf("list quotas, %+v %v", us, err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	cli, done := newContractServer(t)
+	defer done()
+	viper.Set("daemon.rateLimit.upload.rate", 0.001)
+	viper.Set("daemon.rateLimit.upload.burst", 2)
+	resetRateLimiters()
+	defer func() {
+		viper.Set("daemon.rateLimit.upload.rate", nil)
+		viper.Set("daemon.rateLimit.upload.burst", nil)
+		resetRateLimiters()
+	}()
+
+	for i := 0; i < 2; i++ {
+		_, err := cli.UploadFile("a", "a", strings.NewReader("a"))
+		check(t, "upload in the burst", err)
+	}
+	_, err := cli.UploadFile("a", "a", strings.NewReader("a"))
+	errorOf(t, "upload over the rate", err, 429, CodeTooManyRequest)
+
+	req, _ := http.NewRequest("PUT", cli.Base+"/fs/new/a", nil)
+	req.Header.Set("Authorization", "Bearer "+cli.Token)
+	rsp, err := cli.HTTP.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != 429 || rsp.Header.Get("Retry-After") != "1000" || rsp.Header.Get("X-RateLimit-Limit") != "2" {
+		t.Errorf("answers %d, Retry-After %q", rsp.StatusCode, rsp.Header.Get("Retry-After"))
+	}
+
+	// the other routes are not limited by the uploads.
+	_, err = cli.GetFileList("")
+	check(t, "list files", err)
+}
+
+func check(t *testing.T, what string, err error) {
+	if err != nil {
+		t.Errorf("%s failed, %s", what, err)
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/ratelimit"
+	"github.com/spf13/viper"
+)
+
+// the route classes of the rate limits, daemon.rateLimit.<class>.
+const (
+	// every api request, per the remote ip.
+	RateDefault = "default"
+	// the captchas sent by sms or email.
+	RateCaptcha = "captcha"
+	// signup, login and recover, which try the passwords.
+	RateAuth = "auth"
+	// the manual coinbase txs.
+	RateCoinbase = "coinbase"
+	// the uploads to the storage.
+	RateUpload = "upload"
+)
+
+// defaultRateLimits are used unless daemon.rateLimit.<class> is set.
+var defaultRateLimits = map[string]ratelimit.Limit{
+	RateDefault:  {Rate: 20, Burst: 100},
+	RateCaptcha:  {Rate: 1.0 / 60, Burst: 3},
+	RateAuth:     {Rate: 0.2, Burst: 10},
+	RateCoinbase: {Rate: 0.1, Burst: 5},
+	RateUpload:   {Rate: 2, Burst: 20},
+}
+
+var errRateLimited = errors.New("too many requests")
+
+var rateLimiters = struct {
+	sync.Mutex
+	m map[string]*ratelimit.Limiter
+}{m: map[string]*ratelimit.Limiter{}}
+
+// rateLimiter returns the limiter of the class, made at the first call.
+func rateLimiter(class string) *ratelimit.Limiter {
+	rateLimiters.Lock()
+	defer rateLimiters.Unlock()
+
+	if l, ok := rateLimiters.m[class]; ok {
+		return l
+	}
+	limit := defaultRateLimits[class]
+	key := "daemon.rateLimit." + class
+	if viper.IsSet(key + ".rate") {
+		limit.Rate = viper.GetFloat64(key + ".rate")
+	}
+	if viper.IsSet(key + ".burst") {
+		limit.Burst = viper.GetInt(key + ".burst")
+	}
+	if viper.IsSet("daemon.rateLimit.enabled") && !viper.GetBool("daemon.rateLimit.enabled") {
+		limit = ratelimit.Limit{}
+	}
+
+	l := ratelimit.New(limit)
+	rateLimiters.m[class] = l
+	return l
+}
+
+// resetRateLimiters drops the limiters, they are made from the settings again.
+func resetRateLimiters() {
+	rateLimiters.Lock()
+	rateLimiters.m = map[string]*ratelimit.Limiter{}
+	rateLimiters.Unlock()
+}
+
+// rateKey is the client of the request, the login user or the remote ip. the forwarded headers are
+// not trusted.
+func (ctx *RequestContext) rateKey() string {
+	if ctx.user != nil {
+		return "user:" + ctx.user.ID
+	}
+	host, _, err := net.SplitHostPort(ctx.req.RemoteAddr)
+	if err != nil {
+		host = ctx.req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// RateLimit answers 429 if the client of the request is over the limit of the class, the limits of
+// the users apply after AuthMW.
+func RateLimit(class string) martini.Handler {
+	return func(ctx *RequestContext) {
+		l := rateLimiter(class)
+		if l.Limit().Unlimited() {
+			return
+		}
+
+		key := ctx.rateKey()
+		ok, wait := l.Allow(key)
+		h := ctx.res.Header()
+		h.Set("X-RateLimit-Limit", strconv.Itoa(l.Limit().Burst))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(l.Remaining(key)))
+		if ok {
+			return
+		}
+
+		httpRateLimited.With(class).Inc()
+		retry := int(math.Ceil(wait.Seconds()))
+		h.Set("Retry-After", strconv.Itoa(retry))
+		ctx.Error(429, errRateLimited, fmt.Sprintf("%s requests are limited, retry after %ds", class, retry))
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// addrBalance is the balance of an address, the locked part is spendable after its until.
+type addrBalance struct {
+	Addr      string `json:"addr"`
+	Balance   uint64 `json:"balance"`
+	Spendable uint64 `json:"spendable"`
+	Locked    uint64 `json:"locked"`
+	// the earliest until of the locked utxos, 0 if nothing locked.
+	NextUnlock int64 `json:"next_unlock,omitempty"`
+}
+
+// spendableTxIns drops the utxos locked at now.
+func spendableTxIns(utxos []txIn, now time.Time) []txIn {
+	ret := make([]txIn, 0, len(utxos))
+	for _, in := range utxos {
+		if in.Until <= now.Unix() {
+			ret = append(ret, in)
+		}
+	}
+	return ret
+}
+
+// summarizeBalances sums the spendable and locked utxos of every addr, in the order of addrs.
+func summarizeBalances(addrs []string, utxos []txIn, now time.Time) []*addrBalance {
+	byAddr := map[string]*addrBalance{}
+	ret := make([]*addrBalance, 0, len(addrs))
+	for _, addr := range addrs {
+		if _, ok := byAddr[addr]; ok {
+			continue
+		}
+		b := &addrBalance{Addr: addr}
+		byAddr[addr] = b
+		ret = append(ret, b)
+	}
+
+	for _, in := range utxos {
+		b, ok := byAddr[in.Addr]
+		if !ok {
+			continue
+		}
+		b.Balance += in.Balance
+		if in.Until <= now.Unix() {
+			b.Spendable += in.Balance
+			continue
+		}
+		b.Locked += in.Balance
+		if b.NextUnlock == 0 || in.Until < b.NextUnlock {
+			b.NextUnlock = in.Until
+		}
+	}
+	return ret
+}
+
+// POST /lepuscoin/timelock
+// the same body as transfer, with the lock of every out:
+// {
+// 	"in": [{"addr": "from xxx..."}],
+// 	"out": [{"addr": "to addr", "amount": 100}],
+// 	"until": 1500000000, // or "lock": "720h"
+// }
+func TimeLockTransfer(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	var body struct {
+		txWrapper
+		Until int64  `json:"until"`
+		Lock  string `json:"lock"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	until, err := lockUntil(body.Until, body.Lock, time.Now())
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	for i := range body.Out {
+		body.Out[i].Until = until
+	}
+
+	plan, w := prepareTransfer(ctx, &body.txWrapper, false)
+	if plan == nil {
+		return
+	}
+	submitTransfer(ctx, plan, w)
+}
+
+// lockUntil takes until, or now+lock if until is 0, it must be in the future.
+func lockUntil(until int64, lock string, now time.Time) (int64, error) {
+	if until == 0 && lock != "" {
+		d, err := time.ParseDuration(lock)
+		if err != nil {
+			return 0, fmt.Errorf("invalid lock %s, %s", lock, err)
+		}
+		until = now.Add(d).Unix()
+	}
+	if until <= now.Unix() {
+		return 0, fmt.Errorf("until %d is not in the future", until)
+	}
+	return until, nil
+}
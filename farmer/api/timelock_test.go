@@ -0,0 +1,38 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarizeBalances(t *testing.T) {
+	now := time.Unix(1000, 0)
+	us := []txIn{
+		{Addr: "a", Balance: 10},
+		{Addr: "a", Balance: 20, Until: 900},
+		{Addr: "a", Balance: 30, Until: 2000},
+		{Addr: "a", Balance: 40, Until: 1500},
+		{Addr: "b", Balance: 50, Until: 1500},
+	}
+
+	bs := summarizeBalances([]string{"a", "c"}, us, now)
+	if len(bs) != 2 || bs[1].Addr != "c" || bs[1].Balance != 0 {
+		t.Fatalf("unexpected balances %+v", bs)
+	}
+	if a := bs[0]; a.Balance != 100 || a.Spendable != 30 || a.Locked != 70 || a.NextUnlock != 1500 {
+		t.Errorf("unexpected balance %+v", a)
+	}
+	if in := spendableTxIns(us, now); len(in) != 2 {
+		t.Errorf("expect 2 spendable utxos, got %+v", in)
+	}
+
+	if until, err := lockUntil(0, "1h", now); err != nil || until != 4600 {
+		t.Errorf("expect until 4600, got %v %v", until, err)
+	}
+	if _, err := lockUntil(900, "", now); err == nil {
+		t.Errorf("expect error of past until")
+	}
+	if _, err := lockUntil(0, "", now); err == nil {
+		t.Errorf("expect error of no lock")
+	}
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-martini/martini"
+	"github.com/hyperledger/fabric/farmer/wallet"
+	ccpkg "github.com/hyperledger/fabric/peer/chaincode"
+)
+
+// lepuscoinSource tells the balance of addresses by the lepuscoin chaincode.
+type lepuscoinSource struct {
+	cc *ccpkg.ChaincodeWrapper
+}
+
+func newLepuscoinSource() (*lepuscoinSource, error) {
+	cc, err := ccManager.Get("lepuscoin", "query", "query_addrs")
+	if err != nil {
+		return nil, err
+	}
+	return &lepuscoinSource{cc: cc}, nil
+}
+
+func (s *lepuscoinSource) Balances(addrs ...string) (map[string]uint64, error) {
+	qar, err := queryLepuscoinAddrs(s.cc, addrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := map[string]uint64{}
+	for addr, a := range qar.GetAccounts() {
+		ret[addr] = a.Balance
+	}
+	return ret, nil
+}
+
+// openWallet opens the wallet of the login account, write the error if failed.
+func openWallet(ctx *RequestContext) *wallet.Wallet {
+	w, err := wallet.Open(ctx.db, ctx.user.ID)
+	if err == wallet.ErrNoMaster {
+		ctx.Error(409, err)
+		return nil
+	}
+	if err != nil {
+		ctx.log.Errorf("open wallet failed, %s", err)
+		ctx.Error(500, err)
+		return nil
+	}
+	return w
+}
+
+// parseChain accepts receive/change or 0/1, def if empty.
+func parseChain(s string, def int) (int, error) {
+	switch s {
+	case "":
+		return def, nil
+	case "receive", "0":
+		return int(wallet.ChainReceive), nil
+	case "change", "1":
+		return int(wallet.ChainChange), nil
+	}
+	return 0, fmt.Errorf("invalid chain %s", s)
+}
+
+// parseAccountIndex parses the account param, def if empty.
+func parseAccountIndex(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	i, err := strconv.ParseUint(s, 10, 31)
+	if err != nil {
+		return 0, fmt.Errorf("invalid account %s", s)
+	}
+	return int(i), nil
+}
+
+// GET /wallet/accounts
+func ListWalletAccounts(ctx *RequestContext) {
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	as, err := w.Accounts()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, as)
+}
+
+// POST /wallet/accounts {"name": "savings"}
+func NewWalletAccount(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	a, err := w.NewAccount(body.Name)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(201, a)
+}
+
+// GET /wallet/addresses?account=0&chain=receive
+func ListWalletAddresses(ctx *RequestContext) {
+	account, err := parseAccountIndex(ctx.params["account"], -1)
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	chain, err := parseChain(ctx.params["chain"], -1)
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	as, err := w.Addresses(account, chain)
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, as)
+}
+
+// POST /wallet/addresses {"account": 0, "chain": "receive", "label": "shop"}
+func NewWalletAddress(rw http.ResponseWriter, req *http.Request, ctx *RequestContext) {
+	var body struct {
+		Account uint32 `json:"account"`
+		Chain   string `json:"chain"`
+		Label   string `json:"label"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	chain, err := parseChain(body.Chain, int(wallet.ChainReceive))
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	a, err := w.NextAddress(body.Account, uint32(chain), body.Label)
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	ctx.rnd.JSON(201, a)
+}
+
+// PATCH /wallet/addresses/:addr {"label": "shop"}
+func LabelWalletAddress(rw http.ResponseWriter, req *http.Request, ctx *RequestContext, params martini.Params) {
+	var body struct {
+		Label string `json:"label"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	err := w.SetLabel(params["addr"], body.Label)
+	if err == sql.ErrNoRows {
+		ctx.Error(404, fmt.Errorf("address %s not in wallet", params["addr"]))
+		return
+	}
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	a, err := w.Lookup(params["addr"])
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, a)
+}
+
+// POST /wallet/scan?account=0&gap=20
+func ScanWallet(ctx *RequestContext) {
+	account, err := parseAccountIndex(ctx.params["account"], 0)
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+	gap := wallet.DefaultGapLimit
+	if s := ctx.params["gap"]; s != "" {
+		if gap, err = strconv.Atoi(s); err != nil || gap <= 0 || gap > 1000 {
+			ctx.Error(400, fmt.Errorf("invalid gap %s", s))
+			return
+		}
+	}
+
+	src, err := newLepuscoinSource()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	found, err := w.Scan(uint32(account), gap, src)
+	if err != nil {
+		ctx.log.Errorf("scan wallet failed, %s", err)
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, found)
+}
+
+// GET /wallet/balance?account=0
+func GetWalletBalance(ctx *RequestContext) {
+	account, err := parseAccountIndex(ctx.params["account"], -1)
+	if err != nil {
+		ctx.Error(400, err)
+		return
+	}
+
+	src, err := newLepuscoinSource()
+	if err != nil {
+		ctx.Error(500, err)
+		return
+	}
+
+	w := openWallet(ctx)
+	if w == nil {
+		return
+	}
+
+	b, err := w.Balance(account, src)
+	if err != nil {
+		ctx.log.Errorf("query wallet balance failed, %s", err)
+		ctx.Error(500, err)
+		return
+	}
+	ctx.rnd.JSON(200, b)
+}
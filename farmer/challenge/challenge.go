@@ -1 +1,86 @@
 package challenge
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	pb "github.com/conseweb/common/protos"
+	"github.com/golang/protobuf/proto"
+	fpb "github.com/hyperledger/fabric/protos"
+	"github.com/op/go-logging"
+	"golang.org/x/crypto/sha3"
+	"golang.org/x/net/context"
+)
+
+var logger = logging.MustGetLogger("challenge")
+
+var hashes = map[pb.HashAlgo]func() hash.Hash{
+	pb.HashAlgo_MD5:     md5.New,
+	pb.HashAlgo_SHA1:    sha1.New,
+	pb.HashAlgo_SHA224:  sha256.New224,
+	pb.HashAlgo_SHA256:  sha256.New,
+	pb.HashAlgo_SHA384:  sha512.New384,
+	pb.HashAlgo_SHA512:  sha512.New,
+	pb.HashAlgo_SHA3224: sha3.New224,
+	pb.HashAlgo_SHA3256: sha3.New256,
+	pb.HashAlgo_SHA3384: sha3.New384,
+	pb.HashAlgo_SHA3512: sha3.New512,
+}
+
+// BlockSource is the committed blocks of the peer.
+type BlockSource interface {
+	Block(n uint64) (*fpb.Block, error)
+}
+
+// Hash returns the hex hash of the serialized blocks from the low to the high number of rng.
+func Hash(src BlockSource, algo pb.HashAlgo, rng *pb.BlocksRange) (string, error) {
+	newHash, ok := hashes[algo]
+	if !ok {
+		return "", fmt.Errorf("unknown hash algo %s", algo)
+	}
+	if rng == nil || rng.LowBlockNumber > rng.HighBlockNumber {
+		return "", fmt.Errorf("invalid blocks range %v", rng)
+	}
+
+	h := newHash()
+	for n := rng.LowBlockNumber; n <= rng.HighBlockNumber; n++ {
+		block, err := src.Block(n)
+		if err != nil {
+			return "", fmt.Errorf("get block %d failed, %s", n, err)
+		}
+		bs, err := proto.Marshal(block)
+		if err != nil {
+			return "", err
+		}
+		h.Write(bs)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Conquer answers the challenge of the supervisor by the hash of the blocks, and tells whether it is conquered.
+func Conquer(cli pb.FarmerPublicClient, farmerID string, src BlockSource, algo pb.HashAlgo, rng *pb.BlocksRange) (bool, error) {
+	blocksHash, err := Hash(src, algo, rng)
+	if err != nil {
+		return false, err
+	}
+
+	rsp, err := cli.FarmerConquerChallenge(context.Background(), &pb.FarmerConquerChallengeReq{
+		FarmerID:    farmerID,
+		BlocksHash:  blocksHash,
+		HashAlgo:    algo,
+		BlocksRange: rng,
+	})
+	if err != nil {
+		return false, err
+	}
+	if rsp.Error != nil && !rsp.Error.OK() {
+		return false, rsp.Error
+	}
+	logger.Debugf("challenge of blocks %v conquered: %v", rng, rsp.ConquerOK)
+	return rsp.ConquerOK, nil
+}
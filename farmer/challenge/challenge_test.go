@@ -0,0 +1,54 @@
+package challenge
+
+import (
+	"testing"
+
+	pb "github.com/conseweb/common/protos"
+	fpb "github.com/hyperledger/fabric/protos"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+type mockBlocks []*fpb.Block
+
+func (m mockBlocks) Block(n uint64) (*fpb.Block, error) { return m[n], nil }
+
+// mockSupervisor conquers the challenge answered by the hash, and answers ResponseOK as the supervisor.
+type mockSupervisor struct {
+	pb.FarmerPublicClient
+	hash string
+}
+
+func (s *mockSupervisor) FarmerConquerChallenge(ctx context.Context, in *pb.FarmerConquerChallengeReq, opts ...grpc.CallOption) (*pb.FarmerConquerChallengeRsp, error) {
+	if in.FarmerID != "f1" {
+		return &pb.FarmerConquerChallengeRsp{Error: pb.NewErrorf(pb.ErrorType_INVALID_PARAM, "unknown farmer %s", in.FarmerID)}, nil
+	}
+	return &pb.FarmerConquerChallengeRsp{Error: pb.ResponseOK(), ConquerOK: in.BlocksHash == s.hash}, nil
+}
+
+func TestConquer(t *testing.T) {
+	blocks := mockBlocks{{StateHash: []byte{1}}, {StateHash: []byte{2}}, {StateHash: []byte{3}}}
+	rng := &pb.BlocksRange{LowBlockNumber: 1, HighBlockNumber: 2}
+
+	hash, err := Hash(blocks, pb.HashAlgo_SHA256, rng)
+	if err != nil || len(hash) != 64 {
+		t.Fatalf("expect a sha256 hash, got %q %v", hash, err)
+	}
+	if other, _ := Hash(blocks, pb.HashAlgo_SHA256, &pb.BlocksRange{HighBlockNumber: 2}); other == hash {
+		t.Errorf("expect another hash of another range")
+	}
+	if _, err := Hash(blocks, pb.HashAlgo_SHA256, &pb.BlocksRange{LowBlockNumber: 2, HighBlockNumber: 1}); err == nil {
+		t.Errorf("expect error of an invalid range")
+	}
+
+	sv := &mockSupervisor{hash: hash}
+	if ok, err := Conquer(sv, "f1", blocks, pb.HashAlgo_SHA256, rng); err != nil || !ok {
+		t.Errorf("expect conquered, got %v %v", ok, err)
+	}
+	if ok, err := Conquer(sv, "f1", blocks, pb.HashAlgo_MD5, rng); err != nil || ok {
+		t.Errorf("expect not conquered by another hash, got %v %v", ok, err)
+	}
+	if _, err := Conquer(sv, "f2", blocks, pb.HashAlgo_SHA256, rng); err == nil {
+		t.Errorf("expect error of the supervisor")
+	}
+}
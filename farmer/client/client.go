@@ -0,0 +1,182 @@
+// Package client is the go client of the farmer daemon api, the typed methods in client_gen.go are
+// generated from farmer/api/openapi.json.
+package client
+
+//go:generate go run gen/main.go -spec ../api/openapi.json -out client_gen.go
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Error is the error answered by the daemon api, check Code rather than the text of Err.
+type Error struct {
+	Status    int
+	Code      string `json:"code"`
+	Err       string `json:"error"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Err
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Message != "" {
+		msg += ", " + e.Message
+	}
+	return fmt.Sprintf("%d %s", e.Status, msg)
+}
+
+// Client talks to the farmer daemon by its http api.
+type Client struct {
+	// the api url, e.g. http://127.0.0.1:9375/api
+	Base string
+	// the login token, see Login.
+	Token string
+	HTTP  *http.Client
+}
+
+// New returns the client of the api at base.
+func New(base, token string) *Client {
+	return &Client{Base: strings.TrimRight(base, "/"), Token: token, HTTP: http.DefaultClient}
+}
+
+// Request sends the request of method to the api path, and checks the status of the response.
+func (c *Client) Request(method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.Base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	cli := c.HTTP
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	rsp, err := cli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("connect farmer daemon failed, is it running? %s", err)
+	}
+	if rsp.StatusCode >= 300 {
+		defer rsp.Body.Close()
+		e := &Error{Status: rsp.StatusCode}
+		bs, _ := ioutil.ReadAll(rsp.Body)
+		if json.Unmarshal(bs, e) != nil && len(bs) > 0 {
+			e.Err = strings.TrimSpace(string(bs))
+		}
+		if e.RequestID == "" {
+			e.RequestID = rsp.Header.Get("X-Request-Id")
+		}
+		return nil, e
+	}
+	return rsp, nil
+}
+
+// Do sends the json of in to the api path, and decodes the answered json to out.
+// in and out may be nil.
+func (c *Client) Do(method, path string, in, out interface{}) error {
+	_, err := c.call(method, path, in, out)
+	return err
+}
+
+// call is Do which returns the header of the response.
+func (c *Client) call(method, path string, in, out interface{}) (http.Header, error) {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		bs, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body, contentType = bytes.NewReader(bs), "application/json"
+	}
+	return c.send(method, path, contentType, body, out)
+}
+
+// send sends body of contentType, and decodes the answered json to out.
+func (c *Client) send(method, path, contentType string, body io.Reader, out interface{}) (http.Header, error) {
+	rsp, err := c.Request(method, path, contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	bs, err := ioutil.ReadAll(rsp.Body)
+	if err != nil || out == nil || len(bs) == 0 {
+		return rsp.Header, err
+	}
+	return rsp.Header, json.Unmarshal(bs, out)
+}
+
+// Download writes the answer of the api path to w.
+func (c *Client) Download(path string, w io.Writer) error {
+	rsp, err := c.Request("GET", path, "", nil)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+
+	_, err = io.Copy(w, rsp.Body)
+	return err
+}
+
+// Upload puts r as the form file name of the api path.
+func (c *Client) Upload(path, name string, r io.Reader, out interface{}) error {
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fw, r); err != nil {
+		return err
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	_, err = c.send("PUT", path, mw.FormDataContentType(), buf, out)
+	return err
+}
+
+// QueryPath returns the api path with the query.
+func QueryPath(path string, query url.Values) string {
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
+
+// EscapePath escapes every element of the slash separated path.
+func EscapePath(p string) string {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i, s := range parts {
+		parts[i] = url.PathEscape(s)
+	}
+	return strings.Join(parts, "/")
+}
+
+// recordCount is the Record-Count header of a list, -1 if missing.
+func recordCount(h http.Header) int {
+	n, err := strconv.Atoi(h.Get("Record-Count"))
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,2203 @@
+// Code generated by gen/main.go from farmer/api/openapi.json. DO NOT EDIT.
+
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Account of a user on this farmer.
+type Account struct {
+	ID       string `json:"id"`
+	Nicename string `json:"nicename"`
+	Phone    string `json:"phone"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// Language of the passphrase.
+	Lang       int32           `json:"lang"`
+	Passphrase string          `json:"passphrase"`
+	Wallet     json.RawMessage `json:"Wallet,omitempty"`
+	Devices    []Device        `json:"devices,omitempty"`
+	Settings   *Settings       `json:"settings,omitempty"`
+	Role       string          `json:"role"`
+}
+
+// Derived address, m/account'/chain/index.
+type Address struct {
+	Account uint32 `json:"account"`
+	Chain   uint32 `json:"chain"`
+	Index   uint32 `json:"index"`
+	Address string `json:"address"`
+	Label   string `json:"label"`
+	Used    bool   `json:"used"`
+	Created int64  `json:"created"`
+	Balance uint64 `json:"balance"`
+}
+
+// Balance of the wallet.
+type Balance struct {
+	Total uint64 `json:"total"`
+	// Balance of every account index.
+	Accounts  map[string]uint64 `json:"accounts,omitempty"`
+	Addresses []Address         `json:"addresses,omitempty"`
+}
+
+// Chaincode registered on this farmer.
+type Chaincode struct {
+	Alias    string   `json:"alias"`
+	Path     string   `json:"path"`
+	Name     string   `json:"name"`
+	Version  string   `json:"version"`
+	Language string   `json:"language"`
+	Function string   `json:"function"`
+	Args     []string `json:"args,omitempty"`
+	// registered, pending, ready or failed.
+	Status       string `json:"status"`
+	Error        string `json:"error"`
+	TxID         string `json:"txid"`
+	Block        uint64 `json:"block"`
+	DeployHeight uint64 `json:"deploy_height"`
+	Deployed     int64  `json:"deployed"`
+	Ready        int64  `json:"ready"`
+	Updated      int64  `json:"updated"`
+}
+
+// Chaincode call of the peer.
+type ChaincodeSpec struct {
+	Name          string   `json:"name"`
+	Path          string   `json:"path"`
+	Method        string   `json:"method"`
+	Language      string   `json:"language"`
+	Function      string   `json:"function"`
+	Args          []string `json:"args,omitempty"`
+	UserName      string   `json:"user_name"`
+	Attributes    []string `json:"attributes,omitempty"`
+	SecureContext string   `json:"secureContext"`
+}
+
+type Coinbase struct {
+	Addrs  []string `json:"addrs,omitempty"`
+	Amount uint64   `json:"amount"`
+	// Wallet address of an issuer key.
+	Issuer string `json:"issuer"`
+}
+
+// Contact of the address book.
+type Contact struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Email       string   `json:"email"`
+	Phone       string   `json:"phone"`
+	Addr        string   `json:"addr"`
+	Tags        []string `json:"tags,omitempty"`
+	Description string   `json:"description"`
+	NsName      string   `json:"ns_name"`
+	PrevAddr    string   `json:"prev_addr"`
+	AddrChanged bool     `json:"addr_changed"`
+	VerifiedAt  int64    `json:"verified_at"`
+}
+
+// Number of the indexed files.
+type Count struct {
+	Message int `json:"message"`
+}
+
+// Device bound to the account.
+type Device struct {
+	UserID   string `json:"userID"`
+	DeviceID string `json:"deviceID"`
+	OS       string `json:"os"`
+	// 0 farmer, 1 mobile, 2 pad, 3 pc.
+	For int32  `json:"for"`
+	MAC string `json:"mac"`
+	// The name verified by the idprovider.
+	Alias string `json:"alias"`
+	Wpub  []byte `json:"wpub,omitempty"`
+	Spub  []byte `json:"spub,omitempty"`
+	// Whether it is the device of this farmer.
+	IsLocal bool            `json:"IsLocal"`
+	Wallet  json.RawMessage `json:"Wallet,omitempty"`
+	// Wallet address of the device.
+	Address string `json:"address"`
+	// Name given on this farmer.
+	Label string `json:"label"`
+}
+
+type DeviceBinding struct {
+	Type    string `json:"type"`
+	Captcha string `json:"captcha"`
+	OS      string `json:"os"`
+	MAC     string `json:"mac"`
+	Alias   string `json:"alias"`
+	// farmer, mobile, pad or pc.
+	For   string `json:"for"`
+	Spub  []byte `json:"spub,omitempty"`
+	Label string `json:"label"`
+}
+
+type DeviceCaptcha struct {
+	// email or phone.
+	Type string `json:"type"`
+}
+
+type DeviceIdentity struct {
+	DeviceID string `json:"device_id"`
+	UserID   string `json:"user_id"`
+	Alias    string `json:"alias"`
+	For      string `json:"for"`
+}
+
+// Device bound to the account, and whether it is online in the indexer.
+type DeviceStatus struct {
+	UserID   string `json:"userID"`
+	DeviceID string `json:"deviceID"`
+	OS       string `json:"os"`
+	// 0 farmer, 1 mobile, 2 pad, 3 pc.
+	For int32  `json:"for"`
+	MAC string `json:"mac"`
+	// The name verified by the idprovider.
+	Alias string `json:"alias"`
+	Wpub  []byte `json:"wpub,omitempty"`
+	Spub  []byte `json:"spub,omitempty"`
+	// Whether it is the device of this farmer.
+	IsLocal bool            `json:"IsLocal"`
+	Wallet  json.RawMessage `json:"Wallet,omitempty"`
+	// Wallet address of the device.
+	Address string `json:"address"`
+	// Name given on this farmer.
+	Label  string `json:"label"`
+	Online bool   `json:"online"`
+}
+
+type DeviceVerification struct {
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason"`
+}
+
+// Indexed file and the address of its device.
+type FileAddress struct {
+	ID       int64     `json:"id"`
+	DeviceID string    `json:"device_id"`
+	Path     string    `json:"path"`
+	Hash     string    `json:"hash"`
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	Address  string    `json:"address"`
+}
+
+// File of the farmer storage.
+type FileInfo struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Modtime time.Time `json:"modtime"`
+	Isdir   bool      `json:"isdir"`
+}
+
+// Tx of the wallet history.
+type HistoryTx struct {
+	Hash          string         `json:"hash"`
+	TxID          string         `json:"txid"`
+	Kind          string         `json:"kind"`
+	Block         uint64         `json:"block"`
+	Confirmations uint64         `json:"confirmations"`
+	Founder       string         `json:"founder"`
+	Timestamp     int64          `json:"timestamp"`
+	Committed     int64          `json:"committed"`
+	Received      uint64         `json:"received"`
+	Sent          uint64         `json:"sent"`
+	In            []HistoryTxIn  `json:"in,omitempty"`
+	Out           []HistoryTxOut `json:"out,omitempty"`
+}
+
+type HistoryTxIn struct {
+	SourceHash string `json:"source_hash"`
+	SourceIx   uint32 `json:"source_ix"`
+	Addr       string `json:"addr"`
+	Value      uint64 `json:"value"`
+}
+
+type HistoryTxOut struct {
+	Ix    uint32 `json:"ix"`
+	Addr  string `json:"addr"`
+	Value uint64 `json:"value"`
+	Until int64  `json:"until"`
+}
+
+type ImportResult struct {
+	Inserted int      `json:"inserted"`
+	Merged   int      `json:"merged"`
+	Skipped  int      `json:"skipped"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+type IndexedDevice struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+type IndexedFile struct {
+	ID       int64     `json:"id"`
+	DeviceID string    `json:"device_id"`
+	Path     string    `json:"path"`
+	Hash     string    `json:"hash"`
+	Size     int64     `json:"size"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Payment request.
+type Invoice struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Addr      string `json:"addr"`
+	Amount    uint64 `json:"amount"`
+	Memo      string `json:"memo"`
+	Status    string `json:"status"`
+	Created   int64  `json:"created"`
+	Expires   int64  `json:"expires"`
+	Height    uint64 `json:"height"`
+	PaidTx    string `json:"paid_tx"`
+	PaidBlock uint64 `json:"paid_block"`
+	PaidAt    int64  `json:"paid_at"`
+	URI       string `json:"uri"`
+}
+
+// Transfer to the payment request.
+type InvoicePayment struct {
+	// Hash of the tx.
+	ID         string  `json:"id"`
+	Timestamp  int64   `json:"timestamp"`
+	Founder    string  `json:"founder"`
+	ChargeAddr string  `json:"charge_addr"`
+	In         []TxIn  `json:"in,omitempty"`
+	Out        []TxOut `json:"out,omitempty"`
+	Fee        uint64  `json:"fee"`
+	// Coin selection of the ins left empty.
+	Strategy string `json:"strategy"`
+	URI      string `json:"uri"`
+}
+
+type InvoiceURI struct {
+	URI string `json:"uri"`
+}
+
+// Issued coins.
+type IssuanceEntry struct {
+	ID      int64    `json:"id"`
+	Kind    string   `json:"kind"`
+	UserID  string   `json:"user_id"`
+	Issuer  string   `json:"issuer"`
+	Addrs   []string `json:"addrs,omitempty"`
+	Amount  uint64   `json:"amount"`
+	Total   uint64   `json:"total"`
+	TxHash  string   `json:"tx_hash"`
+	Status  string   `json:"status"`
+	Reason  string   `json:"reason"`
+	Created int64    `json:"created"`
+}
+
+type IssuancePolicy struct {
+	Issuers         []string `json:"issuers,omitempty"`
+	Period          string   `json:"period"`
+	PeriodCap       uint64   `json:"period_cap"`
+	MaxAmount       uint64   `json:"max_amount"`
+	Reward          uint64   `json:"reward"`
+	HalvingInterval int      `json:"halving_interval"`
+	PeriodIssued    uint64   `json:"period_issued"`
+	NextReward      uint64   `json:"next_reward"`
+	NextRewardError string   `json:"next_reward_error"`
+}
+
+type Label struct {
+	Label string `json:"label"`
+}
+
+// Account of the login user and its token.
+type LoginResult struct {
+	ID       string `json:"id"`
+	Nicename string `json:"nicename"`
+	Phone    string `json:"phone"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// Language of the passphrase.
+	Lang       int32           `json:"lang"`
+	Passphrase string          `json:"passphrase"`
+	Wallet     json.RawMessage `json:"Wallet,omitempty"`
+	Devices    []Device        `json:"devices,omitempty"`
+	Settings   *Settings       `json:"settings,omitempty"`
+	Role       string          `json:"role"`
+	// Bearer token of the Authorization header.
+	Token   string `json:"token"`
+	Expires int64  `json:"expires"`
+}
+
+type LotteryTicket struct {
+	ID      int64    `json:"id"`
+	UserID  string   `json:"user_id"`
+	Name    string   `json:"name"`
+	Start   int64    `json:"start"`
+	End     int64    `json:"end"`
+	Fx      uint64   `json:"fx,string"`
+	Mr      uint64   `json:"mr,string"`
+	Idx     int64    `json:"idx"`
+	Height  uint64   `json:"height"`
+	Status  string   `json:"status"`
+	Ledgers []string `json:"ledgers,omitempty"`
+	Dist    uint64   `json:"dist,string"`
+	Reason  string   `json:"reason"`
+	Created int64    `json:"created"`
+	Checked int64    `json:"checked"`
+}
+
+// Next lottery and the ticket of the user in it.
+type LotteryWindow struct {
+	Start  int64          `json:"start"`
+	End    int64          `json:"end"`
+	Open   bool           `json:"open"`
+	Ticket *LotteryTicket `json:"ticket,omitempty"`
+}
+
+// User of this farmer and its role.
+type Member struct {
+	ID       string    `json:"id"`
+	Nickname string    `json:"nickname"`
+	Email    string    `json:"email"`
+	Phone    string    `json:"phone"`
+	Role     string    `json:"role"`
+	Updated  time.Time `json:"updated"`
+}
+
+type MemberRole struct {
+	ID string `json:"id"`
+	// admin, operator or viewer.
+	Role string `json:"role"`
+}
+
+// Result of a request without a resource.
+type Message struct {
+	Message string `json:"message"`
+}
+
+// M of N multisig address.
+type Multisig struct {
+	Address string   `json:"address"`
+	M       int      `json:"m"`
+	Pubkeys []string `json:"pubkeys,omitempty"`
+	Label   string   `json:"label"`
+	Created int64    `json:"created"`
+}
+
+type NameKV struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type NewAccount struct {
+	Name string `json:"name"`
+}
+
+type NewAddress struct {
+	Account uint32 `json:"account"`
+	// receive or change.
+	Chain string `json:"chain"`
+	Label string `json:"label"`
+}
+
+type NewInvoice struct {
+	Amount    uint64 `json:"amount"`
+	Memo      string `json:"memo"`
+	Name      string `json:"name"`
+	Addr      string `json:"addr"`
+	Expires   int64  `json:"expires"`
+	ExpiresIn string `json:"expires_in"`
+}
+
+type NewMultisig struct {
+	M       int      `json:"m"`
+	Pubkeys []string `json:"pubkeys,omitempty"`
+	Label   string   `json:"label"`
+}
+
+type NewProof struct {
+	// Hex of the document hash, or
+	Hash string `json:"hash"`
+	// path in the farmer storage.
+	File string `json:"file"`
+	Name string `json:"name"`
+}
+
+// How the account is notified.
+type Notify struct {
+	Email  bool     `json:"email"`
+	Phone  bool     `json:"phone"`
+	Events []string `json:"events,omitempty"`
+}
+
+// Partially signed tx.
+type PSBT struct {
+	Hash      string          `json:"hash"`
+	Tx        json.RawMessage `json:"tx,omitempty"`
+	Inputs    []PSBTInput     `json:"inputs,omitempty"`
+	Complete  bool            `json:"complete"`
+	Submitted bool            `json:"submitted"`
+	// Base64 of the signed tx for the other co-signers.
+	PSBT    string `json:"psbt"`
+	Created int64  `json:"created"`
+	Updated int64  `json:"updated"`
+}
+
+type PSBTImport struct {
+	PSBT string `json:"psbt"`
+}
+
+type PSBTInput struct {
+	Addr     string `json:"addr"`
+	Signed   int    `json:"signed"`
+	Required int    `json:"required"`
+}
+
+// Result of a peer command.
+type PeerResult struct {
+	Msg string `json:"msg"`
+}
+
+// Proof of existence.
+type Proof struct {
+	Hash      string `json:"hash"`
+	Owner     string `json:"owner"`
+	Name      string `json:"name"`
+	File      string `json:"file"`
+	Chaincode string `json:"chaincode"`
+	TxID      string `json:"txid"`
+	Status    string `json:"status"`
+	Block     uint64 `json:"block"`
+	BlockHash string `json:"block_hash"`
+	Timestamp int64  `json:"timestamp"`
+	Created   int64  `json:"created"`
+}
+
+type PubKey struct {
+	Addr string `json:"addr"`
+	// Hex of the compressed public key.
+	Pubkey string `json:"pubkey"`
+}
+
+// Quota of a user.
+type QuotaUpdate struct {
+	// Bytes, 0 is unlimited, -1 drops it for farmer.quota.default.
+	Quota int64 `json:"quota"`
+}
+
+type Receipt struct {
+	Hash              string `json:"hash"`
+	Owner             string `json:"owner"`
+	Chaincode         string `json:"chaincode"`
+	TxID              string `json:"txid"`
+	Timestamp         int64  `json:"timestamp"`
+	BlockNumber       uint64 `json:"block_number"`
+	BlockHash         string `json:"block_hash"`
+	PreviousBlockHash string `json:"previous_block_hash"`
+	StateHash         string `json:"state_hash"`
+	Block             []byte `json:"block,omitempty"`
+}
+
+type ReceiptVerification struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
+}
+
+// Recovers the account from its passphrase.
+type Recovery struct {
+	// email or phone.
+	Type       string `json:"type"`
+	Email      string `json:"email"`
+	Phone      string `json:"phone"`
+	Captcha    string `json:"captcha"`
+	Language   string `json:"language"`
+	Nickname   string `json:"nickname"`
+	Password   string `json:"password"`
+	Passphrase string `json:"passphrase"`
+	// Password of the signup if changed since, the password if empty.
+	WalletPassword string `json:"wallet_password"`
+}
+
+// Device unbound from the account.
+type Revocation struct {
+	DeviceID string    `json:"device_id"`
+	UserID   string    `json:"user_id"`
+	Wpub     string    `json:"wpub"`
+	Spub     []byte    `json:"spub,omitempty"`
+	Revoked  time.Time `json:"revoked"`
+}
+
+// Number of the revoked sessions.
+type Revoked struct {
+	Revoked int64 `json:"revoked"`
+}
+
+// Login session of a token.
+type Session struct {
+	ID      string    `json:"id"`
+	UserID  string    `json:"user_id"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+	Revoked bool      `json:"revoked"`
+	Agent   string    `json:"agent"`
+}
+
+// Preferences of the account on this farmer.
+type Settings struct {
+	// Language of the farmer ui.
+	Language string  `json:"language"`
+	Notify   *Notify `json:"notify,omitempty"`
+}
+
+// Fields of the settings to change, the missing ones are kept.
+type SettingsUpdate struct {
+	Nickname *string `json:"nickname,omitempty"`
+	Language *string `json:"language,omitempty"`
+	Notify   *Notify `json:"notify,omitempty"`
+}
+
+// Sign up or sign in by the email or phone.
+type SignUp struct {
+	// email or phone.
+	Type     string `json:"type"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
+	Captcha  string `json:"captcha"`
+	Language string `json:"language"`
+	Nickname string `json:"nickname"`
+	Password string `json:"password"`
+}
+
+// Storage used by a user.
+type StorageUsage struct {
+	UserID string `json:"user_id"`
+	// Bytes of the files written by the user.
+	Used  int64 `json:"used"`
+	Files int64 `json:"files"`
+	// Bytes, 0 is unlimited.
+	Quota int64 `json:"quota"`
+	// The quota is set for the user rather than farmer.quota.default.
+	Custom bool `json:"custom"`
+}
+
+// Transfer whose outs are locked.
+type TimeLockTransfer struct {
+	// Hash of the tx.
+	ID         string  `json:"id"`
+	Timestamp  int64   `json:"timestamp"`
+	Founder    string  `json:"founder"`
+	ChargeAddr string  `json:"charge_addr"`
+	In         []TxIn  `json:"in,omitempty"`
+	Out        []TxOut `json:"out,omitempty"`
+	Fee        uint64  `json:"fee"`
+	// Coin selection of the ins left empty.
+	Strategy string `json:"strategy"`
+	Until    int64  `json:"until"`
+	// Duration of the lock, e.g. 720h.
+	Lock string `json:"lock"`
+}
+
+// Lepuscoin tx.
+type Transfer struct {
+	// Hash of the tx.
+	ID         string  `json:"id"`
+	Timestamp  int64   `json:"timestamp"`
+	Founder    string  `json:"founder"`
+	ChargeAddr string  `json:"charge_addr"`
+	In         []TxIn  `json:"in,omitempty"`
+	Out        []TxOut `json:"out,omitempty"`
+	Fee        uint64  `json:"fee"`
+	// Coin selection of the ins left empty.
+	Strategy string `json:"strategy"`
+}
+
+type TransferPlan struct {
+	Strategy string  `json:"strategy"`
+	In       []TxIn  `json:"in,omitempty"`
+	Out      []TxOut `json:"out,omitempty"`
+	Fee      uint64  `json:"fee"`
+	Change   uint64  `json:"change"`
+}
+
+type TxIn struct {
+	Addr       string `json:"addr"`
+	PreTxHash  string `json:"pre_tx_hash"`
+	TxOutIndex string `json:"tx_out_index"`
+	Balance    uint64 `json:"balance"`
+	Until      int64  `json:"until"`
+}
+
+type TxOut struct {
+	Addr   string `json:"addr"`
+	Amount uint64 `json:"amount"`
+	Until  int64  `json:"until"`
+	// Pays to the address of the local contact.
+	ContactID int `json:"contact_id"`
+}
+
+// Account of the hd wallet.
+type WalletAccount struct {
+	Index   uint32 `json:"index"`
+	Name    string `json:"name"`
+	Created int64  `json:"created"`
+}
+
+// GetAccountState is GET /account, account of the login user.
+func (c *Client) GetAccountState() (*Account, error) {
+	u := "/account"
+	var ret Account
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListContactsQuery is the query of ListContacts.
+type ListContactsQuery struct {
+	// Matches the name, email, phone or address.
+	Q       string
+	Tag     string
+	Linked  *bool
+	Changed *bool
+	Limit   *int
+	Offset  *int
+}
+
+func (q *ListContactsQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Q != "" {
+		v.Set("q", q.Q)
+	}
+	if q.Tag != "" {
+		v.Set("tag", q.Tag)
+	}
+	if q.Linked != nil {
+		v.Set("linked", strconv.FormatBool(*q.Linked))
+	}
+	if q.Changed != nil {
+		v.Set("changed", strconv.FormatBool(*q.Changed))
+	}
+	if q.Limit != nil {
+		v.Set("limit", strconv.Itoa(*q.Limit))
+	}
+	if q.Offset != nil {
+		v.Set("offset", strconv.Itoa(*q.Offset))
+	}
+	return v
+}
+
+// ListContacts is GET /account/contacts, contacts of the address book.
+func (c *Client) ListContacts(q *ListContactsQuery) ([]Contact, int, error) {
+	u := QueryPath("/account/contacts", q.values())
+	var ret []Contact
+	h, err := c.call("GET", u, nil, &ret)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ret, recordCount(h), nil
+}
+
+// AddContacts is POST /account/contacts, add a contact.
+func (c *Client) AddContacts(body *Contact) (*Contact, error) {
+	u := "/account/contacts"
+	var ret Contact
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// RemoveAllContacts is DELETE /account/contacts, remove every contact.
+func (c *Client) RemoveAllContacts() (*Message, error) {
+	u := "/account/contacts"
+	var ret Message
+	if err := c.Do("DELETE", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ExportContactsQuery is the query of ExportContacts.
+type ExportContactsQuery struct {
+	// vcard or csv.
+	Format string
+	// 3.0 or 4.0 of vcard.
+	Version string
+	// Matches the name, email, phone or address.
+	Q       string
+	Tag     string
+	Linked  *bool
+	Changed *bool
+}
+
+func (q *ExportContactsQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Format != "" {
+		v.Set("format", q.Format)
+	}
+	if q.Version != "" {
+		v.Set("version", q.Version)
+	}
+	if q.Q != "" {
+		v.Set("q", q.Q)
+	}
+	if q.Tag != "" {
+		v.Set("tag", q.Tag)
+	}
+	if q.Linked != nil {
+		v.Set("linked", strconv.FormatBool(*q.Linked))
+	}
+	if q.Changed != nil {
+		v.Set("changed", strconv.FormatBool(*q.Changed))
+	}
+	return v
+}
+
+// ExportContacts is GET /account/contacts/export, export the contacts.
+func (c *Client) ExportContacts(q *ExportContactsQuery) (io.ReadCloser, error) {
+	u := QueryPath("/account/contacts/export", q.values())
+	rsp, err := c.Request("GET", u, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.Body, nil
+}
+
+// ImportContactsQuery is the query of ImportContacts.
+type ImportContactsQuery struct {
+	// vcard or csv, by the content type if empty.
+	Format string
+	// merge, skip or replace.
+	Mode string
+}
+
+func (q *ImportContactsQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Format != "" {
+		v.Set("format", q.Format)
+	}
+	if q.Mode != "" {
+		v.Set("mode", q.Mode)
+	}
+	return v
+}
+
+// ImportContacts is POST /account/contacts/import, import vcard or csv contacts.
+func (c *Client) ImportContacts(q *ImportContactsQuery, body io.Reader, contentType string) (*ImportResult, error) {
+	u := QueryPath("/account/contacts/import", q.values())
+	var ret ImportResult
+	if _, err := c.send("POST", u, contentType, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListContactTags is GET /account/contacts/tags, tags of the contacts.
+func (c *Client) ListContactTags() ([]string, error) {
+	u := "/account/contacts/tags"
+	var ret []string
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// UpdateContacts is PATCH /account/contacts/{id}, change a contact.
+func (c *Client) UpdateContacts(id string, body *Contact) (*Contact, error) {
+	u := "/account/contacts/" + url.PathEscape(id)
+	var ret Contact
+	if err := c.Do("PATCH", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// RemoveContacts is DELETE /account/contacts/{id}, remove a contact.
+func (c *Client) RemoveContacts(id string) (*Message, error) {
+	u := "/account/contacts/" + url.PathEscape(id)
+	var ret Message
+	if err := c.Do("DELETE", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// VerifyContact is POST /account/contacts/{id}/verify, resolve the address of a contact again.
+func (c *Client) VerifyContact(id string) (*Contact, error) {
+	u := "/account/contacts/" + url.PathEscape(id) + "/verify"
+	var ret Contact
+	if err := c.Do("POST", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Login is POST /account/login, login.
+func (c *Client) Login(body *SignUp) (*LoginResult, error) {
+	u := "/account/login"
+	var ret LoginResult
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Logout is DELETE /account/logout, revoke the token of the request.
+func (c *Client) Logout() error {
+	u := "/account/logout"
+	return c.Do("DELETE", u, nil, nil)
+}
+
+// RecoverAccount is POST /account/recover, recover the account from the passphrase.
+func (c *Client) RecoverAccount(body *Recovery) (*LoginResult, error) {
+	u := "/account/recover"
+	var ret LoginResult
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListSessions is GET /account/sessions, sessions of the account.
+func (c *Client) ListSessions() ([]Session, error) {
+	u := "/account/sessions"
+	var ret []Session
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// RevokeSessions is DELETE /account/sessions, revoke every session of the account.
+func (c *Client) RevokeSessions() (*Revoked, error) {
+	u := "/account/sessions"
+	var ret Revoked
+	if err := c.Do("DELETE", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// RevokeSession is DELETE /account/sessions/{id}, revoke a session.
+func (c *Client) RevokeSession(id string) (*Message, error) {
+	u := "/account/sessions/" + url.PathEscape(id)
+	var ret Message
+	if err := c.Do("DELETE", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetAccountSetting is GET /account/setting, settings of the account.
+func (c *Client) GetAccountSetting() (*Settings, error) {
+	u := "/account/setting"
+	var ret Settings
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// UpdateAccountSetting is PATCH /account/setting, change the settings of the account.
+func (c *Client) UpdateAccountSetting(body *SettingsUpdate) (*Settings, error) {
+	u := "/account/setting"
+	var ret Settings
+	if err := c.Do("PATCH", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// DeployCC is POST /cc/deploy, deploy a chaincode.
+func (c *Client) DeployCC(body *ChaincodeSpec) (*Message, error) {
+	u := "/cc/deploy"
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// InvokeCC is POST /cc/invoke, invoke a chaincode.
+func (c *Client) InvokeCC(body *ChaincodeSpec) (*Message, error) {
+	u := "/cc/invoke"
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// QueryCC is POST /cc/query, query a chaincode.
+func (c *Client) QueryCC(body *ChaincodeSpec) (*Message, error) {
+	u := "/cc/query"
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ProxyChain is GET /chain, chain of the peer rest api.
+func (c *Client) ProxyChain() (json.RawMessage, error) {
+	u := "/chain"
+	var ret json.RawMessage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ProxyChainPath is GET /chain/{path}, proxied to the peer rest api.
+func (c *Client) ProxyChainPath(path string) (json.RawMessage, error) {
+	u := "/chain/" + EscapePath(path)
+	var ret json.RawMessage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListChaincodes is GET /chaincode, registered chaincodes.
+func (c *Client) ListChaincodes() ([]Chaincode, error) {
+	u := "/chaincode"
+	var ret []Chaincode
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ProxyChaincode is POST /chaincode, jSON-RPC of the peer chaincode api.
+func (c *Client) ProxyChaincode(body interface{}) (json.RawMessage, error) {
+	u := "/chaincode"
+	var ret json.RawMessage
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetChaincodeQuery is the query of GetChaincode.
+type GetChaincodeQuery struct {
+	// Waits a pending chaincode at most the duration, e.g. 10s.
+	Wait string
+}
+
+func (q *GetChaincodeQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Wait != "" {
+		v.Set("wait", q.Wait)
+	}
+	return v
+}
+
+// GetChaincode is GET /chaincode/{alias}, registered chaincode.
+func (c *Client) GetChaincode(alias string, q *GetChaincodeQuery) (*Chaincode, error) {
+	u := QueryPath("/chaincode/"+url.PathEscape(alias), q.values())
+	var ret Chaincode
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// RegisterChaincode is PUT /chaincode/{alias}, register a chaincode.
+func (c *Client) RegisterChaincode(alias string, body *Chaincode) (*Chaincode, error) {
+	u := "/chaincode/" + url.PathEscape(alias)
+	var ret Chaincode
+	if err := c.Do("PUT", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// RemoveChaincode is DELETE /chaincode/{alias}, remove a registered chaincode.
+func (c *Client) RemoveChaincode(alias string) (*Message, error) {
+	u := "/chaincode/" + url.PathEscape(alias)
+	var ret Message
+	if err := c.Do("DELETE", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// DeployChaincode is POST /chaincode/{alias}/deploy, deploy a registered chaincode.
+func (c *Client) DeployChaincode(alias string) (*Chaincode, error) {
+	u := "/chaincode/" + url.PathEscape(alias) + "/deploy"
+	var ret Chaincode
+	if err := c.Do("POST", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// UpgradeChaincode is POST /chaincode/{alias}/upgrade, upgrade a registered chaincode.
+func (c *Client) UpgradeChaincode(alias string, body *Chaincode) (*Chaincode, error) {
+	u := "/chaincode/" + url.PathEscape(alias) + "/upgrade"
+	var ret Chaincode
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListDevices is GET /device, devices of the account.
+func (c *Client) ListDevices() ([]DeviceStatus, error) {
+	u := "/device"
+	var ret []DeviceStatus
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// BindDevice is POST /device/bind, bind a device.
+func (c *Client) BindDevice(body *DeviceBinding) (*Device, error) {
+	u := "/device/bind"
+	var ret Device
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// AcquireDeviceCaptcha is POST /device/captcha, send the captcha of binding a device.
+func (c *Client) AcquireDeviceCaptcha(body *DeviceCaptcha) (*Message, error) {
+	u := "/device/captcha"
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetCoinBaseTxQuery is the query of GetCoinBaseTx.
+type GetCoinBaseTxQuery struct {
+	Amount *int
+	Issuer string
+}
+
+func (q *GetCoinBaseTxQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Amount != nil {
+		v.Set("amount", strconv.Itoa(*q.Amount))
+	}
+	if q.Issuer != "" {
+		v.Set("issuer", q.Issuer)
+	}
+	return v
+}
+
+// GetCoinBaseTx is GET /device/coinbase_tx/{addr}, signed coinbase tx of an address.
+func (c *Client) GetCoinBaseTx(addr string, q *GetCoinBaseTxQuery) (*Message, error) {
+	u := QueryPath("/device/coinbase_tx/"+url.PathEscape(addr), q.values())
+	var ret Message
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// NewDeviceTx is POST /device/tx, serialize a tx.
+func (c *Client) NewDeviceTx(body *Transfer) (*Message, error) {
+	u := "/device/tx"
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// VerifyDevice is POST /device/verify, whether a device is bound to a user.
+func (c *Client) VerifyDevice(body *DeviceIdentity) (*DeviceVerification, error) {
+	u := "/device/verify"
+	var ret DeviceVerification
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// LabelDevice is PATCH /device/{id}, label a device.
+func (c *Client) LabelDevice(id string, body *Label) (*Device, error) {
+	u := "/device/" + url.PathEscape(id)
+	var ret Device
+	if err := c.Do("PATCH", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// UnbindDevice is DELETE /device/{id}, unbind a device.
+func (c *Client) UnbindDevice(id string) (*Revocation, error) {
+	u := "/device/" + url.PathEscape(id)
+	var ret Revocation
+	if err := c.Do("DELETE", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetDevops is GET /devops/{path}, proxied to the peer rest api.
+func (c *Client) GetDevops(path string) (json.RawMessage, error) {
+	u := "/devops/" + EscapePath(path)
+	var ret json.RawMessage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// PostDevops is POST /devops/{path}, proxied to the peer rest api.
+func (c *Client) PostDevops(path string, body interface{}) (json.RawMessage, error) {
+	u := "/devops/" + EscapePath(path)
+	var ret json.RawMessage
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetFile is GET /fs/cat/{path}, content of a file.
+func (c *Client) GetFile(path string) (io.ReadCloser, error) {
+	u := "/fs/cat/" + EscapePath(path)
+	rsp, err := c.Request("GET", u, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.Body, nil
+}
+
+// GetFileList is GET /fs/ls/{path}, list a directory.
+func (c *Client) GetFileList(path string) ([]FileInfo, error) {
+	u := "/fs/ls/" + EscapePath(path)
+	var ret []FileInfo
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// NewDir is POST /fs/mkdir/{path}, make a directory.
+func (c *Client) NewDir(path string) (*Message, error) {
+	u := "/fs/mkdir/" + EscapePath(path)
+	var ret Message
+	if err := c.Do("POST", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// UploadFile is PUT /fs/new/{path}, upload a file.
+func (c *Client) UploadFile(path string, name string, r io.Reader) (*Message, error) {
+	u := "/fs/new/" + EscapePath(path)
+	var ret Message
+	if err := c.Upload(u, name, r, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetStorageQuota is GET /fs/quota, storage used by the login user.
+func (c *Client) GetStorageQuota() (*StorageUsage, error) {
+	u := "/fs/quota"
+	var ret StorageUsage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// RenameFileQuery is the query of RenameFile.
+type RenameFileQuery struct {
+	Newpath string
+}
+
+func (q *RenameFileQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Newpath != "" {
+		v.Set("newpath", q.Newpath)
+	}
+	return v
+}
+
+// RenameFile is PATCH /fs/rename/{path}, rename a file.
+func (c *Client) RenameFile(path string, q *RenameFileQuery) (*Message, error) {
+	u := QueryPath("/fs/rename/"+EscapePath(path), q.values())
+	var ret Message
+	if err := c.Do("PATCH", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// RemoveFile is DELETE /fs/rm/{path}, remove a file.
+func (c *Client) RemoveFile(path string) (*Message, error) {
+	u := "/fs/rm/" + EscapePath(path)
+	var ret Message
+	if err := c.Do("DELETE", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetFileAddr is GET /indexer/address/{file_id}, address of the device of a file.
+func (c *Client) GetFileAddr(fileID string) (*FileAddress, error) {
+	u := "/indexer/address/" + url.PathEscape(fileID)
+	var ret FileAddress
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// SetFileIndexQuery is the query of SetFileIndex.
+type SetFileIndexQuery struct {
+	Clean  *bool
+	UserID string
+	Alias  string
+}
+
+func (q *SetFileIndexQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Clean != nil {
+		v.Set("clean", strconv.FormatBool(*q.Clean))
+	}
+	if q.UserID != "" {
+		v.Set("user_id", q.UserID)
+	}
+	if q.Alias != "" {
+		v.Set("alias", q.Alias)
+	}
+	return v
+}
+
+// SetFileIndex is POST /indexer/files/{device_id}, index the files of a device.
+func (c *Client) SetFileIndex(deviceID string, q *SetFileIndexQuery, body []IndexedFile) (*Count, error) {
+	u := QueryPath("/indexer/files/"+url.PathEscape(deviceID), q.values())
+	var ret Count
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// OfflineDevice is POST /indexer/offline/{device_id}, set a device offline.
+func (c *Client) OfflineDevice(deviceID string) (*Message, error) {
+	u := "/indexer/offline/" + url.PathEscape(deviceID)
+	var ret Message
+	if err := c.Do("POST", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// OnlineDeviceQuery is the query of OnlineDevice.
+type OnlineDeviceQuery struct {
+	UserID string
+	Alias  string
+}
+
+func (q *OnlineDeviceQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.UserID != "" {
+		v.Set("user_id", q.UserID)
+	}
+	if q.Alias != "" {
+		v.Set("alias", q.Alias)
+	}
+	return v
+}
+
+// OnlineDevice is POST /indexer/online/{device_id}, set a device online.
+func (c *Client) OnlineDevice(deviceID string, q *OnlineDeviceQuery, body *IndexedDevice) (*Message, error) {
+	u := QueryPath("/indexer/online/"+url.PathEscape(deviceID), q.values())
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListInvoicesQuery is the query of ListInvoices.
+type ListInvoicesQuery struct {
+	Status string
+	Limit  *int
+	Offset *int
+}
+
+func (q *ListInvoicesQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Status != "" {
+		v.Set("status", q.Status)
+	}
+	if q.Limit != nil {
+		v.Set("limit", strconv.Itoa(*q.Limit))
+	}
+	if q.Offset != nil {
+		v.Set("offset", strconv.Itoa(*q.Offset))
+	}
+	return v
+}
+
+// ListInvoices is GET /invoice, payment requests of the account.
+func (c *Client) ListInvoices(q *ListInvoicesQuery) ([]Invoice, int, error) {
+	u := QueryPath("/invoice", q.values())
+	var ret []Invoice
+	h, err := c.call("GET", u, nil, &ret)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ret, recordCount(h), nil
+}
+
+// NewInvoice is POST /invoice, create a payment request.
+func (c *Client) NewInvoice(body *NewInvoice) (*Invoice, error) {
+	u := "/invoice"
+	var ret Invoice
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// DecodeInvoice is POST /invoice/decode, decode a payment request uri.
+func (c *Client) DecodeInvoice(body *InvoiceURI) (*Invoice, error) {
+	u := "/invoice/decode"
+	var ret Invoice
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// PayInvoice is POST /invoice/pay, pay a payment request.
+func (c *Client) PayInvoice(body *InvoicePayment) (*Message, error) {
+	u := "/invoice/pay"
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetInvoice is GET /invoice/{id}, payment request.
+func (c *Client) GetInvoice(id string) (*Invoice, error) {
+	u := "/invoice/" + url.PathEscape(id)
+	var ret Invoice
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// QueryAddrsQuery is the query of QueryAddrs.
+type QueryAddrsQuery struct {
+	// Comma separated addresses.
+	Addrs   string
+	Format  *bool
+	Summary *bool
+}
+
+func (q *QueryAddrsQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Addrs != "" {
+		v.Set("addrs", q.Addrs)
+	}
+	if q.Format != nil {
+		v.Set("format", strconv.FormatBool(*q.Format))
+	}
+	if q.Summary != nil {
+		v.Set("summary", strconv.FormatBool(*q.Summary))
+	}
+	return v
+}
+
+// QueryAddrs is GET /lepuscoin/balance, balance of addresses.
+func (c *Client) QueryAddrs(q *QueryAddrsQuery) (json.RawMessage, error) {
+	u := QueryPath("/lepuscoin/balance", q.values())
+	var ret json.RawMessage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// QueryCoin is GET /lepuscoin/coin, coin info of the chaincode.
+func (c *Client) QueryCoin() (json.RawMessage, error) {
+	u := "/lepuscoin/coin"
+	var ret json.RawMessage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// DoCoinbase is POST /lepuscoin/coinbase, issue coins.
+func (c *Client) DoCoinbase(body *Coinbase) (*Message, error) {
+	u := "/lepuscoin/coinbase"
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// DeployLepuscoin is POST /lepuscoin/deploy, deploy the lepuscoin chaincode.
+func (c *Client) DeployLepuscoin() (*Message, error) {
+	u := "/lepuscoin/deploy"
+	var ret Message
+	if err := c.Do("POST", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListHistoryQuery is the query of ListHistory.
+type ListHistoryQuery struct {
+	// Comma separated addresses, the wallet addresses if empty.
+	Addrs  string
+	Limit  *int
+	Offset *int
+}
+
+func (q *ListHistoryQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Addrs != "" {
+		v.Set("addrs", q.Addrs)
+	}
+	if q.Limit != nil {
+		v.Set("limit", strconv.Itoa(*q.Limit))
+	}
+	if q.Offset != nil {
+		v.Set("offset", strconv.Itoa(*q.Offset))
+	}
+	return v
+}
+
+// ListHistory is GET /lepuscoin/history, tx history of addresses.
+func (c *Client) ListHistory(q *ListHistoryQuery) ([]HistoryTx, int, error) {
+	u := QueryPath("/lepuscoin/history", q.values())
+	var ret []HistoryTx
+	h, err := c.call("GET", u, nil, &ret)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ret, recordCount(h), nil
+}
+
+// GetHistoryTx is GET /lepuscoin/history/{hash}, tx of the history.
+func (c *Client) GetHistoryTx(hash string) (*HistoryTx, error) {
+	u := "/lepuscoin/history/" + url.PathEscape(hash)
+	var ret HistoryTx
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListIssuanceQuery is the query of ListIssuance.
+type ListIssuanceQuery struct {
+	Kind   string
+	Status string
+	Limit  *int
+	Offset *int
+}
+
+func (q *ListIssuanceQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Kind != "" {
+		v.Set("kind", q.Kind)
+	}
+	if q.Status != "" {
+		v.Set("status", q.Status)
+	}
+	if q.Limit != nil {
+		v.Set("limit", strconv.Itoa(*q.Limit))
+	}
+	if q.Offset != nil {
+		v.Set("offset", strconv.Itoa(*q.Offset))
+	}
+	return v
+}
+
+// ListIssuance is GET /lepuscoin/issuance, issued coins.
+func (c *Client) ListIssuance(q *ListIssuanceQuery) ([]IssuanceEntry, int, error) {
+	u := QueryPath("/lepuscoin/issuance", q.values())
+	var ret []IssuanceEntry
+	h, err := c.call("GET", u, nil, &ret)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ret, recordCount(h), nil
+}
+
+// GetIssuancePolicy is GET /lepuscoin/issuance/policy, issuance policy.
+func (c *Client) GetIssuancePolicy() (*IssuancePolicy, error) {
+	u := "/lepuscoin/issuance/policy"
+	var ret IssuancePolicy
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// SpendMultisig is POST /lepuscoin/multisig/spend, spend the coins of multisig addresses.
+func (c *Client) SpendMultisig(body *Transfer) (*PSBT, error) {
+	u := "/lepuscoin/multisig/spend"
+	var ret PSBT
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListPSBTs is GET /lepuscoin/psbt, partially signed txs.
+func (c *Client) ListPSBTs() ([]PSBT, error) {
+	u := "/lepuscoin/psbt"
+	var ret []PSBT
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ImportPSBT is POST /lepuscoin/psbt, merge the signatures of a co-signer.
+func (c *Client) ImportPSBT(body *PSBTImport) (*PSBT, error) {
+	u := "/lepuscoin/psbt"
+	var ret PSBT
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetPSBT is GET /lepuscoin/psbt/{hash}, partially signed tx.
+func (c *Client) GetPSBT(hash string) (*PSBT, error) {
+	u := "/lepuscoin/psbt/" + url.PathEscape(hash)
+	var ret PSBT
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// SignPSBT is POST /lepuscoin/psbt/{hash}/sign, sign a partially signed tx.
+func (c *Client) SignPSBT(hash string) (*PSBT, error) {
+	u := "/lepuscoin/psbt/" + url.PathEscape(hash) + "/sign"
+	var ret PSBT
+	if err := c.Do("POST", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// SubmitPSBT is POST /lepuscoin/psbt/{hash}/submit, invoke a signed tx.
+func (c *Client) SubmitPSBT(hash string) (*Message, error) {
+	u := "/lepuscoin/psbt/" + url.PathEscape(hash) + "/submit"
+	var ret Message
+	if err := c.Do("POST", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// TimeLockTransfer is POST /lepuscoin/timelock, transfer locked coins.
+func (c *Client) TimeLockTransfer(body *TimeLockTransfer) (*Message, error) {
+	u := "/lepuscoin/timelock"
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Transfer is POST /lepuscoin/transfer, transfer coins.
+func (c *Client) Transfer(body *Transfer) (*Message, error) {
+	u := "/lepuscoin/transfer"
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// DryRunTransfer is POST /lepuscoin/transfer/dryrun, plan a transfer without invoking it.
+func (c *Client) DryRunTransfer(body *Transfer) (*TransferPlan, error) {
+	u := "/lepuscoin/transfer/dryrun"
+	var ret TransferPlan
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// NewTx is POST /lepuscoin/tx, serialize a tx.
+func (c *Client) NewTx(body *Transfer) (*Message, error) {
+	u := "/lepuscoin/tx"
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// QueryTxQuery is the query of QueryTx.
+type QueryTxQuery struct {
+	Depth *int
+}
+
+func (q *QueryTxQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Depth != nil {
+		v.Set("depth", strconv.Itoa(*q.Depth))
+	}
+	return v
+}
+
+// QueryTx is GET /lepuscoin/tx/{tx}, tx of the chaincode.
+func (c *Client) QueryTx(tx string, q *QueryTxQuery) (json.RawMessage, error) {
+	u := QueryPath("/lepuscoin/tx/"+url.PathEscape(tx), q.values())
+	var ret json.RawMessage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetNextLottery is GET /lottery/next, next lottery.
+func (c *Client) GetNextLottery() (*LotteryWindow, error) {
+	u := "/lottery/next"
+	var ret LotteryWindow
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListLotteryTicketsQuery is the query of ListLotteryTickets.
+type ListLotteryTicketsQuery struct {
+	Limit  *int
+	Offset *int
+}
+
+func (q *ListLotteryTicketsQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Limit != nil {
+		v.Set("limit", strconv.Itoa(*q.Limit))
+	}
+	if q.Offset != nil {
+		v.Set("offset", strconv.Itoa(*q.Offset))
+	}
+	return v
+}
+
+// ListLotteryTickets is GET /lottery/tickets, tickets of the user.
+func (c *Client) ListLotteryTickets(q *ListLotteryTicketsQuery) ([]LotteryTicket, int, error) {
+	u := QueryPath("/lottery/tickets", q.values())
+	var ret []LotteryTicket
+	h, err := c.call("GET", u, nil, &ret)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ret, recordCount(h), nil
+}
+
+// SendLotteryTicket is POST /lottery/tickets, send a ticket to the open lottery.
+func (c *Client) SendLotteryTicket() (*LotteryTicket, error) {
+	u := "/lottery/tickets"
+	var ret LotteryTicket
+	if err := c.Do("POST", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetLotteryTicket is GET /lottery/tickets/{id}, ticket of the user.
+func (c *Client) GetLotteryTicket(id string) (*LotteryTicket, error) {
+	u := "/lottery/tickets/" + url.PathEscape(id)
+	var ret LotteryTicket
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// CheckLotteryTicket is POST /lottery/tickets/{id}/check, verify the result of a ticket.
+func (c *Client) CheckLotteryTicket(id string) (*LotteryTicket, error) {
+	u := "/lottery/tickets/" + url.PathEscape(id) + "/check"
+	var ret LotteryTicket
+	if err := c.Do("POST", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetMetrics is GET /metrics, prometheus metrics.
+func (c *Client) GetMetrics() (io.ReadCloser, error) {
+	u := "/metrics"
+	rsp, err := c.Request("GET", u, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.Body, nil
+}
+
+// DeployNameService is POST /namesrv/deploy, deploy the nameservice chaincode.
+func (c *Client) DeployNameService() (*Message, error) {
+	u := "/namesrv/deploy"
+	var ret Message
+	if err := c.Do("POST", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// NewNameServiceKV is POST /namesrv/new, register a name.
+func (c *Client) NewNameServiceKV(body *NameKV) (*Message, error) {
+	u := "/namesrv/new"
+	var ret Message
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ResolveNameServiceKV is GET /namesrv/{key}, resolve a name.
+func (c *Client) ResolveNameServiceKV(key string) (*NameKV, error) {
+	u := "/namesrv/" + url.PathEscape(key)
+	var ret NameKV
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// RemoveNameServiceKV is DELETE /namesrv/{key}, remove a name.
+func (c *Client) RemoveNameServiceKV(key string) (*Message, error) {
+	u := "/namesrv/" + url.PathEscape(key)
+	var ret Message
+	if err := c.Do("DELETE", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ProxyNetwork is GET /network/{path}, proxied to the peer rest api.
+func (c *Client) ProxyNetwork(path string) (json.RawMessage, error) {
+	u := "/network/" + EscapePath(path)
+	var ret json.RawMessage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetOpenAPI is GET /openapi.json, this document.
+func (c *Client) GetOpenAPI() (json.RawMessage, error) {
+	u := "/openapi.json"
+	var ret json.RawMessage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// RestartPeer is PATCH /peer/restart, restart the peer.
+func (c *Client) RestartPeer() (*PeerResult, error) {
+	u := "/peer/restart"
+	var ret PeerResult
+	if err := c.Do("PATCH", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// StartPeer is PATCH /peer/start, start the peer.
+func (c *Client) StartPeer() (*PeerResult, error) {
+	u := "/peer/start"
+	var ret PeerResult
+	if err := c.Do("PATCH", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// StopPeer is PATCH /peer/stop, stop the peer.
+func (c *Client) StopPeer() (*PeerResult, error) {
+	u := "/peer/stop"
+	var ret PeerResult
+	if err := c.Do("PATCH", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListProofsQuery is the query of ListProofs.
+type ListProofsQuery struct {
+	Owner  string
+	Limit  *int
+	Offset *int
+}
+
+func (q *ListProofsQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Owner != "" {
+		v.Set("owner", q.Owner)
+	}
+	if q.Limit != nil {
+		v.Set("limit", strconv.Itoa(*q.Limit))
+	}
+	if q.Offset != nil {
+		v.Set("offset", strconv.Itoa(*q.Offset))
+	}
+	return v
+}
+
+// ListProofs is GET /poe, proofs of existence.
+func (c *Client) ListProofs(q *ListProofsQuery) ([]Proof, int, error) {
+	u := QueryPath("/poe", q.values())
+	var ret []Proof
+	h, err := c.call("GET", u, nil, &ret)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ret, recordCount(h), nil
+}
+
+// RegisterProof is POST /poe, register a proof of existence.
+func (c *Client) RegisterProof(body *NewProof) (*Proof, error) {
+	u := "/poe"
+	var ret Proof
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// VerifyProofReceipt is POST /poe/verify, verify a receipt against the local chain.
+func (c *Client) VerifyProofReceipt(body *Receipt) (*ReceiptVerification, error) {
+	u := "/poe/verify"
+	var ret ReceiptVerification
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetProof is GET /poe/{hash}, proof of existence.
+func (c *Client) GetProof(hash string) (*Proof, error) {
+	u := "/poe/" + url.PathEscape(hash)
+	var ret Proof
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetProofReceipt is GET /poe/{hash}/receipt, receipt of a proof.
+func (c *Client) GetProofReceipt(hash string) (*Receipt, error) {
+	u := "/poe/" + url.PathEscape(hash) + "/receipt"
+	var ret Receipt
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetRegistrar is GET /registrar/{path}, proxied to the peer rest api.
+func (c *Client) GetRegistrar(path string) (json.RawMessage, error) {
+	u := "/registrar/" + EscapePath(path)
+	var ret json.RawMessage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// PostRegistrar is POST /registrar/{path}, proxied to the peer rest api.
+func (c *Client) PostRegistrar(path string, body interface{}) (json.RawMessage, error) {
+	u := "/registrar/" + EscapePath(path)
+	var ret json.RawMessage
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Registry is POST /signup, sign up an account.
+func (c *Client) Registry(body *SignUp) (*Account, error) {
+	u := "/signup"
+	var ret Account
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// RegVerificationType is POST /signup/{vtype}, send the captcha of signing up.
+func (c *Client) RegVerificationType(vtype string, body *SignUp) error {
+	u := "/signup/" + url.PathEscape(vtype)
+	return c.Do("POST", u, body, nil)
+}
+
+// ProxyTransactions is GET /transactions/{path}, proxied to the peer rest api.
+func (c *Client) ProxyTransactions(path string) (json.RawMessage, error) {
+	u := "/transactions/" + EscapePath(path)
+	var ret json.RawMessage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListMembers is GET /users, users of this farmer.
+func (c *Client) ListMembers() ([]Member, error) {
+	u := "/users"
+	var ret []Member
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListStorageQuotas is GET /users/quota, storage used by the users.
+func (c *Client) ListStorageQuotas() ([]StorageUsage, error) {
+	u := "/users/quota"
+	var ret []StorageUsage
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// SetMemberRole is PATCH /users/{id}, change the role of a user.
+func (c *Client) SetMemberRole(id string, body *MemberRole) (*MemberRole, error) {
+	u := "/users/" + url.PathEscape(id)
+	var ret MemberRole
+	if err := c.Do("PATCH", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// SetStorageQuota is PUT /users/{id}/quota, set the storage quota of a user.
+func (c *Client) SetStorageQuota(id string, body *QuotaUpdate) (*StorageUsage, error) {
+	u := "/users/" + url.PathEscape(id) + "/quota"
+	var ret StorageUsage
+	if err := c.Do("PUT", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListWalletAccounts is GET /wallet/accounts, accounts of the wallet.
+func (c *Client) ListWalletAccounts() ([]WalletAccount, error) {
+	u := "/wallet/accounts"
+	var ret []WalletAccount
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// NewWalletAccount is POST /wallet/accounts, add an account to the wallet.
+func (c *Client) NewWalletAccount(body *NewAccount) (*WalletAccount, error) {
+	u := "/wallet/accounts"
+	var ret WalletAccount
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListWalletAddressesQuery is the query of ListWalletAddresses.
+type ListWalletAddressesQuery struct {
+	Account *int
+	// receive or change.
+	Chain string
+}
+
+func (q *ListWalletAddressesQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Account != nil {
+		v.Set("account", strconv.Itoa(*q.Account))
+	}
+	if q.Chain != "" {
+		v.Set("chain", q.Chain)
+	}
+	return v
+}
+
+// ListWalletAddresses is GET /wallet/addresses, addresses of the wallet.
+func (c *Client) ListWalletAddresses(q *ListWalletAddressesQuery) ([]Address, error) {
+	u := QueryPath("/wallet/addresses", q.values())
+	var ret []Address
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// NewWalletAddress is POST /wallet/addresses, derive a new address.
+func (c *Client) NewWalletAddress(body *NewAddress) (*Address, error) {
+	u := "/wallet/addresses"
+	var ret Address
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// LabelWalletAddress is PATCH /wallet/addresses/{addr}, label an address.
+func (c *Client) LabelWalletAddress(addr string, body *Label) (*Address, error) {
+	u := "/wallet/addresses/" + url.PathEscape(addr)
+	var ret Address
+	if err := c.Do("PATCH", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetWalletPubKey is GET /wallet/addresses/{addr}/pubkey, public key of an address.
+func (c *Client) GetWalletPubKey(addr string) (*PubKey, error) {
+	u := "/wallet/addresses/" + url.PathEscape(addr) + "/pubkey"
+	var ret PubKey
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetWalletBalanceQuery is the query of GetWalletBalance.
+type GetWalletBalanceQuery struct {
+	Account *int
+}
+
+func (q *GetWalletBalanceQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Account != nil {
+		v.Set("account", strconv.Itoa(*q.Account))
+	}
+	return v
+}
+
+// GetWalletBalance is GET /wallet/balance, balance of the wallet.
+func (c *Client) GetWalletBalance(q *GetWalletBalanceQuery) (*Balance, error) {
+	u := QueryPath("/wallet/balance", q.values())
+	var ret Balance
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListWalletMultisigs is GET /wallet/multisig, multisig addresses of the wallet.
+func (c *Client) ListWalletMultisigs() ([]Multisig, error) {
+	u := "/wallet/multisig"
+	var ret []Multisig
+	if err := c.Do("GET", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// NewWalletMultisig is POST /wallet/multisig, add a multisig address.
+func (c *Client) NewWalletMultisig(body *NewMultisig) (*Multisig, error) {
+	u := "/wallet/multisig"
+	var ret Multisig
+	if err := c.Do("POST", u, body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ScanWalletQuery is the query of ScanWallet.
+type ScanWalletQuery struct {
+	Account *int
+	Gap     *int
+}
+
+func (q *ScanWalletQuery) values() url.Values {
+	v := url.Values{}
+	if q == nil {
+		return v
+	}
+	if q.Account != nil {
+		v.Set("account", strconv.Itoa(*q.Account))
+	}
+	if q.Gap != nil {
+		v.Set("gap", strconv.Itoa(*q.Gap))
+	}
+	return v
+}
+
+// ScanWallet is POST /wallet/scan, find the used addresses by the gap limit.
+func (c *Client) ScanWallet(q *ScanWalletQuery) ([]Address, error) {
+	u := QueryPath("/wallet/scan", q.values())
+	var ret []Address
+	if err := c.Do("POST", u, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerated(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("no go toolchain")
+	}
+	dir, err := ioutil.TempDir("", "farmer-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "client_gen.go")
+	if bs, err := exec.Command("go", "run", "gen/main.go", "-spec", "../api/openapi.json", "-out", out).CombinedOutput(); err != nil {
+		t.Fatalf("generate failed, %s %s", err, bs)
+	}
+	want, _ := ioutil.ReadFile(out)
+	got, _ := ioutil.ReadFile("client_gen.go")
+	if !bytes.Equal(want, got) {
+		t.Errorf("client_gen.go is out of date, run go generate in farmer/client")
+	}
+}
+
+func TestError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0" {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"error":"Unauthorized","message":"login first"}`))
+			return
+		}
+		w.Header().Set("Record-Count", "3")
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL+"/", "")
+	err := c.Do("GET", "/account", nil, nil)
+	e, ok := err.(*Error)
+	if !ok || e.Status != 401 || e.Message != "login first" {
+		t.Fatalf("expect 401 error, %v", err)
+	}
+	if e.Error() != "401 Unauthorized, login first" {
+		t.Errorf("error is %q", e.Error())
+	}
+
+	c.Token = "t0"
+	var l []string
+	h, err := c.call("GET", "/list", nil, &l)
+	if err != nil || recordCount(h) != 3 {
+		t.Errorf("list, %v %v", h, err)
+	}
+}
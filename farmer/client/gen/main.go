@@ -0,0 +1,420 @@
+// gen writes the typed methods of farmer/client from the openapi document of the farmer api.
+//
+//	go run gen/main.go -spec ../api/openapi.json -out client_gen.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+type schema struct {
+	Type                 string  `json:"type"`
+	Format               string  `json:"format"`
+	Ref                  string  `json:"$ref"`
+	Description          string  `json:"description"`
+	Nullable             bool    `json:"x-nullable"`
+	Items                *schema `json:"items"`
+	AdditionalProperties *schema `json:"additionalProperties"`
+	Properties           props   `json:"properties"`
+}
+
+type prop struct {
+	name string
+	s    *schema
+}
+
+// props keeps the order of the properties in the document.
+type props []prop
+
+func (ps *props) UnmarshalJSON(bs []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		s := &schema{}
+		if err := dec.Decode(s); err != nil {
+			return err
+		}
+		*ps = append(*ps, prop{t.(string), s})
+	}
+	return nil
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Type        string  `json:"type"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+type response struct {
+	Schema  *schema                    `json:"schema"`
+	Headers map[string]json.RawMessage `json:"headers"`
+}
+
+type operation struct {
+	Summary     string               `json:"summary"`
+	OperationID string               `json:"operationId"`
+	Parameters  []*parameter         `json:"parameters"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type spec struct {
+	Paths       map[string]map[string]*operation `json:"paths"`
+	Definitions map[string]*schema               `json:"definitions"`
+}
+
+var initialisms = map[string]string{
+	"id": "ID", "uri": "URI", "txid": "TxID", "psbt": "PSBT", "os": "OS", "mac": "MAC",
+}
+
+// goName is the exported go name of the json name, e.g. user_id is UserID.
+func goName(s string) string {
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == '_' || r == '-' || r == '.' })
+	for i, p := range parts {
+		if v, ok := initialisms[strings.ToLower(p)]; ok {
+			parts[i] = v
+			continue
+		}
+		parts[i] = strings.ToUpper(p[:1]) + p[1:]
+	}
+	return strings.Join(parts, "")
+}
+
+func refName(ref string) string {
+	return strings.TrimPrefix(ref, "#/definitions/")
+}
+
+// goType is the go type of s, a referenced definition is a pointer unless it is an item of a list.
+func goType(s *schema, item bool) string {
+	if s.Ref != "" {
+		if item {
+			return refName(s.Ref)
+		}
+		return "*" + refName(s.Ref)
+	}
+	if s.Nullable {
+		return "*" + goType(&schema{Type: s.Type, Format: s.Format}, item)
+	}
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			return "time.Time"
+		case "byte":
+			return "[]byte"
+		case "uint64":
+			return "uint64"
+		}
+		return "string"
+	case "integer":
+		switch s.Format {
+		case "int32", "int64", "uint32", "uint64":
+			return s.Format
+		}
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + goType(s.Items, true)
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "map[string]" + goType(s.AdditionalProperties, true)
+		}
+	}
+	return "json.RawMessage"
+}
+
+type generator struct {
+	buf bytes.Buffer
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+	g.buf.WriteByte('\n')
+}
+
+func (g *generator) comment(s string) {
+	if s != "" {
+		g.p("// %s", s)
+	}
+}
+
+func (g *generator) definition(name string, s *schema) {
+	g.comment(s.Description)
+	g.p("type %s struct {", name)
+	for _, pr := range s.Properties {
+		typ := goType(pr.s, false)
+		// the missing ones are nil, the zero values are sent.
+		tag := pr.name
+		if strings.HasPrefix(typ, "*") || strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[") || typ == "json.RawMessage" {
+			tag += ",omitempty"
+		}
+		if pr.s.Type == "string" && pr.s.Format == "uint64" {
+			tag += ",string"
+		}
+		g.comment(pr.s.Description)
+		g.p("%s %s `json:%q`", goName(pr.name), typ, tag)
+	}
+	g.p("}\n")
+}
+
+// query writes the struct of the query parameters of the operation name.
+func (g *generator) query(name string, params []*parameter) {
+	g.p("// %s is the query of %s.", name+"Query", name)
+	g.p("type %sQuery struct {", name)
+	for _, p := range params {
+		g.comment(p.Description)
+		switch p.Type {
+		case "integer":
+			g.p("%s *int", goName(p.Name))
+		case "boolean":
+			g.p("%s *bool", goName(p.Name))
+		default:
+			g.p("%s string", goName(p.Name))
+		}
+	}
+	g.p("}\n")
+
+	g.p("func (q *%sQuery) values() url.Values {", name)
+	g.p("v := url.Values{}")
+	g.p("if q == nil {\nreturn v\n}")
+	for _, p := range params {
+		f := "q." + goName(p.Name)
+		switch p.Type {
+		case "integer":
+			g.p("if %s != nil {\nv.Set(%q, strconv.Itoa(*%s))\n}", f, p.Name, f)
+		case "boolean":
+			g.p("if %s != nil {\nv.Set(%q, strconv.FormatBool(*%s))\n}", f, p.Name, f)
+		default:
+			g.p("if %s != \"\" {\nv.Set(%q, %s)\n}", f, p.Name, f)
+		}
+	}
+	g.p("return v")
+	g.p("}\n")
+}
+
+func (g *generator) operation(method, path string, op *operation) {
+	name := goName(op.OperationID)
+	name = strings.ToUpper(name[:1]) + name[1:]
+
+	var (
+		args, query []*parameter
+		body, form  *parameter
+	)
+	for _, p := range op.Parameters {
+		switch p.In {
+		case "path":
+			args = append(args, p)
+		case "query":
+			query = append(query, p)
+		case "body":
+			body = p
+		case "formData":
+			form = p
+		}
+	}
+	if len(query) > 0 {
+		g.query(name, query)
+	}
+
+	var (
+		params []string
+		rsp    *response
+	)
+	for _, p := range args {
+		params = append(params, argName(p.Name)+" string")
+	}
+	if len(query) > 0 {
+		params = append(params, "q *"+name+"Query")
+	}
+	for _, code := range []string{"200", "201", "202"} {
+		if r, ok := op.Responses[code]; ok {
+			rsp = r
+			break
+		}
+	}
+
+	// the path of the request.
+	pathExpr := `"` + path + `"`
+	for _, p := range args {
+		escape := "url.PathEscape"
+		if p.Name == "path" {
+			escape = "EscapePath"
+		}
+		pathExpr = strings.Replace(pathExpr, "{"+p.Name+"}", `"+`+escape+"("+argName(p.Name)+`)+"`, 1)
+	}
+	pathExpr = strings.Replace(pathExpr, `+""`, "", -1)
+	if len(query) > 0 {
+		pathExpr = "QueryPath(" + pathExpr + ", q.values())"
+	}
+
+	in := "nil"
+	switch {
+	case body != nil && body.Schema.Type == "string" && body.Schema.Format == "binary":
+		params = append(params, "body io.Reader", "contentType string")
+	case body != nil && body.Schema.Ref == "" && body.Schema.Type == "":
+		params = append(params, "body interface{}")
+		in = "body"
+	case body != nil:
+		params = append(params, "body "+goType(body.Schema, false))
+		in = "body"
+	case form != nil:
+		params = append(params, "name string", "r io.Reader")
+	}
+
+	var out string
+	count := false
+	if rsp != nil && rsp.Schema != nil {
+		switch {
+		case rsp.Schema.Type == "file":
+			out = "io.ReadCloser"
+		case rsp.Schema.Ref == "" && rsp.Schema.Type == "":
+			out = "json.RawMessage"
+		default:
+			out = goType(rsp.Schema, false)
+			_, count = rsp.Headers["Record-Count"]
+		}
+	}
+
+	results := "error"
+	switch {
+	case out != "" && count:
+		results = "(" + out + ", int, error)"
+	case out != "":
+		results = "(" + out + ", error)"
+	}
+
+	g.p("// %s is %s %s, %s.", name, strings.ToUpper(method), path, strings.ToLower(op.Summary[:1])+op.Summary[1:])
+	g.p("func (c *Client) %s(%s) %s {", name, strings.Join(params, ", "), results)
+	g.p("u := %s", pathExpr)
+	M := strings.ToUpper(method)
+	switch {
+	case out == "io.ReadCloser":
+		g.p("rsp, err := c.Request(%q, u, \"\", nil)", M)
+		g.p("if err != nil {\nreturn nil, err\n}")
+		g.p("return rsp.Body, nil")
+	case body != nil && in == "nil":
+		g.p("var ret %s", strings.TrimPrefix(out, "*"))
+		g.p("if _, err := c.send(%q, u, contentType, body, &ret); err != nil {\nreturn nil, err\n}", M)
+		g.p("return %s, nil", retExpr(out))
+	case form != nil:
+		g.p("var ret %s", strings.TrimPrefix(out, "*"))
+		g.p("if err := c.Upload(u, name, r, &ret); err != nil {\nreturn nil, err\n}")
+		g.p("return %s, nil", retExpr(out))
+	case out == "":
+		g.p("return c.Do(%q, u, %s, nil)", M, in)
+	case count:
+		g.p("var ret %s", out)
+		g.p("h, err := c.call(%q, u, %s, &ret)", M, in)
+		g.p("if err != nil {\nreturn nil, 0, err\n}")
+		g.p("return ret, recordCount(h), nil")
+	default:
+		g.p("var ret %s", strings.TrimPrefix(out, "*"))
+		g.p("if err := c.Do(%q, u, %s, &ret); err != nil {\nreturn nil, err\n}", M, in)
+		g.p("return %s, nil", retExpr(out))
+	}
+	g.p("}\n")
+}
+
+// argName is the go argument of the path parameter, e.g. device_id is deviceID.
+func argName(s string) string {
+	n := goName(s)
+	if v, ok := initialisms[strings.ToLower(s)]; ok && v == n {
+		return strings.ToLower(n)
+	}
+	return strings.ToLower(n[:1]) + n[1:]
+}
+
+func retExpr(out string) string {
+	if strings.HasPrefix(out, "*") {
+		return "&ret"
+	}
+	return "ret"
+}
+
+var methods = []string{"get", "put", "post", "patch", "delete"}
+
+func main() {
+	specPath := flag.String("spec", "../api/openapi.json", "the openapi document")
+	outPath := flag.String("out", "client_gen.go", "the generated file")
+	flag.Parse()
+
+	bs, err := ioutil.ReadFile(*specPath)
+	if err != nil {
+		fatal(err)
+	}
+	sp := &spec{}
+	if err := json.Unmarshal(bs, sp); err != nil {
+		fatal(err)
+	}
+
+	g := &generator{}
+
+	names := make([]string, 0, len(sp.Definitions))
+	for n := range sp.Definitions {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		// the same as Error of client.go.
+		if n == "Error" {
+			continue
+		}
+		g.definition(n, sp.Definitions[n])
+	}
+
+	paths := make([]string, 0, len(sp.Paths))
+	for p := range sp.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		for _, m := range methods {
+			if op, ok := sp.Paths[p][m]; ok {
+				g.operation(m, p, op)
+			}
+		}
+	}
+
+	body := g.buf.String()
+	var imports []string
+	for _, pkg := range []string{"encoding/json", "io", "net/url", "strconv", "time"} {
+		if strings.Contains(body, pkg[strings.LastIndex(pkg, "/")+1:]+".") {
+			imports = append(imports, fmt.Sprintf("%q", pkg))
+		}
+	}
+	head := "// Code generated by gen/main.go from farmer/api/openapi.json. DO NOT EDIT.\n\npackage client\n\n"
+	head += "import (\n" + strings.Join(imports, "\n") + "\n)\n\n"
+
+	src, err := format.Source([]byte(head + body))
+	if err != nil {
+		os.Stderr.WriteString(head + body)
+		fatal(err)
+	}
+	if err := ioutil.WriteFile(*outPath, src, 0644); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
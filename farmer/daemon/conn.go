@@ -69,6 +69,43 @@ func (d *Daemon) GetIDPClient() (pb.IDPPClient, error) {
 	return d.idppCli, nil
 }
 
+func (d *Daemon) ConnIDPA(addr string) error {
+	opts := []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithTimeout(defaultTimeout),
+		grpc.WithBlock(),
+	}
+
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	if d.idpaConn != nil {
+		d.idpaConn.Close()
+	}
+	d.idpaConn = conn
+	d.idpaCli = pb.NewIDPAClient(conn)
+	return nil
+}
+
+// GetIDPAClient returns the client of IDPA, which verifies the devices of the other accounts.
+func (d *Daemon) GetIDPAClient() (pb.IDPAClient, error) {
+	if d.idpaCli != nil {
+		return d.idpaCli, nil
+	}
+
+	err := d.ConnIDPA(d.IDPAAddr)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	return d.idpaCli, nil
+}
+
 func (d *Daemon) GetSVClient() (pb.FarmerPublicClient, error) {
 	if d.svCli != nil {
 		return d.svCli, nil
@@ -83,6 +120,42 @@ func (d *Daemon) GetSVClient() (pb.FarmerPublicClient, error) {
 	return d.svCli, nil
 }
 
+func (d *Daemon) ConnTeller(addr string) error {
+	opts := []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithTimeout(defaultTimeout),
+		grpc.WithBlock(),
+	}
+
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	if d.tellerConn != nil {
+		d.tellerConn.Close()
+	}
+	d.tellerConn = conn
+	d.lotteryCli = pb.NewLotteryAPIClient(conn)
+	return nil
+}
+
+func (d *Daemon) GetLotteryClient() (pb.LotteryAPIClient, error) {
+	if d.lotteryCli != nil {
+		return d.lotteryCli, nil
+	}
+
+	err := d.ConnTeller(d.TellerAddr)
+	if err != nil {
+		logger.Error(err)
+		return nil, err
+	}
+
+	return d.lotteryCli, nil
+}
+
 func (d *Daemon) CloseConn() {
 	if d.idproviderConn != nil {
 		d.idproviderConn.Close()
@@ -90,4 +163,10 @@ func (d *Daemon) CloseConn() {
 	if d.supervisorConn != nil {
 		d.supervisorConn.Close()
 	}
+	if d.tellerConn != nil {
+		d.tellerConn.Close()
+	}
+	if d.idpaConn != nil {
+		d.idpaConn.Close()
+	}
 }
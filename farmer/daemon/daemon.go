@@ -1,6 +1,7 @@
 package daemon
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
@@ -13,6 +14,18 @@ import (
 
 	pb "github.com/conseweb/common/protos"
 	"github.com/hyperledger/fabric/farmer/account"
+	"github.com/hyperledger/fabric/farmer/history"
+	"github.com/hyperledger/fabric/farmer/indexer"
+	"github.com/hyperledger/fabric/farmer/invoice"
+	"github.com/hyperledger/fabric/farmer/issuance"
+	"github.com/hyperledger/fabric/farmer/lottery"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	"github.com/hyperledger/fabric/farmer/poe"
+	"github.com/hyperledger/fabric/farmer/quota"
+	"github.com/hyperledger/fabric/farmer/registry"
+	"github.com/hyperledger/fabric/farmer/session"
+	"github.com/hyperledger/fabric/farmer/store"
+	"github.com/hyperledger/fabric/farmer/wallet"
 	"github.com/hyperledger/fabric/peer/node"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/op/go-logging"
@@ -26,7 +39,10 @@ const (
 	// for grpc
 	DefaultSupervisorAddr = ":9376"
 	DefaultIDProviderAddr = ":9377"
+	DefaultTellerAddr     = ":9378"
 	defaultTimeout        = 3 * time.Second
+
+	defaultShutdownTimeout = 30 * time.Second
 )
 
 var (
@@ -37,6 +53,8 @@ var (
 type Daemon struct {
 	SupervisorAddr string
 	IDProviderAddr string
+	IDPAAddr       string // the same as IDProviderAddr if not set
+	TellerAddr     string
 	ListenAddr     string
 	RESTURL        string
 	RootFS         string
@@ -47,10 +65,17 @@ type Daemon struct {
 	exitCh chan error
 	sync.Mutex
 
+	// run in the reverse order by Exit.
+	shutdownHooks []func(context.Context) error
+
 	supervisorConn *grpc.ClientConn
 	idproviderConn *grpc.ClientConn
 	svCli          pb.FarmerPublicClient
 	idppCli        pb.IDPPClient
+	idpaConn       *grpc.ClientConn
+	idpaCli        pb.IDPAClient
+	tellerConn     *grpc.ClientConn
+	lotteryCli     pb.LotteryAPIClient
 
 	// used save account info.
 	localDB *sql.DB
@@ -60,6 +85,7 @@ func NewDaemon() *Daemon {
 	d := &Daemon{
 		SupervisorAddr: DefaultSupervisorAddr,
 		IDProviderAddr: DefaultIDProviderAddr,
+		TellerAddr:     DefaultTellerAddr,
 		ListenAddr:     DefaultListenAddr,
 		RESTURL:        viper.GetString("rest.address"),
 		RootFS:         viper.GetString("peer.fileSystemPath"),
@@ -79,25 +105,39 @@ func NewDaemon() *Daemon {
 	} else {
 		d.IDProviderAddr = idpAddr
 	}
+	d.IDPAAddr = d.IDProviderAddr
+	if idpaAddr := viper.GetString("farmer.idpaAddress"); idpaAddr != "" {
+		d.IDPAAddr = idpaAddr
+	}
+	if tellerAddr := viper.GetString("farmer.tellerAddress"); tellerAddr != "" {
+		d.TellerAddr = tellerAddr
+	}
 	listenAddr := viper.GetString("daemon.address")
 	if listenAddr != "" {
 		d.ListenAddr = listenAddr
 	}
 
-	a, err := account.LoadFromFile()
-	if err != nil {
-		d.GetLogger().Errorf("load account failed", err)
-	}
-	if a != nil {
-		d.Account = a
-	}
-
 	return d
 }
 
-//
-type dbHandler interface {
-	InitDB(db *sql.DB) error
+// DBPath returns the path of farmer.db.
+func DBPath() string {
+	return filepath.Join(viper.GetString("peer.fileSystemPath"), "farmer.db")
+}
+
+// schemas of farmer.db, the tables of every package are versioned on their own.
+var schemas = []*migrate.Schema{
+	account.AccountsSchema,
+	account.ContactsSchema,
+	wallet.Schema,
+	history.Schema,
+	invoice.Schema,
+	issuance.Schema,
+	registry.Schema,
+	poe.Schema,
+	session.Schema,
+	lottery.Schema,
+	quota.Schema,
 }
 
 func (d *Daemon) Init() error {
@@ -105,12 +145,7 @@ func (d *Daemon) Init() error {
 		return err
 	}
 
-	a, err := account.LoadFromFile()
-	if err == nil && a != nil {
-		d.Account = a
-	}
-
-	db, err := sql.Open("sqlite3", filepath.Join(viper.GetString("peer.fileSystemPath"), "farmer.db"))
+	db, err := sql.Open("sqlite3", DBPath())
 	if err != nil {
 		return err
 	}
@@ -119,21 +154,61 @@ func (d *Daemon) Init() error {
 		return err
 	}
 
-	// for init db, e. create tables.
-	for _, h := range []dbHandler{
-		&account.Contact{},
-	} {
-		if err := h.InitDB(db); err != nil {
-			logger.Errorf("init db failed, error: %s", err.Error())
-			return err
-		}
+	if err := migrateDBs(db); err != nil {
+		logger.Errorf("migrate db failed, error: %s", err.Error())
+		return err
 	}
 
 	d.localDB = db
 
+	if err := d.loadAccount(db); err != nil {
+		logger.Warningf("load account failed, %s", err)
+	}
+	return nil
+}
+
+// loadAccount imports the account of the single user farmer, and sets the account of the newest session
+// as the farmer account.
+func (d *Daemon) loadAccount(db *sql.DB) error {
+	if a, err := account.ImportFile(db); err != nil {
+		return err
+	} else if a != nil {
+		logger.Infof("account %s is imported from the account file", a.ID)
+	}
+
+	id, err := session.LastActive(db)
+	if err != nil || id == "" {
+		return err
+	}
+	a, err := account.Load(db, id)
+	if err != nil {
+		return err
+	}
+	d.SetAccount(a)
 	return nil
 }
 
+// migrateDBs brings farmer.db, farmerKV.db and indexer.db to the latest schema.
+func migrateDBs(db *sql.DB) error {
+	r := &migrate.Runner{
+		Path:   DBPath(),
+		Backup: viper.GetBool("daemon.migration.backup"),
+		Strict: true,
+	}
+	if err := r.Run(db, schemas...); err != nil {
+		return err
+	}
+
+	kv, err := store.NewKV()
+	if err != nil {
+		return err
+	}
+	kv.Close()
+
+	_, err = indexer.InitDB()
+	return err
+}
+
 func (d *Daemon) GetDB() *sql.DB {
 	if d.localDB != nil {
 		return d.localDB
@@ -142,7 +217,7 @@ func (d *Daemon) GetDB() *sql.DB {
 }
 
 func (d *Daemon) WaitExit() {
-	sigChan := make(chan os.Signal)
+	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	select {
@@ -173,6 +248,38 @@ func (d *Daemon) writePid() error {
 	return nil
 }
 
+// OnShutdown adds fn to run when the daemon exits, e.g. draining the http requests.
+// ctx is done at daemon.shutdownTimeout.
+func (d *Daemon) OnShutdown(fn func(ctx context.Context) error) {
+	d.Lock()
+	defer d.Unlock()
+	d.shutdownHooks = append(d.shutdownHooks, fn)
+}
+
+func shutdownTimeout() time.Duration {
+	if t := viper.GetDuration("daemon.shutdownTimeout"); t > 0 {
+		return t
+	}
+	return defaultShutdownTimeout
+}
+
+// shutdown runs the shutdown hooks, then stops the peer.
+func (d *Daemon) shutdown() {
+	d.Lock()
+	hooks := d.shutdownHooks
+	d.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			logger.Warningf("shutdown failed, %s", err)
+		}
+	}
+
+	node.Shutdown()
+}
+
 func (d *Daemon) Exit(err error) {
 	select {
 	case <-d.exitCh:
@@ -182,15 +289,16 @@ func (d *Daemon) Exit(err error) {
 		close(d.exitCh)
 	}
 
+	logger.Infof("farmer daemon(PID: %d) is shutting down...", d.pid)
+	d.shutdown()
 	os.RemoveAll(pidFilePath())
 	d.CloseConn()
 
-	time.Sleep(1 * time.Second)
 	if err != nil {
 		logger.Errorf("farmer daemon(PID: %d) exit by error: %s", d.pid, err)
-	} else {
-		logger.Infof("farmer daemon(PID: %d) exit...", d.pid)
+		os.Exit(1)
 	}
+	logger.Infof("farmer daemon(PID: %d) exit...", d.pid)
 	os.Exit(0)
 }
 
@@ -201,20 +309,18 @@ func (d *Daemon) GetLogger() *logging.Logger {
 	return logging.MustGetLogger("daemon")
 }
 
-func (d *Daemon) ResetAccount(a *account.Account) {
+// SetAccount sets the farmer account, which the supervisor knows this farmer by. it is the last
+// logged in user, the api users are told by their tokens. nil if nobody is logged in.
+func (d *Daemon) SetAccount(a *account.Account) {
 	d.Lock()
 	defer d.Unlock()
-	if a == nil {
-		err := d.Account.Logout()
-		if err != nil {
-			logger.Errorf("user logout failed", err)
-		}
-		return
-	}
 	d.Account = a
 }
 
+// GetUser returns the farmer account.
 func (d *Daemon) GetUser() *account.Account {
+	d.Lock()
+	defer d.Unlock()
 	if d.Account != nil && d.Account.ID != "" {
 		return d.Account
 	}
@@ -222,6 +328,7 @@ func (d *Daemon) GetUser() *account.Account {
 	return nil
 }
 
+// IsLogin tells whether the farmer account is set.
 func (d *Daemon) IsLogin() bool {
 	u := d.GetUser()
 	if u == nil {
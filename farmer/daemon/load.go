@@ -2,9 +2,7 @@ package daemon
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/viper"
@@ -24,15 +22,9 @@ func LoadDaemon() (*Daemon, error) {
 		}
 	}
 
-	pidFile := filepath.Join(fsPath, "farmer.pid")
 	// Check farmer pid file.
-	pidf, err := os.Open(pidFile)
-	if os.IsExist(err) {
-		pidbs, err := ioutil.ReadAll(pidf)
-		if err != nil {
-			return nil, fmt.Errorf("Open pid file %s faild, error: %s", pidFile, err.Error())
-		}
-		return nil, fmt.Errorf("Farmer daemon is running(PID: %s)", pidbs)
+	if err := removeStalePid(); err != nil {
+		return nil, err
 	}
 
 	addr := viper.GetString("daemon.address")
@@ -0,0 +1,126 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	logrus "github.com/Sirupsen/logrus"
+	"github.com/hyperledger/fabric/flogging"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultLogMaxSize    = 10 // MB
+	defaultLogMaxBackups = 5
+)
+
+// LogFilePath returns the log file of the daemon in the background, daemon.log.file
+// which is relative to peer.fileSystemPath.
+func LogFilePath() string {
+	p := viper.GetString("daemon.log.file")
+	if p == "" {
+		p = "farmer.log"
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(viper.GetString("peer.fileSystemPath"), p)
+	}
+	return p
+}
+
+// RotateWriter writes to a file which is rotated to file.1 ... file.<maxBackups> once it
+// exceeds maxSize bytes.
+type RotateWriter struct {
+	sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	f    *os.File
+	size int64
+}
+
+// NewRotateWriter opens the file at path to append.
+func NewRotateWriter(path string, maxSize int64, maxBackups int) (*RotateWriter, error) {
+	w := &RotateWriter{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f, w.size = f, fi.Size()
+	return nil
+}
+
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate shifts file.i to file.i+1, the oldest is removed, must be locked.
+func (w *RotateWriter) rotate() error {
+	w.f.Close()
+
+	if w.maxBackups <= 0 {
+		os.Remove(w.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", w.path, w.maxBackups))
+		for i := w.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+		}
+		if err := os.Rename(w.path, w.path+".1"); err != nil {
+			return err
+		}
+	}
+	return w.open()
+}
+
+func (w *RotateWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+	return w.f.Close()
+}
+
+// RedirectLogs writes the logs to the rotated LogFilePath, for the daemon in the background.
+func RedirectLogs() (*RotateWriter, error) {
+	maxSize := viper.GetInt("daemon.log.maxSize")
+	if maxSize <= 0 {
+		maxSize = defaultLogMaxSize
+	}
+	maxBackups := viper.GetInt("daemon.log.maxBackups")
+	if maxBackups <= 0 {
+		maxBackups = defaultLogMaxBackups
+	}
+
+	w, err := NewRotateWriter(LogFilePath(), int64(maxSize)<<20, maxBackups)
+	if err != nil {
+		return nil, err
+	}
+	flogging.SetOutput(w)
+	logrus.SetOutput(w)
+	return w, nil
+}
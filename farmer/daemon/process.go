@@ -0,0 +1,95 @@
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ReadPid returns the pid in farmer.pid.
+func ReadPid() (int, error) {
+	bs, err := ioutil.ReadFile(pidFilePath())
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(bs)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pid file %s, %s", pidFilePath(), err)
+	}
+	return pid, nil
+}
+
+// processAlive tells whether the process of pid is running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// Running returns the pid of the running farmer daemon. a pid file of the exited is stale.
+func Running() (int, bool) {
+	pid, err := ReadPid()
+	if err != nil {
+		return 0, false
+	}
+	return pid, processAlive(pid)
+}
+
+// removeStalePid removes the pid file left by an exited daemon, fails if the daemon is running.
+func removeStalePid() error {
+	pid, err := ReadPid()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil && processAlive(pid) {
+		return fmt.Errorf("Farmer daemon is running(PID: %d)", pid)
+	}
+
+	logger.Warningf("remove stale pid file %s of pid %d", pidFilePath(), pid)
+	return os.Remove(pidFilePath())
+}
+
+// Stop sends SIGTERM to the running farmer daemon and waits it to exit at most timeout.
+// it is killed at the timeout if force. returns the pid of the stopped.
+func Stop(timeout time.Duration, force bool) (int, error) {
+	pid, ok := Running()
+	if !ok {
+		return 0, fmt.Errorf("farmer daemon is not running")
+	}
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return pid, fmt.Errorf("stop farmer daemon(PID: %d) failed, %s", pid, err)
+	}
+
+	if waitExit(pid, timeout) {
+		return pid, nil
+	}
+	if !force {
+		return pid, fmt.Errorf("farmer daemon(PID: %d) does not exit in %s", pid, timeout)
+	}
+
+	logger.Warningf("kill farmer daemon(PID: %d) not exited in %s", pid, timeout)
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+		return pid, err
+	}
+	waitExit(pid, 5*time.Second)
+	// the killed does not remove its pid file.
+	os.Remove(pidFilePath())
+	return pid, nil
+}
+
+func waitExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return true
+}
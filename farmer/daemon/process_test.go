@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestRunning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "farmer-pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	viper.Set("peer.fileSystemPath", dir)
+	defer viper.Set("peer.fileSystemPath", "")
+
+	if _, ok := Running(); ok {
+		t.Fatal("running without pid file")
+	}
+
+	if err := ioutil.WriteFile(pidFilePath(), []byte(fmt.Sprint(os.Getpid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pid, ok := Running(); !ok || pid != os.Getpid() {
+		t.Fatalf("running %d %v, want %d", pid, ok, os.Getpid())
+	}
+	if err := removeStalePid(); err == nil {
+		t.Fatal("removed the pid file of the running")
+	}
+
+	// pid of no process.
+	if err := ioutil.WriteFile(pidFilePath(), []byte("4194304"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Running(); ok {
+		t.Fatal("stale pid is running")
+	}
+	if err := removeStalePid(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pidFilePath()); !os.IsNotExist(err) {
+		t.Fatalf("stale pid file is not removed, %v", err)
+	}
+}
+
+func TestRotateWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "farmer-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "farmer.log")
+	w, err := NewRotateWriter(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"farmer.log":   "dddddd\n",
+		"farmer.log.1": "cccccc\n",
+		"farmer.log.2": "bbbbbb\n",
+	} {
+		bs, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(bs) != want {
+			t.Errorf("%s is %q, want %q", name, bs, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("backups are more than 2, %v", err)
+	}
+}
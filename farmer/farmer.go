@@ -1,6 +1,13 @@
 package farmer
 
 import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
 	"github.com/hyperledger/fabric/farmer/api"
 	"github.com/hyperledger/fabric/farmer/daemon"
 	// "github.com/hyperledger/fabric/flogging"
@@ -8,7 +15,18 @@ import (
 	// "github.com/op/go-logging"
 )
 
+// BackgroundEnv is set for the daemon started by StartBackground.
+const BackgroundEnv = "FARMER_BACKGROUND"
+
 func StartFarmer() {
+	if os.Getenv(BackgroundEnv) != "" {
+		w, err := daemon.RedirectLogs()
+		if err != nil {
+			panic(err)
+		}
+		defer w.Close()
+	}
+
 	d, err := daemon.LoadDaemon()
 	if err != nil {
 		panic(err)
@@ -18,19 +36,66 @@ func StartFarmer() {
 
 	go func() {
 		if err := d.StartPeer(); err != nil {
-			panic(err)
+			d.Exit(err)
 		}
 	}()
 
 	go func() {
 		if err := api.Serve(d); err != nil {
-			panic(err)
+			d.Exit(err)
 		}
 	}()
 	d.WaitExit()
 }
 
-func StopFarmer() error {
+// StartBackground starts the farmer daemon by the command args in a new session whose
+// output is appended to the log file, and waits it to write the pid file.
+func StartBackground(args []string) (int, error) {
+	if pid, ok := daemon.Running(); ok {
+		return pid, fmt.Errorf("Farmer daemon is running(PID: %d)", pid)
+	}
+
+	logPath := daemon.LogFilePath()
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return 0, err
+	}
+	out, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), BackgroundEnv+"=1")
+	cmd.Stdout, cmd.Stderr = out, out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	timeout := time.After(30 * time.Second)
+	for {
+		select {
+		case err := <-exited:
+			return 0, fmt.Errorf("farmer daemon exited(%v), see %s", err, logPath)
+		case <-timeout:
+			return cmd.Process.Pid, fmt.Errorf("farmer daemon(PID: %d) does not write the pid file, see %s", cmd.Process.Pid, logPath)
+		case <-time.After(100 * time.Millisecond):
+			if pid, err := daemon.ReadPid(); err == nil && pid == cmd.Process.Pid {
+				return pid, nil
+			}
+		}
+	}
+}
 
-	return nil
+// StopFarmer stops the running farmer daemon by SIGTERM, it drains the http requests and stops the peer.
+func StopFarmer(timeout time.Duration, force bool) (int, error) {
+	return daemon.Stop(timeout, force)
 }
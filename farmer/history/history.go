@@ -0,0 +1,482 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	lpb "github.com/conseweb/common/assets/lepuscoin/protos"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	pb "github.com/hyperledger/fabric/protos"
+	"github.com/op/go-logging"
+)
+
+const (
+	KindTransfer = "transfer"
+	KindCoinbase = "coinbase"
+)
+
+var logger = logging.MustGetLogger("history")
+
+// lepuscoin invoke functions and the kind of their tx.
+var invokeKinds = map[string]string{
+	"invoke_transfer": KindTransfer,
+	"invoke_coinbase": KindCoinbase,
+}
+
+// Schema is the migrations of the lepuscoin history tables in farmer.db.
+var Schema = &migrate.Schema{
+	Name: "history",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create lepuscoin history tables", Up: createTables},
+		{Version: 2, Name: "record the commit time of the txs", Up: addCommitted},
+	},
+}
+
+func createTables(tx *sql.Tx) error {
+	for _, sqlstr := range []string{`
+	CREATE TABLE IF NOT EXISTS 'lepuscoin_sync' (
+		'id' INTEGER PRIMARY KEY,
+		'height' INTEGER NOT NULL
+	)`, `
+	CREATE TABLE IF NOT EXISTS 'lepuscoin_txs' (
+		'hash' VARCHAR(64) PRIMARY KEY,
+		'txid' VARCHAR(128) NOT NULL,
+		'kind' VARCHAR(16) NOT NULL,
+		'block' INTEGER NOT NULL,
+		'seq' INTEGER NOT NULL,
+		'founder' VARCHAR(64) NOT NULL DEFAULT '',
+		'timestamp' INTEGER NOT NULL
+	)`, `
+	CREATE TABLE IF NOT EXISTS 'lepuscoin_txins' (
+		'hash' VARCHAR(64) NOT NULL,
+		'n' INTEGER NOT NULL,
+		'source_hash' VARCHAR(64) NOT NULL,
+		'source_ix' INTEGER NOT NULL,
+		'addr' VARCHAR(64) NOT NULL,
+		PRIMARY KEY ('hash', 'n')
+	)`, `
+	CREATE TABLE IF NOT EXISTS 'lepuscoin_txouts' (
+		'hash' VARCHAR(64) NOT NULL,
+		'ix' INTEGER NOT NULL,
+		'addr' VARCHAR(64) NOT NULL,
+		'value' INTEGER NOT NULL,
+		'until' INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY ('hash', 'ix')
+	)`,
+		`CREATE INDEX IF NOT EXISTS 'idx_lepuscoin_txs_block' ON 'lepuscoin_txs' ('block', 'seq')`,
+		`CREATE INDEX IF NOT EXISTS 'idx_lepuscoin_txins_addr' ON 'lepuscoin_txins' ('addr')`,
+		`CREATE INDEX IF NOT EXISTS 'idx_lepuscoin_txouts_addr' ON 'lepuscoin_txouts' ('addr')`,
+	} {
+		if _, err := tx.Exec(sqlstr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addCommitted(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE 'lepuscoin_txs' ADD COLUMN 'committed' INTEGER NOT NULL DEFAULT 0`)
+	return err
+}
+
+// BlockSource is the committed blocks of the peer.
+type BlockSource interface {
+	Height() (uint64, error)
+	Block(n uint64) (*pb.Block, error)
+}
+
+// Tx is a lepuscoin tx of the history.
+type Tx struct {
+	Hash          string `json:"hash"`
+	TxID          string `json:"txid"`
+	Kind          string `json:"kind"`
+	Block         uint64 `json:"block"`
+	Confirmations uint64 `json:"confirmations"`
+	Founder       string `json:"founder"`
+	// set by the payer.
+	Timestamp int64 `json:"timestamp"`
+	// unix seconds the peer of the farmer committed the block, 0 if synced by an old farmer.
+	Committed int64 `json:"committed"`
+
+	// of the queried addresses.
+	Received uint64 `json:"received"`
+	Sent     uint64 `json:"sent"`
+
+	// filled by Get only.
+	In  []*TxIn  `json:"in,omitempty"`
+	Out []*TxOut `json:"out,omitempty"`
+}
+
+type TxIn struct {
+	SourceHash string `json:"source_hash"`
+	SourceIx   uint32 `json:"source_ix"`
+	Addr       string `json:"addr"`
+	// 0 if the source tx is not in the history.
+	Value uint64 `json:"value"`
+}
+
+type TxOut struct {
+	Ix    uint32 `json:"ix"`
+	Addr  string `json:"addr"`
+	Value uint64 `json:"value"`
+	Until int64  `json:"until"`
+}
+
+// Height returns the height of the synced blocks.
+func Height(db *sql.DB) (uint64, error) {
+	var h uint64
+	err := db.QueryRow(`SELECT height FROM lepuscoin_sync WHERE id = 1`).Scan(&h)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return h, err
+}
+
+// Sync follows the blocks after the synced height, and records the txs of the
+// lepuscoin chaincode named ccName. It returns the number of recorded txs.
+func Sync(db *sql.DB, src BlockSource, ccName string) (int, error) {
+	if ccName == "" {
+		return 0, fmt.Errorf("lepuscoin chaincode is not deployed")
+	}
+
+	from, err := Height(db)
+	if err != nil {
+		return 0, err
+	}
+	to, err := src.Height()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := from; i < to; i++ {
+		block, err := src.Block(i)
+		if err != nil {
+			return n, err
+		}
+
+		txs, err := syncBlock(db, i, block, ccName)
+		if err != nil {
+			logger.Errorf("sync block %d failed, %s", i, err)
+			return n, err
+		}
+		n += txs
+	}
+	if n > 0 {
+		logger.Debugf("synced blocks %d-%d, %d lepuscoin txs", from, to, n)
+	}
+	return n, nil
+}
+
+// syncBlock records the lepuscoin txs of block number i and moves the height in a transaction.
+func syncBlock(db *sql.DB, i uint64, block *pb.Block, ccName string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	committed := time.Now().Unix()
+	if ts := block.GetNonHashData().GetLocalLedgerCommitTimestamp(); ts != nil {
+		committed = ts.Seconds
+	}
+
+	n := 0
+	for seq, t := range block.GetTransactions() {
+		kind, ltx, err := decodeTx(t, ccName)
+		if err != nil {
+			logger.Warningf("decode tx %s of block %d failed, %s", t.Txid, i, err)
+			continue
+		}
+		if ltx == nil {
+			continue
+		}
+		if err := checkTx(tx, kind, ltx, committed); err != nil {
+			// the failed invokes are not in the block, this is the last guard of the history.
+			logger.Warningf("skip invalid tx %s of block %d, %s", t.Txid, i, err)
+			continue
+		}
+		if err := insertTx(tx, i, seq, t.Txid, kind, ltx, committed); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		n++
+	}
+
+	if _, err := tx.Exec(`REPLACE INTO lepuscoin_sync (id, height) VALUES (1, ?)`, i+1); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// decodeTx returns the lepuscoin tx of t, nil if t is not a lepuscoin invoke.
+func decodeTx(t *pb.Transaction, ccName string) (string, *lpb.TX, error) {
+	if t.Type != pb.Transaction_CHAINCODE_INVOKE || t.ConfidentialityLevel == pb.ConfidentialityLevel_CONFIDENTIAL {
+		return "", nil, nil
+	}
+
+	ccid := &pb.ChaincodeID{}
+	if err := proto.Unmarshal(t.ChaincodeID, ccid); err != nil {
+		return "", nil, err
+	}
+	if ccid.Name != ccName {
+		return "", nil, nil
+	}
+
+	spec := &pb.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(t.Payload, spec); err != nil {
+		return "", nil, err
+	}
+	if spec.GetChaincodeSpec().GetCtorMsg() == nil {
+		return "", nil, nil
+	}
+	args := spec.ChaincodeSpec.CtorMsg.Args
+	if len(args) < 2 {
+		return "", nil, nil
+	}
+	kind, ok := invokeKinds[string(args[0])]
+	if !ok {
+		return "", nil, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(string(args[1]))
+	if err != nil {
+		return "", nil, err
+	}
+	ltx, err := lpb.ParseTXBytes(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	return kind, ltx, nil
+}
+
+// checkTx checks ltx against the utxos of the history: the inputs of a transfer are the unspent
+// outputs of their addresses, unlocked at the committed time of the block, which cover the outputs,
+// and a coinbase has no inputs. the timestamp of ltx is set by the payer, it is not trusted.
+func checkTx(tx *sql.Tx, kind string, ltx *lpb.TX, committed int64) error {
+	if len(ltx.Txout) == 0 {
+		return fmt.Errorf("no output")
+	}
+	var out uint64
+	for _, o := range ltx.Txout {
+		if out+o.Value < out {
+			return fmt.Errorf("the sum of the outputs overflows")
+		}
+		out += o.Value
+	}
+	if kind == KindCoinbase {
+		if len(ltx.Txin) > 0 {
+			return fmt.Errorf("coinbase has inputs")
+		}
+		return nil
+	}
+	if len(ltx.Txin) == 0 {
+		return fmt.Errorf("no input")
+	}
+
+	var in uint64
+	spent := map[string]bool{}
+	for _, txin := range ltx.Txin {
+		key := fmt.Sprintf("%s:%d", txin.SourceHash, txin.Ix)
+		if spent[key] {
+			return fmt.Errorf("input %s is spent twice", key)
+		}
+		spent[key] = true
+
+		var (
+			addr  string
+			value uint64
+			until int64
+		)
+		err := tx.QueryRow(`SELECT addr, value, until FROM lepuscoin_txouts WHERE hash = ? AND ix = ?`,
+			txin.SourceHash, txin.Ix).Scan(&addr, &value, &until)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("input %s is not an output", key)
+		}
+		if err != nil {
+			return err
+		}
+		if addr != txin.Addr {
+			return fmt.Errorf("input %s is of %s, not %s", key, addr, txin.Addr)
+		}
+		if until > committed {
+			return fmt.Errorf("input %s is locked until %d", key, until)
+		}
+
+		var by string
+		err = tx.QueryRow(`SELECT hash FROM lepuscoin_txins WHERE source_hash = ? AND source_ix = ? AND hash != ?`,
+			txin.SourceHash, txin.Ix, ltx.TxHash()).Scan(&by)
+		if err == nil {
+			return fmt.Errorf("input %s is spent by %s", key, by)
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		if in+value < in {
+			return fmt.Errorf("the sum of the inputs overflows")
+		}
+		in += value
+	}
+	if out > in {
+		return fmt.Errorf("outputs %d are more than inputs %d", out, in)
+	}
+	return nil
+}
+
+func insertTx(tx *sql.Tx, block uint64, seq int, txid, kind string, ltx *lpb.TX, committed int64) error {
+	hash := ltx.TxHash()
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO lepuscoin_txs (hash, txid, kind, block, seq, founder, timestamp, committed) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		hash, txid, kind, block, seq, ltx.Founder, ltx.Timestamp, committed); err != nil {
+		return err
+	}
+	for n, in := range ltx.Txin {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO lepuscoin_txins (hash, n, source_hash, source_ix, addr) VALUES (?, ?, ?, ?, ?)`,
+			hash, n, in.SourceHash, in.Ix, in.Addr); err != nil {
+			return err
+		}
+	}
+	for ix, out := range ltx.Txout {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO lepuscoin_txouts (hash, ix, addr, value, until) VALUES (?, ?, ?, ?, ?)`,
+			hash, ix, out.Addr, out.Value, out.Until); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the txs which spend from or pay to addrs, the latest first, and the total count.
+func List(db *sql.DB, addrs []string, limit, offset int) ([]*Tx, int, error) {
+	if len(addrs) == 0 {
+		return []*Tx{}, 0, nil
+	}
+	height, err := Height(db)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	in := "(" + strings.TrimSuffix(strings.Repeat("?,", len(addrs)), ",") + ")"
+	addrArgs := make([]interface{}, 0, len(addrs))
+	for _, addr := range addrs {
+		addrArgs = append(addrArgs, addr)
+	}
+	where := ` WHERE t.hash IN (SELECT hash FROM lepuscoin_txouts WHERE addr IN ` + in +
+		` UNION SELECT hash FROM lepuscoin_txins WHERE addr IN ` + in + `)`
+	whereArgs := append(append([]interface{}{}, addrArgs...), addrArgs...)
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM lepuscoin_txs t`+where, whereArgs...).Scan(&count); err != nil {
+		return nil, 0, err
+	}
+
+	if limit <= 0 {
+		limit = -1
+	}
+	query := `SELECT t.hash, t.txid, t.kind, t.block, t.founder, t.timestamp, t.committed,
+		(SELECT COALESCE(SUM(o.value), 0) FROM lepuscoin_txouts o WHERE o.hash = t.hash AND o.addr IN ` + in + `),
+		(SELECT COALESCE(SUM(so.value), 0) FROM lepuscoin_txins i
+			JOIN lepuscoin_txouts so ON so.hash = i.source_hash AND so.ix = i.source_ix
+			WHERE i.hash = t.hash AND i.addr IN ` + in + `)
+		FROM lepuscoin_txs t` + where + ` ORDER BY t.block DESC, t.seq DESC LIMIT ? OFFSET ?`
+	args := append(append(append([]interface{}{}, addrArgs...), addrArgs...), whereArgs...)
+	args = append(args, limit, offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		logger.Errorf("query lepuscoin history failed, %s", err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	txs := []*Tx{}
+	for rows.Next() {
+		t := &Tx{}
+		if err := rows.Scan(&t.Hash, &t.TxID, &t.Kind, &t.Block, &t.Founder, &t.Timestamp, &t.Committed, &t.Received, &t.Sent); err != nil {
+			return nil, 0, err
+		}
+		t.Confirmations = height - t.Block
+		txs = append(txs, t)
+	}
+	return txs, count, rows.Err()
+}
+
+// Get returns the tx of hash with its inputs and outputs, sql.ErrNoRows if not found.
+func Get(db *sql.DB, hash string) (*Tx, error) {
+	height, err := Height(db)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Tx{In: []*TxIn{}, Out: []*TxOut{}}
+	err = db.QueryRow(`SELECT hash, txid, kind, block, founder, timestamp, committed FROM lepuscoin_txs WHERE hash = ?`, hash).
+		Scan(&t.Hash, &t.TxID, &t.Kind, &t.Block, &t.Founder, &t.Timestamp, &t.Committed)
+	if err != nil {
+		return nil, err
+	}
+	t.Confirmations = height - t.Block
+
+	rows, err := db.Query(`SELECT i.source_hash, i.source_ix, i.addr, COALESCE(so.value, 0) FROM lepuscoin_txins i
+		LEFT JOIN lepuscoin_txouts so ON so.hash = i.source_hash AND so.ix = i.source_ix
+		WHERE i.hash = ? ORDER BY i.n`, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		in := &TxIn{}
+		if err := rows.Scan(&in.SourceHash, &in.SourceIx, &in.Addr, &in.Value); err != nil {
+			return nil, err
+		}
+		t.In = append(t.In, in)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT ix, addr, value, until FROM lepuscoin_txouts WHERE hash = ? ORDER BY ix`, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		out := &TxOut{}
+		if err := rows.Scan(&out.Ix, &out.Addr, &out.Value, &out.Until); err != nil {
+			return nil, err
+		}
+		t.Out = append(t.Out, out)
+	}
+	return t, rows.Err()
+}
+
+// Payments returns the txs paying to addr in the blocks from the number, the earliest first, Received
+// is the sum of their unlocked outputs to addr.
+func Payments(db *sql.DB, addr string, from uint64) ([]*Tx, error) {
+	height, err := Height(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT t.hash, t.txid, t.kind, t.block, t.founder, t.timestamp, t.committed, SUM(o.value)
+		FROM lepuscoin_txs t JOIN lepuscoin_txouts o ON o.hash = t.hash
+		WHERE o.addr = ? AND o.until = 0 AND t.block >= ?
+		GROUP BY t.hash ORDER BY t.block, t.seq`, addr, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	txs := []*Tx{}
+	for rows.Next() {
+		t := &Tx{}
+		if err := rows.Scan(&t.Hash, &t.TxID, &t.Kind, &t.Block, &t.Founder, &t.Timestamp, &t.Committed, &t.Received); err != nil {
+			return nil, err
+		}
+		t.Confirmations = height - t.Block
+		txs = append(txs, t)
+	}
+	return txs, rows.Err()
+}
@@ -0,0 +1,163 @@
+package history
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/conseweb/common/assets/lepuscoin/client"
+	lpb "github.com/conseweb/common/assets/lepuscoin/protos"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	pb "github.com/hyperledger/fabric/protos"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type mockBlocks []*pb.Block
+
+func (m mockBlocks) Height() (uint64, error)           { return uint64(len(m)), nil }
+func (m mockBlocks) Block(n uint64) (*pb.Block, error) { return m[n], nil }
+
+func invokeTx(t *testing.T, ccName, function string, ltx *lpb.TX) *pb.Transaction {
+	bs, err := ltx.Base64Bytes()
+	if err != nil {
+		t.Fatalf("encode tx failed, %s", err)
+	}
+	spec := &pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{
+		ChaincodeID: &pb.ChaincodeID{Name: ccName},
+		CtorMsg:     &pb.ChaincodeInput{Args: [][]byte{[]byte(function), bs}},
+	}}
+	payload, _ := proto.Marshal(spec)
+	ccid, _ := proto.Marshal(spec.ChaincodeSpec.ChaincodeID)
+	return &pb.Transaction{
+		Type:        pb.Transaction_CHAINCODE_INVOKE,
+		ChaincodeID: ccid,
+		Payload:     payload,
+		Txid:        function + ltx.TxHash()[:8],
+	}
+}
+
+func TestSync(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db failed, %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, Schema); err != nil {
+		t.Fatalf("migrate failed, %s", err)
+	}
+
+	coinbase := client.NewTransactionV1("")
+	coinbase.AddTxOut(client.NewTxOut(100, "alice", time.Time{}))
+
+	transfer := client.NewTransactionV1("alice")
+	transfer.AddTxIn(client.NewTxIn("alice", coinbase.TxHash(), 0))
+	transfer.AddTxOut(client.NewTxOut(30, "bob", time.Time{}))
+	transfer.AddTxOut(client.NewTxOut(70, "alice", time.Time{}))
+
+	blocks := mockBlocks{
+		{},
+		{Transactions: []*pb.Transaction{
+			invokeTx(t, "lepuscoin", "invoke_coinbase", coinbase),
+			invokeTx(t, "other", "invoke_coinbase", coinbase),
+		}},
+		{Transactions: []*pb.Transaction{
+			invokeTx(t, "lepuscoin", "query_addrs", transfer),
+			invokeTx(t, "lepuscoin", "invoke_transfer", transfer),
+		}, NonHashData: &pb.NonHashData{LocalLedgerCommitTimestamp: &timestamp.Timestamp{Seconds: 101}}},
+	}
+
+	n, err := Sync(db, blocks[:2], "lepuscoin")
+	if err != nil || n != 1 {
+		t.Fatalf("expect 1 tx synced, got %v %v", n, err)
+	}
+	n, err = Sync(db, blocks, "lepuscoin")
+	if err != nil || n != 1 {
+		t.Fatalf("expect 1 more tx synced, got %v %v", n, err)
+	}
+	if h, _ := Height(db); h != 3 {
+		t.Errorf("expect height 3, got %v", h)
+	}
+
+	txs, count, err := List(db, []string{"alice"}, 10, 0)
+	if err != nil || count != 2 || len(txs) != 2 {
+		t.Fatalf("expect 2 txs of alice, got %+v %v %v", txs, count, err)
+	}
+	if txs[0].Kind != KindTransfer || txs[0].Sent != 100 || txs[0].Received != 70 || txs[0].Confirmations != 1 {
+		t.Errorf("unexpected transfer %+v", txs[0])
+	}
+	if txs[1].Kind != KindCoinbase || txs[1].Received != 100 || txs[1].Confirmations != 2 {
+		t.Errorf("unexpected coinbase %+v", txs[1])
+	}
+
+	txs, count, _ = List(db, []string{"bob"}, 1, 0)
+	if count != 1 || len(txs) != 1 || txs[0].Received != 30 || txs[0].Sent != 0 {
+		t.Errorf("unexpected txs of bob %+v", txs)
+	}
+
+	tx, err := Get(db, transfer.TxHash())
+	if err != nil {
+		t.Fatalf("get tx failed, %s", err)
+	}
+	if len(tx.In) != 1 || tx.In[0].Value != 100 || len(tx.Out) != 2 || tx.Committed != 101 {
+		t.Errorf("unexpected tx %+v", tx)
+	}
+	if _, err := Get(db, "nope"); err != sql.ErrNoRows {
+		t.Errorf("expect ErrNoRows, got %v", err)
+	}
+
+	// the invalid txs are not history.
+	double := client.NewTransactionV1("alice")
+	double.AddTxIn(client.NewTxIn("alice", coinbase.TxHash(), 0))
+	double.AddTxOut(client.NewTxOut(100, "eve", time.Time{}))
+	more := client.NewTransactionV1("bob")
+	more.AddTxIn(client.NewTxIn("bob", transfer.TxHash(), 0))
+	more.AddTxOut(client.NewTxOut(31, "eve", time.Time{}))
+	foreign := client.NewTransactionV1("eve")
+	foreign.AddTxIn(client.NewTxIn("eve", transfer.TxHash(), 1))
+	foreign.AddTxOut(client.NewTxOut(70, "eve", time.Time{}))
+	unknown := client.NewTransactionV1("eve")
+	unknown.AddTxIn(client.NewTxIn("eve", "nothing", 0))
+	unknown.AddTxOut(client.NewTxOut(1, "eve", time.Time{}))
+	blocks = append(blocks, &pb.Block{Transactions: []*pb.Transaction{
+		invokeTx(t, "lepuscoin", "invoke_transfer", double),
+		invokeTx(t, "lepuscoin", "invoke_transfer", more),
+		invokeTx(t, "lepuscoin", "invoke_transfer", foreign),
+		invokeTx(t, "lepuscoin", "invoke_transfer", unknown),
+	}})
+	if n, err := Sync(db, blocks, "lepuscoin"); err != nil || n != 0 {
+		t.Errorf("expect the invalid txs skipped, got %v %v", n, err)
+	}
+	if _, count, _ := List(db, []string{"eve"}, 10, 0); count != 0 {
+		t.Errorf("eve has %d txs", count)
+	}
+
+	// the locks are checked by the commit time of the block rather than the timestamp of the payer,
+	// and the outputs must not overflow.
+	now := time.Now().Unix()
+	locked := client.NewTransactionV1("")
+	locked.Txout = []*lpb.TX_TXOUT{{Value: 50, Addr: "frank", Until: now + 3600}}
+	early := client.NewTransactionV1("frank")
+	early.Timestamp = now + 7200
+	early.AddTxIn(client.NewTxIn("frank", locked.TxHash(), 0))
+	early.AddTxOut(client.NewTxOut(50, "frank", time.Time{}))
+	huge := client.NewTransactionV1("")
+	huge.AddTxOut(client.NewTxOut(math.MaxUint64/2+1, "frank", time.Time{}))
+	huge.AddTxOut(client.NewTxOut(math.MaxUint64/2+1, "frank", time.Time{}))
+	blocks = append(blocks, &pb.Block{Transactions: []*pb.Transaction{
+		invokeTx(t, "lepuscoin", "invoke_coinbase", locked),
+		invokeTx(t, "lepuscoin", "invoke_transfer", early),
+		invokeTx(t, "lepuscoin", "invoke_coinbase", huge),
+	}, NonHashData: &pb.NonHashData{LocalLedgerCommitTimestamp: &timestamp.Timestamp{Seconds: now}}})
+	if n, err := Sync(db, blocks, "lepuscoin"); err != nil || n != 1 {
+		t.Errorf("expect the locked coinbase synced only, got %v %v", n, err)
+	}
+	blocks = append(blocks, &pb.Block{Transactions: []*pb.Transaction{
+		invokeTx(t, "lepuscoin", "invoke_transfer", early),
+	}, NonHashData: &pb.NonHashData{LocalLedgerCommitTimestamp: &timestamp.Timestamp{Seconds: now + 3600}}})
+	if n, err := Sync(db, blocks, "lepuscoin"); err != nil || n != 1 {
+		t.Errorf("expect the unlocked transfer synced, got %v %v", n, err)
+	}
+}
@@ -1,12 +1,14 @@
 package indexer
 
 import (
+	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/go-xorm/xorm"
+	"github.com/hyperledger/fabric/farmer/migrate"
 	"github.com/op/go-logging"
 	"github.com/spf13/viper"
 )
@@ -21,17 +23,31 @@ type FileInfo struct {
 	DeviceID string `xorm:"notnull index 'device_id'" json:"device_id"`
 	Path     string `xorm:"notnull index 'path'" json:"path"`
 	Hash     string `xorm:"notnull index 'hash'" json:"hash"`
-	Size     int64  `xorm:"'size'" json:"hash"`
+	Size     int64  `xorm:"'size'" json:"size"`
 
 	Created time.Time `xorm:"created" json:"created"`
 	Updated time.Time `xorm:"updated" json:"updated"`
 }
 
 type Device struct {
-	ID      string `xorm:"pk" json:"id"`
+	ID      string `xorm:"pk 'id'" json:"id"`
 	Address string `xorm:"notnull index" json:"address"`
 }
 
+// Schema is the migrations of indexer.db, the tables are the ones xorm maps FileInfo and Device to.
+var Schema = &migrate.Schema{
+	Name: "indexer",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create file_info and device", Up: createTables},
+		{Version: 2, Name: "rename device i_d to id", Up: renameDeviceID},
+	},
+}
+
+// DBPath returns the path of indexer.db.
+func DBPath() string {
+	return filepath.Join(viper.GetString("peer.fileSystemPath"), "indexer.db")
+}
+
 func InitDB() (*xorm.Engine, error) {
 	if orm != nil {
 		if err := orm.Ping(); err != nil {
@@ -40,27 +56,119 @@ func InitDB() (*xorm.Engine, error) {
 		return orm, nil
 	}
 
-	path := viper.GetString("peer.fileSystemPath")
-	fi, err := os.Stat(filepath.Join(path, "indexer.db"))
-	var Orm *xorm.Engine
-	if err != nil && os.IsExist(err) {
+	path := DBPath()
+	fi, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
-	if fi.IsDir() {
+	if fi != nil && fi.IsDir() {
 		return nil, fmt.Errorf("%s is a directory", path)
 	}
 
-	Orm, err = xorm.NewEngine("sqlite3", path)
+	Orm, err := xorm.NewEngine("sqlite3", path)
 	if err != nil {
-		fmt.Println(err)
+		log.Errorf("open indexer db failed, %s", err)
 		return nil, err
 	}
 
 	Orm.ShowSQL(true)
 
-	Orm.Sync2(&FileInfo{}, &Device{})
+	r := &migrate.Runner{
+		Path:   path,
+		Backup: viper.GetBool("daemon.migration.backup"),
+		Strict: true,
+	}
+	if err := r.Run(Orm.DB().DB, Schema); err != nil {
+		Orm.Close()
+		return nil, err
+	}
 
 	orm = Orm
 
 	return Orm, nil
 }
+
+// CloseDB closes indexer.db, InitDB opens it again.
+func CloseDB() error {
+	if orm == nil {
+		return nil
+	}
+	err := orm.Close()
+	orm = nil
+	return err
+}
+
+func createTables(tx *sql.Tx) error {
+	for _, sqlstr := range []string{`
+	CREATE TABLE IF NOT EXISTS 'file_info' (
+		'id' INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+		'device_id' TEXT NOT NULL,
+		'path' TEXT NOT NULL,
+		'hash' TEXT NOT NULL,
+		'size' INTEGER NULL,
+		'created' DATETIME NULL,
+		'updated' DATETIME NULL
+	)`,
+		`CREATE INDEX IF NOT EXISTS 'IDX_file_info_device_id' ON 'file_info' ('device_id')`,
+		`CREATE INDEX IF NOT EXISTS 'IDX_file_info_path' ON 'file_info' ('path')`,
+		`CREATE INDEX IF NOT EXISTS 'IDX_file_info_hash' ON 'file_info' ('hash')`,
+		`
+	CREATE TABLE IF NOT EXISTS 'device' (
+		'id' TEXT PRIMARY KEY NOT NULL,
+		'address' TEXT NOT NULL
+	)`,
+		`CREATE INDEX IF NOT EXISTS 'IDX_device_address' ON 'device' ('address')`,
+	} {
+		if _, err := tx.Exec(sqlstr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats is the size of the index.
+type Stats struct {
+	Files   int64 `json:"files"`
+	Bytes   int64 `json:"bytes"`
+	Devices int64 `json:"devices"`
+}
+
+// GetStats counts the indexed files, their bytes and the devices.
+func GetStats(db *sql.DB) (*Stats, error) {
+	s := &Stats{}
+	if err := db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(size), 0) FROM file_info`).Scan(&s.Files, &s.Bytes); err != nil {
+		return nil, err
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM device`).Scan(&s.Devices); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// renameDeviceID renames the i_d column which xorm's Sync2 created before the migrations.
+func renameDeviceID(tx *sql.Tx) error {
+	rows, err := tx.Query(`PRAGMA table_info('device')`)
+	if err != nil {
+		return err
+	}
+	found := false
+	for rows.Next() {
+		var (
+			cid, notnull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notnull, &dflt, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		found = found || name == "i_d"
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || !found {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE 'device' RENAME COLUMN 'i_d' TO 'id'`)
+	return err
+}
@@ -0,0 +1,302 @@
+package invoice
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/farmer/history"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	"github.com/op/go-logging"
+)
+
+const (
+	StatusPending = "pending"
+	StatusPaid    = "paid"
+	StatusExpired = "expired"
+
+	// URIScheme is the scheme of the payment request uri.
+	URIScheme = "lepuscoin"
+)
+
+var logger = logging.MustGetLogger("invoice")
+
+// Schema is the migrations of the invoice tables in farmer.db.
+var Schema = &migrate.Schema{
+	Name: "invoice",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create invoice tables", Up: createTables},
+		{Version: 2, Name: "bound the payments by the block height", Up: addHeight},
+	},
+}
+
+func createTables(tx *sql.Tx) error {
+	for _, sqlstr := range []string{`
+	CREATE TABLE IF NOT EXISTS 'invoices' (
+		'id' VARCHAR(32) PRIMARY KEY,
+		'user_id' VARCHAR(64) NOT NULL,
+		'name' VARCHAR(128) NOT NULL DEFAULT '',
+		'addr' VARCHAR(64) NOT NULL,
+		'amount' INTEGER NOT NULL,
+		'memo' VARCHAR(256) NOT NULL DEFAULT '',
+		'status' VARCHAR(16) NOT NULL,
+		'created' INTEGER NOT NULL,
+		'expires' INTEGER NOT NULL DEFAULT 0,
+		'paid_tx' VARCHAR(64) NOT NULL DEFAULT '',
+		'paid_block' INTEGER NOT NULL DEFAULT 0,
+		'paid_at' INTEGER NOT NULL DEFAULT 0
+	)`,
+		`CREATE INDEX IF NOT EXISTS 'idx_invoices_status' ON 'invoices' ('user_id', 'status')`,
+	} {
+		if _, err := tx.Exec(sqlstr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addHeight bounds the saved invoices by the synced height, the txs synced before have been settled.
+func addHeight(tx *sql.Tx) error {
+	if _, err := tx.Exec(`ALTER TABLE 'invoices' ADD COLUMN 'height' INTEGER NOT NULL DEFAULT 0`); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE invoices SET height = (SELECT COALESCE(MAX(height), 0) FROM lepuscoin_sync)`)
+	return err
+}
+
+const invoiceColumns = `id, name, addr, amount, memo, status, created, expires, height, paid_tx, paid_block, paid_at`
+
+// Invoice is a payment request of amount to addr, paid by the first matching transfer
+// in the blocks committed after it. the timestamps of the txs are set by the payers, so the
+// payments are bounded by the block height and the commit time of the farmer's peer.
+type Invoice struct {
+	ID string `json:"id"`
+	// the nameservice name which addr is resolved from, empty if addressed directly.
+	Name    string `json:"name,omitempty"`
+	Addr    string `json:"addr"`
+	Amount  uint64 `json:"amount"`
+	Memo    string `json:"memo"`
+	Status  string `json:"status"`
+	Created int64  `json:"created"`
+	// unix seconds, 0 never expires.
+	Expires int64 `json:"expires"`
+	// the synced block height at Created, paid by the txs of the blocks from it.
+	Height uint64 `json:"height"`
+
+	PaidTx    string `json:"paid_tx,omitempty"`
+	PaidBlock uint64 `json:"paid_block,omitempty"`
+	PaidAt    int64  `json:"paid_at,omitempty"`
+
+	URI string `json:"uri"`
+}
+
+// Create saves a pending invoice of the user, ID and Created are filled.
+func Create(db *sql.DB, userID string, inv *Invoice) error {
+	if inv.Addr == "" {
+		return fmt.Errorf("invoice has no address")
+	}
+	if inv.Amount == 0 {
+		return fmt.Errorf("invoice amount is 0")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	inv.ID = hex.EncodeToString(id)
+	inv.Status = StatusPending
+	inv.Created = time.Now().Unix()
+	if inv.Expires != 0 && inv.Expires <= inv.Created {
+		return fmt.Errorf("expires %d is not in the future", inv.Expires)
+	}
+	h, err := history.Height(db)
+	if err != nil {
+		return err
+	}
+	inv.Height = h
+
+	_, err = db.Exec(`INSERT INTO invoices (id, user_id, name, addr, amount, memo, status, created, expires, height) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		inv.ID, userID, inv.Name, inv.Addr, inv.Amount, inv.Memo, inv.Status, inv.Created, inv.Expires, inv.Height)
+	if err != nil {
+		logger.Errorf("save invoice %+v failed, %s", inv, err)
+		return err
+	}
+	inv.URI = inv.EncodeURI()
+	return nil
+}
+
+// Get returns the invoice of the user, sql.ErrNoRows if not found.
+func Get(db *sql.DB, userID, id string) (*Invoice, error) {
+	return scanInvoice(db.QueryRow(`SELECT `+invoiceColumns+` FROM invoices WHERE user_id = ? AND id = ?`, userID, id))
+}
+
+// List returns the invoices of the user in the status, all if empty, the latest first, and the total count.
+func List(db *sql.DB, userID, status string, limit, offset int) ([]*Invoice, int, error) {
+	where := ` WHERE user_id = ?`
+	args := []interface{}{userID}
+	if status != "" {
+		where += ` AND status = ?`
+		args = append(args, status)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM invoices`+where, args...).Scan(&count); err != nil {
+		return nil, 0, err
+	}
+
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := db.Query(`SELECT `+invoiceColumns+` FROM invoices`+where+` ORDER BY created DESC, rowid DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	invs := []*Invoice{}
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		invs = append(invs, inv)
+	}
+	return invs, count, rows.Err()
+}
+
+// Settle marks the pending invoices paid by the synced history, the earliest invoice of an
+// address takes the earliest tx paying at least its amount, a tx pays one invoice only.
+// the unpaid invoices expired at now are marked expired. returns the newly paid invoices.
+func Settle(db *sql.DB, now time.Time) ([]*Invoice, error) {
+	rows, err := db.Query(`SELECT `+invoiceColumns+` FROM invoices WHERE status = ? ORDER BY created, rowid`, StatusPending)
+	if err != nil {
+		return nil, err
+	}
+	pending := []*Invoice{}
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pending = append(pending, inv)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	paid := []*Invoice{}
+	for _, inv := range pending {
+		t, err := findPayment(db, inv)
+		if err != nil {
+			return paid, err
+		}
+
+		if t != nil {
+			inv.Status, inv.PaidTx, inv.PaidBlock, inv.PaidAt = StatusPaid, t.Hash, t.Block, t.Committed
+			if _, err := db.Exec(`UPDATE invoices SET status = ?, paid_tx = ?, paid_block = ?, paid_at = ? WHERE id = ?`,
+				inv.Status, inv.PaidTx, inv.PaidBlock, inv.PaidAt, inv.ID); err != nil {
+				return paid, err
+			}
+			paid = append(paid, inv)
+			continue
+		}
+
+		if inv.Expires != 0 && inv.Expires < now.Unix() {
+			if _, err := db.Exec(`UPDATE invoices SET status = ? WHERE id = ?`, StatusExpired, inv.ID); err != nil {
+				return paid, err
+			}
+		}
+	}
+	return paid, nil
+}
+
+// findPayment returns the first tx paying inv in time and not taken by another invoice, nil if none.
+func findPayment(db *sql.DB, inv *Invoice) (*history.Tx, error) {
+	txs, err := history.Payments(db, inv.Addr, inv.Height)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range txs {
+		if t.Received < inv.Amount || (inv.Expires != 0 && t.Committed > inv.Expires) {
+			continue
+		}
+		var taken int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM invoices WHERE paid_tx = ?`, t.Hash).Scan(&taken); err != nil {
+			return nil, err
+		}
+		if taken == 0 {
+			return t, nil
+		}
+	}
+	return nil, nil
+}
+
+// EncodeURI encodes the request as lepuscoin:<addr>?amount=100&expires=...&id=...&memo=...&name=...
+func (inv *Invoice) EncodeURI() string {
+	q := url.Values{}
+	q.Set("amount", strconv.FormatUint(inv.Amount, 10))
+	if inv.ID != "" {
+		q.Set("id", inv.ID)
+	}
+	if inv.Name != "" {
+		q.Set("name", inv.Name)
+	}
+	if inv.Memo != "" {
+		q.Set("memo", inv.Memo)
+	}
+	if inv.Expires != 0 {
+		q.Set("expires", strconv.FormatInt(inv.Expires, 10))
+	}
+	return URIScheme + ":" + inv.Addr + "?" + q.Encode()
+}
+
+// ParseURI decodes a payment request uri, the status is not known by the payer.
+func ParseURI(uri string) (*Invoice, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != URIScheme || u.Opaque == "" {
+		return nil, fmt.Errorf("not a %s payment request, %s", URIScheme, uri)
+	}
+
+	q := u.Query()
+	inv := &Invoice{
+		ID:   q.Get("id"),
+		Name: q.Get("name"),
+		Addr: u.Opaque,
+		Memo: q.Get("memo"),
+	}
+	if inv.Amount, err = strconv.ParseUint(q.Get("amount"), 10, 64); err != nil || inv.Amount == 0 {
+		return nil, fmt.Errorf("invalid amount %s", q.Get("amount"))
+	}
+	if s := q.Get("expires"); s != "" {
+		if inv.Expires, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid expires %s", s)
+		}
+	}
+	inv.URI = inv.EncodeURI()
+	return inv, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanInvoice(row rowScanner) (*Invoice, error) {
+	inv := &Invoice{}
+	if err := row.Scan(&inv.ID, &inv.Name, &inv.Addr, &inv.Amount, &inv.Memo, &inv.Status,
+		&inv.Created, &inv.Expires, &inv.Height, &inv.PaidTx, &inv.PaidBlock, &inv.PaidAt); err != nil {
+		return nil, err
+	}
+	inv.URI = inv.EncodeURI()
+	return inv, nil
+}
@@ -0,0 +1,105 @@
+package invoice
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/farmer/history"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db failed, %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, history.Schema, Schema); err != nil {
+		t.Fatalf("migrate failed, %s", err)
+	}
+	return db
+}
+
+func pay(t *testing.T, db *sql.DB, hash string, block uint64, timestamp, committed int64, addr string, value uint64) {
+	if _, err := db.Exec(`INSERT INTO lepuscoin_txs (hash, txid, kind, block, seq, timestamp, committed) VALUES (?, ?, ?, ?, 0, ?, ?)`,
+		hash, hash, history.KindTransfer, block, timestamp, committed); err != nil {
+		t.Fatalf("insert tx failed, %s", err)
+	}
+	if _, err := db.Exec(`INSERT INTO lepuscoin_txouts (hash, ix, addr, value) VALUES (?, 0, ?, ?)`, hash, addr, value); err != nil {
+		t.Fatalf("insert txout failed, %s", err)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	db := openDB(t)
+	if _, err := db.Exec(`REPLACE INTO lepuscoin_sync (id, height) VALUES (1, 2)`); err != nil {
+		t.Fatalf("set height failed, %s", err)
+	}
+
+	inv1 := &Invoice{Name: "shop.alice", Addr: "shop", Amount: 100, Memo: "coffee"}
+	inv2 := &Invoice{Addr: "shop", Amount: 100}
+	inv3 := &Invoice{Addr: "shop", Amount: 50, Expires: time.Now().Unix() + 60}
+	for _, inv := range []*Invoice{inv1, inv2, inv3} {
+		if err := Create(db, "u1", inv); err != nil {
+			t.Fatalf("create invoice failed, %s", err)
+		}
+	}
+	if err := Create(db, "u1", &Invoice{Addr: "shop", Amount: 1, Expires: 1}); err == nil {
+		t.Errorf("expect error of past expires")
+	}
+
+	// the timestamps are set by the payers, the blocks and the commit times count.
+	now := time.Now().Unix()
+	pay(t, db, "old", 1, now, now, "shop", 100)
+	pay(t, db, "short", 2, now, now, "shop", 30)
+	pay(t, db, "full", 3, inv1.Created-3600, now, "shop", 120)
+	pay(t, db, "late", 4, now, now+120, "shop", 50)
+
+	paid, err := Settle(db, time.Now())
+	if err != nil {
+		t.Fatalf("settle failed, %s", err)
+	}
+	if len(paid) != 1 || paid[0].ID != inv1.ID || paid[0].PaidTx != "full" || paid[0].PaidBlock != 3 || paid[0].PaidAt != now {
+		t.Fatalf("expect invoice 1 paid by full, got %+v", paid)
+	}
+
+	// the tx has paid invoice 1, late is committed after invoice 3 expires.
+	if paid, _ = Settle(db, time.Now().Add(2*time.Minute)); len(paid) != 0 {
+		t.Errorf("expect nothing paid, got %+v", paid)
+	}
+	invs, count, err := List(db, "u1", StatusPending, 10, 0)
+	if err != nil || count != 1 || invs[0].ID != inv2.ID {
+		t.Errorf("expect invoice 2 pending, got %+v %v %v", invs, count, err)
+	}
+	if inv, _ := Get(db, "u1", inv3.ID); inv.Status != StatusExpired {
+		t.Errorf("expect invoice 3 expired, got %+v", inv)
+	}
+	if _, err := Get(db, "u2", inv1.ID); err != sql.ErrNoRows {
+		t.Errorf("expect ErrNoRows, got %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	inv := &Invoice{ID: "ab12", Name: "shop.alice", Addr: "mtCLPxw18uxFMK1tbWLCVxJa4Tby7My7aM", Amount: 100, Memo: "coffee & cake", Expires: 1500000000}
+	uri := inv.EncodeURI()
+	if uri != "lepuscoin:mtCLPxw18uxFMK1tbWLCVxJa4Tby7My7aM?amount=100&expires=1500000000&id=ab12&memo=coffee+%26+cake&name=shop.alice" {
+		t.Errorf("unexpected uri %s", uri)
+	}
+
+	got, err := ParseURI(uri)
+	if err != nil {
+		t.Fatalf("parse failed, %s", err)
+	}
+	if got.ID != inv.ID || got.Name != inv.Name || got.Addr != inv.Addr || got.Amount != inv.Amount ||
+		got.Memo != inv.Memo || got.Expires != inv.Expires {
+		t.Errorf("expect %+v, got %+v", inv, got)
+	}
+
+	for _, bad := range []string{"bitcoin:xxx?amount=1", "lepuscoin:xxx", "lepuscoin:?amount=1", "lepuscoin:xxx?amount=0"} {
+		if _, err := ParseURI(bad); err == nil {
+			t.Errorf("expect error of %s", bad)
+		}
+	}
+}
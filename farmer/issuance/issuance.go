@@ -0,0 +1,319 @@
+package issuance
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/farmer/migrate"
+	"github.com/op/go-logging"
+	"github.com/spf13/viper"
+)
+
+const (
+	// KindManual is a coinbase by an issuer, KindReward is the reward of a conquered challenge.
+	KindManual = "manual"
+	KindReward = "reward"
+
+	// StatusSigned is a signed coinbase handed to the caller, which may invoke it later.
+	// StatusReserved is checked and counted, until it is signed, issued or failed.
+	StatusIssued   = "issued"
+	StatusSigned   = "signed"
+	StatusReserved = "reserved"
+	StatusRejected = "rejected"
+	StatusFailed   = "failed"
+
+	defaultPeriod = 24 * time.Hour
+)
+
+var logger = logging.MustGetLogger("issuance")
+
+// Schema is the migrations of the issuance audit log in farmer.db.
+var Schema = &migrate.Schema{
+	Name: "issuance",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create issuance log", Up: createTables},
+	},
+}
+
+func createTables(tx *sql.Tx) error {
+	for _, sqlstr := range []string{`
+	CREATE TABLE IF NOT EXISTS 'issuance_log' (
+		'id' INTEGER PRIMARY KEY AUTOINCREMENT,
+		'kind' VARCHAR(16) NOT NULL,
+		'user_id' VARCHAR(64) NOT NULL DEFAULT '',
+		'issuer' VARCHAR(66) NOT NULL DEFAULT '',
+		'addrs' TEXT NOT NULL,
+		'amount' INTEGER NOT NULL,
+		'total' INTEGER NOT NULL,
+		'tx_hash' VARCHAR(64) NOT NULL DEFAULT '',
+		'status' VARCHAR(16) NOT NULL,
+		'reason' VARCHAR(256) NOT NULL DEFAULT '',
+		'created' INTEGER NOT NULL
+	)`,
+		`CREATE INDEX IF NOT EXISTS 'idx_issuance_log_created' ON 'issuance_log' ('status', 'created')`,
+	} {
+		if _, err := tx.Exec(sqlstr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Policy governs who may issue lepuscoin by coinbase and how much.
+type Policy struct {
+	// hex of the compressed public keys which may sign a manual coinbase.
+	Issuers []string
+	// the issued total in any Period is at most PeriodCap, 0 is unlimited.
+	Period    time.Duration
+	PeriodCap uint64
+	// the most of a manual coinbase output, 0 is unlimited.
+	MaxAmount uint64
+
+	// a conquered challenge is rewarded Reward, halved after every HalvingInterval
+	// rewards, 0 never halves. no reward if Reward is 0.
+	Reward          uint64
+	HalvingInterval int
+}
+
+// LoadPolicy reads the policy of farmer.lepuscoin.issuance.
+func LoadPolicy() *Policy {
+	p := &Policy{
+		Period:          viper.GetDuration("farmer.lepuscoin.issuance.period"),
+		PeriodCap:       uint64(viper.GetInt("farmer.lepuscoin.issuance.periodCap")),
+		MaxAmount:       uint64(viper.GetInt("farmer.lepuscoin.issuance.maxAmount")),
+		Reward:          uint64(viper.GetInt("farmer.lepuscoin.issuance.reward")),
+		HalvingInterval: viper.GetInt("farmer.lepuscoin.issuance.halvingInterval"),
+	}
+	for _, k := range viper.GetStringSlice("farmer.lepuscoin.issuance.issuers") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			p.Issuers = append(p.Issuers, k)
+		}
+	}
+	if p.Period <= 0 {
+		p.Period = defaultPeriod
+	}
+	return p
+}
+
+// IsIssuer tells whether pubkey, hex of a compressed public key, may sign a manual coinbase.
+func (p *Policy) IsIssuer(pubkey string) bool {
+	pubkey = strings.ToLower(pubkey)
+	for _, k := range p.Issuers {
+		if k == pubkey {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckManual checks the coinbase of amount to every addr signed by pubkey.
+func (p *Policy) CheckManual(db *sql.DB, pubkey string, addrs []string, amount uint64, now time.Time) error {
+	return p.checkManual(db, pubkey, addrs, amount, now)
+}
+
+func (p *Policy) checkManual(q querier, pubkey string, addrs []string, amount uint64, now time.Time) error {
+	if !p.IsIssuer(pubkey) {
+		return fmt.Errorf("public key %s is not an issuer", pubkey)
+	}
+	if len(addrs) == 0 || amount == 0 {
+		return fmt.Errorf("nothing to issue")
+	}
+	if p.MaxAmount > 0 && amount > p.MaxAmount {
+		return fmt.Errorf("amount %d is above the max %d", amount, p.MaxAmount)
+	}
+	return p.checkCap(q, amount*uint64(len(addrs)), now)
+}
+
+// RewardAmount returns the reward of the next conquered challenge, it is capped as any issuance.
+func (p *Policy) RewardAmount(db *sql.DB, now time.Time) (uint64, error) {
+	return p.rewardAmount(db, now)
+}
+
+func (p *Policy) rewardAmount(q querier, now time.Time) (uint64, error) {
+	if p.Reward == 0 {
+		return 0, fmt.Errorf("challenge is not rewarded")
+	}
+
+	reward := p.Reward
+	if p.HalvingInterval > 0 {
+		var n int
+		if err := q.QueryRow(`SELECT COUNT(*) FROM issuance_log WHERE kind = ? AND status IN (?, ?, ?)`,
+			KindReward, StatusIssued, StatusSigned, StatusReserved).Scan(&n); err != nil {
+			return 0, err
+		}
+		halvings := uint(n / p.HalvingInterval)
+		if halvings >= 64 {
+			return 0, fmt.Errorf("reward is halved to 0")
+		}
+		if reward >>= halvings; reward == 0 {
+			return 0, fmt.Errorf("reward is halved to 0")
+		}
+	}
+	return reward, p.checkCap(q, reward, now)
+}
+
+// ReserveManual checks e, a manual coinbase, and records it reserved in one transaction, so the
+// concurrent issuances can not pass the cap together. the rejected is recorded and returned.
+func (p *Policy) ReserveManual(db *sql.DB, e *Entry, now time.Time) error {
+	return reserve(db, e, now, func(q querier) error {
+		return p.checkManual(q, e.Issuer, e.Addrs, e.Amount, now)
+	})
+}
+
+// ReserveReward sets the Amount of e, a conquered challenge, and reserves it as ReserveManual.
+func (p *Policy) ReserveReward(db *sql.DB, e *Entry, now time.Time) error {
+	return reserve(db, e, now, func(q querier) (err error) {
+		e.Amount, err = p.rewardAmount(q, now)
+		return err
+	})
+}
+
+func reserve(db *sql.DB, e *Entry, now time.Time, check func(querier) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	e.Status, e.Reason, e.Created = StatusReserved, "", now.Unix()
+	rejected := check(tx)
+	if rejected != nil {
+		e.Status, e.Reason = StatusRejected, rejected.Error()
+	}
+	if err := record(tx, e); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return rejected
+}
+
+func (p *Policy) checkCap(q querier, total uint64, now time.Time) error {
+	if p.PeriodCap == 0 {
+		return nil
+	}
+	issued, err := issuedSince(q, now.Add(-p.Period))
+	if err != nil {
+		return err
+	}
+	if issued+total > p.PeriodCap {
+		return fmt.Errorf("%d issued in the last %s, %d more is above the cap %d", issued, p.Period, total, p.PeriodCap)
+	}
+	return nil
+}
+
+// Issued returns the total issued, signed or reserved since.
+func Issued(db *sql.DB, since time.Time) (uint64, error) {
+	return issuedSince(db, since)
+}
+
+func issuedSince(q querier, since time.Time) (uint64, error) {
+	var total uint64
+	err := q.QueryRow(`SELECT COALESCE(SUM(total), 0) FROM issuance_log WHERE status IN (?, ?, ?) AND created >= ?`,
+		StatusIssued, StatusSigned, StatusReserved, since.Unix()).Scan(&total)
+	return total, err
+}
+
+// Conquered returns how many challenges userID conquered, every conquest is recorded as a reward,
+// rejected or not.
+func Conquered(db *sql.DB, userID string) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM issuance_log WHERE kind = ? AND user_id = ?`, KindReward, userID).Scan(&n)
+	return n, err
+}
+
+// Entry is a record of the audit log, every coinbase attempt is recorded, rejected or not.
+type Entry struct {
+	ID     int64    `json:"id"`
+	Kind   string   `json:"kind"`
+	UserID string   `json:"user_id"`
+	Issuer string   `json:"issuer"`
+	Addrs  []string `json:"addrs"`
+	// of every addr.
+	Amount  uint64 `json:"amount"`
+	Total   uint64 `json:"total"`
+	TxHash  string `json:"tx_hash"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Created int64  `json:"created"`
+}
+
+// Record appends e to the audit log, ID, Total and Created are filled.
+func Record(db *sql.DB, e *Entry) error {
+	return record(db, e)
+}
+
+func record(q querier, e *Entry) error {
+	e.Total = e.Amount * uint64(len(e.Addrs))
+	if e.Created == 0 {
+		e.Created = time.Now().Unix()
+	}
+	ret, err := q.Exec(`INSERT INTO issuance_log (kind, user_id, issuer, addrs, amount, total, tx_hash, status, reason, created)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Kind, e.UserID, e.Issuer, strings.Join(e.Addrs, ","), e.Amount, e.Total, e.TxHash, e.Status, e.Reason, e.Created)
+	if err != nil {
+		logger.Errorf("record issuance %+v failed, %s", e, err)
+		return err
+	}
+	e.ID, err = ret.LastInsertId()
+	return err
+}
+
+// Update records the status, the reason and the tx hash of e reserved.
+func Update(db *sql.DB, e *Entry) error {
+	_, err := db.Exec(`UPDATE issuance_log SET status = ?, reason = ?, tx_hash = ? WHERE id = ?`, e.Status, e.Reason, e.TxHash, e.ID)
+	if err != nil {
+		logger.Errorf("update issuance %+v failed, %s", e, err)
+	}
+	return err
+}
+
+// List returns the audit log of the kind and status, all if empty, the latest first, and the total count.
+func List(db *sql.DB, kind, status string, limit, offset int) ([]*Entry, int, error) {
+	where := ` WHERE 1 = 1`
+	args := []interface{}{}
+	if kind != "" {
+		where += ` AND kind = ?`
+		args = append(args, kind)
+	}
+	if status != "" {
+		where += ` AND status = ?`
+		args = append(args, status)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM issuance_log`+where, args...).Scan(&count); err != nil {
+		return nil, 0, err
+	}
+
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := db.Query(`SELECT id, kind, user_id, issuer, addrs, amount, total, tx_hash, status, reason, created
+		FROM issuance_log`+where+` ORDER BY id DESC LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	es := []*Entry{}
+	for rows.Next() {
+		e := &Entry{}
+		var addrs string
+		if err := rows.Scan(&e.ID, &e.Kind, &e.UserID, &e.Issuer, &addrs, &e.Amount, &e.Total, &e.TxHash, &e.Status, &e.Reason, &e.Created); err != nil {
+			return nil, 0, err
+		}
+		e.Addrs = strings.Split(addrs, ",")
+		es = append(es, e)
+	}
+	return es, count, rows.Err()
+}
@@ -0,0 +1,93 @@
+package issuance
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/farmer/migrate"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestPolicy(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db failed, %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, Schema); err != nil {
+		t.Fatalf("migrate failed, %s", err)
+	}
+
+	p := &Policy{
+		Issuers:         []string{"02aa"},
+		Period:          time.Hour,
+		PeriodCap:       1000,
+		MaxAmount:       300,
+		Reward:          100,
+		HalvingInterval: 2,
+	}
+	now := time.Now()
+
+	if err := p.CheckManual(db, "03bb", []string{"a"}, 10, now); err == nil {
+		t.Errorf("expect error of not an issuer")
+	}
+	if err := p.CheckManual(db, "02AA", []string{"a"}, 301, now); err == nil {
+		t.Errorf("expect error of max amount")
+	}
+	if err := p.CheckManual(db, "02aa", []string{"a", "b", "c", "d"}, 300, now); err == nil {
+		t.Errorf("expect error of period cap")
+	}
+
+	// the rejected and the out of the period are not counted.
+	for _, e := range []*Entry{
+		{Kind: KindManual, Addrs: []string{"a", "b"}, Amount: 300, Status: StatusIssued},
+		{Kind: KindManual, Addrs: []string{"a"}, Amount: 300, Status: StatusRejected},
+		{Kind: KindManual, Addrs: []string{"a"}, Amount: 300, Status: StatusIssued, Created: now.Add(-2 * time.Hour).Unix()},
+		{Kind: KindReward, Addrs: []string{"a"}, Amount: 100, Status: StatusIssued},
+		{Kind: KindReward, Addrs: []string{"a"}, Amount: 100, Status: StatusSigned},
+	} {
+		if err := Record(db, e); err != nil {
+			t.Fatalf("record failed, %s", err)
+		}
+	}
+	if issued, _ := Issued(db, now.Add(-time.Hour)); issued != 800 {
+		t.Errorf("expect 800 issued, got %v", issued)
+	}
+	if err := p.CheckManual(db, "02aa", []string{"a"}, 201, now); err == nil {
+		t.Errorf("expect error of period cap")
+	}
+	if err := p.CheckManual(db, "02aa", []string{"a"}, 200, now); err != nil {
+		t.Errorf("expect 200 allowed, got %s", err)
+	}
+
+	// 2 rewards are issued, it is halved once.
+	if r, err := p.RewardAmount(db, now); err != nil || r != 50 {
+		t.Errorf("expect reward 50, got %v %v", r, err)
+	}
+
+	es, count, err := List(db, KindManual, "", 10, 0)
+	if err != nil || count != 3 || es[0].Total != 300 || es[1].Status != StatusRejected {
+		t.Errorf("unexpected log %+v %v %v", es, count, err)
+	}
+
+	// the reserved is counted until it fails, the rejected is recorded.
+	e := &Entry{Kind: KindManual, Issuer: "02aa", Addrs: []string{"a"}, Amount: 200}
+	if err := p.ReserveManual(db, e, now); err != nil || e.ID == 0 || e.Status != StatusReserved {
+		t.Fatalf("expect 200 reserved, got %+v %v", e, err)
+	}
+	rejected := &Entry{Kind: KindManual, Issuer: "02aa", Addrs: []string{"a"}, Amount: 1}
+	if err := p.ReserveManual(db, rejected, now); err == nil || rejected.ID == 0 || rejected.Status != StatusRejected {
+		t.Errorf("expect error of period cap, got %+v %v", rejected, err)
+	}
+	e.Status, e.Reason = StatusFailed, "invoke failed"
+	if err := Update(db, e); err != nil {
+		t.Fatalf("update failed, %s", err)
+	}
+	if err := p.CheckManual(db, "02aa", []string{"a"}, 200, now); err != nil {
+		t.Errorf("expect 200 allowed, got %s", err)
+	}
+	if _, count, _ := List(db, KindManual, StatusRejected, 10, 0); count != 2 {
+		t.Errorf("expect 2 rejected, got %v", count)
+	}
+}
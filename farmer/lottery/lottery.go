@@ -0,0 +1,386 @@
+// Package lottery takes part in the lotteries of the teller, which draws the farmers voting for the ledgers.
+package lottery
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	pb "github.com/conseweb/common/protos"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	"github.com/op/go-logging"
+	"golang.org/x/net/context"
+)
+
+const (
+	// StatusSent is a ticket received by the teller, the others are its result.
+	StatusSent = "sent"
+	// StatusSelected is a ticket drawn as a voter of some ledgers, StatusMissed is not drawn.
+	StatusSelected = "selected"
+	StatusMissed   = "missed"
+	// StatusInvalid is a ticket which the result of the teller does not match.
+	StatusInvalid = "invalid"
+
+	defaultTimeout = 10 * time.Second
+)
+
+var (
+	logger = logging.MustGetLogger("lottery")
+
+	ErrNotOpen  = errors.New("lottery is not open")
+	ErrSent     = errors.New("ticket of the lottery is sent")
+	ErrNotDrawn = errors.New("lottery is not drawn")
+)
+
+// Schema is the migrations of the lottery tickets in farmer.db.
+var Schema = &migrate.Schema{
+	Name: "lottery",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create lottery tickets", Up: createTables},
+	},
+}
+
+func createTables(tx *sql.Tx) error {
+	for _, sqlstr := range []string{`
+	CREATE TABLE IF NOT EXISTS 'lottery_tickets' (
+		'id' INTEGER PRIMARY KEY AUTOINCREMENT,
+		'user_id' VARCHAR(64) NOT NULL,
+		'name' VARCHAR(64) NOT NULL,
+		'start_time' INTEGER NOT NULL,
+		'end_time' INTEGER NOT NULL,
+		'fx' INTEGER NOT NULL,
+		'mr' INTEGER NOT NULL,
+		'idx' INTEGER NOT NULL,
+		'height' INTEGER NOT NULL,
+		'status' VARCHAR(16) NOT NULL,
+		'ledgers' TEXT NOT NULL DEFAULT '',
+		'dist' INTEGER NOT NULL DEFAULT 0,
+		'reason' VARCHAR(256) NOT NULL DEFAULT '',
+		'created' INTEGER NOT NULL,
+		'checked' INTEGER NOT NULL DEFAULT 0,
+		UNIQUE ('user_id', 'start_time')
+	)`,
+		`CREATE INDEX IF NOT EXISTS 'idx_lottery_tickets_status' ON 'lottery_tickets' ('status', 'end_time')`,
+	} {
+		if _, err := tx.Exec(sqlstr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Window is the time a lottery receives the tickets.
+type Window struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// Open tells whether the tickets are received at now.
+func (w *Window) Open(now time.Time) bool {
+	return now.Unix() >= w.Start && now.Unix() < w.End
+}
+
+// State is what the lottery number of a farmer is derived from.
+type State struct {
+	// of the ledger.
+	Height    uint64
+	BlockHash []byte
+	// supervisor challenges conquered by the farmer.
+	Conquered int
+}
+
+// Fx returns the lottery number of fid in the lottery starting at start, the same state gives the same number.
+func Fx(fid string, start int64, s *State) uint64 {
+	h := sha256.New()
+	h.Write([]byte(fid))
+	binary.Write(h, binary.BigEndian, start)
+	binary.Write(h, binary.BigEndian, s.Height)
+	h.Write(s.BlockHash)
+	binary.Write(h, binary.BigEndian, uint64(s.Conquered))
+	return binary.BigEndian.Uint64(h.Sum(nil)[:8])
+}
+
+// Ticket is a participation of a farmer in a lottery, the numbers are strings in json as they are 64 bits.
+type Ticket struct {
+	ID      int64    `json:"id"`
+	UserID  string   `json:"user_id"`
+	Name    string   `json:"name"`
+	Start   int64    `json:"start"`
+	End     int64    `json:"end"`
+	Fx      uint64   `json:"fx,string"`
+	Mr      uint64   `json:"mr,string"`
+	Idx     int64    `json:"idx"`
+	Height  uint64   `json:"height"`
+	Status  string   `json:"status"`
+	Ledgers []string `json:"ledgers"`
+	Dist    uint64   `json:"dist,string"`
+	Reason  string   `json:"reason,omitempty"`
+	Created int64    `json:"created"`
+	Checked int64    `json:"checked,omitempty"`
+}
+
+const ticketColumns = `id, user_id, name, start_time, end_time, fx, mr, idx, height, status, ledgers, dist, reason, created, checked`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTicket(row rowScanner) (*Ticket, error) {
+	var (
+		t                 Ticket
+		fx, mr, dist, hgt int64
+		ledgers           string
+	)
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Start, &t.End, &fx, &mr, &t.Idx, &hgt, &t.Status,
+		&ledgers, &dist, &t.Reason, &t.Created, &t.Checked); err != nil {
+		return nil, err
+	}
+	// sqlite integers are signed, the bits are kept.
+	t.Fx, t.Mr, t.Dist, t.Height = uint64(fx), uint64(mr), uint64(dist), uint64(hgt)
+	t.Ledgers = []string{}
+	if ledgers != "" {
+		t.Ledgers = strings.Split(ledgers, ",")
+	}
+	return &t, nil
+}
+
+func insertTicket(db *sql.DB, t *Ticket) error {
+	res, err := db.Exec(`INSERT INTO lottery_tickets (user_id, name, start_time, end_time, fx, mr, idx, height, status, created)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.UserID, t.Name, t.Start, t.End, int64(t.Fx), int64(t.Mr), t.Idx, int64(t.Height), t.Status, t.Created)
+	if err != nil {
+		return err
+	}
+	t.ID, err = res.LastInsertId()
+	return err
+}
+
+func updateResult(db *sql.DB, t *Ticket) error {
+	_, err := db.Exec(`UPDATE lottery_tickets SET status = ?, ledgers = ?, dist = ?, reason = ?, checked = ? WHERE id = ?`,
+		t.Status, strings.Join(t.Ledgers, ","), int64(t.Dist), t.Reason, t.Checked, t.ID)
+	return err
+}
+
+// Get returns the ticket id of userID, sql.ErrNoRows if there is none.
+func Get(db *sql.DB, userID string, id int64) (*Ticket, error) {
+	return scanTicket(db.QueryRow(`SELECT `+ticketColumns+` FROM lottery_tickets WHERE id = ? AND user_id = ?`, id, userID))
+}
+
+// Find returns the ticket of userID in the lottery starting at start, sql.ErrNoRows if there is none.
+func Find(db *sql.DB, userID string, start int64) (*Ticket, error) {
+	return scanTicket(db.QueryRow(`SELECT `+ticketColumns+` FROM lottery_tickets WHERE user_id = ? AND start_time = ?`, userID, start))
+}
+
+// List returns the tickets of userID, the latest first, and the total count.
+func List(db *sql.DB, userID string, limit, offset int) ([]*Ticket, int, error) {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM lottery_tickets WHERE user_id = ?`, userID).Scan(&count); err != nil {
+		return nil, 0, err
+	}
+
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := db.Query(`SELECT `+ticketColumns+` FROM lottery_tickets WHERE user_id = ? ORDER BY start_time DESC LIMIT ? OFFSET ?`,
+		userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	ts := []*Ticket{}
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, count, rows.Err()
+}
+
+// Pending returns the sent tickets of the lotteries ended before now, whose result is to be checked.
+func Pending(db *sql.DB, now time.Time) ([]*Ticket, error) {
+	rows, err := db.Query(`SELECT `+ticketColumns+` FROM lottery_tickets WHERE status = ? AND end_time <= ? ORDER BY id`,
+		StatusSent, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ts := []*Ticket{}
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, rows.Err()
+}
+
+// Client talks to the LotteryAPI of the teller, and records the tickets in db.
+type Client struct {
+	api     pb.LotteryAPIClient
+	db      *sql.DB
+	Timeout time.Duration
+}
+
+func NewClient(api pb.LotteryAPIClient, db *sql.DB) *Client {
+	return &Client{api: api, db: db, Timeout: defaultTimeout}
+}
+
+func (c *Client) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), c.Timeout)
+}
+
+// Next returns the window of the next lottery, or the running one.
+func (c *Client) Next() (*Window, error) {
+	ctx, cancel := c.context()
+	defer cancel()
+
+	rsp, err := c.api.NextLotteryInfo(ctx, &pb.NextLotteryInfoReq{})
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Error != nil && !rsp.Error.OK() {
+		return nil, rsp.Error
+	}
+	if rsp.EndTime <= rsp.StartTime {
+		return nil, fmt.Errorf("invalid lottery window %d - %d", rsp.StartTime, rsp.EndTime)
+	}
+	return &Window{Start: rsp.StartTime, End: rsp.EndTime}, nil
+}
+
+// Participate sends the Fx ticket of fid derived from s to the open lottery, at most once a lottery.
+// returns the sent ticket and ErrSent if it is sent before.
+func (c *Client) Participate(fid string, s *State, now time.Time) (*Ticket, error) {
+	w, err := c.Next()
+	if err != nil {
+		return nil, err
+	}
+	if !w.Open(now) {
+		return nil, ErrNotOpen
+	}
+	if t, err := Find(c.db, fid, w.Start); err == nil {
+		return t, ErrSent
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	fx := Fx(fid, w.Start, s)
+	ctx, cancel := c.context()
+	defer cancel()
+	rsp, err := c.api.SendLotteryFx(ctx, &pb.SendLotteryFxReq{Fid: fid, Fx: fx})
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Error != nil && !rsp.Error.OK() {
+		return nil, rsp.Error
+	}
+	if rsp.Ticket == nil || rsp.Ticket.Fid != fid || rsp.Ticket.Fx != fx {
+		return nil, fmt.Errorf("ticket of the teller %v does not match fx %d of %s", rsp.Ticket, fx, fid)
+	}
+
+	t := &Ticket{
+		UserID:  fid,
+		Name:    rsp.Ticket.LotteryName,
+		Start:   w.Start,
+		End:     w.End,
+		Fx:      fx,
+		Mr:      rsp.Ticket.Mr,
+		Idx:     rsp.Ticket.Idx,
+		Height:  s.Height,
+		Status:  StatusSent,
+		Ledgers: []string{},
+		Created: now.Unix(),
+	}
+	if err := insertTicket(c.db, t); err != nil {
+		logger.Errorf("save lottery ticket of %s failed, %s", fid, err)
+		return nil, err
+	}
+	logger.Infof("lottery ticket of %s is sent to %s, fx %d", fid, t.Name, fx)
+	return t, nil
+}
+
+// Check gets the result of the lottery of t, verifies and records it in t.
+func (c *Client) Check(t *Ticket, now time.Time) error {
+	if now.Unix() < t.End {
+		return ErrNotDrawn
+	}
+
+	ctx, cancel := c.context()
+	defer cancel()
+	rsp, err := c.api.GetLotteryResult(ctx, &pb.GetLotteryResultReq{LotteryName: t.Name})
+	if err != nil {
+		return err
+	}
+	if rsp.Error != nil && !rsp.Error.OK() {
+		return rsp.Error
+	}
+
+	verify(t, rsp.Result)
+	t.Checked = now.Unix()
+	return updateResult(c.db, t)
+}
+
+// verify sets the status of t by the result r. the ticket must be in the result as it is sent,
+// and the ledgers it is drawn for must list the farmer.
+func verify(t *Ticket, r *pb.LotteryResult) {
+	invalid := func(format string, args ...interface{}) {
+		t.Status, t.Reason, t.Ledgers, t.Dist = StatusInvalid, fmt.Sprintf(format, args...), []string{}, 0
+	}
+	if r == nil || r.Name != t.Name {
+		invalid("result is not of lottery %s", t.Name)
+		return
+	}
+
+	var fx *pb.LotteryFx
+	for _, f := range r.Fxs {
+		if f.Fid == t.UserID {
+			fx = f
+			break
+		}
+	}
+	if fx == nil {
+		invalid("ticket is not in the result")
+		return
+	}
+	if fx.Value != t.Fx || fx.Mr != t.Mr {
+		invalid("ticket is changed to fx %d mr %d", fx.Value, fx.Mr)
+		return
+	}
+
+	lxs := map[string]*pb.LotteryLx{}
+	for _, lx := range r.Lxs {
+		lxs[lx.Lid] = lx
+	}
+	for _, lid := range fx.Ledgers {
+		lx, ok := lxs[lid]
+		if !ok {
+			invalid("ledger %s is not in the result", lid)
+			return
+		}
+		found := false
+		for _, fid := range lx.Farmers {
+			if fid == t.UserID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			invalid("ledger %s does not list the farmer", lid)
+			return
+		}
+	}
+
+	t.Status, t.Reason, t.Dist = StatusMissed, "", fx.Dist
+	t.Ledgers = append([]string{}, fx.Ledgers...)
+	if len(fx.Ledgers) > 0 {
+		t.Status = StatusSelected
+	}
+}
@@ -0,0 +1,210 @@
+package lottery
+
+import (
+	"database/sql"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/conseweb/common/protos"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// stubTeller is a teller of a lottery, the result is drawn by draw. it answers ResponseOK as the
+// teller does, and refuses the tickets of refused.
+type stubTeller struct {
+	sync.Mutex
+	start, end int64
+	fxs        []*pb.LotteryFx
+	draw       func(fxs []*pb.LotteryFx) *pb.LotteryResult
+	refused    string
+}
+
+func (s *stubTeller) NextLotteryInfo(ctx context.Context, req *pb.NextLotteryInfoReq) (*pb.NextLotteryInfoRsp, error) {
+	s.Lock()
+	defer s.Unlock()
+	return &pb.NextLotteryInfoRsp{Error: pb.ResponseOK(), StartTime: s.start, EndTime: s.end}, nil
+}
+
+func (s *stubTeller) SendLotteryFx(ctx context.Context, req *pb.SendLotteryFxReq) (*pb.SendLotteryFxRsp, error) {
+	s.Lock()
+	defer s.Unlock()
+	if req.Fid == s.refused {
+		return &pb.SendLotteryFxRsp{Error: pb.NewErrorf(pb.ErrorType_INVALID_PARAM, "refused %s", req.Fid)}, nil
+	}
+	mr := uint64(len(s.fxs) + 7)
+	s.fxs = append(s.fxs, &pb.LotteryFx{Fid: req.Fid, Value: req.Fx, Mr: mr})
+	return &pb.SendLotteryFxRsp{Error: pb.ResponseOK(), Ticket: &pb.LotteryFxTicket{
+		Fid: req.Fid, Fx: req.Fx, Mr: mr, Idx: int64(len(s.fxs)), LotteryName: "round-1",
+	}}, nil
+}
+
+func (s *stubTeller) SendLotteryLx(ctx context.Context, req *pb.SendLotteryLxReq) (*pb.SendLotteryLxRsp, error) {
+	return &pb.SendLotteryLxRsp{}, nil
+}
+
+func (s *stubTeller) StartLottery(ctx context.Context, req *pb.StartLotteryReq) (*pb.StartLotteryRsp, error) {
+	return &pb.StartLotteryRsp{}, nil
+}
+
+func (s *stubTeller) GetLotteryResult(ctx context.Context, req *pb.GetLotteryResultReq) (*pb.GetLotteryResultRsp, error) {
+	s.Lock()
+	defer s.Unlock()
+	if req.LotteryName != "round-1" {
+		return &pb.GetLotteryResultRsp{Error: pb.NewError(pb.ErrorType_INVALID_PARAM, "no lottery "+req.LotteryName)}, nil
+	}
+	return &pb.GetLotteryResultRsp{Error: pb.ResponseOK(), Result: s.draw(s.fxs)}, nil
+}
+
+func newTestClient(t *testing.T, teller *stubTeller) (*Client, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterLotteryAPIServer(srv, teller)
+	go srv.Serve(lis)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(3*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, Schema); err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(pb.NewLotteryAPIClient(conn), db), func() {
+		conn.Close()
+		srv.Stop()
+		db.Close()
+	}
+}
+
+func TestLottery(t *testing.T) {
+	now := time.Now()
+	teller := &stubTeller{start: now.Unix() - 10, end: now.Unix() + 10, refused: "carol"}
+	teller.draw = func(fxs []*pb.LotteryFx) *pb.LotteryResult {
+		fxs[0].Ledgers, fxs[0].Dist = []string{"l1"}, 3
+		return &pb.LotteryResult{Name: "round-1", Fxs: fxs, Lxs: []*pb.LotteryLx{
+			{Lid: "l1", Won: true, Farmers: []string{"alice"}},
+		}}
+	}
+	c, done := newTestClient(t, teller)
+	defer done()
+
+	state := &State{Height: 10, BlockHash: []byte("top"), Conquered: 2}
+	ticket, err := c.Participate("alice", state, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Fx != Fx("alice", teller.start, state) || ticket.Name != "round-1" || ticket.Status != StatusSent {
+		t.Fatalf("ticket %+v", ticket)
+	}
+	if _, err := c.Participate("alice", state, now); err != ErrSent {
+		t.Errorf("participate twice, %v", err)
+	}
+	if _, err := c.Participate("bob", &State{Height: 10}, now); err != nil {
+		t.Fatal(err)
+	}
+	// the refused ticket is not recorded.
+	if _, err := c.Participate("carol", &State{Height: 10}, now); err == nil {
+		t.Errorf("expect error of the refused ticket")
+	}
+	if _, err := Find(c.db, "carol", teller.start); err != sql.ErrNoRows {
+		t.Errorf("expect no ticket of carol, got %v", err)
+	}
+	if saved, err := Find(c.db, "alice", teller.start); err != nil || saved.ID != ticket.ID || saved.Status != StatusSent {
+		t.Errorf("expect the ticket of alice saved, got %+v %v", saved, err)
+	}
+
+	if err := c.Check(ticket, now); err != ErrNotDrawn {
+		t.Errorf("check before the end, %v", err)
+	}
+	after := time.Unix(teller.end, 0)
+	ts, err := Pending(c.db, after)
+	if err != nil || len(ts) != 2 {
+		t.Fatalf("pending %v %v", ts, err)
+	}
+	for _, tk := range ts {
+		if err := c.Check(tk, after); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	alice, err := Get(c.db, "alice", ticket.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.Status != StatusSelected || len(alice.Ledgers) != 1 || alice.Ledgers[0] != "l1" || alice.Dist != 3 {
+		t.Errorf("alice %+v", alice)
+	}
+	bobs, count, err := List(c.db, "bob", 10, 0)
+	if err != nil || count != 1 || bobs[0].Status != StatusMissed {
+		t.Errorf("tickets of bob %+v %d %v", bobs, count, err)
+	}
+	if ts, _ := Pending(c.db, after); len(ts) != 0 {
+		t.Errorf("checked tickets are pending, %v", ts)
+	}
+
+	unknown := *alice
+	unknown.Name = "round-2"
+	if err := c.Check(&unknown, after); err == nil {
+		t.Errorf("expect error of an unknown lottery")
+	}
+}
+
+func TestLotteryInvalid(t *testing.T) {
+	now := time.Now()
+	teller := &stubTeller{start: now.Unix() - 10, end: now.Unix() + 10}
+	c, done := newTestClient(t, teller)
+	defer done()
+
+	ticket, err := c.Participate("alice", &State{Height: 1}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		draw func(fxs []*pb.LotteryFx) *pb.LotteryResult
+	}{
+		{"changed fx", func(fxs []*pb.LotteryFx) *pb.LotteryResult {
+			return &pb.LotteryResult{Name: "round-1", Fxs: []*pb.LotteryFx{{Fid: "alice", Value: fxs[0].Value + 1, Mr: fxs[0].Mr}}}
+		}},
+		{"missing ticket", func(fxs []*pb.LotteryFx) *pb.LotteryResult {
+			return &pb.LotteryResult{Name: "round-1"}
+		}},
+		{"unknown ledger", func(fxs []*pb.LotteryFx) *pb.LotteryResult {
+			f := *fxs[0]
+			f.Ledgers = []string{"l9"}
+			return &pb.LotteryResult{Name: "round-1", Fxs: []*pb.LotteryFx{&f}}
+		}},
+		{"ledger without the farmer", func(fxs []*pb.LotteryFx) *pb.LotteryResult {
+			f := *fxs[0]
+			f.Ledgers = []string{"l1"}
+			return &pb.LotteryResult{Name: "round-1", Fxs: []*pb.LotteryFx{&f}, Lxs: []*pb.LotteryLx{{Lid: "l1"}}}
+		}},
+	} {
+		teller.draw = tc.draw
+		if err := c.Check(ticket, time.Unix(teller.end, 0)); err != nil {
+			t.Fatalf("%s, %s", tc.name, err)
+		}
+		if ticket.Status != StatusInvalid || ticket.Reason == "" {
+			t.Errorf("%s, ticket %+v", tc.name, ticket)
+		}
+	}
+
+	// closed.
+	if _, err := c.Participate("bob", &State{}, time.Unix(teller.end, 0)); err != ErrNotOpen {
+		t.Errorf("participate the closed, %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+// Package metrics keeps the counters, gauges and histograms of the farmer and writes them in
+// the prometheus text format, the client library is not vendored.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the content type of the prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets are the buckets of the latencies in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	registryLock sync.Mutex
+	registry     = map[string]collector{}
+)
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+func register(name string, c collector) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("metric %s is registered twice", name))
+	}
+	registry[name] = c
+}
+
+// WriteText writes all the metrics in the prometheus text format, sorted by name.
+func WriteText(w io.Writer) error {
+	registryLock.Lock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cs := make([]collector, len(names))
+	for i, name := range names {
+		cs[i] = registry[name]
+	}
+	registryLock.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range cs {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// vec is the children of a metric by the label values.
+type vec struct {
+	sync.Mutex
+	name, help, kind string
+	labels           []string
+	children         map[string]interface{}
+	newChild         func() interface{}
+}
+
+func (v *vec) with(values []string) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	v.Lock()
+	defer v.Unlock()
+	c, ok := v.children[key]
+	if !ok {
+		c = v.newChild()
+		v.children[key] = c
+	}
+	return c
+}
+
+// each calls fn with the label pairs of the children, sorted.
+func (v *vec) each(fn func(labels string, child interface{})) {
+	v.Lock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	children := make(map[string]interface{}, len(v.children))
+	for k, c := range v.children {
+		children[k] = c
+	}
+	v.Unlock()
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		var values []string
+		if len(v.labels) > 0 {
+			values = strings.Split(k, "\xff")
+		}
+		fn(labelPairs(v.labels, values), children[k])
+	}
+}
+
+func (v *vec) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+}
+
+func labelPairs(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+}
+
+// Gauge is a value which goes up and down, a Counter only goes up.
+type Gauge struct {
+	lock  sync.Mutex
+	value float64
+}
+
+func (g *Gauge) Set(f float64) {
+	g.lock.Lock()
+	g.value = f
+	g.lock.Unlock()
+}
+
+func (g *Gauge) Add(f float64) {
+	g.lock.Lock()
+	g.value += f
+	g.lock.Unlock()
+}
+
+func (g *Gauge) Inc() { g.Add(1) }
+
+func (g *Gauge) Value() float64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.value
+}
+
+// Counter is a Gauge which is never decreased.
+type Counter struct {
+	g Gauge
+}
+
+// Add increases the counter, the negative is ignored.
+func (c *Counter) Add(f float64) {
+	if f > 0 {
+		c.g.Add(f)
+	}
+}
+
+func (c *Counter) Inc() { c.g.Add(1) }
+
+func (c *Counter) Value() float64 { return c.g.Value() }
+
+// GaugeVec is the gauges of a name by the label values.
+type GaugeVec struct{ vec }
+
+// NewGaugeVec registers the gauges of name.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{vec{name: name, help: help, kind: "gauge", labels: labels, children: map[string]interface{}{},
+		newChild: func() interface{} { return new(Gauge) }}}
+	register(name, v)
+	return v
+}
+
+func (v *GaugeVec) With(values ...string) *Gauge { return v.with(values).(*Gauge) }
+
+func (v *GaugeVec) write(w *bufio.Writer) {
+	v.header(w)
+	v.each(func(labels string, c interface{}) { writeSample(w, v.name, labels, c.(*Gauge).Value()) })
+}
+
+// CounterVec is the counters of a name by the label values.
+type CounterVec struct{ vec }
+
+// NewCounterVec registers the counters of name, it should end with _total.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{vec{name: name, help: help, kind: "counter", labels: labels, children: map[string]interface{}{},
+		newChild: func() interface{} { return new(Counter) }}}
+	register(name, v)
+	return v
+}
+
+func (v *CounterVec) With(values ...string) *Counter { return v.with(values).(*Counter) }
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.header(w)
+	v.each(func(labels string, c interface{}) { writeSample(w, v.name, labels, c.(*Counter).Value()) })
+}
+
+// Histogram counts the observed values in the buckets.
+type Histogram struct {
+	lock    sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *Histogram) Observe(f float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i, b := range h.buckets {
+		if f <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += f
+}
+
+// HistogramVec is the histograms of a name by the label values.
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+// NewHistogramVec registers the histograms of name, DefBuckets if buckets is nil.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	v := &HistogramVec{buckets: buckets}
+	v.vec = vec{name: name, help: help, kind: "histogram", labels: labels, children: map[string]interface{}{},
+		newChild: func() interface{} {
+			return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		}}
+	register(name, v)
+	return v
+}
+
+func (v *HistogramVec) With(values ...string) *Histogram { return v.with(values).(*Histogram) }
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.header(w)
+	v.each(func(labels string, c interface{}) {
+		h := c.(*Histogram)
+		h.lock.Lock()
+		counts, count, sum := append([]uint64(nil), h.counts...), h.count, h.sum
+		h.lock.Unlock()
+
+		sep := ""
+		if labels != "" {
+			sep = ","
+		}
+		for i, b := range v.buckets {
+			writeSample(w, v.name+"_bucket", labels+sep+`le="`+formatFloat(b)+`"`, float64(counts[i]))
+		}
+		writeSample(w, v.name+"_bucket", labels+sep+`le="+Inf"`, float64(count))
+		writeSample(w, v.name+"_sum", labels, sum)
+		writeSample(w, v.name+"_count", labels, float64(count))
+	})
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	reqs := NewCounterVec("test_requests_total", "Requests.", "route", "code")
+	reqs.With("/a", "200").Inc()
+	reqs.With("/a", "200").Add(2)
+	reqs.With("/b\"", "500").Add(-1)
+	NewGaugeVec("test_height", "Height.").With().Set(42)
+	NewHistogramVec("test_seconds", "Latency.", []float64{1, 0.1}, "op").With("q").Observe(0.5)
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_height Height.
+# TYPE test_height gauge
+test_height 42
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{route="/a",code="200"} 3
+test_requests_total{route="/b\"",code="500"} 0
+# HELP test_seconds Latency.
+# TYPE test_seconds histogram
+test_seconds_bucket{op="q",le="0.1"} 0
+test_seconds_bucket{op="q",le="1"} 1
+test_seconds_bucket{op="q",le="+Inf"} 1
+test_seconds_sum{op="q"} 0.5
+test_seconds_count{op="q"} 1
+`
+	if got := buf.String(); !strings.Contains(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
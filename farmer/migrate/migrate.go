@@ -0,0 +1,231 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+var (
+	logger = logging.MustGetLogger("migrate")
+
+	ErrNewerSchema = errors.New("database schema is newer than this farmer knows")
+)
+
+// Migration is one step of a schema, applied in a transaction.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+}
+
+// Schema is a group of tables in a database, versioned on its own, so that
+// every package keeps the migrations of its tables.
+type Schema struct {
+	Name       string
+	Migrations []Migration
+}
+
+// Latest returns the version of the last migration.
+func (s *Schema) Latest() int {
+	if len(s.Migrations) == 0 {
+		return 0
+	}
+	return s.Migrations[len(s.Migrations)-1].Version
+}
+
+func (s *Schema) validate() error {
+	last := 0
+	for _, m := range s.Migrations {
+		if m.Version <= last {
+			return fmt.Errorf("schema %s: migration %d<%s> is out of order", s.Name, m.Version, m.Name)
+		}
+		if m.Up == nil {
+			return fmt.Errorf("schema %s: migration %d<%s> has no up", s.Name, m.Version, m.Name)
+		}
+		last = m.Version
+	}
+	return nil
+}
+
+// Runner applies schemas to the database file at Path.
+type Runner struct {
+	// Path of the database file, used by backup.
+	Path string
+	// Backup copies the database file before any migration is applied.
+	Backup bool
+	// Strict refuses the database having a schema not in the ones run, which a newer farmer added.
+	// set it when the runner is given all the schemas of the database.
+	Strict bool
+}
+
+func initDB(db *sql.DB) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS 'schema_migrations' (
+		'schema' VARCHAR(32) NOT NULL,
+		'version' INTEGER NOT NULL,
+		'name' VARCHAR(64) NOT NULL,
+		'applied_at' INTEGER NOT NULL,
+		PRIMARY KEY ('schema', 'version')
+	)`)
+	return err
+}
+
+// Versions returns the applied version of every schema in db.
+func Versions(db *sql.DB) (map[string]int, error) {
+	if err := initDB(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT schema, MAX(version) FROM schema_migrations GROUP BY schema`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vs := map[string]int{}
+	for rows.Next() {
+		var (
+			name string
+			v    int
+		)
+		if err := rows.Scan(&name, &v); err != nil {
+			return nil, err
+		}
+		vs[name] = v
+	}
+	return vs, rows.Err()
+}
+
+// Run applies the pending migrations of schemas in order. It refuses to touch
+// db if any schema was migrated by a newer farmer.
+func (r *Runner) Run(db *sql.DB, schemas ...*Schema) error {
+	vs, err := Versions(db)
+	if err != nil {
+		logger.Errorf("read schema versions of %s failed, %s", r.Path, err)
+		return err
+	}
+	if r.Strict {
+		known := map[string]bool{}
+		for _, s := range schemas {
+			known[s.Name] = true
+		}
+		for name, v := range vs {
+			if !known[name] {
+				return fmt.Errorf("%s: schema %s at version %d is unknown, %w", r.Path, name, v, ErrNewerSchema)
+			}
+		}
+	}
+
+	pending := 0
+	for _, s := range schemas {
+		if err := s.validate(); err != nil {
+			return err
+		}
+		if vs[s.Name] > s.Latest() {
+			return fmt.Errorf("%s: schema %s is at version %d, latest known is %d, %w", r.Path, s.Name, vs[s.Name], s.Latest(), ErrNewerSchema)
+		}
+		for _, m := range s.Migrations {
+			if m.Version > vs[s.Name] {
+				pending++
+			}
+		}
+	}
+	if pending == 0 {
+		return nil
+	}
+
+	if r.Backup {
+		bak, err := r.backup(db)
+		if err != nil {
+			logger.Errorf("backup %s failed, %s", r.Path, err)
+			return err
+		}
+		if bak != "" {
+			logger.Infof("backup %s to %s before migrating", r.Path, bak)
+		}
+	}
+
+	for _, s := range schemas {
+		for _, m := range s.Migrations {
+			if m.Version <= vs[s.Name] {
+				continue
+			}
+			if err := apply(db, s, m); err != nil {
+				logger.Errorf("migrate %s schema %s to %d<%s> failed, %s", r.Path, s.Name, m.Version, m.Name, err)
+				return err
+			}
+			logger.Infof("migrated %s schema %s to %d<%s>", r.Path, s.Name, m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+func apply(db *sql.DB, s *Schema, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := m.Up(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO schema_migrations (schema, version, name, applied_at) VALUES (?, ?, ?, ?)`,
+		s.Name, m.Version, m.Name, time.Now().Unix())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// backup copies the database file next to it, nothing to do for a new database.
+func (r *Runner) backup(db *sql.DB) (string, error) {
+	if r.Path == "" {
+		return "", nil
+	}
+
+	var tables int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')`).Scan(&tables)
+	if err != nil || tables == 0 {
+		return "", err
+	}
+
+	src, err := os.Open(r.Path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.Size() == 0 {
+		return "", nil
+	}
+
+	bak := fmt.Sprintf("%s.%s.bak", r.Path, time.Now().Format("20060102150405.000000"))
+	dst, err := os.OpenFile(bak, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(bak)
+		return "", err
+	}
+	return bak, dst.Close()
+}
@@ -0,0 +1,123 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) (*sql.DB, string) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatalf("temp dir failed, %s", err)
+	}
+
+	path := filepath.Join(dir, "test.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open db failed, %s", err)
+	}
+	return db, path
+}
+
+func createTable(name string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(fmt.Sprintf("CREATE TABLE %s (id INTEGER)", name))
+		return err
+	}
+}
+
+func TestRun(t *testing.T) {
+	db, path := openDB(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	s := &Schema{
+		Name: "test",
+		Migrations: []Migration{
+			{Version: 1, Name: "a", Up: createTable("a")},
+		},
+	}
+	r := &Runner{Path: path, Backup: true}
+	if err := r.Run(db, s); err != nil {
+		t.Fatalf("run failed, %s", err)
+	}
+
+	s.Migrations = append(s.Migrations, Migration{Version: 2, Name: "b", Up: createTable("b")})
+	if err := r.Run(db, s); err != nil {
+		t.Fatalf("run again failed, %s", err)
+	}
+
+	vs, err := Versions(db)
+	if err != nil {
+		t.Fatalf("versions failed, %s", err)
+	}
+	if vs["test"] != 2 {
+		t.Errorf("expect version 2, got %v", vs["test"])
+	}
+
+	baks, _ := filepath.Glob(path + ".*.bak")
+	if len(baks) != 1 {
+		t.Errorf("expect 1 backup before the second migration, got %v", baks)
+	}
+
+	// an older farmer knows version 1 only.
+	s.Migrations = s.Migrations[:1]
+	if err := r.Run(db, s); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("expect error on newer schema, %v", err)
+	}
+}
+
+func TestRunStrict(t *testing.T) {
+	db, path := openDB(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	a := &Schema{Name: "a", Migrations: []Migration{{Version: 1, Name: "a", Up: createTable("a")}}}
+	b := &Schema{Name: "b", Migrations: []Migration{{Version: 1, Name: "b", Up: createTable("b")}}}
+	if err := (&Runner{Strict: true}).Run(db, a, b); err != nil {
+		t.Fatalf("run failed, %s", err)
+	}
+
+	// a subset of the schemas is fine unless strict.
+	if err := (&Runner{}).Run(db, a); err != nil {
+		t.Errorf("run a failed, %s", err)
+	}
+	// an older farmer does not know b.
+	if err := (&Runner{Strict: true}).Run(db, a); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("expect error on unknown schema, %v", err)
+	}
+}
+
+func TestRunFailed(t *testing.T) {
+	db, path := openDB(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	s := &Schema{
+		Name: "test",
+		Migrations: []Migration{
+			{Version: 1, Name: "a", Up: createTable("a")},
+			{Version: 2, Name: "again", Up: createTable("a")},
+		},
+	}
+	if err := (&Runner{}).Run(db, s); err == nil {
+		t.Fatalf("expect the second migration failed")
+	}
+
+	vs, err := Versions(db)
+	if err != nil {
+		t.Fatalf("versions failed, %s", err)
+	}
+	if vs["test"] != 1 {
+		t.Errorf("expect version 1, got %v", vs["test"])
+	}
+
+	s.Migrations[0], s.Migrations[1] = s.Migrations[1], s.Migrations[0]
+	if err := (&Runner{}).Run(db, s); err == nil {
+		t.Errorf("expect error on out of order migrations")
+	}
+}
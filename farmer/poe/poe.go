@@ -0,0 +1,370 @@
+package poe
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	pb "github.com/hyperledger/fabric/protos"
+	"github.com/op/go-logging"
+)
+
+// the functions of the poe chaincode.
+const (
+	// invoke register [hash, owner, name]
+	FuncRegister = "register"
+	// query get [hash], answers the json of Proof.
+	FuncGet = "get"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusCommitted = "committed"
+
+	// Algo is the hash algo of the files hashed by the farmer.
+	Algo = "sha256"
+)
+
+var (
+	ErrExists       = errors.New("the hash is registered")
+	ErrNotCommitted = errors.New("the proof is not committed yet")
+	// ErrBlockMismatch is a receipt whose block is not the one of the local chain.
+	ErrBlockMismatch = errors.New("the block is not the one of the local chain")
+)
+
+var logger = logging.MustGetLogger("poe")
+
+// Schema is the migrations of the proofs registered by the farmer in farmer.db.
+var Schema = &migrate.Schema{
+	Name: "poe",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create poe tables", Up: createTables},
+	},
+}
+
+func createTables(tx *sql.Tx) error {
+	for _, sqlstr := range []string{`
+	CREATE TABLE IF NOT EXISTS 'poe_proofs' (
+		'hash' VARCHAR(128) PRIMARY KEY,
+		'user_id' VARCHAR(64) NOT NULL,
+		'owner' VARCHAR(64) NOT NULL,
+		'name' VARCHAR(256) NOT NULL DEFAULT '',
+		'file' VARCHAR(512) NOT NULL DEFAULT '',
+		'chaincode' VARCHAR(256) NOT NULL,
+		'txid' VARCHAR(128) NOT NULL,
+		'status' VARCHAR(16) NOT NULL,
+		'height' INTEGER NOT NULL DEFAULT 0,
+		'block' INTEGER NOT NULL DEFAULT 0,
+		'block_hash' VARCHAR(128) NOT NULL DEFAULT '',
+		'timestamp' INTEGER NOT NULL DEFAULT 0,
+		'created' INTEGER NOT NULL
+	)`,
+		`CREATE INDEX IF NOT EXISTS 'idx_poe_proofs_owner' ON 'poe_proofs' ('owner', 'created')`,
+	} {
+		if _, err := tx.Exec(sqlstr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const proofColumns = `hash, user_id, owner, name, file, chaincode, txid, status, height, block, block_hash, timestamp, created`
+
+// Proof is a document hash registered in the poe chaincode.
+type Proof struct {
+	Hash   string `json:"hash"`
+	UserID string `json:"-"`
+	Owner  string `json:"owner"`
+	Name   string `json:"name,omitempty"`
+	// the path in the storage driver which the hash is computed from.
+	File string `json:"file,omitempty"`
+
+	Chaincode string `json:"chaincode,omitempty"`
+	Txid      string `json:"txid,omitempty"`
+	Status    string `json:"status,omitempty"`
+	// the blockchain height when the tx was sent, the tx is looked up from it.
+	Height    uint64 `json:"-"`
+	Block     uint64 `json:"block,omitempty"`
+	BlockHash string `json:"block_hash,omitempty"`
+	// unix seconds of the registering tx.
+	Timestamp int64 `json:"timestamp,omitempty"`
+	Created   int64 `json:"created,omitempty"`
+}
+
+// NormalizeHash checks the hex hash of a document, returns it in lower case.
+func NormalizeHash(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	bs, err := hex.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid hash, %s", err)
+	}
+	if len(bs) < 16 || len(bs) > 64 {
+		return "", fmt.Errorf("invalid hash of %d bytes", len(bs))
+	}
+	return s, nil
+}
+
+// HashReader returns the hex sha256 of r.
+func HashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Record saves the proof registered by the farmer, ErrExists if the hash is registered.
+func Record(db *sql.DB, p *Proof) error {
+	if p.Status == "" {
+		p.Status = StatusPending
+	}
+	if p.Created == 0 {
+		p.Created = time.Now().Unix()
+	}
+
+	_, err := db.Exec(`INSERT INTO poe_proofs (`+proofColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.Hash, p.UserID, p.Owner, p.Name, p.File, p.Chaincode, p.Txid, p.Status,
+		p.Height, p.Block, p.BlockHash, p.Timestamp, p.Created)
+	if err != nil {
+		if _, gerr := Get(db, p.Hash); gerr == nil {
+			return ErrExists
+		}
+		logger.Errorf("record proof %s failed, %s", p.Hash, err)
+	}
+	return err
+}
+
+// Commit marks the proof of hash committed in the block.
+func Commit(db *sql.DB, hash string, block uint64, blockHash string, timestamp int64) error {
+	_, err := db.Exec(`UPDATE poe_proofs SET status = ?, block = ?, block_hash = ?, timestamp = ? WHERE hash = ?`,
+		StatusCommitted, block, blockHash, timestamp, hash)
+	return err
+}
+
+// Scanned saves the height which the tx of the pending proof is looked up from next time.
+func Scanned(db *sql.DB, hash string, height uint64) error {
+	_, err := db.Exec(`UPDATE poe_proofs SET height = ? WHERE hash = ? AND status = ?`, height, hash, StatusPending)
+	return err
+}
+
+// Get returns the proof of hash registered by the farmer, sql.ErrNoRows if not.
+func Get(db *sql.DB, hash string) (*Proof, error) {
+	return scanProof(db.QueryRow(`SELECT `+proofColumns+` FROM poe_proofs WHERE hash = ?`, hash))
+}
+
+// List returns the proofs of owner, the latest first, and the count of them.
+func List(db *sql.DB, owner string, limit, offset int) ([]*Proof, int, error) {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM poe_proofs WHERE owner = ?`, owner).Scan(&count); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`SELECT `+proofColumns+` FROM poe_proofs WHERE owner = ? ORDER BY created DESC, rowid DESC LIMIT ? OFFSET ?`,
+		owner, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	ps := []*Proof{}
+	for rows.Next() {
+		p, err := scanProof(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, count, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProof(row rowScanner) (*Proof, error) {
+	p := &Proof{}
+	if err := row.Scan(&p.Hash, &p.UserID, &p.Owner, &p.Name, &p.File, &p.Chaincode, &p.Txid, &p.Status,
+		&p.Height, &p.Block, &p.BlockHash, &p.Timestamp, &p.Created); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// BlockSource is the committed blocks of the peer.
+type BlockSource interface {
+	Height() (uint64, error)
+	Block(n uint64) (*pb.Block, error)
+}
+
+// FindTx looks up txid in the blocks from the number. returns the block and its number if committed,
+// and the number to look up from next time.
+func FindTx(src BlockSource, txid string, from uint64) (*pb.Block, uint64, uint64, error) {
+	height, err := src.Height()
+	if err != nil {
+		return nil, 0, from, err
+	}
+
+	for n := from; n < height; n++ {
+		block, err := src.Block(n)
+		if err != nil {
+			return nil, 0, n, err
+		}
+		if txOf(block, txid) != nil {
+			return block, n, n + 1, nil
+		}
+	}
+	return nil, 0, height, nil
+}
+
+func txTime(tx *pb.Transaction) int64 {
+	if tx.Timestamp == nil {
+		return 0
+	}
+	return tx.Timestamp.Seconds
+}
+
+func txOf(block *pb.Block, txid string) *pb.Transaction {
+	for _, tx := range block.GetTransactions() {
+		if tx.Txid == txid {
+			return tx
+		}
+	}
+	return nil
+}
+
+// Receipt is the self-contained proof of a document hash, verified by the block which commits
+// the registering tx without asking the peer.
+type Receipt struct {
+	Hash      string `json:"hash"`
+	Owner     string `json:"owner"`
+	Chaincode string `json:"chaincode"`
+	Txid      string `json:"txid"`
+	Timestamp int64  `json:"timestamp"`
+
+	BlockNumber       uint64 `json:"block_number"`
+	BlockHash         string `json:"block_hash"`
+	PreviousBlockHash string `json:"previous_block_hash"`
+	StateHash         string `json:"state_hash"`
+	// the serialized block without the non-hash data, which hashes to BlockHash.
+	Block []byte `json:"block"`
+}
+
+// NewReceipt returns the receipt of p, which is committed in the block of the number.
+func NewReceipt(p *Proof, block *pb.Block, number uint64) (*Receipt, error) {
+	tx := txOf(block, p.Txid)
+	if tx == nil {
+		return nil, fmt.Errorf("tx %s is not in block %d", p.Txid, number)
+	}
+
+	cp := *block
+	cp.NonHashData = nil
+	bs, err := proto.Marshal(&cp)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := cp.GetHash()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Receipt{
+		Hash:              p.Hash,
+		Owner:             p.Owner,
+		Chaincode:         p.Chaincode,
+		Txid:              p.Txid,
+		Timestamp:         txTime(tx),
+		BlockNumber:       number,
+		BlockHash:         hex.EncodeToString(hash),
+		PreviousBlockHash: hex.EncodeToString(block.PreviousBlockHash),
+		StateHash:         hex.EncodeToString(block.StateHash),
+		Block:             bs,
+	}, nil
+}
+
+// VerifyReceipt checks that the block of r hashes to its block hash, and commits the public tx of
+// the chaincode which registers the hash of r to its owner. a confidential tx can not be checked.
+func VerifyReceipt(r *Receipt, chaincode string) error {
+	if chaincode == "" {
+		return fmt.Errorf("poe chaincode is not deployed")
+	}
+	if r.Chaincode != chaincode {
+		return fmt.Errorf("chaincode mismatch")
+	}
+
+	block := &pb.Block{}
+	if err := proto.Unmarshal(r.Block, block); err != nil {
+		return fmt.Errorf("invalid block, %s", err)
+	}
+	hash, err := block.GetHash()
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash) != strings.ToLower(r.BlockHash) {
+		return fmt.Errorf("block hash mismatch")
+	}
+	if hex.EncodeToString(block.PreviousBlockHash) != strings.ToLower(r.PreviousBlockHash) ||
+		hex.EncodeToString(block.StateHash) != strings.ToLower(r.StateHash) {
+		return fmt.Errorf("block header mismatch")
+	}
+
+	tx := txOf(block, r.Txid)
+	if tx == nil {
+		return fmt.Errorf("tx %s is not in the block", r.Txid)
+	}
+	if txTime(tx) != r.Timestamp {
+		return fmt.Errorf("timestamp mismatch")
+	}
+	if tx.ConfidentialityLevel != pb.ConfidentialityLevel_PUBLIC {
+		return fmt.Errorf("the confidential tx can not be verified")
+	}
+
+	spec := &pb.ChaincodeInvocationSpec{}
+	if err := proto.Unmarshal(tx.Payload, spec); err != nil {
+		return fmt.Errorf("invalid tx payload, %s", err)
+	}
+	cs := spec.GetChaincodeSpec()
+	if cs == nil || cs.ChaincodeID == nil || cs.CtorMsg == nil {
+		return fmt.Errorf("invalid tx payload")
+	}
+	if cs.ChaincodeID.Name != chaincode {
+		return fmt.Errorf("chaincode mismatch")
+	}
+	args := cs.CtorMsg.Args
+	if len(args) < 3 || string(args[0]) != FuncRegister ||
+		!bytes.Equal(bytes.ToLower(args[1]), []byte(strings.ToLower(r.Hash))) || string(args[2]) != r.Owner {
+		return fmt.Errorf("the tx does not register %s to %s", r.Hash, r.Owner)
+	}
+	return nil
+}
+
+// MatchBlock checks that the block hash of r is the one of the block of its number in src,
+// ErrBlockMismatch if not. the errors of src are returned as is.
+func MatchBlock(src BlockSource, r *Receipt) error {
+	height, err := src.Height()
+	if err != nil {
+		return err
+	}
+	if r.BlockNumber >= height {
+		return fmt.Errorf("block %d is not committed, %w", r.BlockNumber, ErrBlockMismatch)
+	}
+	block, err := src.Block(r.BlockNumber)
+	if err != nil {
+		return err
+	}
+	hash, err := block.GetHash()
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash) != strings.ToLower(r.BlockHash) {
+		return ErrBlockMismatch
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package poe
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	pb "github.com/hyperledger/fabric/protos"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type mockBlocks []*pb.Block
+
+func (m mockBlocks) Height() (uint64, error)           { return uint64(len(m)), nil }
+func (m mockBlocks) Block(n uint64) (*pb.Block, error) { return m[n], nil }
+
+func TestProofs(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db failed, %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, Schema); err != nil {
+		t.Fatalf("migrate failed, %s", err)
+	}
+
+	hash, err := HashReader(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, err := NormalizeHash(strings.ToUpper(hash)); err != nil || h != hash {
+		t.Errorf("expect %s, got %s %v", hash, h, err)
+	}
+	if _, err := NormalizeHash("abcd"); err == nil {
+		t.Errorf("expect error of a short hash")
+	}
+
+	p := &Proof{Hash: hash, UserID: "u1", Owner: "u1", Chaincode: "cc", Txid: "tx1"}
+	if err := Record(db, p); err != nil {
+		t.Fatalf("record failed, %s", err)
+	}
+	if err := Record(db, &Proof{Hash: hash, UserID: "u2", Owner: "u2", Chaincode: "cc", Txid: "tx2"}); err != ErrExists {
+		t.Errorf("expect ErrExists, got %v", err)
+	}
+	Record(db, &Proof{Hash: strings.Repeat("ab", 32), UserID: "u2", Owner: "u2", Chaincode: "cc", Txid: "tx3"})
+
+	if err := Commit(db, hash, 3, "beef", 100); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Get(db, hash)
+	if err != nil || got.Status != StatusCommitted || got.Block != 3 || got.Txid != "tx1" {
+		t.Errorf("unexpected proof %+v %v", got, err)
+	}
+	ps, count, err := List(db, "u1", 10, 0)
+	if err != nil || count != 1 || len(ps) != 1 || ps[0].Hash != hash {
+		t.Errorf("unexpected proofs %+v %v %v", ps, count, err)
+	}
+}
+
+func TestReceipt(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	payload, _ := proto.Marshal(&pb.ChaincodeInvocationSpec{ChaincodeSpec: &pb.ChaincodeSpec{
+		ChaincodeID: &pb.ChaincodeID{Name: "cc"},
+		CtorMsg:     &pb.ChaincodeInput{Args: [][]byte{[]byte(FuncRegister), []byte(hash), []byte("u1"), []byte("doc")}},
+	}})
+	blocks := mockBlocks{
+		{},
+		{
+			PreviousBlockHash: []byte{1},
+			StateHash:         []byte{2},
+			Transactions: []*pb.Transaction{
+				{Txid: "tx0"},
+				{Txid: "tx1", Payload: payload, Timestamp: &timestamp.Timestamp{Seconds: 100}},
+			},
+			NonHashData: &pb.NonHashData{LocalLedgerCommitTimestamp: &timestamp.Timestamp{Seconds: 101}},
+		},
+	}
+
+	block, n, next, err := FindTx(blocks, "tx1", 0)
+	if err != nil || block == nil || n != 1 || next != 2 {
+		t.Fatalf("expect tx1 in block 1, got %v %v %v", n, next, err)
+	}
+
+	p := &Proof{Hash: hash, Owner: "u1", Chaincode: "cc", Txid: "tx1"}
+	r, err := NewReceipt(p, block, n)
+	if err != nil {
+		t.Fatalf("new receipt failed, %s", err)
+	}
+	if r.Timestamp != 100 || r.BlockNumber != 1 {
+		t.Errorf("unexpected receipt %+v", r)
+	}
+	if err := VerifyReceipt(r, "cc"); err != nil {
+		t.Errorf("verify receipt failed, %s", err)
+	}
+	if err := MatchBlock(blocks, r); err != nil {
+		t.Errorf("match block failed, %s", err)
+	}
+	if err := VerifyReceipt(r, ""); err == nil {
+		t.Errorf("expect error of no poe chaincode")
+	}
+	if err := VerifyReceipt(r, "other"); err == nil {
+		t.Errorf("expect error of another chaincode")
+	}
+
+	forged := *r
+	forged.Owner = "u2"
+	if err := VerifyReceipt(&forged, "cc"); err == nil {
+		t.Errorf("expect error of a forged owner")
+	}
+	forged = *r
+	forged.Chaincode = ""
+	if err := VerifyReceipt(&forged, "cc"); err == nil {
+		t.Errorf("expect error of an empty chaincode")
+	}
+	forged = *r
+	forged.BlockHash = strings.Repeat("00", 64)
+	if err := VerifyReceipt(&forged, "cc"); err == nil {
+		t.Errorf("expect error of a forged block hash")
+	}
+
+	// a self-consistent block which is not in the chain.
+	other := *block
+	other.StateHash = []byte{3}
+	forged = *r
+	forged.StateHash = "03"
+	forged.Block, _ = proto.Marshal(&other)
+	bh, _ := other.GetHash()
+	forged.BlockHash = hex.EncodeToString(bh)
+	if err := VerifyReceipt(&forged, "cc"); err != nil {
+		t.Errorf("verify receipt failed, %s", err)
+	}
+	if err := MatchBlock(blocks, &forged); err != ErrBlockMismatch {
+		t.Errorf("expect ErrBlockMismatch, got %v", err)
+	}
+	forged.BlockNumber = 2
+	if err := MatchBlock(blocks, &forged); !errors.Is(err, ErrBlockMismatch) {
+		t.Errorf("expect ErrBlockMismatch, got %v", err)
+	}
+
+	confidential := *block
+	confidential.Transactions = []*pb.Transaction{
+		{Txid: "tx1", Payload: payload, Timestamp: &timestamp.Timestamp{Seconds: 100}, ConfidentialityLevel: pb.ConfidentialityLevel_CONFIDENTIAL},
+	}
+	if r, err = NewReceipt(p, &confidential, n); err != nil {
+		t.Fatalf("new receipt failed, %s", err)
+	}
+	if err := VerifyReceipt(r, "cc"); err == nil {
+		t.Errorf("expect error of a confidential tx")
+	}
+}
@@ -0,0 +1,194 @@
+// Package quota is the storage used by the users of the farmer and their quotas, kept in farmer.db.
+package quota
+
+import (
+	"database/sql"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/farmer/migrate"
+)
+
+var ErrExceeded = errors.New("storage quota is exceeded")
+
+// Schema is the migrations of the storage quotas in farmer.db.
+var Schema = &migrate.Schema{
+	Name: "quota",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create storage files and quotas", Up: createTables},
+	},
+}
+
+func createTables(tx *sql.Tx) error {
+	for _, stmt := range []string{`
+	CREATE TABLE IF NOT EXISTS 'storage_files' (
+		'path' VARCHAR(1024) PRIMARY KEY,
+		'user_id' VARCHAR(64) NOT NULL,
+		'size' INTEGER NOT NULL,
+		'updated' INTEGER NOT NULL
+	)`,
+		`CREATE INDEX IF NOT EXISTS 'IDX_storage_files_user_id' ON 'storage_files' ('user_id')`,
+		`
+	CREATE TABLE IF NOT EXISTS 'storage_quotas' (
+		'user_id' VARCHAR(64) PRIMARY KEY,
+		'bytes' INTEGER NOT NULL
+	)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Usage is the storage used by a user.
+type Usage struct {
+	UserID string `json:"user_id"`
+	// bytes of the files written by the user.
+	Used  int64 `json:"used"`
+	Files int64 `json:"files"`
+	// bytes, 0 is unlimited.
+	Quota int64 `json:"quota"`
+	// the quota is set for the user, rather than the default one.
+	Custom bool `json:"custom"`
+}
+
+// Available returns the bytes the user may write more, -1 if unlimited.
+func (u *Usage) Available() int64 {
+	if u.Quota <= 0 {
+		return -1
+	}
+	if u.Used >= u.Quota {
+		return 0
+	}
+	return u.Quota - u.Used
+}
+
+// Clean returns the path of the file in the table, e.g. /a/b.
+func Clean(p string) string {
+	return path.Clean("/" + strings.TrimPrefix(p, "/"))
+}
+
+// Get returns the usage of the user, the quota is defaultQuota unless it is set for the user.
+func Get(db *sql.DB, userID string, defaultQuota int64) (*Usage, error) {
+	u := &Usage{UserID: userID, Quota: defaultQuota}
+	err := db.QueryRow(`SELECT COUNT(*), IFNULL(SUM(size), 0) FROM storage_files WHERE user_id = ?`, userID).
+		Scan(&u.Files, &u.Used)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow(`SELECT bytes FROM storage_quotas WHERE user_id = ?`, userID).Scan(&u.Quota)
+	switch err {
+	case nil:
+		u.Custom = true
+	case sql.ErrNoRows:
+	default:
+		return nil, err
+	}
+	return u, nil
+}
+
+// List returns the usages of the users who have files or a quota.
+func List(db *sql.DB, defaultQuota int64) ([]*Usage, error) {
+	rows, err := db.Query(`
+	SELECT user_id FROM storage_files
+	UNION
+	SELECT user_id FROM storage_quotas
+	ORDER BY user_id`)
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ret := make([]*Usage, 0, len(ids))
+	for _, id := range ids {
+		u, err := Get(db, id, defaultQuota)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, u)
+	}
+	return ret, nil
+}
+
+// SetQuota sets the quota of the user, a negative one drops it, then the default one is used.
+func SetQuota(db *sql.DB, userID string, bytes int64) error {
+	if bytes < 0 {
+		_, err := db.Exec(`DELETE FROM storage_quotas WHERE user_id = ?`, userID)
+		return err
+	}
+	_, err := db.Exec(`INSERT OR REPLACE INTO storage_quotas (user_id, bytes) VALUES (?, ?)`, userID, bytes)
+	return err
+}
+
+// File returns the owner and the recorded size of the file, "" and 0 if it is not recorded.
+func File(db *sql.DB, p string) (userID string, size int64, err error) {
+	err = db.QueryRow(`SELECT user_id, size FROM storage_files WHERE path = ?`, Clean(p)).Scan(&userID, &size)
+	if err == sql.ErrNoRows {
+		return "", 0, nil
+	}
+	return userID, size, err
+}
+
+// Record records the file is written by the user, the user becomes the owner if another one wrote it.
+func Record(db *sql.DB, userID, p string, size int64) error {
+	_, err := db.Exec(`INSERT OR REPLACE INTO storage_files (path, user_id, size, updated) VALUES (?, ?, ?, ?)`,
+		Clean(p), userID, size, time.Now().Unix())
+	return err
+}
+
+// Remove drops the file, or the files in the directory.
+func Remove(db *sql.DB, p string) error {
+	p = Clean(p)
+	_, err := db.Exec(`DELETE FROM storage_files WHERE path = ? OR instr(path, ?) = 1`, p, dirPrefix(p))
+	return err
+}
+
+// Move moves the file, or the files in the directory.
+func Move(db *sql.DB, src, dst string) error {
+	src, dst = Clean(src), Clean(dst)
+	if src == dst {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the moved files replace the ones at dst.
+	if _, err := tx.Exec(`DELETE FROM storage_files WHERE path = ? OR instr(path, ?) = 1`, dst, dirPrefix(dst)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE storage_files SET path = ? WHERE path = ?`, dst, src); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE storage_files SET path = ?1 || substr(path, length(?2) + 1) WHERE instr(path, ?2) = 1`,
+		dirPrefix(dst), dirPrefix(src)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func dirPrefix(p string) string {
+	if p == "/" {
+		return p
+	}
+	return p + "/"
+}
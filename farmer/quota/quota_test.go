@@ -0,0 +1,86 @@
+package quota
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/hyperledger/fabric/farmer/migrate"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db failed, %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, Schema); err != nil {
+		t.Fatalf("migrate failed, %s", err)
+	}
+	return db
+}
+
+func usage(t *testing.T, db *sql.DB, user string) *Usage {
+	u, err := Get(db, user, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestQuota(t *testing.T) {
+	db := openDB(t)
+
+	for p, size := range map[string]int64{"/a": 10, "docs/b": 20, "/docs/c/d": 30, "/docsx": 5, "/文档/e": 1} {
+		if err := Record(db, "alice", p, size); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if u := usage(t, db, "alice"); u.Used != 66 || u.Files != 5 || u.Quota != 100 || u.Available() != 34 {
+		t.Errorf("usage %+v", u)
+	}
+
+	// bob overwrites a, and owns it.
+	Record(db, "bob", "/a", 15)
+	if u := usage(t, db, "bob"); u.Used != 15 || u.Files != 1 {
+		t.Errorf("usage of bob %+v", u)
+	}
+	if owner, n, _ := File(db, "a"); owner != "bob" || n != 15 {
+		t.Errorf("a is %s %d", owner, n)
+	}
+
+	if err := Move(db, "/docs", "/archive/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, n, _ := File(db, "/archive/docs/c/d"); n != 30 {
+		t.Errorf("d is not moved")
+	}
+	if _, n, _ := File(db, "/docsx"); n != 5 {
+		t.Errorf("docsx should not be moved")
+	}
+	Move(db, "/文档", "/文")
+	if _, n, _ := File(db, "/文/e"); n != 1 {
+		t.Errorf("e is not moved")
+	}
+
+	if err := Remove(db, "/archive"); err != nil {
+		t.Fatal(err)
+	}
+	if u := usage(t, db, "alice"); u.Used != 6 || u.Files != 2 {
+		t.Errorf("usage after remove %+v", u)
+	}
+
+	SetQuota(db, "alice", 5)
+	if u := usage(t, db, "alice"); u.Quota != 5 || !u.Custom || u.Available() != 0 {
+		t.Errorf("custom quota %+v", u)
+	}
+	SetQuota(db, "carol", 0)
+	us, err := List(db, 100)
+	if err != nil || len(us) != 3 || us[2].UserID != "carol" || us[2].Available() != -1 {
+		t.Errorf("list %v", err)
+	}
+	SetQuota(db, "alice", -1)
+	if u := usage(t, db, "alice"); u.Quota != 100 || u.Custom {
+		t.Errorf("dropped quota %+v", u)
+	}
+}
@@ -0,0 +1,110 @@
+// Package ratelimit is the token buckets of the api, one bucket per client key.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// the buckets are swept when there are more of them, the full ones are dropped.
+const sweepSize = 4096
+
+// Limit is Rate tokens per second, at most Burst of them are saved. the zero Rate is unlimited.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Unlimited tells whether every request is allowed.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is the buckets of a Limit keyed by the clients.
+type Limiter struct {
+	limit Limit
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// for the tests.
+	now func() time.Time
+}
+
+// New returns the limiter of l, the buckets are full at first.
+func New(l Limit) *Limiter {
+	return &Limiter{limit: l, buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// Limit returns the limit of l.
+func (l *Limiter) Limit() Limit {
+	return l.limit
+}
+
+// Allow takes a token from the bucket of key. if there is none, it returns false and how long until
+// the next token.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l.limit.Unlimited() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= sweepSize {
+			l.sweep(now)
+		}
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration(math.Ceil((1 - b.tokens) / l.limit.Rate * float64(time.Second)))
+	return false, wait
+}
+
+// Remaining returns the tokens left in the bucket of key.
+func (l *Limiter) Remaining(key string) int {
+	if l.limit.Unlimited() {
+		return math.MaxInt32
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return l.limit.Burst
+	}
+	l.refill(b, l.now())
+	return int(b.tokens)
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(l.limit.Burst), b.tokens+elapsed*l.limit.Rate)
+		b.last = now
+	}
+}
+
+// sweep drops the full buckets, they are the same as the new ones.
+func (l *Limiter) sweep(now time.Time) {
+	for k, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.limit.Burst) {
+			delete(l.buckets, k)
+		}
+	}
+}
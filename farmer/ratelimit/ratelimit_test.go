@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(Limit{Rate: 0.5, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d of the burst is refused", i)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != 2*time.Second {
+		t.Errorf("expect refused and wait 2s, %v %s", ok, wait)
+	}
+	// the buckets are per key.
+	if ok, _ := l.Allow("b"); !ok {
+		t.Errorf("b is refused")
+	}
+
+	now = now.Add(time.Second)
+	if ok, wait := l.Allow("a"); ok || wait != time.Second {
+		t.Errorf("expect refused and wait 1s, %v %s", ok, wait)
+	}
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Errorf("a token is refilled after 2s")
+	}
+
+	// at most burst tokens are saved.
+	now = now.Add(time.Hour)
+	if n := l.Remaining("a"); n != 2 {
+		t.Errorf("remaining %d, expect 2", n)
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	l := New(Limit{})
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("unlimited refuses")
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(Limit{Rate: 1, Burst: 1})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < sweepSize; i++ {
+		l.Allow(fmt.Sprint(i))
+	}
+	now = now.Add(time.Second)
+	l.Allow("new")
+	if len(l.buckets) != 1 {
+		t.Errorf("the full buckets should be swept, %d left", len(l.buckets))
+	}
+}
@@ -0,0 +1,204 @@
+package registry
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/farmer/migrate"
+	pb "github.com/hyperledger/fabric/protos"
+	"github.com/op/go-logging"
+)
+
+// deploy status of a chaincode alias.
+const (
+	StatusRegistered = "registered"
+	// deployed, the deploy tx is not committed or the chaincode does not answer yet.
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+var logger = logging.MustGetLogger("registry")
+
+// Schema is the migrations of the chaincode registry in farmer.db.
+var Schema = &migrate.Schema{
+	Name: "registry",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create chaincode registry", Up: createTables},
+		{Version: 2, Name: "track deploy tx of chaincodes", Up: addDeployTx},
+	},
+}
+
+func createTables(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS 'chaincodes' (
+		'alias' VARCHAR(64) PRIMARY KEY,
+		'path' VARCHAR(256) NOT NULL,
+		'name' VARCHAR(256) NOT NULL DEFAULT '',
+		'version' VARCHAR(64) NOT NULL DEFAULT '',
+		'language' VARCHAR(16) NOT NULL DEFAULT '',
+		'function' VARCHAR(64) NOT NULL DEFAULT '',
+		'args' TEXT NOT NULL DEFAULT '[]',
+		'status' VARCHAR(16) NOT NULL,
+		'error' VARCHAR(256) NOT NULL DEFAULT '',
+		'deploy_height' INTEGER NOT NULL DEFAULT 0,
+		'deployed' INTEGER NOT NULL DEFAULT 0,
+		'ready' INTEGER NOT NULL DEFAULT 0,
+		'updated' INTEGER NOT NULL
+	)`)
+	return err
+}
+
+func addDeployTx(tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`ALTER TABLE chaincodes ADD COLUMN 'txid' VARCHAR(256) NOT NULL DEFAULT ''`,
+		`ALTER TABLE chaincodes ADD COLUMN 'block' INTEGER NOT NULL DEFAULT 0`,
+		`UPDATE chaincodes SET status = 'pending', txid = name WHERE status = 'deploying'`,
+		`UPDATE chaincodes SET txid = name WHERE status = 'ready'`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const columns = `alias, path, name, version, language, function, args, status, error, txid, block, deploy_height, deployed, ready, updated`
+
+// Chaincode is the chaincode deployed for an alias.
+type Chaincode struct {
+	Alias    string `json:"alias"`
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Language string `json:"language"`
+	// the init function and args of the deploy.
+	Function string   `json:"function"`
+	Args     []string `json:"args"`
+
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// the deploy tx, and the number of the block which commits it, 0 if not committed.
+	Txid  string `json:"txid"`
+	Block uint64 `json:"block"`
+	// the blockchain height when the deploy was sent, the deploy tx is looked up from it.
+	DeployHeight uint64 `json:"deploy_height"`
+	Deployed     int64  `json:"deployed"`
+	Ready        int64  `json:"ready"`
+	Updated      int64  `json:"updated"`
+}
+
+// Ensure saves c if its alias is not registered.
+func Ensure(db *sql.DB, c *Chaincode) error {
+	return save(db, `INSERT OR IGNORE`, c)
+}
+
+// Save saves c, replaces the registered alias.
+func Save(db *sql.DB, c *Chaincode) error {
+	return save(db, `INSERT OR REPLACE`, c)
+}
+
+func save(db *sql.DB, insert string, c *Chaincode) error {
+	if c.Status == "" {
+		c.Status = StatusRegistered
+	}
+	if c.Args == nil {
+		c.Args = []string{}
+	}
+	args, err := json.Marshal(c.Args)
+	if err != nil {
+		return err
+	}
+	c.Updated = time.Now().Unix()
+
+	_, err = db.Exec(insert+` INTO chaincodes (`+columns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.Alias, c.Path, c.Name, c.Version, c.Language, c.Function, string(args), c.Status, c.Error,
+		c.Txid, c.Block, c.DeployHeight, c.Deployed, c.Ready, c.Updated)
+	if err != nil {
+		logger.Errorf("save chaincode %s failed, %s", c.Alias, err)
+	}
+	return err
+}
+
+// Get returns the chaincode of alias, sql.ErrNoRows if not registered.
+func Get(db *sql.DB, alias string) (*Chaincode, error) {
+	return scan(db.QueryRow(`SELECT `+columns+` FROM chaincodes WHERE alias = ?`, alias))
+}
+
+// List returns the registered chaincodes by alias.
+func List(db *sql.DB) ([]*Chaincode, error) {
+	rows, err := db.Query(`SELECT ` + columns + ` FROM chaincodes ORDER BY alias`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ccs := []*Chaincode{}
+	for rows.Next() {
+		c, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		ccs = append(ccs, c)
+	}
+	return ccs, rows.Err()
+}
+
+// Remove unregisters alias, sql.ErrNoRows if not registered.
+func Remove(db *sql.DB, alias string) error {
+	ret, err := db.Exec(`DELETE FROM chaincodes WHERE alias = ?`, alias)
+	if err != nil {
+		return err
+	}
+	if n, _ := ret.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scan(row rowScanner) (*Chaincode, error) {
+	c := &Chaincode{}
+	var args string
+	if err := row.Scan(&c.Alias, &c.Path, &c.Name, &c.Version, &c.Language, &c.Function, &args, &c.Status, &c.Error,
+		&c.Txid, &c.Block, &c.DeployHeight, &c.Deployed, &c.Ready, &c.Updated); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(args), &c.Args); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// BlockSource is the committed blocks of the peer.
+type BlockSource interface {
+	Height() (uint64, error)
+	Block(n uint64) (*pb.Block, error)
+}
+
+// FindDeploy looks up the deploy tx of txid, which is the chaincode name, in the blocks from the number.
+// returns whether it is committed, and the number to look up from next time, which follows the
+// block of the tx if committed.
+func FindDeploy(src BlockSource, txid string, from uint64) (bool, uint64, error) {
+	height, err := src.Height()
+	if err != nil {
+		return false, from, err
+	}
+
+	for n := from; n < height; n++ {
+		block, err := src.Block(n)
+		if err != nil {
+			return false, n, err
+		}
+		for _, tx := range block.GetTransactions() {
+			if tx.Type == pb.Transaction_CHAINCODE_DEPLOY && tx.Txid == txid {
+				return true, n + 1, nil
+			}
+		}
+	}
+	return false, height, nil
+}
@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/hyperledger/fabric/farmer/migrate"
+	pb "github.com/hyperledger/fabric/protos"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type mockBlocks []*pb.Block
+
+func (m mockBlocks) Height() (uint64, error)           { return uint64(len(m)), nil }
+func (m mockBlocks) Block(n uint64) (*pb.Block, error) { return m[n], nil }
+
+func TestRegistry(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db failed, %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, Schema); err != nil {
+		t.Fatalf("migrate failed, %s", err)
+	}
+
+	if err := Ensure(db, &Chaincode{Alias: "lepuscoin", Path: "a/lepuscoin", Function: "deploy"}); err != nil {
+		t.Fatalf("ensure failed, %s", err)
+	}
+	if err := Save(db, &Chaincode{Alias: "lepuscoin", Path: "a/lepuscoin", Name: "abc", Txid: "abc", Block: 7, Status: StatusReady, Args: []string{"x"}}); err != nil {
+		t.Fatalf("save failed, %s", err)
+	}
+	// the deployed is kept.
+	Ensure(db, &Chaincode{Alias: "lepuscoin", Path: "a/lepuscoin"})
+	Ensure(db, &Chaincode{Alias: "poe", Path: "a/poe"})
+
+	c, err := Get(db, "lepuscoin")
+	if err != nil || c.Name != "abc" || c.Status != StatusReady || c.Block != 7 || len(c.Args) != 1 {
+		t.Errorf("unexpected chaincode %+v %v", c, err)
+	}
+	ccs, err := List(db)
+	if err != nil || len(ccs) != 2 || ccs[1].Alias != "poe" || ccs[1].Status != StatusRegistered {
+		t.Errorf("unexpected chaincodes %+v %v", ccs, err)
+	}
+
+	if err := Remove(db, "poe"); err != nil {
+		t.Errorf("remove failed, %s", err)
+	}
+	if err := Remove(db, "poe"); err != sql.ErrNoRows {
+		t.Errorf("expect ErrNoRows, got %v", err)
+	}
+}
+
+func TestFindDeploy(t *testing.T) {
+	blocks := mockBlocks{
+		{},
+		{Transactions: []*pb.Transaction{{Type: pb.Transaction_CHAINCODE_INVOKE, Txid: "abc"}}},
+		{Transactions: []*pb.Transaction{{Type: pb.Transaction_CHAINCODE_DEPLOY, Txid: "abc"}}},
+	}
+
+	found, next, err := FindDeploy(blocks[:2], "abc", 0)
+	if err != nil || found || next != 2 {
+		t.Errorf("expect not found up to 2, got %v %v %v", found, next, err)
+	}
+	found, next, err = FindDeploy(blocks, "abc", next)
+	if err != nil || !found || next != 3 {
+		t.Errorf("expect found in 2, got %v %v %v", found, next, err)
+	}
+}
@@ -0,0 +1,232 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/farmer/migrate"
+	"github.com/op/go-logging"
+)
+
+var (
+	logger = logging.MustGetLogger("session")
+
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpired      = errors.New("token is expired")
+	ErrRevoked      = errors.New("token is revoked")
+)
+
+// Schema is the migrations of the login sessions in farmer.db.
+var Schema = &migrate.Schema{
+	Name: "sessions",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create sessions", Up: createTables},
+	},
+}
+
+func createTables(tx *sql.Tx) error {
+	for _, sqlstr := range []string{`
+	CREATE TABLE IF NOT EXISTS 'sessions' (
+		'id' VARCHAR(32) PRIMARY KEY,
+		'user_id' VARCHAR(64) NOT NULL,
+		'created' INTEGER NOT NULL,
+		'expires' INTEGER NOT NULL,
+		'revoked' INTEGER NOT NULL DEFAULT 0,
+		'agent' VARCHAR(256) NOT NULL DEFAULT ''
+	)`,
+		`CREATE INDEX IF NOT EXISTS 'idx_sessions_user' ON 'sessions' ('user_id')`, `
+	CREATE TABLE IF NOT EXISTS 'session_keys' (
+		'id' INTEGER PRIMARY KEY,
+		'secret' BLOB NOT NULL
+	)`,
+	} {
+		if _, err := tx.Exec(sqlstr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Session is a login of an user, the token of it is signed by the key of the daemon.
+type Session struct {
+	ID      string    `json:"id"`
+	UserID  string    `json:"user_id"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+	Revoked bool      `json:"revoked"`
+	Agent   string    `json:"agent"`
+}
+
+// Manager issues and verifies the tokens of the sessions in db.
+type Manager struct {
+	db  *sql.DB
+	key []byte
+	ttl time.Duration
+}
+
+// NewManager loads the signing key from db, it is generated at the first time.
+func NewManager(db *sql.DB, ttl time.Duration) (*Manager, error) {
+	var key []byte
+	err := db.QueryRow(`SELECT secret FROM session_keys WHERE id = 1`).Scan(&key)
+	if err == sql.ErrNoRows {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec(`INSERT INTO session_keys (id, secret) VALUES (1, ?)`, key); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		logger.Errorf("load session key failed, %s", err)
+		return nil, err
+	}
+	return &Manager{db: db, key: key, ttl: ttl}, nil
+}
+
+func (m *Manager) sign(payload string) string {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Issue starts a session of userID, returns it and its token in the form id.expires.signature.
+func (m *Manager) Issue(userID, agent string) (*Session, string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	s := &Session{
+		ID:      hex.EncodeToString(id),
+		UserID:  userID,
+		Created: now,
+		Expires: now.Add(m.ttl),
+		Agent:   agent,
+	}
+	if _, err := m.db.Exec(`INSERT INTO sessions (id, user_id, created, expires, agent) VALUES (?, ?, ?, ?, ?)`,
+		s.ID, s.UserID, s.Created.Unix(), s.Expires.Unix(), s.Agent); err != nil {
+		logger.Errorf("save session of %s failed, %s", userID, err)
+		return nil, "", err
+	}
+
+	// the expired are kept a while to tell ErrExpired from ErrInvalidToken.
+	if _, err := m.db.Exec(`DELETE FROM sessions WHERE expires < ?`, now.Add(-m.ttl).Unix()); err != nil {
+		logger.Warningf("purge expired sessions failed, %s", err)
+	}
+
+	payload := s.ID + "." + strconv.FormatInt(s.Expires.Unix(), 10)
+	return s, payload + "." + m.sign(payload), nil
+}
+
+// Verify returns the session of token if it is signed, not expired and not revoked.
+func (m *Manager) Verify(token string) (*Session, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(m.sign(payload))) {
+		return nil, ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= expires {
+		return nil, ErrExpired
+	}
+
+	s, err := m.Get(parts[0])
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.Revoked {
+		return nil, ErrRevoked
+	}
+	return s, nil
+}
+
+// Get returns the session of id.
+func (m *Manager) Get(id string) (*Session, error) {
+	return scanSession(m.db.QueryRow(`SELECT id, user_id, created, expires, revoked, agent FROM sessions WHERE id = ?`, id))
+}
+
+// List returns the active sessions of userID, the newest first.
+func (m *Manager) List(userID string) ([]*Session, error) {
+	rows, err := m.db.Query(`SELECT id, user_id, created, expires, revoked, agent FROM sessions
+	WHERE user_id = ? AND revoked = 0 AND expires > ? ORDER BY created DESC`, userID, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ss := []*Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, rows.Err()
+}
+
+// Revoke ends the session id of userID, sql.ErrNoRows if there is none.
+func (m *Manager) Revoke(userID, id string) error {
+	res, err := m.db.Exec(`UPDATE sessions SET revoked = 1 WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeUser ends all the sessions of userID, returns how many are ended.
+func (m *Manager) RevokeUser(userID string) (int64, error) {
+	res, err := m.db.Exec(`UPDATE sessions SET revoked = 1 WHERE user_id = ? AND revoked = 0`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// LastActive returns the user of the newest active session, empty if there is none.
+func LastActive(db *sql.DB) (string, error) {
+	var userID string
+	err := db.QueryRow(`SELECT user_id FROM sessions WHERE revoked = 0 AND expires > ? ORDER BY created DESC LIMIT 1`,
+		time.Now().Unix()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return userID, err
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSession(row rowScanner) (*Session, error) {
+	var (
+		s                Session
+		created, expires int64
+	)
+	if err := row.Scan(&s.ID, &s.UserID, &created, &expires, &s.Revoked, &s.Agent); err != nil {
+		return nil, err
+	}
+	s.Created, s.Expires = time.Unix(created, 0), time.Unix(expires, 0)
+	return &s, nil
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/farmer/migrate"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db failed, %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, Schema); err != nil {
+		t.Fatalf("migrate failed, %s", err)
+	}
+	return db
+}
+
+func TestSession(t *testing.T) {
+	db := openDB(t)
+	m, err := NewManager(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, token, err := m.Issue("alice", "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Verify(token)
+	if err != nil || got.ID != s.ID || got.UserID != "alice" || got.Agent != "cli" {
+		t.Fatalf("verify %+v %v", got, err)
+	}
+
+	// the key is kept in db, the tokens survive a restart.
+	m2, err := NewManager(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m2.Verify(token); err != nil {
+		t.Errorf("verify by the reloaded manager failed, %s", err)
+	}
+
+	parts := strings.Split(token, ".")
+	for _, bad := range []string{
+		"",
+		"abc",
+		parts[0] + "." + parts[1] + ".x",
+		parts[0] + ".9999999999." + parts[2],
+	} {
+		if _, err := m.Verify(bad); err != ErrInvalidToken {
+			t.Errorf("verify %q, %v, want %v", bad, err, ErrInvalidToken)
+		}
+	}
+
+	_, other, _ := m.Issue("bob", "")
+	if err := m.Revoke("bob", s.ID); err != sql.ErrNoRows {
+		t.Errorf("revoke the session of another user, %v", err)
+	}
+	if err := m.Revoke("alice", s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Verify(token); err != ErrRevoked {
+		t.Errorf("verify revoked, %v", err)
+	}
+	if _, err := m.Verify(other); err != nil {
+		t.Errorf("verify the session of bob, %v", err)
+	}
+	if user, err := LastActive(db); err != nil || user != "bob" {
+		t.Errorf("last active %s %v", user, err)
+	}
+
+	if n, err := m.RevokeUser("bob"); err != nil || n != 1 {
+		t.Errorf("revoke bob %d %v", n, err)
+	}
+	if ss, err := m.List("bob"); err != nil || len(ss) != 0 {
+		t.Errorf("sessions of bob %v %v", ss, err)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	db := openDB(t)
+	m, err := NewManager(db, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, token, err := m.Issue("alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Verify(token); err != ErrExpired {
+		t.Errorf("verify expired, %v", err)
+	}
+}
@@ -2,19 +2,90 @@ package store
 
 import (
 	"database/sql"
+	"io"
+	"os"
 	"path/filepath"
 
+	"github.com/hyperledger/fabric/farmer/migrate"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/op/go-logging"
 	"github.com/spf13/viper"
 )
 
+var logger = logging.MustGetLogger("store")
+
+// KVSchema is the migrations of farmerKV.db.
+var KVSchema = &migrate.Schema{
+	Name: "kv",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create kv", Up: createKV},
+	},
+}
+
 type KVStore struct {
 	db *sql.DB
 }
 
+// KVPath returns the path of farmerKV.db.
+func KVPath() string {
+	return filepath.Join(viper.GetString("peer.fileSystemPath"), "farmerKV.db")
+}
+
+// legacyKVPath is where the farmers before the migrations kept farmerKV.db.
+func legacyKVPath() string {
+	return filepath.Join(viper.GetString("farmer.fileSystemPath"), "farmerKV.db")
+}
+
+// moveLegacyKV moves farmerKV.db of an old farmer to KVPath, unless there is one already.
+func moveLegacyKV() error {
+	src, dst := legacyKVPath(), KVPath()
+	a, _ := filepath.Abs(src)
+	b, _ := filepath.Abs(dst)
+	if a == b {
+		return nil
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		return err
+	}
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	logger.Infof("move %s of the old farmer to %s", src, dst)
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	// another device, the old one is kept.
+	return copyFile(src, dst)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
 func NewKV() (*KVStore, error) {
-	fsPath := viper.GetString("farmer.fileSystemPath")
-	db, err := sql.Open("sqlite3", filepath.Join(fsPath, "farmerKV.db"))
+	if err := moveLegacyKV(); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", KVPath())
 	if err != nil {
 		return nil, err
 	}
@@ -30,7 +101,16 @@ func NewKV() (*KVStore, error) {
 }
 
 func (kv *KVStore) initDB() error {
-	_, err := kv.db.Exec(`
+	r := &migrate.Runner{
+		Path:   KVPath(),
+		Backup: viper.GetBool("daemon.migration.backup"),
+		Strict: true,
+	}
+	return r.Run(kv.db, KVSchema)
+}
+
+func createKV(tx *sql.Tx) error {
+	_, err := tx.Exec(`
 CREATE TABLE IF NOT EXISTS kv (
 	key VARCHAR(32) PRIMARY KEY,
 	value VARCHAR(255)
@@ -50,3 +130,7 @@ func (kv *KVStore) Get(key string) (value string, exists bool) {
 	}
 	return value, true
 }
+
+func (kv *KVStore) Close() error {
+	return kv.db.Close()
+}
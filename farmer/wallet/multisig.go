@@ -0,0 +1,202 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+const maxMultisigKeys = 15
+
+// address versions of the multisig addresses, as bitcoin p2sh.
+const (
+	multisigMainnet byte = 0x05
+	multisigTestnet byte = 0xc4
+)
+
+func createMultisigTables(tx *sql.Tx) error {
+	for _, sqlstr := range []string{`
+	CREATE TABLE IF NOT EXISTS 'wallet_multisigs' (
+		'user_id' VARCHAR(64) NOT NULL,
+		'address' VARCHAR(64) NOT NULL,
+		'm' INTEGER NOT NULL,
+		'pubkeys' TEXT NOT NULL,
+		'label' VARCHAR(64) NOT NULL DEFAULT '',
+		'created' INTEGER NOT NULL,
+		PRIMARY KEY ('user_id', 'address')
+	)`, `
+	CREATE TABLE IF NOT EXISTS 'wallet_psbts' (
+		'user_id' VARCHAR(64) NOT NULL,
+		'hash' VARCHAR(64) NOT NULL,
+		'data' BLOB NOT NULL,
+		'submitted' INTEGER NOT NULL DEFAULT 0,
+		'created' INTEGER NOT NULL,
+		'updated' INTEGER NOT NULL,
+		PRIMARY KEY ('user_id', 'hash')
+	)`,
+	} {
+		if _, err := tx.Exec(sqlstr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Multisig is an address spent by M of the N public keys.
+type Multisig struct {
+	Address string   `json:"address"`
+	M       int      `json:"m"`
+	Pubkeys []string `json:"pubkeys"` // hex of the compressed keys, sorted
+	Label   string   `json:"label"`
+	Created int64    `json:"created"`
+}
+
+// MultisigAddr returns the address of m of pubkeys, which are compressed, and sorted so that
+// every co-signer gets the same address.
+func MultisigAddr(m int, pubkeys [][]byte, testnet bool) (string, error) {
+	if len(pubkeys) == 0 || len(pubkeys) > maxMultisigKeys {
+		return "", fmt.Errorf("%d public keys, 1-%d are allowed", len(pubkeys), maxMultisigKeys)
+	}
+	if m < 1 || m > len(pubkeys) {
+		return "", fmt.Errorf("m %d out of 1-%d", m, len(pubkeys))
+	}
+
+	script := []byte{byte(m)}
+	for _, pk := range sortPubkeys(pubkeys) {
+		script = append(script, pk...)
+	}
+	script = append(script, byte(len(pubkeys)))
+
+	version := multisigMainnet
+	if testnet {
+		version = multisigTestnet
+	}
+	return base58.CheckEncode(hash160(script), version), nil
+}
+
+// NewMultisig saves the m of pubkeys address, pubkeys are hex of the compressed or uncompressed keys.
+func (w *Wallet) NewMultisig(m int, pubkeys []string, label string, testnet bool) (*Multisig, error) {
+	keys := [][]byte{}
+	seen := map[string]struct{}{}
+	for _, s := range pubkeys {
+		bs, err := hex.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %s, %s", s, err)
+		}
+		pub, err := btcec.ParsePubKey(bs, btcec.S256())
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %s, %s", s, err)
+		}
+		pk := pub.SerializeCompressed()
+		if _, ok := seen[string(pk)]; ok {
+			return nil, fmt.Errorf("repeated public key %s", s)
+		}
+		seen[string(pk)] = struct{}{}
+		keys = append(keys, pk)
+	}
+
+	addr, err := MultisigAddr(m, keys, testnet)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := &Multisig{Address: addr, M: m, Label: label, Created: time.Now().Unix()}
+	for _, pk := range sortPubkeys(keys) {
+		ms.Pubkeys = append(ms.Pubkeys, hex.EncodeToString(pk))
+	}
+	if _, err := w.db.Exec(`INSERT OR REPLACE INTO wallet_multisigs (user_id, address, m, pubkeys, label, created) VALUES (?, ?, ?, ?, ?, ?)`,
+		w.userID, ms.Address, ms.M, strings.Join(ms.Pubkeys, ","), ms.Label, ms.Created); err != nil {
+		logger.Errorf("save multisig %+v failed, %s", ms, err)
+		return nil, err
+	}
+	return ms, nil
+}
+
+// Multisigs returns the saved multisig addresses.
+func (w *Wallet) Multisigs() ([]*Multisig, error) {
+	rows, err := w.db.Query(`SELECT address, m, pubkeys, label, created FROM wallet_multisigs WHERE user_id = ? ORDER BY created`, w.userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mss := []*Multisig{}
+	for rows.Next() {
+		ms, err := scanMultisig(rows)
+		if err != nil {
+			return nil, err
+		}
+		mss = append(mss, ms)
+	}
+	return mss, rows.Err()
+}
+
+// LookupMultisig returns the saved multisig addr, sql.ErrNoRows if not found.
+func (w *Wallet) LookupMultisig(addr string) (*Multisig, error) {
+	return scanMultisig(w.db.QueryRow(`SELECT address, m, pubkeys, label, created FROM wallet_multisigs WHERE user_id = ? AND address = ?`,
+		w.userID, addr))
+}
+
+// PubKey returns the hex of the compressed public key of addr, for the co-signers.
+func (w *Wallet) PubKey(addr string) (string, error) {
+	key, err := w.Key(addr)
+	if err != nil {
+		return "", err
+	}
+	_, pub := btcec.PrivKeyFromBytes(btcec.S256(), privKeyBytes(key))
+	return hex.EncodeToString(pub.SerializeCompressed()), nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMultisig(row rowScanner) (*Multisig, error) {
+	ms := &Multisig{}
+	var pubkeys string
+	if err := row.Scan(&ms.Address, &ms.M, &pubkeys, &ms.Label, &ms.Created); err != nil {
+		return nil, err
+	}
+	ms.Pubkeys = strings.Split(pubkeys, ",")
+	return ms, nil
+}
+
+func (ms *Multisig) pubkeys() ([][]byte, error) {
+	keys := make([][]byte, 0, len(ms.Pubkeys))
+	for _, s := range ms.Pubkeys {
+		pk, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, pk)
+	}
+	return keys, nil
+}
+
+func sortPubkeys(pubkeys [][]byte) [][]byte {
+	sorted := append([][]byte{}, pubkeys...)
+	sort.Sort(byBytes(sorted))
+	return sorted
+}
+
+type byBytes [][]byte
+
+func (s byBytes) Len() int           { return len(s) }
+func (s byBytes) Less(i, j int) bool { return bytes.Compare(s[i], s[j]) < 0 }
+func (s byBytes) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func hash160(data []byte) []byte {
+	sh := sha256.Sum256(data)
+	rh := ripemd160.New()
+	rh.Write(sh[:])
+	return rh.Sum(nil)
+}
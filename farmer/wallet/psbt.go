@@ -0,0 +1,313 @@
+package wallet
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec"
+	pb "github.com/conseweb/common/assets/lepuscoin/protos"
+	"github.com/conseweb/common/hdwallet"
+	"github.com/golang/protobuf/proto"
+)
+
+// PSBTInput is the signing state of a txin.
+type PSBTInput struct {
+	Addr     string `json:"addr"`
+	Signed   int    `json:"signed"`
+	Required int    `json:"required"`
+}
+
+// PSBT is a partially signed tx, passed between the co-signers of its multisig txins
+// until every txin has enough signatures.
+type PSBT struct {
+	Hash      string       `json:"hash"`
+	Tx        *pb.TX       `json:"tx"`
+	Inputs    []*PSBTInput `json:"inputs"`
+	Complete  bool         `json:"complete"`
+	Submitted bool         `json:"submitted"`
+	// base64 of the serialized SignedTX, for the other co-signers.
+	Data    string `json:"psbt"`
+	Created int64  `json:"created"`
+	Updated int64  `json:"updated"`
+
+	stx *SignedTX
+}
+
+// NewPSBT creates the partially signed tx of tx, signs what the wallet can sign and saves it.
+// the multisig txins must spend the saved multisig addresses.
+func (w *Wallet) NewPSBT(tx *pb.TX) (*PSBT, error) {
+	stx := newSignedTX(tx)
+	for _, in := range tx.Txin {
+		ms, err := w.LookupMultisig(in.Addr)
+		if err == sql.ErrNoRows {
+			stx.Sigs = append(stx.Sigs, &TxSig{})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err := ms.pubkeys()
+		if err != nil {
+			return nil, err
+		}
+		stx.Sigs = append(stx.Sigs, &TxSig{M: uint32(ms.M), Pubkeys: keys, MultiSigs: make([][]byte, len(keys))})
+	}
+
+	if _, err := w.signPartial(stx); err != nil {
+		return nil, err
+	}
+	return w.savePSBT(stx)
+}
+
+// ImportPSBT decodes the base64 or raw partially signed tx of a co-signer, and merges its
+// signatures into the saved one of the same tx. a tx having no txin of the wallet keys is refused.
+func (w *Wallet) ImportPSBT(data []byte) (*PSBT, error) {
+	if bs, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data))); err == nil {
+		data = bs
+	}
+
+	stx := &SignedTX{}
+	if err := proto.Unmarshal(data, stx); err != nil {
+		return nil, fmt.Errorf("invalid psbt, %s", err)
+	}
+	if _, err := verifySigs(stx); err != nil {
+		return nil, err
+	}
+	if ok, err := w.involved(stx); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("psbt %s has no txin of the wallet", stx.TX().TxHash())
+	}
+
+	saved, err := w.GetPSBT(stx.TX().TxHash())
+	if err == nil {
+		if err := mergeSigs(saved.stx, stx); err != nil {
+			return nil, err
+		}
+		stx = saved.stx
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+	return w.savePSBT(stx)
+}
+
+// SignPSBT adds the signatures of the wallet keys to the saved partially signed tx.
+func (w *Wallet) SignPSBT(hash string) (*PSBT, error) {
+	p, err := w.GetPSBT(hash)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.signPartial(p.stx); err != nil {
+		return nil, err
+	}
+	return w.savePSBT(p.stx)
+}
+
+// FinalizePSBT returns the serialized SignedTX of the saved tx, every txin must have enough signatures.
+func (w *Wallet) FinalizePSBT(hash string) ([]byte, error) {
+	p, err := w.GetPSBT(hash)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Complete {
+		return nil, fmt.Errorf("psbt %s is not completely signed", hash)
+	}
+	return proto.Marshal(p.stx)
+}
+
+// MarkSubmitted marks the saved tx as sent to the chaincode.
+func (w *Wallet) MarkSubmitted(hash string) error {
+	_, err := w.db.Exec(`UPDATE wallet_psbts SET submitted = 1, updated = ? WHERE user_id = ? AND hash = ?`,
+		time.Now().Unix(), w.userID, hash)
+	return err
+}
+
+// GetPSBT returns the saved partially signed tx, sql.ErrNoRows if not found.
+func (w *Wallet) GetPSBT(hash string) (*PSBT, error) {
+	return scanPSBT(w.db.QueryRow(`SELECT hash, data, submitted, created, updated FROM wallet_psbts WHERE user_id = ? AND hash = ?`,
+		w.userID, hash))
+}
+
+// PSBTs returns the saved partially signed txs, the latest updated first.
+func (w *Wallet) PSBTs() ([]*PSBT, error) {
+	rows, err := w.db.Query(`SELECT hash, data, submitted, created, updated FROM wallet_psbts WHERE user_id = ? ORDER BY updated DESC`, w.userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ps := []*PSBT{}
+	for rows.Next() {
+		p, err := scanPSBT(rows)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+	return ps, rows.Err()
+}
+
+// signPartial signs the unsigned txins and multisig keys owned by the wallet, and returns the number of new signatures.
+func (w *Wallet) signPartial(stx *SignedTX) (int, error) {
+	hash, err := txDigest(stx.TX())
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i, in := range stx.Txin {
+		ts := stx.Sigs[i]
+		if len(ts.Pubkeys) == 0 {
+			if len(ts.Sig) > 0 {
+				continue
+			}
+			key, err := w.Key(in.Addr)
+			if _, ok := err.(*CannotSignError); ok {
+				continue
+			}
+			if err != nil {
+				return n, err
+			}
+			if ts.Pubkey, ts.Sig, err = sign(key, hash); err != nil {
+				return n, err
+			}
+			n++
+			continue
+		}
+
+		for j, pk := range ts.Pubkeys {
+			if len(ts.MultiSigs[j]) > 0 {
+				continue
+			}
+			key, err := w.pubKeyOwner(pk)
+			if err != nil {
+				return n, err
+			}
+			if key == nil {
+				continue
+			}
+			if _, ts.MultiSigs[j], err = sign(key, hash); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// involved tells whether any txin of stx is of a wallet key, itself or one of its multisig keys.
+func (w *Wallet) involved(stx *SignedTX) (bool, error) {
+	for i, in := range stx.Txin {
+		ts := stx.Sigs[i]
+		if len(ts.Pubkeys) == 0 {
+			_, err := w.Key(in.Addr)
+			if _, ok := err.(*CannotSignError); ok {
+				continue
+			}
+			return err == nil, err
+		}
+		for _, pk := range ts.Pubkeys {
+			key, err := w.pubKeyOwner(pk)
+			if err != nil {
+				return false, err
+			}
+			if key != nil {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// pubKeyOwner returns the private key of the compressed pub, nil if the wallet does not own it.
+func (w *Wallet) pubKeyOwner(pk []byte) (*hdwallet.HDWallet, error) {
+	pub, err := btcec.ParsePubKey(pk, btcec.S256())
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range pubKeyAddrs(pub) {
+		key, err := w.Key(addr)
+		if _, ok := err.(*CannotSignError); ok {
+			continue
+		}
+		return key, err
+	}
+	return nil, nil
+}
+
+func (w *Wallet) savePSBT(stx *SignedTX) (*PSBT, error) {
+	data, err := proto.Marshal(stx)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := stx.TX().TxHash()
+	now := time.Now().Unix()
+	if _, err := w.db.Exec(`INSERT OR IGNORE INTO wallet_psbts (user_id, hash, data, created, updated) VALUES (?, ?, ?, ?, ?)`,
+		w.userID, hash, data, now, now); err != nil {
+		logger.Errorf("save psbt %s failed, %s", hash, err)
+		return nil, err
+	}
+	if _, err := w.db.Exec(`UPDATE wallet_psbts SET data = ?, updated = ? WHERE user_id = ? AND hash = ?`,
+		data, now, w.userID, hash); err != nil {
+		logger.Errorf("save psbt %s failed, %s", hash, err)
+		return nil, err
+	}
+	return w.GetPSBT(hash)
+}
+
+func scanPSBT(row rowScanner) (*PSBT, error) {
+	p := &PSBT{stx: &SignedTX{}}
+	var data []byte
+	if err := row.Scan(&p.Hash, &data, &p.Submitted, &p.Created, &p.Updated); err != nil {
+		return nil, err
+	}
+	if err := proto.Unmarshal(data, p.stx); err != nil {
+		return nil, err
+	}
+
+	inputs, err := verifySigs(p.stx)
+	if err != nil {
+		return nil, err
+	}
+	p.Tx = p.stx.TX()
+	p.Inputs = inputs
+	p.Complete = true
+	for _, in := range inputs {
+		if in.Signed < in.Required {
+			p.Complete = false
+		}
+	}
+	p.Data = base64.StdEncoding.EncodeToString(data)
+	return p, nil
+}
+
+// mergeSigs copies the signatures of from missing in to, both of the same tx.
+func mergeSigs(to, from *SignedTX) error {
+	for i, ts := range to.Sigs {
+		fs := from.Sigs[i]
+		if len(ts.Pubkeys) != len(fs.Pubkeys) || ts.M != fs.M {
+			return fmt.Errorf("txin %d: different multisig of %s", i, to.Txin[i].Addr)
+		}
+
+		if len(ts.Pubkeys) == 0 {
+			if len(ts.Sig) == 0 {
+				ts.Pubkey, ts.Sig = fs.Pubkey, fs.Sig
+			}
+			continue
+		}
+		for j := range ts.Pubkeys {
+			if !bytes.Equal(ts.Pubkeys[j], fs.Pubkeys[j]) {
+				return fmt.Errorf("txin %d: different multisig of %s", i, to.Txin[i].Addr)
+			}
+			if len(ts.MultiSigs[j]) == 0 {
+				ts.MultiSigs[j] = fs.MultiSigs[j]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil/base58"
+	pb "github.com/conseweb/common/assets/lepuscoin/protos"
+	"github.com/conseweb/common/hdwallet"
+	"github.com/golang/protobuf/proto"
+)
+
+// device keys are m/i, one for each bound device, see account.NewLocalDevice.
+const maxDeviceKeys = 16
+
+// CannotSignError is returned when a txin spends an address which the wallet does not own.
+type CannotSignError struct {
+	Addr string
+}
+
+func (e *CannotSignError) Error() string {
+	return fmt.Sprintf("wallet can not sign for address %s", e.Addr)
+}
+
+// TxSig is the signature of the txin at the same position.
+type TxSig struct {
+	// compressed public key of the txin addr.
+	Pubkey []byte `protobuf:"bytes,1,opt,name=pubkey" json:"pubkey,omitempty"`
+	// DER signature of the tx hash.
+	Sig []byte `protobuf:"bytes,2,opt,name=sig" json:"sig,omitempty"`
+
+	// for a multisig addr, M of the sorted Pubkeys, MultiSigs has the
+	// signature of every public key, empty if it does not sign yet.
+	M         uint32   `protobuf:"varint,3,opt,name=m" json:"m,omitempty"`
+	Pubkeys   [][]byte `protobuf:"bytes,4,rep,name=pubkeys" json:"pubkeys,omitempty"`
+	MultiSigs [][]byte `protobuf:"bytes,5,rep,name=multiSigs" json:"multiSigs,omitempty"`
+}
+
+func (m *TxSig) Reset()         { *m = TxSig{} }
+func (m *TxSig) String() string { return proto.CompactTextString(m) }
+func (*TxSig) ProtoMessage()    {}
+
+// SignedTX is pb.TX with the signatures of its txins as the field 6, the
+// other fields keep the numbers of pb.TX so that it is still decoded as a pb.TX.
+type SignedTX struct {
+	Version   uint64         `protobuf:"varint,1,opt,name=version" json:"version,omitempty"`
+	Timestamp int64          `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"`
+	Txin      []*pb.TX_TXIN  `protobuf:"bytes,3,rep,name=txin" json:"txin,omitempty"`
+	Txout     []*pb.TX_TXOUT `protobuf:"bytes,4,rep,name=txout" json:"txout,omitempty"`
+	Founder   string         `protobuf:"bytes,5,opt,name=founder" json:"founder,omitempty"`
+	Sigs      []*TxSig       `protobuf:"bytes,6,rep,name=sigs" json:"sigs,omitempty"`
+}
+
+func (m *SignedTX) Reset()         { *m = SignedTX{} }
+func (m *SignedTX) String() string { return proto.CompactTextString(m) }
+func (*SignedTX) ProtoMessage()    {}
+
+// TX returns the unsigned transaction.
+func (m *SignedTX) TX() *pb.TX {
+	return &pb.TX{
+		Version:   m.Version,
+		Timestamp: m.Timestamp,
+		Txin:      m.Txin,
+		Txout:     m.Txout,
+		Founder:   m.Founder,
+	}
+}
+
+// Key returns the private key of addr, the derived addresses and the device keys are looked up.
+func (w *Wallet) Key(addr string) (*hdwallet.HDWallet, error) {
+	a, err := w.Lookup(addr)
+	if err == nil {
+		return w.Derive(a.Account, a.Chain, a.Index)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	master, err := w.masterKey()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < maxDeviceKeys; i++ {
+		key, err := master.Child(i)
+		if err != nil {
+			return nil, err
+		}
+		if key.Pub().Address() == addr {
+			return key, nil
+		}
+	}
+	return nil, &CannotSignError{Addr: addr}
+}
+
+// SignTx signs every txin of tx by the key of its addr, and returns the serialized SignedTX.
+func (w *Wallet) SignTx(tx *pb.TX) ([]byte, error) {
+	hash, err := txDigest(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	stx := newSignedTX(tx)
+	for _, in := range tx.Txin {
+		key, err := w.Key(in.Addr)
+		if err != nil {
+			return nil, err
+		}
+
+		pub, sig, err := sign(key, hash)
+		if err != nil {
+			logger.Errorf("sign txin of %s failed, %s", in.Addr, err)
+			return nil, err
+		}
+		stx.Sigs = append(stx.Sigs, &TxSig{Pubkey: pub, Sig: sig})
+	}
+
+	return proto.Marshal(stx)
+}
+
+// SignCoinbase signs the coinbase tx, which has no txin, by the key of the issuer addr, and
+// returns the serialized SignedTX with the only signature.
+func (w *Wallet) SignCoinbase(tx *pb.TX, issuer string) ([]byte, error) {
+	if len(tx.Txin) > 0 {
+		return nil, fmt.Errorf("not a coinbase tx")
+	}
+	hash, err := txDigest(tx)
+	if err != nil {
+		return nil, err
+	}
+	key, err := w.Key(issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, sig, err := sign(key, hash)
+	if err != nil {
+		return nil, err
+	}
+	stx := newSignedTX(tx)
+	stx.Sigs = []*TxSig{{Pubkey: pub, Sig: sig}}
+	return proto.Marshal(stx)
+}
+
+// VerifyCoinbase decodes a serialized SignedTX of SignCoinbase, and returns it with the
+// compressed public key of the issuer.
+func VerifyCoinbase(data []byte) (*SignedTX, []byte, error) {
+	stx := &SignedTX{}
+	if err := proto.Unmarshal(data, stx); err != nil {
+		return nil, nil, err
+	}
+	if len(stx.Txin) > 0 || len(stx.Sigs) != 1 {
+		return nil, nil, fmt.Errorf("not a signed coinbase tx")
+	}
+	hash, err := txDigest(stx.TX())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pub, err := btcec.ParsePubKey(stx.Sigs[0].Pubkey, btcec.S256())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := verify(pub, stx.Sigs[0].Sig, hash); err != nil {
+		return nil, nil, err
+	}
+	return stx, pub.SerializeCompressed(), nil
+}
+
+// VerifyTx decodes a serialized SignedTX, and checks that every txin is signed by the key of
+// its addr, or by M keys of its multisig addr.
+func VerifyTx(data []byte) (*SignedTX, error) {
+	stx := &SignedTX{}
+	if err := proto.Unmarshal(data, stx); err != nil {
+		return nil, err
+	}
+
+	inputs, err := verifySigs(stx)
+	if err != nil {
+		return nil, err
+	}
+	for i, in := range inputs {
+		if in.Signed < in.Required {
+			return nil, fmt.Errorf("txin %d: %d of %d signatures of %s", i, in.Signed, in.Required, in.Addr)
+		}
+	}
+	return stx, nil
+}
+
+// verifySigs checks the present signatures of stx, and counts them for every txin.
+func verifySigs(stx *SignedTX) ([]*PSBTInput, error) {
+	if len(stx.Sigs) != len(stx.Txin) {
+		return nil, fmt.Errorf("%d txins with %d signatures", len(stx.Txin), len(stx.Sigs))
+	}
+
+	hash, err := txDigest(stx.TX())
+	if err != nil {
+		return nil, err
+	}
+
+	inputs := make([]*PSBTInput, 0, len(stx.Txin))
+	for i, in := range stx.Txin {
+		ts := stx.Sigs[i]
+		input := &PSBTInput{Addr: in.Addr, Required: 1}
+
+		if len(ts.Pubkeys) == 0 {
+			if len(ts.Sig) > 0 {
+				pub, err := btcec.ParsePubKey(ts.Pubkey, btcec.S256())
+				if err != nil {
+					return nil, fmt.Errorf("txin %d: %s", i, err)
+				}
+				if !pubKeyHasAddr(pub, in.Addr) {
+					return nil, fmt.Errorf("txin %d: public key is not of address %s", i, in.Addr)
+				}
+				if err := verify(pub, ts.Sig, hash); err != nil {
+					return nil, fmt.Errorf("txin %d: %s of %s", i, err, in.Addr)
+				}
+				input.Signed = 1
+			}
+			inputs = append(inputs, input)
+			continue
+		}
+
+		if len(ts.MultiSigs) != len(ts.Pubkeys) {
+			return nil, fmt.Errorf("txin %d: %d public keys with %d signatures", i, len(ts.Pubkeys), len(ts.MultiSigs))
+		}
+		if !multisigHasAddr(int(ts.M), ts.Pubkeys, in.Addr) {
+			return nil, fmt.Errorf("txin %d: public keys are not of multisig address %s", i, in.Addr)
+		}
+		input.Required = int(ts.M)
+		for j, sig := range ts.MultiSigs {
+			if len(sig) == 0 {
+				continue
+			}
+			pub, err := btcec.ParsePubKey(ts.Pubkeys[j], btcec.S256())
+			if err != nil {
+				return nil, fmt.Errorf("txin %d: %s", i, err)
+			}
+			if err := verify(pub, sig, hash); err != nil {
+				return nil, fmt.Errorf("txin %d: %s of key %d", i, err, j)
+			}
+			input.Signed++
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+func newSignedTX(tx *pb.TX) *SignedTX {
+	return &SignedTX{
+		Version:   tx.Version,
+		Timestamp: tx.Timestamp,
+		Txin:      tx.Txin,
+		Txout:     tx.Txout,
+		Founder:   tx.Founder,
+	}
+}
+
+// sign returns the compressed public key of key and its signature of hash.
+func sign(key *hdwallet.HDWallet, hash []byte) ([]byte, []byte, error) {
+	priv, pub := btcec.PrivKeyFromBytes(btcec.S256(), privKeyBytes(key))
+	sig, err := priv.Sign(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pub.SerializeCompressed(), sig.Serialize(), nil
+}
+
+func verify(pub *btcec.PublicKey, sig, hash []byte) error {
+	s, err := btcec.ParseDERSignature(sig, btcec.S256())
+	if err != nil {
+		return err
+	}
+	if !s.Verify(hash, pub) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// txDigest is the double sha256 of the unsigned tx, the same bytes as pb.TX.TxHash.
+func txDigest(tx *pb.TX) ([]byte, error) {
+	bs, err := tx.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(bs)
+	h = sha256.Sum256(h[:])
+	return h[:], nil
+}
+
+// privKeyBytes takes the 32 bytes secret from the serialized private key, which ends
+// with 0x00||secret and 4 bytes checksum.
+func privKeyBytes(key *hdwallet.HDWallet) []byte {
+	ser := key.Serialize()
+	return ser[len(ser)-36 : len(ser)-4]
+}
+
+// pubKeyAddrs returns the mainnet and testnet addresses of pub, as hdwallet.Address.
+func pubKeyAddrs(pub *btcec.PublicKey) []string {
+	h160 := hash160(pub.SerializeUncompressed())
+	return []string{base58.CheckEncode(h160, 0x00), base58.CheckEncode(h160, 0x6f)}
+}
+
+func pubKeyHasAddr(pub *btcec.PublicKey, addr string) bool {
+	for _, a := range pubKeyAddrs(pub) {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func multisigHasAddr(m int, pubkeys [][]byte, addr string) bool {
+	for _, testnet := range []bool{false, true} {
+		if a, err := MultisigAddr(m, pubkeys, testnet); err == nil && a == addr {
+			return true
+		}
+	}
+	return false
+}
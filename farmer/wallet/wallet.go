@@ -0,0 +1,443 @@
+package wallet
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/conseweb/common/hdwallet"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	"github.com/op/go-logging"
+)
+
+// chains of an account, as BIP44.
+const (
+	ChainReceive uint32 = 0
+	ChainChange  uint32 = 1
+
+	hardened uint32 = 0x80000000
+
+	DefaultGapLimit = 20
+)
+
+var (
+	logger = logging.MustGetLogger("wallet")
+
+	ErrNoMaster = errors.New("wallet master key is not on this device, recover it from the passphrase")
+)
+
+// Schema is the migrations of the wallet tables in farmer.db.
+var Schema = &migrate.Schema{
+	Name: "wallet",
+	Migrations: []migrate.Migration{
+		{Version: 1, Name: "create wallet tables", Up: createTables},
+		{Version: 2, Name: "create multisig tables", Up: createMultisigTables},
+	},
+}
+
+func createTables(tx *sql.Tx) error {
+	for _, sqlstr := range []string{`
+	CREATE TABLE IF NOT EXISTS 'wallet_masters' (
+		'user_id' VARCHAR(64) PRIMARY KEY,
+		'xprv' VARCHAR(128) NOT NULL
+	)`, `
+	CREATE TABLE IF NOT EXISTS 'wallet_accounts' (
+		'user_id' VARCHAR(64) NOT NULL,
+		'idx' INTEGER NOT NULL,
+		'name' VARCHAR(32) NOT NULL,
+		'created' INTEGER NOT NULL,
+		PRIMARY KEY ('user_id', 'idx')
+	)`, `
+	CREATE TABLE IF NOT EXISTS 'wallet_addresses' (
+		'user_id' VARCHAR(64) NOT NULL,
+		'account' INTEGER NOT NULL,
+		'chain' INTEGER NOT NULL,
+		'idx' INTEGER NOT NULL,
+		'address' VARCHAR(64) NOT NULL UNIQUE,
+		'label' VARCHAR(64) NOT NULL DEFAULT '',
+		'used' INTEGER NOT NULL DEFAULT 0,
+		'created' INTEGER NOT NULL,
+		PRIMARY KEY ('user_id', 'account', 'chain', 'idx')
+	)`,
+	} {
+		if _, err := tx.Exec(sqlstr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Account is a BIP44 like account of the wallet, m/idx'.
+type Account struct {
+	Index   uint32 `json:"index"`
+	Name    string `json:"name"`
+	Created int64  `json:"created"`
+}
+
+// Address is a derived address, m/account'/chain/index.
+type Address struct {
+	Account uint32 `json:"account"`
+	Chain   uint32 `json:"chain"`
+	Index   uint32 `json:"index"`
+	Address string `json:"address"`
+	Label   string `json:"label"`
+	Used    bool   `json:"used"`
+	Created int64  `json:"created"`
+
+	// filled by Scan and Balance only.
+	Balance uint64 `json:"balance"`
+}
+
+// Source tells the balance of addresses, an address missing in the result was never used.
+type Source interface {
+	Balances(addrs ...string) (map[string]uint64, error)
+}
+
+// Balance is the aggregated balance of a wallet.
+type Balance struct {
+	Total     uint64            `json:"total"`
+	Accounts  map[uint32]uint64 `json:"accounts"`
+	Addresses []*Address        `json:"addresses"`
+}
+
+// Wallet derives and keeps the addresses of an user.
+type Wallet struct {
+	db     *sql.DB
+	userID string
+	xprv   string
+}
+
+// SaveMaster keeps the master private key of userID in db.
+func SaveMaster(db *sql.DB, userID string, master *hdwallet.HDWallet) error {
+	if userID == "" || master == nil {
+		return fmt.Errorf("user id and master key are required")
+	}
+	if _, err := db.Exec(`REPLACE INTO wallet_masters (user_id, xprv) VALUES (?, ?)`, userID, master.String()); err != nil {
+		logger.Errorf("save wallet master of %s failed, %s", userID, err)
+		return err
+	}
+	return nil
+}
+
+// HasMaster tells whether the master key of userID is kept in db.
+func HasMaster(db *sql.DB, userID string) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM wallet_masters WHERE user_id = ?`, userID).Scan(&n)
+	return n > 0, err
+}
+
+// Open returns the wallet of userID, the default account 0 is created at the first time.
+func Open(db *sql.DB, userID string) (*Wallet, error) {
+	var xprv string
+	err := db.QueryRow(`SELECT xprv FROM wallet_masters WHERE user_id = ?`, userID).Scan(&xprv)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoMaster
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := hdwallet.ParseStringWallet(xprv); err != nil {
+		return nil, err
+	}
+
+	w := &Wallet{db: db, userID: userID, xprv: xprv}
+	if _, err := db.Exec(`INSERT OR IGNORE INTO wallet_accounts (user_id, idx, name, created) VALUES (?, 0, 'default', ?)`,
+		userID, time.Now().Unix()); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Accounts returns the accounts of the wallet.
+func (w *Wallet) Accounts() ([]*Account, error) {
+	rows, err := w.db.Query(`SELECT idx, name, created FROM wallet_accounts WHERE user_id = ? ORDER BY idx`, w.userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	as := []*Account{}
+	for rows.Next() {
+		a := &Account{}
+		if err := rows.Scan(&a.Index, &a.Name, &a.Created); err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	return as, rows.Err()
+}
+
+// NewAccount adds an account after the last one.
+func (w *Wallet) NewAccount(name string) (*Account, error) {
+	var last sql.NullInt64
+	if err := w.db.QueryRow(`SELECT MAX(idx) FROM wallet_accounts WHERE user_id = ?`, w.userID).Scan(&last); err != nil {
+		return nil, err
+	}
+
+	a := &Account{Name: name, Created: time.Now().Unix()}
+	if last.Valid {
+		a.Index = uint32(last.Int64) + 1
+	}
+	if a.Name == "" {
+		a.Name = fmt.Sprintf("account %d", a.Index)
+	}
+
+	if _, err := w.db.Exec(`INSERT INTO wallet_accounts (user_id, idx, name, created) VALUES (?, ?, ?, ?)`,
+		w.userID, a.Index, a.Name, a.Created); err != nil {
+		logger.Errorf("insert wallet account %+v failed, %s", a, err)
+		return nil, err
+	}
+	return a, nil
+}
+
+// Derive returns the private key of m/account'/chain/index.
+func (w *Wallet) Derive(account, chain, index uint32) (*hdwallet.HDWallet, error) {
+	if account >= hardened || index >= hardened {
+		return nil, fmt.Errorf("invalid derivation path m/%d'/%d/%d", account, chain, index)
+	}
+	if chain != ChainReceive && chain != ChainChange {
+		return nil, fmt.Errorf("invalid chain %d", chain)
+	}
+
+	key, err := w.masterKey()
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range []uint32{hardened + account, chain, index} {
+		child, err := key.Child(i)
+		if err != nil {
+			return nil, err
+		}
+		key = child
+	}
+	return key, nil
+}
+
+// DeviceKey returns the private key of m/index, the wallet of the index-th device bound to the user.
+func (w *Wallet) DeviceKey(index uint32) (*hdwallet.HDWallet, error) {
+	if index >= hardened {
+		return nil, fmt.Errorf("invalid device index %d", index)
+	}
+	key, err := w.masterKey()
+	if err != nil {
+		return nil, err
+	}
+	return key.Child(index)
+}
+
+// NextAddress derives the address after the last one of account and chain.
+func (w *Wallet) NextAddress(account, chain uint32, label string) (*Address, error) {
+	if err := w.checkAccount(account); err != nil {
+		return nil, err
+	}
+
+	var last sql.NullInt64
+	if err := w.db.QueryRow(`SELECT MAX(idx) FROM wallet_addresses WHERE user_id = ? AND account = ? AND chain = ?`,
+		w.userID, account, chain).Scan(&last); err != nil {
+		return nil, err
+	}
+
+	var index uint32
+	if last.Valid {
+		index = uint32(last.Int64) + 1
+	}
+	return w.saveAddress(account, chain, index, label, false)
+}
+
+// Addresses returns the saved addresses, a negative account or chain matches all.
+func (w *Wallet) Addresses(account, chain int) ([]*Address, error) {
+	query := `SELECT account, chain, idx, address, label, used, created FROM wallet_addresses WHERE user_id = ?`
+	args := []interface{}{w.userID}
+	if account >= 0 {
+		query += ` AND account = ?`
+		args = append(args, account)
+	}
+	if chain >= 0 {
+		query += ` AND chain = ?`
+		args = append(args, chain)
+	}
+	query += ` ORDER BY account, chain, idx`
+
+	rows, err := w.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	as := []*Address{}
+	for rows.Next() {
+		a := &Address{}
+		if err := rows.Scan(&a.Account, &a.Chain, &a.Index, &a.Address, &a.Label, &a.Used, &a.Created); err != nil {
+			return nil, err
+		}
+		as = append(as, a)
+	}
+	return as, rows.Err()
+}
+
+// Lookup returns the saved address addr, sql.ErrNoRows if the wallet does not own it.
+func (w *Wallet) Lookup(addr string) (*Address, error) {
+	a := &Address{}
+	err := w.db.QueryRow(`SELECT account, chain, idx, address, label, used, created FROM wallet_addresses WHERE user_id = ? AND address = ?`,
+		w.userID, addr).Scan(&a.Account, &a.Chain, &a.Index, &a.Address, &a.Label, &a.Used, &a.Created)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetLabel labels a saved address.
+func (w *Wallet) SetLabel(addr, label string) error {
+	res, err := w.db.Exec(`UPDATE wallet_addresses SET label = ? WHERE user_id = ? AND address = ?`, label, w.userID, addr)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Scan derives both chains of account until gap addresses in a row are unused
+// in src, and saves every address up to the last used one.
+func (w *Wallet) Scan(account uint32, gap int, src Source) ([]*Address, error) {
+	if err := w.checkAccount(account); err != nil {
+		return nil, err
+	}
+	if gap <= 0 {
+		gap = DefaultGapLimit
+	}
+
+	found := []*Address{}
+	for _, chain := range []uint32{ChainReceive, ChainChange} {
+		var index uint32
+		for unused := 0; unused < gap; {
+			batch := make([]string, 0, gap)
+			for i := 0; i < gap; i++ {
+				key, err := w.Derive(account, chain, index+uint32(i))
+				if err != nil {
+					return nil, err
+				}
+				batch = append(batch, key.Pub().Address())
+			}
+
+			balances, err := src.Balances(batch...)
+			if err != nil {
+				return nil, err
+			}
+
+			for i, addr := range batch {
+				balance, used := balances[addr]
+				if !used {
+					unused++
+					if unused >= gap {
+						break
+					}
+					continue
+				}
+
+				// save the unused ones before the used one, they are in the gap.
+				for j := index + uint32(i) - uint32(unused); j < index+uint32(i); j++ {
+					if _, err := w.saveAddress(account, chain, j, "", false); err != nil {
+						return nil, err
+					}
+				}
+				unused = 0
+
+				a, err := w.saveAddress(account, chain, index+uint32(i), "", true)
+				if err != nil {
+					return nil, err
+				}
+				a.Balance = balance
+				found = append(found, a)
+			}
+			index += uint32(gap)
+		}
+	}
+
+	logger.Debugf("scan wallet account %d of %s, found %d used addresses", account, w.userID, len(found))
+	return found, nil
+}
+
+// Balance sums the balance of the saved addresses, a negative account sums all accounts.
+func (w *Wallet) Balance(account int, src Source) (*Balance, error) {
+	as, err := w.Addresses(account, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Balance{Accounts: map[uint32]uint64{}, Addresses: []*Address{}}
+	if len(as) == 0 {
+		return b, nil
+	}
+
+	addrs := make([]string, 0, len(as))
+	for _, a := range as {
+		addrs = append(addrs, a.Address)
+	}
+	balances, err := src.Balances(addrs...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range as {
+		balance, ok := balances[a.Address]
+		if !ok {
+			continue
+		}
+		a.Balance = balance
+		b.Total += balance
+		b.Accounts[a.Account] += balance
+		b.Addresses = append(b.Addresses, a)
+	}
+	return b, nil
+}
+
+// masterKey parses the master key every time, hdwallet.Serialize appends to the
+// version bytes which a derived key shares with the parsed buffer, so a kept
+// master would be overwritten by serializing its children.
+func (w *Wallet) masterKey() (*hdwallet.HDWallet, error) {
+	return hdwallet.ParseStringWallet(w.xprv)
+}
+
+func (w *Wallet) checkAccount(account uint32) error {
+	var n int
+	if err := w.db.QueryRow(`SELECT COUNT(*) FROM wallet_accounts WHERE user_id = ? AND idx = ?`, w.userID, account).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("wallet account %d not found", account)
+	}
+	return nil
+}
+
+// saveAddress derives and saves m/account'/chain/index, an existing one is marked used if used.
+func (w *Wallet) saveAddress(account, chain, index uint32, label string, used bool) (*Address, error) {
+	key, err := w.Derive(account, chain, index)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Address{
+		Account: account,
+		Chain:   chain,
+		Index:   index,
+		Address: key.Pub().Address(),
+		Label:   label,
+		Used:    used,
+		Created: time.Now().Unix(),
+	}
+	if _, err := w.db.Exec(`INSERT OR IGNORE INTO wallet_addresses (user_id, account, chain, idx, address, label, used, created) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.userID, a.Account, a.Chain, a.Index, a.Address, a.Label, a.Used, a.Created); err != nil {
+		logger.Errorf("save wallet address %+v failed, %s", a, err)
+		return nil, err
+	}
+	if used {
+		if _, err := w.db.Exec(`UPDATE wallet_addresses SET used = 1 WHERE user_id = ? AND address = ?`, w.userID, a.Address); err != nil {
+			return nil, err
+		}
+	}
+	return w.Lookup(a.Address)
+}
@@ -0,0 +1,307 @@
+package wallet
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/conseweb/common/assets/lepuscoin/client"
+	pb "github.com/conseweb/common/assets/lepuscoin/protos"
+	"github.com/conseweb/common/hdwallet"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/farmer/migrate"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type mockSource map[string]uint64
+
+func (s mockSource) Balances(addrs ...string) (map[string]uint64, error) {
+	ret := map[string]uint64{}
+	for _, addr := range addrs {
+		if b, ok := s[addr]; ok {
+			ret[addr] = b
+		}
+	}
+	return ret, nil
+}
+
+func openWallet(t *testing.T) *Wallet {
+	return openSeedWallet(t, "farmer wallet test seed")
+}
+
+func openSeedWallet(t *testing.T, seed string) *Wallet {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db failed, %s", err)
+	}
+	db.SetMaxOpenConns(1)
+	if err := (&migrate.Runner{}).Run(db, Schema); err != nil {
+		t.Fatalf("migrate failed, %s", err)
+	}
+
+	if _, err := Open(db, "u1"); err != ErrNoMaster {
+		t.Fatalf("expect ErrNoMaster, got %v", err)
+	}
+	if err := SaveMaster(db, "u1", hdwallet.MasterKey([]byte(seed), true)); err != nil {
+		t.Fatalf("save master failed, %s", err)
+	}
+	w, err := Open(db, "u1")
+	if err != nil {
+		t.Fatalf("open wallet failed, %s", err)
+	}
+	return w
+}
+
+func TestNextAddress(t *testing.T) {
+	w := openWallet(t)
+
+	a0, err := w.NextAddress(0, ChainReceive, "shop")
+	if err != nil {
+		t.Fatalf("next address failed, %s", err)
+	}
+	a1, err := w.NextAddress(0, ChainReceive, "")
+	if err != nil {
+		t.Fatalf("next address failed, %s", err)
+	}
+	if a0.Index != 0 || a1.Index != 1 || a0.Address == a1.Address || a0.Label != "shop" {
+		t.Errorf("unexpected addresses %+v %+v", a0, a1)
+	}
+
+	if _, err := w.NextAddress(1, ChainReceive, ""); err == nil {
+		t.Errorf("expect error of unknown account")
+	}
+	acc, err := w.NewAccount("")
+	if err != nil || acc.Index != 1 {
+		t.Fatalf("new account failed, %+v %v", acc, err)
+	}
+	c0, err := w.NextAddress(1, ChainChange, "")
+	if err != nil || c0.Address == a0.Address {
+		t.Fatalf("next address of account 1 failed, %+v %v", c0, err)
+	}
+
+	if err := w.SetLabel(a1.Address, "rent"); err != nil {
+		t.Fatalf("set label failed, %s", err)
+	}
+	if err := w.SetLabel("nope", "rent"); err != sql.ErrNoRows {
+		t.Errorf("expect ErrNoRows, got %v", err)
+	}
+	as, err := w.Addresses(0, int(ChainReceive))
+	if err != nil || len(as) != 2 || as[1].Label != "rent" {
+		t.Errorf("unexpected addresses %+v %v", as, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	w := openWallet(t)
+
+	addr := func(chain, index uint32) string {
+		key, err := w.Derive(0, chain, index)
+		if err != nil {
+			t.Fatalf("derive failed, %s", err)
+		}
+		return key.Pub().Address()
+	}
+
+	// used addresses within the gap of 5 are found, 15 is behind 5 unused ones.
+	src := mockSource{
+		addr(ChainReceive, 0):  10,
+		addr(ChainReceive, 4):  20,
+		addr(ChainReceive, 9):  0,
+		addr(ChainChange, 2):   5,
+		addr(ChainReceive, 15): 100,
+	}
+
+	found, err := w.Scan(0, 5, src)
+	if err != nil {
+		t.Fatalf("scan failed, %s", err)
+	}
+	if len(found) != 4 {
+		t.Fatalf("expect 4 used addresses, got %+v", found)
+	}
+
+	as, err := w.Addresses(0, int(ChainReceive))
+	if err != nil || len(as) != 10 {
+		t.Fatalf("expect receive 0-9 saved, got %d %v", len(as), err)
+	}
+	if !as[9].Used || as[8].Used {
+		t.Errorf("unexpected used flags %+v %+v", as[8], as[9])
+	}
+
+	b, err := w.Balance(-1, src)
+	if err != nil {
+		t.Fatalf("balance failed, %s", err)
+	}
+	if b.Total != 35 || b.Accounts[0] != 35 {
+		t.Errorf("expect balance 35, got %+v", b)
+	}
+}
+
+func TestSignTx(t *testing.T) {
+	w := openWallet(t)
+
+	a, err := w.NextAddress(0, ChainReceive, "")
+	if err != nil {
+		t.Fatalf("next address failed, %s", err)
+	}
+	master, err := w.masterKey()
+	if err != nil {
+		t.Fatalf("master key failed, %s", err)
+	}
+	dev, err := master.Child(0)
+	if err != nil {
+		t.Fatalf("derive device key failed, %s", err)
+	}
+
+	tx := client.NewTransactionV1(a.Address)
+	tx.AddTxIn(client.NewTxIn(a.Address, "8af9bc2f92732908d569c604dc6b0fac7679fa4e805f81d58a16e6f58d17a4f3", 0))
+	tx.AddTxIn(client.NewTxIn(dev.Pub().Address(), "4590c4b5b3c5a1fbfb0c955f02e609efcb95054b924dbd34139e5a0ce21e6abe", 1))
+	tx.AddTxOut(client.NewTxOut(50, "kjlk", time.Time{}))
+
+	bs, err := w.SignTx(tx)
+	if err != nil {
+		t.Fatalf("sign failed, %s", err)
+	}
+	if _, err := VerifyTx(bs); err != nil {
+		t.Errorf("verify failed, %s", err)
+	}
+
+	// a chaincode unaware of the signatures decodes the same tx.
+	ptx, err := pb.ParseTXBytes(bs)
+	if err != nil || ptx.TxHash() != tx.TxHash() {
+		t.Errorf("expect the same tx hash, got %v %v", ptx, err)
+	}
+
+	stx := &SignedTX{}
+	proto.Unmarshal(bs, stx)
+	stx.Txout[0].Value = 5000
+	tampered, _ := proto.Marshal(stx)
+	if _, err := VerifyTx(tampered); err == nil {
+		t.Errorf("expect tampered tx failed")
+	}
+
+	tx.AddTxIn(client.NewTxIn("mtCLPxw18uxFMK1tbWLCVxJa4Tby7My7aM", "728ff33734e5dfcabc3163b37175f663ed2b2ea624b237a5df96bc5c8347383f", 1))
+	if _, err := w.SignTx(tx); err == nil {
+		t.Errorf("expect error of foreign address")
+	} else if _, ok := err.(*CannotSignError); !ok {
+		t.Errorf("expect CannotSignError, got %v", err)
+	}
+}
+
+func TestMultisigPSBT(t *testing.T) {
+	alice, bob, carol := openWallet(t), openSeedWallet(t, "bob seed"), openSeedWallet(t, "carol seed")
+
+	var pubkeys []string
+	for _, w := range []*Wallet{alice, bob, carol} {
+		a, err := w.NextAddress(0, ChainReceive, "")
+		if err != nil {
+			t.Fatalf("next address failed, %s", err)
+		}
+		pk, err := w.PubKey(a.Address)
+		if err != nil {
+			t.Fatalf("pubkey failed, %s", err)
+		}
+		pubkeys = append(pubkeys, pk)
+	}
+
+	ms, err := alice.NewMultisig(2, pubkeys, "shared", true)
+	if err != nil {
+		t.Fatalf("new multisig failed, %s", err)
+	}
+	// the order of the keys does not matter.
+	ms2, err := bob.NewMultisig(2, []string{pubkeys[2], pubkeys[0], pubkeys[1]}, "", true)
+	if err != nil || ms2.Address != ms.Address {
+		t.Fatalf("expect the same multisig address, got %v %v", ms2, err)
+	}
+	if _, err := alice.NewMultisig(4, pubkeys, "", true); err == nil {
+		t.Errorf("expect error of m > n")
+	}
+	if _, err := alice.NewMultisig(1, []string{pubkeys[0], pubkeys[0]}, "", true); err == nil {
+		t.Errorf("expect error of repeated keys")
+	}
+
+	tx := client.NewTransactionV1(ms.Address)
+	tx.AddTxIn(client.NewTxIn(ms.Address, "8af9bc2f92732908d569c604dc6b0fac7679fa4e805f81d58a16e6f58d17a4f3", 0))
+	tx.AddTxOut(client.NewTxOut(50, "kjlk", time.Time{}))
+
+	p, err := alice.NewPSBT(tx)
+	if err != nil {
+		t.Fatalf("new psbt failed, %s", err)
+	}
+	if p.Complete || p.Inputs[0].Signed != 1 || p.Inputs[0].Required != 2 {
+		t.Fatalf("expect 1 of 2 signatures, got %+v", p.Inputs[0])
+	}
+	if _, err := alice.FinalizePSBT(p.Hash); err == nil {
+		t.Errorf("expect error of incomplete psbt")
+	}
+
+	// carol signs the copy from alice, and alice merges it back.
+	cp, err := carol.ImportPSBT([]byte(p.Data))
+	if err != nil {
+		t.Fatalf("import psbt failed, %s", err)
+	}
+	if cp, err = carol.SignPSBT(cp.Hash); err != nil || !cp.Complete {
+		t.Fatalf("expect complete psbt, got %+v %v", cp, err)
+	}
+	if p, err = alice.ImportPSBT([]byte(cp.Data)); err != nil || !p.Complete {
+		t.Fatalf("expect complete psbt, got %+v %v", p, err)
+	}
+
+	bs, err := alice.FinalizePSBT(p.Hash)
+	if err != nil {
+		t.Fatalf("finalize failed, %s", err)
+	}
+	if _, err := VerifyTx(bs); err != nil {
+		t.Errorf("verify failed, %s", err)
+	}
+	if ptx, err := pb.ParseTXBytes(bs); err != nil || ptx.TxHash() != tx.TxHash() {
+		t.Errorf("expect the same tx hash, got %v %v", ptx, err)
+	}
+
+	// the psbts are of the user, another one can not see nor import them.
+	if err := SaveMaster(alice.db, "u2", hdwallet.MasterKey([]byte("dave seed"), true)); err != nil {
+		t.Fatalf("save master failed, %s", err)
+	}
+	dave, err := Open(alice.db, "u2")
+	if err != nil {
+		t.Fatalf("open wallet failed, %s", err)
+	}
+	if ps, err := dave.PSBTs(); err != nil || len(ps) != 0 {
+		t.Errorf("expect no psbt of u2, got %v %v", ps, err)
+	}
+	if _, err := dave.GetPSBT(p.Hash); err != sql.ErrNoRows {
+		t.Errorf("expect ErrNoRows, got %v", err)
+	}
+	if _, err := dave.ImportPSBT([]byte(p.Data)); err == nil {
+		t.Errorf("expect error of a psbt without the keys of u2")
+	}
+}
+
+func TestSignCoinbase(t *testing.T) {
+	w := openWallet(t)
+	a, err := w.NextAddress(0, ChainReceive, "")
+	if err != nil {
+		t.Fatalf("next address failed, %s", err)
+	}
+
+	tx := client.NewTransactionV1("")
+	tx.AddTxOut(client.NewTxOut(100, "kjlk", time.Time{}))
+	bs, err := w.SignCoinbase(tx, a.Address)
+	if err != nil {
+		t.Fatalf("sign failed, %s", err)
+	}
+	_, pub, err := VerifyCoinbase(bs)
+	if err != nil {
+		t.Fatalf("verify failed, %s", err)
+	}
+	if pk, _ := w.PubKey(a.Address); hex.EncodeToString(pub) != pk {
+		t.Errorf("expect issuer %s, got %x", pk, pub)
+	}
+	if ptx, err := pb.ParseTXBytes(bs); err != nil || ptx.TxHash() != tx.TxHash() {
+		t.Errorf("expect the same tx hash, got %v %v", ptx, err)
+	}
+
+	if _, err := w.SignCoinbase(tx, "mtCLPxw18uxFMK1tbWLCVxJa4Tby7My7aM"); err == nil {
+		t.Errorf("expect error of foreign issuer")
+	}
+}
@@ -17,8 +17,10 @@ limitations under the License.
 package flogging
 
 import (
+	"io"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/op/go-logging"
 	"github.com/spf13/viper"
@@ -96,7 +98,7 @@ func init() {
 		"%{color}%{time:15:04:05.000} [%{module}] %{shortfunc} -> %{level:.4s} %{id:03x}%{color:reset} %{message}",
 	)
 
-	backend := logging.NewLogBackend(os.Stderr, "", 0)
+	backend := logging.NewLogBackend(output, "", 0)
 	backendFormatter := logging.NewBackendFormatter(backend, format)
 	logging.SetBackend(backendFormatter).SetLevel(loggingDefaultLevel, "")
 }
@@ -106,7 +108,28 @@ func jsonLogger() {
 		`{"time":"%{time:15:04:05.000}", "module":"%{module}", "func":"%{shortfunc}", "level":"%{level:.4s}", "id":"%{id:03x}", "message":"%{message}"}`,
 	)
 
-	backend := logging.NewLogBackend(os.Stderr, "", 0)
+	backend := logging.NewLogBackend(output, "", 0)
 	backendFormatter := logging.NewBackendFormatter(backend, format)
 	logging.SetBackend(backendFormatter).SetLevel(loggingDefaultLevel, "")
 }
+
+// output is the writer of the logs, stderr by default.
+var output = &switchWriter{w: os.Stderr}
+
+type switchWriter struct {
+	sync.RWMutex
+	w io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	s.RLock()
+	defer s.RUnlock()
+	return s.w.Write(p)
+}
+
+// SetOutput writes the logs to w, the levels set by LoggingInit are kept.
+func SetOutput(w io.Writer) {
+	output.Lock()
+	output.w = w
+	output.Unlock()
+}
@@ -6,8 +6,10 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/hyperledger/fabric/core"
+	"github.com/hyperledger/fabric/farmer/metrics"
 	"github.com/hyperledger/fabric/peer/common"
 	"github.com/hyperledger/fabric/peer/util"
 	pb "github.com/hyperledger/fabric/protos"
@@ -50,6 +52,21 @@ type ParamsWrapper struct {
 	Attributes    []string               `json:"attributes"`
 }
 
+var (
+	ccDuration = metrics.NewHistogramVec("farmer_chaincode_duration_seconds",
+		"Latency of the chaincode deploy, invoke and query.", nil, "method", "chaincode")
+	ccErrors = metrics.NewCounterVec("farmer_chaincode_errors_total",
+		"Failed chaincode deploy, invoke and query.", "method", "chaincode")
+)
+
+// observe records the latency since start and the error of the chaincode method.
+func (c *ChaincodeWrapper) observe(method string, start time.Time, err error) {
+	ccDuration.With(method, c.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		ccErrors.With(method, c.Name).Inc()
+	}
+}
+
 var (
 	NewID = func(start int) func() int {
 		id := start - 1
@@ -157,7 +174,9 @@ func (c *ChaincodeWrapper) ToSpec() (*pb.ChaincodeSpec, error) {
 	return spec, nil
 }
 
-func (c *ChaincodeWrapper) Deploy() (string, error) {
+func (c *ChaincodeWrapper) Deploy() (name string, err error) {
+	defer func(start time.Time) { c.observe("deploy", start, err) }(time.Now())
+
 	spec, err := c.ToSpec()
 	if err != nil {
 		return "", err
@@ -178,7 +197,13 @@ func (c *ChaincodeWrapper) Deploy() (string, error) {
 	return chaincodeDeploymentSpec.ChaincodeSpec.ChaincodeID.Name, nil
 }
 
-func (c *ChaincodeWrapper) Invoke() ([]byte, error) {
+func (c *ChaincodeWrapper) Invoke() (msg []byte, err error) {
+	method := "invoke"
+	if c.Method == "query" {
+		method = "query"
+	}
+	defer func(start time.Time) { c.observe(method, start, err) }(time.Now())
+
 	spec, err := c.ToSpec()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,210 @@
+package farmer
+
+import (
+	"fmt"
+	"os"
+
+	fdaemon "github.com/hyperledger/fabric/farmer/daemon"
+	"github.com/spf13/cobra"
+)
+
+// signInFlags are the flags to sign in or sign up by email or phone.
+type signInFlags struct {
+	email    string
+	phone    string
+	password string
+}
+
+func (f *signInFlags) bind(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&f.email, "email", "", "Email of the account")
+	flags.StringVar(&f.phone, "phone", "", "Phone of the account")
+	flags.StringVarP(&f.password, "password", "p", "", "Password of the account, $FARMER_PASSWORD if empty")
+}
+
+func (f *signInFlags) body() (map[string]string, error) {
+	body := map[string]string{}
+	switch {
+	case f.email != "":
+		body["type"], body["email"] = "email", f.email
+	case f.phone != "":
+		body["type"], body["phone"] = "phone", f.phone
+	default:
+		return nil, fmt.Errorf("email or phone is required")
+	}
+
+	body["password"] = f.password
+	if body["password"] == "" {
+		body["password"] = os.Getenv("FARMER_PASSWORD")
+	}
+	return body, nil
+}
+
+// accountSummary is the account answered by the daemon without the secrets.
+type accountSummary struct {
+	ID       string `json:"id"`
+	NickName string `json:"nicename"`
+	Phone    string `json:"phone"`
+	Email    string `json:"email"`
+}
+
+func loginCmd() *cobra.Command {
+	f := &signInFlags{}
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Login the farmer daemon.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			body, err := f.body()
+			if err != nil {
+				return err
+			}
+			if body["password"] == "" {
+				return fmt.Errorf("password is required")
+			}
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			var ret struct {
+				accountSummary
+				Token   string `json:"token"`
+				Expires int64  `json:"expires"`
+			}
+			if err := cli.do("POST", "/account/login", body, &ret); err != nil {
+				return err
+			}
+			if err := saveToken(cli.base, ret.Token); err != nil {
+				return err
+			}
+			return printResult(os.Stdout, outputMode, ret.accountSummary)
+		},
+	}
+	f.bind(cmd)
+	return cmd
+}
+
+func signupCmd() *cobra.Command {
+	f := &signInFlags{}
+	var captcha, nickname, language string
+	cmd := &cobra.Command{
+		Use:   "signup",
+		Short: "Sign up an account by the captcha of 'signup captcha'.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			body, err := f.body()
+			if err != nil {
+				return err
+			}
+			if captcha == "" {
+				return fmt.Errorf("captcha is required, see 'signup captcha'")
+			}
+			body["captcha"], body["nickname"], body["language"] = captcha, nickname, language
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			a := &accountSummary{}
+			if err := cli.do("POST", "/signup", body, a); err != nil {
+				return err
+			}
+			return printResult(os.Stdout, outputMode, a)
+		},
+	}
+	f.bind(cmd)
+	cmd.Flags().StringVar(&captcha, "captcha", "", "Captcha sent to the email or phone")
+	cmd.Flags().StringVar(&nickname, "nickname", "", "Nickname of the account")
+	cmd.Flags().StringVar(&language, "language", "", "Language of the wallet passphrase")
+
+	cf := &signInFlags{}
+	captchaCmd := &cobra.Command{
+		Use:   "captcha",
+		Short: "Send the captcha of signing up to the email or phone.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			body, err := cf.body()
+			if err != nil {
+				return err
+			}
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+			if err := cli.do("POST", "/signup/"+body["type"], body, nil); err != nil {
+				return err
+			}
+			fmt.Printf("captcha is sent to %s\n", body[body["type"]])
+			return nil
+		},
+	}
+	cf.bind(captchaCmd)
+	cmd.AddCommand(captchaCmd)
+	return cmd
+}
+
+func logoutCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "logout",
+		Short: "User Logout.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+			// the token is dropped even if it is expired or revoked already.
+			err = cli.do("DELETE", "/account/logout", nil, nil)
+			if e, ok := err.(*apiError); ok && e.Status == 401 {
+				err = nil
+			}
+			if err != nil {
+				return err
+			}
+			return saveToken(cli.base, "")
+		},
+	}
+}
+
+func statusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show the process, the login account and the chaincodes of the farmer daemon.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			status := map[string]interface{}{"daemon": cli.base, "running": false, "login": false}
+			pid, running := fdaemon.Running()
+			if running {
+				status["pid"] = pid
+			}
+			// the daemon may run out of this fileSystemPath, e.g. --addr.
+			if !running && daemonAddr == "" {
+				return printResult(os.Stdout, outputMode, status, "daemon", "running", "pid")
+			}
+			status["running"] = true
+
+			a := &accountSummary{}
+			if err := cli.do("GET", "/account", nil, a); err == nil {
+				status["login"], status["account"], status["nickname"] = true, a.ID, a.NickName
+			} else if e, ok := err.(*apiError); !ok || e.Status != 401 {
+				return err
+			}
+
+			var ccs []map[string]interface{}
+			if err := cli.do("GET", "/chaincode", nil, &ccs); err != nil {
+				return err
+			}
+
+			if outputMode == outputJSON {
+				status["chaincodes"] = ccs
+				return printResult(os.Stdout, outputMode, status)
+			}
+			if err := printResult(os.Stdout, outputMode, status, "daemon", "running", "pid", "login", "account", "nickname"); err != nil {
+				return err
+			}
+			fmt.Println()
+			return printResult(os.Stdout, outputMode, ccs, "alias", "status", "name", "block", "error")
+		},
+	}
+}
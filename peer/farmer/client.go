@@ -0,0 +1,116 @@
+package farmer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	fclient "github.com/hyperledger/fabric/farmer/client"
+	fdaemon "github.com/hyperledger/fabric/farmer/daemon"
+	"github.com/spf13/viper"
+)
+
+// apiError is the error answered by the daemon api.
+type apiError = fclient.Error
+
+// client talks to the running farmer daemon by its http api.
+type client struct {
+	base  string
+	token string
+	cli   *http.Client
+}
+
+// daemonURL returns the api url of the daemon listening on addr, the unspecified host is the loopback.
+func daemonURL(addr string) (string, error) {
+	if strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
+		return strings.TrimRight(addr, "/") + "/api", nil
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid daemon address %s, %s", addr, err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port) + "/api", nil
+}
+
+func newClient() (*client, error) {
+	addr := daemonAddr
+	if addr == "" {
+		addr = viper.GetString("daemon.address")
+	}
+	if addr == "" {
+		addr = fdaemon.DefaultListenAddr
+	}
+
+	base, err := daemonURL(addr)
+	if err != nil {
+		return nil, err
+	}
+	token := os.Getenv("FARMER_TOKEN")
+	if token == "" {
+		token = loadToken(base)
+	}
+	return &client{base: base, token: token, cli: &http.Client{Timeout: 2 * time.Minute}}, nil
+}
+
+// tokenFilePath returns the file of the login tokens, which are keyed by the daemon url.
+func tokenFilePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.TempDir()
+	}
+	return filepath.Join(home, ".farmer", "tokens.json")
+}
+
+func loadTokens() map[string]string {
+	tokens := map[string]string{}
+	bs, err := ioutil.ReadFile(tokenFilePath())
+	if err == nil {
+		json.Unmarshal(bs, &tokens)
+	}
+	return tokens
+}
+
+func loadToken(base string) string {
+	return loadTokens()[base]
+}
+
+// saveToken keeps the login token of the daemon at base, removes it if empty.
+func saveToken(base, token string) error {
+	tokens := loadTokens()
+	if token == "" {
+		delete(tokens, base)
+	} else {
+		tokens[base] = token
+	}
+
+	bs, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(tokenFilePath()), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(tokenFilePath(), bs, 0600)
+}
+
+// api is the typed client of the daemon api.
+func (c *client) api() *fclient.Client {
+	return &fclient.Client{Base: c.base, Token: c.token, HTTP: c.cli}
+}
+
+// do sends the json of in to the api path, and decodes the answered json to out.
+// in and out may be nil.
+func (c *client) do(method, path string, in, out interface{}) error {
+	logger.Debugf("%s %s", method, path)
+	return c.api().Do(method, path, in, out)
+}
@@ -0,0 +1,114 @@
+package farmer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDaemonURL(t *testing.T) {
+	for addr, expect := range map[string]string{
+		"0.0.0.0:9375":            "http://127.0.0.1:9375/api",
+		":9375":                   "http://127.0.0.1:9375/api",
+		"10.0.0.2:80":             "http://10.0.0.2:80/api",
+		"http://farmer.local:81/": "http://farmer.local:81/api",
+	} {
+		if got, err := daemonURL(addr); err != nil || got != expect {
+			t.Errorf("expect %s of %s, got %s %v", expect, addr, got, err)
+		}
+	}
+	if _, err := daemonURL("farmer"); err == nil {
+		t.Errorf("expect error of an address without port")
+	}
+}
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/api/namesrv/alice":
+			w.Write([]byte(`{"key": "alice", "value": "addr1"}`))
+		case "/api/account":
+			w.WriteHeader(401)
+			w.Write([]byte(`{"message": "login required."}`))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer srv.Close()
+
+	cli := &client{base: srv.URL + "/api", cli: srv.Client()}
+	var kv map[string]string
+	if err := cli.do("GET", "/namesrv/alice", nil, &kv); err != nil || kv["value"] != "addr1" {
+		t.Errorf("unexpected resolve %v %v", kv, err)
+	}
+
+	err := cli.do("GET", "/account", nil, nil)
+	if e, ok := err.(*apiError); !ok || e.Status != 401 || !strings.Contains(e.Error(), "login required") {
+		t.Errorf("expect 401 error, got %v", err)
+	}
+}
+
+func TestPrintResult(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"alias": "lepuscoin", "status": "ready", "block": 12},
+		{"alias": "poe", "status": "pending"},
+	}
+	buf := &bytes.Buffer{}
+	if err := printResult(buf, outputTable, rows, "alias", "status", "block"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ALIAS") || !strings.Contains(lines[1], "12") {
+		t.Errorf("unexpected table:\n%s", buf.String())
+	}
+
+	if _, err := parseOut("addr1:100"); err != nil {
+		t.Errorf("parse out failed, %s", err)
+	}
+	if _, err := parseOut("addr1"); err == nil {
+		t.Errorf("expect error of an out without amount")
+	}
+}
+
+func TestToken(t *testing.T) {
+	home, err := ioutil.TempDir("", "farmer-home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer t1" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write([]byte(`{"id": "alice"}`))
+	}))
+	defer srv.Close()
+
+	base := srv.URL + "/api"
+	if err := saveToken(base, "t1"); err != nil {
+		t.Fatal(err)
+	}
+	saveToken("http://other/api", "t2")
+
+	cli := &client{base: base, token: loadToken(base), cli: srv.Client()}
+	a := &accountSummary{}
+	if err := cli.do("GET", "/account", nil, a); err != nil || a.ID != "alice" {
+		t.Errorf("get account with token, %+v %v", a, err)
+	}
+
+	saveToken(base, "")
+	if tok := loadToken(base); tok != "" {
+		t.Errorf("token is not removed, %s", tok)
+	}
+	if tok := loadToken("http://other/api"); tok != "t2" {
+		t.Errorf("token of the other daemon is %s", tok)
+	}
+}
@@ -20,6 +20,11 @@ var (
 	farmerSupervisorAddr string
 	isDaemon             bool
 
+	// the daemon address, daemon.address if empty.
+	daemonAddr string
+	// json or table
+	outputMode string
+
 	farmerCmd = &cobra.Command{
 		Use:   farmerFuncName,
 		Short: fmt.Sprintf("%s specific commands.", farmerFuncName),
@@ -29,22 +34,24 @@ var (
 
 // Cmd returns the cobra command for Node
 func Cmd() *cobra.Command {
-	// flags := farmerCmd.PersistentFlags()
+	flags := farmerCmd.PersistentFlags()
+	flags.StringVar(&daemonAddr, "addr", "", "Address of the running farmer daemon, daemon.address if empty")
+	flags.StringVarP(&outputMode, "output", "o", outputTable, "Output of the results, json or table")
 
 	// // TODO: more falgs
 	// flags.StringVarP(&farmerUserID, "userID", "u", "", "Your Account ID")
 	// flags.StringVarP(&farmerSupervisorAddr, "supervisorAddr", "a", "", "Supervisor Address")
 
-	logoutCmd := &cobra.Command{
-		Use:   "logout",
-		Short: "User Logout.",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			return logout(args)
-		},
-	}
-
 	farmerCmd.AddCommand(startCmd())
-	farmerCmd.AddCommand(logoutCmd)
+	farmerCmd.AddCommand(stopCmd())
+	farmerCmd.AddCommand(loginCmd())
+	farmerCmd.AddCommand(signupCmd())
+	farmerCmd.AddCommand(logoutCmd())
+	farmerCmd.AddCommand(statusCmd())
+	farmerCmd.AddCommand(walletCmd())
+	farmerCmd.AddCommand(namesrvCmd())
+	farmerCmd.AddCommand(fsCmd())
+	farmerCmd.AddCommand(indexerCmd())
 
 	return farmerCmd
 }
@@ -66,7 +73,3 @@ func ParseArgs() error {
 	}
 	return nil
 }
-
-func logout(args []string) error {
-	return nil
-}
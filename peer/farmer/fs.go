@@ -0,0 +1,103 @@
+package farmer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+func fsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fs",
+		Short: "Files in the farmer storage.",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:     "ls [path]",
+		Aliases: []string{"list"},
+		Short:   "List the files in the path.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := ""
+			if len(args) > 0 {
+				path = args[0]
+			}
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			fis, err := cli.api().GetFileList(path)
+			if err != nil {
+				return err
+			}
+			return printResult(os.Stdout, outputMode, fis, "path", "size", "isdir", "modtime")
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "cat <path>",
+		Short: "Write the file to stdout.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("path is required")
+			}
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+			rc, err := cli.api().GetFile(args[0])
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			_, err = io.Copy(os.Stdout, rc)
+			return err
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "put <local file> <path>",
+		Short: "Upload the local file to the path.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("local file and path are required")
+			}
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			ret, err := cli.api().UploadFile(args[1], filepath.Base(args[0]), f)
+			if err != nil {
+				return err
+			}
+			return printResult(os.Stdout, outputMode, ret)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "quota",
+		Short: "Show the storage used by the login user and the quota, 0 is unlimited.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+			u, err := cli.api().GetStorageQuota()
+			if err != nil {
+				return err
+			}
+			return printResult(os.Stdout, outputMode, u, "user_id", "used", "files", "quota")
+		},
+	})
+	return cmd
+}
@@ -0,0 +1,40 @@
+package farmer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func indexerCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "indexer",
+		Short: "File indexer of the devices.",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "address <file id>",
+		Short: "Show the file and the address of the online device which keeps it.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("file id is required")
+			}
+			if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
+				return fmt.Errorf("invalid file id %s", args[0])
+			}
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			ret, err := cli.api().GetFileAddr(args[0])
+			if err != nil {
+				return err
+			}
+			return printResult(os.Stdout, outputMode, ret, "id", "device_id", "path", "hash", "size", "address")
+		},
+	})
+	return cmd
+}
@@ -0,0 +1,58 @@
+package farmer
+
+import (
+	"fmt"
+	"os"
+
+	fclient "github.com/hyperledger/fabric/farmer/client"
+	"github.com/spf13/cobra"
+)
+
+func namesrvCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "namesrv",
+		Short: "Names of the nameservice chaincode.",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "register <name> <value>",
+		Short: "Register the name to the value, an address usually.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("name and value are required")
+			}
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			msg, err := cli.api().NewNameServiceKV(&fclient.NameKV{Key: args[0], Value: args[1]})
+			if err != nil {
+				return err
+			}
+			ret := map[string]interface{}{"key": args[0], "value": args[1], "txid": msg.Message}
+			return printResult(os.Stdout, outputMode, ret, "key", "value", "txid")
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "resolve <name>",
+		Short: "Resolve the value of the name.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("name is required")
+			}
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			kv, err := cli.api().ResolveNameServiceKV(args[0])
+			if err != nil {
+				return err
+			}
+			return printResult(os.Stdout, outputMode, kv, "key", "value")
+		},
+	})
+	return cmd
+}
@@ -0,0 +1,102 @@
+package farmer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	outputJSON  = "json"
+	outputTable = "table"
+)
+
+// printResult writes v in the output mode, the table of a list is of the columns,
+// or all the fields of its first row if none.
+func printResult(w io.Writer, mode string, v interface{}, columns ...string) error {
+	switch mode {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputTable, "":
+	default:
+		return fmt.Errorf("unknown output %s, json or table", mode)
+	}
+
+	// tables are printed from the generic json values.
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var data interface{}
+	if err := json.Unmarshal(bs, &data); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	switch d := data.(type) {
+	case []interface{}:
+		if len(columns) == 0 && len(d) > 0 {
+			if row, ok := d[0].(map[string]interface{}); ok {
+				columns = sortedKeys(row)
+			}
+		}
+		if len(columns) == 0 {
+			for _, item := range d {
+				fmt.Fprintln(tw, cell(item))
+			}
+			break
+		}
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+		for _, item := range d {
+			row, _ := item.(map[string]interface{})
+			cells := make([]string, len(columns))
+			for i, c := range columns {
+				cells[i] = cell(row[c])
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+	case map[string]interface{}:
+		if len(columns) == 0 {
+			columns = sortedKeys(d)
+		}
+		for _, c := range columns {
+			fmt.Fprintf(tw, "%s\t%s\n", strings.ToUpper(c), cell(d[c]))
+		}
+	default:
+		fmt.Fprintln(tw, cell(d))
+	}
+	return tw.Flush()
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cell is the text of a json value in a table, the objects and lists are compact json.
+func cell(v interface{}) string {
+	switch d := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return d
+	case float64:
+		if d == float64(int64(d)) {
+			return fmt.Sprint(int64(d))
+		}
+		return fmt.Sprint(d)
+	case map[string]interface{}, []interface{}:
+		bs, _ := json.Marshal(d)
+		return string(bs)
+	}
+	return fmt.Sprint(v)
+}
@@ -1,20 +1,75 @@
 package farmer
 
 import (
+	"fmt"
+	"os"
+	"time"
+
 	"github.com/hyperledger/fabric/farmer"
+	fdaemon "github.com/hyperledger/fabric/farmer/daemon"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
+// backgroundArgs returns the command args of the daemon in the background, without -d.
+func backgroundArgs(args []string) []string {
+	ret := []string{}
+	for _, arg := range args {
+		switch arg {
+		case "-d", "--daemon", "--daemon=true":
+			continue
+		}
+		ret = append(ret, arg)
+	}
+	return ret
+}
+
 func startCmd() *cobra.Command {
+	var logFile string
 	cmd := &cobra.Command{
 		Use:   "start",
 		Short: "start farmer daemon.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			logger.Debugf("start farmer daemon.")
-			farmer.StartFarmer()
+			if logFile != "" {
+				viper.Set("daemon.log.file", logFile)
+			}
+			if !isDaemon {
+				logger.Debugf("start farmer daemon.")
+				farmer.StartFarmer()
+				return nil
+			}
+
+			pid, err := farmer.StartBackground(backgroundArgs(os.Args[1:]))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("farmer daemon is started(PID: %d), logs are in %s\n", pid, fdaemon.LogFilePath())
 			return nil
 		},
 	}
+	cmd.Flags().BoolVarP(&isDaemon, "daemon", "d", false, "Run the farmer daemon in the background")
+	cmd.Flags().StringVar(&logFile, "log-file", "", "Log file of the daemon in the background, daemon.log.file if empty")
+	return cmd
+}
 
+func stopCmd() *cobra.Command {
+	var (
+		timeout time.Duration
+		force   bool
+	)
+	cmd := &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the running farmer daemon.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pid, err := farmer.StopFarmer(timeout, force)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("farmer daemon(PID: %d) is stopped\n", pid)
+			return nil
+		},
+	}
+	cmd.Flags().DurationVar(&timeout, "timeout", time.Minute, "Time to wait the daemon to exit")
+	cmd.Flags().BoolVar(&force, "force", false, "Kill the daemon which does not exit in the timeout")
 	return cmd
 }
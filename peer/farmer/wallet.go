@@ -0,0 +1,131 @@
+package farmer
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	fclient "github.com/hyperledger/fabric/farmer/client"
+	"github.com/spf13/cobra"
+)
+
+func walletCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wallet",
+		Short: "Wallet of the login account.",
+	}
+	cmd.AddCommand(walletBalanceCmd())
+	cmd.AddCommand(walletTransferCmd())
+	return cmd
+}
+
+func walletBalanceCmd() *cobra.Command {
+	var account int
+	cmd := &cobra.Command{
+		Use:   "balance",
+		Short: "Show the balance of the wallet addresses.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			q := &fclient.GetWalletBalanceQuery{}
+			if account >= 0 {
+				q.Account = &account
+			}
+			b, err := cli.api().GetWalletBalance(q)
+			if err != nil {
+				return err
+			}
+
+			if outputMode == outputJSON {
+				return printResult(os.Stdout, outputMode, b)
+			}
+			if err := printResult(os.Stdout, outputMode, b.Addresses, "account", "chain", "index", "address", "label", "balance"); err != nil {
+				return err
+			}
+			fmt.Printf("\nTOTAL  %d\n", b.Total)
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&account, "account", -1, "Index of the wallet account, all accounts if negative")
+	return cmd
+}
+
+// parseOut parses the out of a transfer in the form addr:amount.
+func parseOut(s string) (map[string]interface{}, error) {
+	i := strings.LastIndex(s, ":")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid out %s, addr:amount", s)
+	}
+	amount, err := strconv.ParseUint(s[i+1:], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount of out %s, %s", s, err)
+	}
+	return map[string]interface{}{"addr": s[:i], "amount": amount}, nil
+}
+
+func walletTransferCmd() *cobra.Command {
+	var (
+		from     []string
+		to       []string
+		fee      uint64
+		strategy string
+		change   string
+		dryRun   bool
+	)
+	cmd := &cobra.Command{
+		Use:     "transfer",
+		Short:   "Transfer lepuscoin from the wallet addresses.",
+		Example: "peer farmer wallet transfer --from <addr> --to <addr>:100 --to <addr>:50 --fee 1",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(from) == 0 || len(to) == 0 {
+				return fmt.Errorf("--from and --to are required")
+			}
+			in := []map[string]string{}
+			for _, addr := range from {
+				in = append(in, map[string]string{"addr": addr})
+			}
+			out := []map[string]interface{}{}
+			for _, s := range to {
+				o, err := parseOut(s)
+				if err != nil {
+					return err
+				}
+				out = append(out, o)
+			}
+			body := map[string]interface{}{
+				"in":          in,
+				"out":         out,
+				"fee":         fee,
+				"strategy":    strategy,
+				"charge_addr": change,
+			}
+
+			cli, err := newClient()
+			if err != nil {
+				return err
+			}
+			path := "/lepuscoin/transfer"
+			if dryRun {
+				path += "/dryrun"
+			}
+			var ret map[string]interface{}
+			if err := cli.do("POST", path, body, &ret); err != nil {
+				return err
+			}
+			return printResult(os.Stdout, outputMode, ret)
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringSliceVar(&from, "from", nil, "Wallet addresses which the coins are from")
+	flags.StringSliceVar(&to, "to", nil, "Outs in the form addr:amount")
+	flags.Uint64Var(&fee, "fee", 0, "Fee to farmer.lepuscoin.feeAddr")
+	flags.StringVar(&strategy, "strategy", "", "Coin selection, bnb, largest-first or smallest-sufficient")
+	flags.StringVar(&change, "change", "", "Address of the change, the first selected in address if empty")
+	flags.BoolVar(&dryRun, "dry-run", false, "Show the selected coins without transferring")
+	return cmd
+}
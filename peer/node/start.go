@@ -26,6 +26,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -121,6 +122,7 @@ func serve(args []string) error {
 	}
 
 	db.Start()
+	atomic.StoreInt32(&dbStarted, 1)
 
 	var opts []grpc.ServerOption
 	if comm.TLSEnabled() {
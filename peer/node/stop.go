@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/golang/protobuf/ptypes/empty"
@@ -84,6 +85,18 @@ func Stop() (err error) {
 	return err
 }
 
+// dbStarted is 1 once the db is opened by serve.
+var dbStarted int32
+
+// Shutdown stops the peer served in this process without exiting it like Stop,
+// it closes the db and removes the pid file.
+func Shutdown() {
+	if atomic.CompareAndSwapInt32(&dbStarted, 1, 0) {
+		db.Stop()
+	}
+	os.Remove(viper.GetString("peer.fileSystemPath") + "/peer.pid")
+}
+
 func readPid(fileName string) (int, error) {
 	fd, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
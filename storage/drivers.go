@@ -1,11 +1,15 @@
 package storage
 
 import (
+	"errors"
 	"io"
 
 	"golang.org/x/net/context"
 )
 
+// ErrInvalidPath is returned for the paths out of the root of the driver.
+var ErrInvalidPath = errors.New("invalid path")
+
 type StorageDriver interface {
 	BaseFile
 
@@ -143,7 +143,16 @@ func (d *Driver) Mkdir(ctx context.Context, path string) error {
 }
 
 func (d *Driver) Move(ctx context.Context, sourcePath string, destPath string) error {
-	return os.Rename(sourcePath, destPath)
+	src, err := d.Abs(sourcePath)
+	if err != nil {
+		return err
+	}
+	dst, err := d.Abs(destPath)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(src, dst)
 }
 
 func (d *Driver) Delete(ctx context.Context, path string) error {
@@ -163,7 +172,7 @@ func (d *Driver) Abs(path string) (string, error) {
 	}
 
 	if !strings.HasPrefix(absPath, d.chroot) {
-		return "", fmt.Errorf("%s not exists", path)
+		return "", fmt.Errorf("%s, %w", path, storage.ErrInvalidPath)
 	}
 
 	return absPath, nil
@@ -1,7 +1,12 @@
 package localfs
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"golang.org/x/net/context"
 )
 
 type testData struct {
@@ -41,3 +46,27 @@ func TestAbx(t *testing.T) {
 		}
 	}
 }
+
+func TestMove(t *testing.T) {
+	chroot, err := ioutil.TempDir("", "localfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(chroot)
+
+	fs, err := NewDriver(chroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(chroot, "a"), []byte("a"), 0644)
+
+	if err := fs.Move(context.TODO(), "a", "/b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(chroot, "b")); err != nil {
+		t.Errorf("b should be in the chroot, %s", err)
+	}
+	if err := fs.Move(context.TODO(), "/b", "/../b"); err == nil {
+		t.Errorf("move out of the chroot should be returned error")
+	}
+}